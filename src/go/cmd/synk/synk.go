@@ -40,8 +40,9 @@ const (
 )
 
 var (
-	maxQPS  int
-	retries uint64
+	maxQPS         int
+	retries        uint64
+	sourceRevision string
 
 	cmdRoot = &cobra.Command{
 		Use:   "synk",
@@ -76,6 +77,7 @@ func main() {
 
 	cmdRoot.PersistentFlags().IntVar(&maxQPS, "max-qps", 50, "max number of calls to the apiserver per second")
 	cmdApply.PersistentFlags().Uint64Var(&retries, "retries", 60, "max number of retries for transient errors, with a 5 second constant backoff")
+	cmdApply.PersistentFlags().StringVar(&sourceRevision, "source-revision", "", "source revision of the manifests to record on the ResourceSet, eg a git commit")
 
 	cmdRoot.AddCommand(cmdInit)
 	cmdRoot.AddCommand(cmdApply)
@@ -187,6 +189,7 @@ func apply(name string) error {
 	opts := &synk.ApplyOptions{
 		Namespace:        namespace,
 		EnforceNamespace: enforceNamespace,
+		SourceRevision:   sourceRevision,
 		Log:              logAction,
 	}
 	if err := backoff.Retry(
@@ -43,6 +43,9 @@ type ResourceSetList struct {
 
 type ResourceSetSpec struct {
 	Resources []ResourceSetSpecGroup `json:"resources"`
+	// Suspended causes Synk to skip applies of the set until it is
+	// resumed.
+	Suspended bool `json:"suspended,omitempty"`
 }
 
 type ResourceSetStatus struct {
@@ -51,6 +54,19 @@ type ResourceSetStatus struct {
 	FinishedAt metav1.Time              `json:"finishedAt,omitempty"`
 	Applied    []ResourceSetStatusGroup `json:"applied,omitempty"`
 	Failed     []ResourceSetStatusGroup `json:"failed,omitempty"`
+	// Pruned lists the resources of previous versions that are no longer
+	// part of the set, with the reason why they were or weren't pruned.
+	Pruned []ResourceSetStatusGroup `json:"pruned,omitempty"`
+	// Counts breaks down the resources of the set by scope.
+	Counts *ResourceCounts `json:"counts,omitempty"`
+}
+
+// ResourceCounts is the number of resources of a set by scope. CRDs are
+// counted separately from other cluster-scoped resources.
+type ResourceCounts struct {
+	CRDs          int `json:"crds"`
+	ClusterScoped int `json:"clusterScoped"`
+	Namespaced    int `json:"namespaced"`
 }
 
 type ResourceSetSpecGroup struct {
@@ -73,12 +89,29 @@ type ResourceRef struct {
 }
 
 type ResourceStatus struct {
-	Namespace  string         `json:"namespace,omitempty"`
-	Name       string         `json:"name"`
-	Action     ResourceAction `json:"action"`
-	UID        string         `json:"uid,omitempty"`
-	Generation int64          `json:"generation,omitempty"`
-	Error      string         `json:"error,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// GenerateName is set for resources that were created with
+	// metadata.generateName. It identifies them in the input, while Name is
+	// the name that the apiserver generated.
+	GenerateName string         `json:"generateName,omitempty"`
+	Action       ResourceAction `json:"action"`
+	UID          string         `json:"uid,omitempty"`
+	Generation   int64          `json:"generation,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	// Checksum is a hash of the applied manifest, which allows detecting
+	// changes between versions of the set.
+	Checksum string `json:"checksum,omitempty"`
+	// Warnings returned by the apiserver when applying the resource.
+	Warnings []string `json:"warnings,omitempty"`
+	// PruneReason is only set for resources in the pruned status group.
+	PruneReason PruneReason `json:"pruneReason,omitempty"`
+	// ReadyTimeout is how long Synk waited at most for the resource to become
+	// ready. It is only set if Synk waited for readiness.
+	ReadyTimeout *metav1.Duration `json:"readyTimeout,omitempty"`
+	// Canary is set for resources that were applied and became ready before
+	// the other resources of the set were applied.
+	Canary bool `json:"canary,omitempty"`
 }
 
 type ResourceSetPhase string
@@ -87,6 +120,8 @@ const (
 	ResourceSetPhasePending ResourceSetPhase = "Pending"
 	ResourceSetPhaseFailed  ResourceSetPhase = "Failed"
 	ResourceSetPhaseSettled ResourceSetPhase = "Settled"
+	// Degraded is set if some but not all resources were applied successfully.
+	ResourceSetPhaseDegraded ResourceSetPhase = "Degraded"
 )
 
 type ResourceAction string
@@ -96,6 +131,34 @@ const (
 	ResourceActionCreate  ResourceAction = "Create"
 	ResourceActionUpdate  ResourceAction = "Update"
 	ResourceActionReplace ResourceAction = "Replace"
+	// Skip is used for resources that were intentionally not applied.
+	ResourceActionSkip ResourceAction = "Skip"
+	// Delete is used for resources that were pruned.
+	ResourceActionDelete ResourceAction = "Delete"
+)
+
+type PruneReason string
+
+const (
+	// RemovedFromSet is used for resources that were pruned since they are no
+	// longer part of the set.
+	PruneReasonRemovedFromSet PruneReason = "RemovedFromSet"
+	// PrunedByAllowList is used for resources that were pruned since their
+	// kind is in the prune allow-list.
+	PruneReasonPrunedByAllowList PruneReason = "PrunedByAllowList"
+	// SkippedNotInAllowList is used for resources that were orphaned instead
+	// of pruned since their kind is not in the prune allow-list.
+	PruneReasonSkippedNotInAllowList PruneReason = "SkippedNotInAllowList"
+	// ExemptCRD is used for CRDs, which are never pruned since that would
+	// delete all their instances.
+	PruneReasonExemptCRD PruneReason = "ExemptCRD"
+	// ExceedsPruneLimit is used for resources that were kept since pruning
+	// them would exceed the configured prune limit.
+	PruneReasonExceedsPruneLimit PruneReason = "ExceedsPruneLimit"
+	// SkippedTooYoung is used for resources that were kept since they were
+	// created more recently than the minimum prune age. They are pruned by
+	// a later apply.
+	PruneReasonSkippedTooYoung PruneReason = "SkippedTooYoung"
 )
 
 // +genclient
@@ -445,6 +445,22 @@ func (in ConfigValues) DeepCopyInto(out *ConfigValues) {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceCounts) DeepCopyInto(out *ResourceCounts) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceCounts.
+func (in *ResourceCounts) DeepCopy() *ResourceCounts {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceCounts)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceRef) DeepCopyInto(out *ResourceRef) {
 	*out = *in
@@ -585,6 +601,18 @@ func (in *ResourceSetStatus) DeepCopyInto(out *ResourceSetStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Pruned != nil {
+		in, out := &in.Pruned, &out.Pruned
+		*out = make([]ResourceSetStatusGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Counts != nil {
+		in, out := &in.Counts, &out.Counts
+		*out = new(ResourceCounts)
+		**out = **in
+	}
 	return
 }
 
@@ -604,7 +632,9 @@ func (in *ResourceSetStatusGroup) DeepCopyInto(out *ResourceSetStatusGroup) {
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
 		*out = make([]ResourceStatus, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -622,6 +652,16 @@ func (in *ResourceSetStatusGroup) DeepCopy() *ResourceSetStatusGroup {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceStatus) DeepCopyInto(out *ResourceStatus) {
 	*out = *in
+	if in.Warnings != nil {
+		in, out := &in.Warnings, &out.Warnings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReadyTimeout != nil {
+		in, out := &in.ReadyTimeout, &out.ReadyTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -0,0 +1,41 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// checkAdopt returns an error if the live object isn't owned by a
+// ResourceSet yet and its labels don't match AdoptSelector. CRDs that aren't
+// owned by the ResourceSet are never adopted and aren't checked.
+func checkAdopt(desired, live *unstructured.Unstructured, set *apps.ResourceSet, opts *applyOptions) error {
+	if opts.AdoptSelector == nil || isCustomResourceDefinition(desired) && !ownsCRD(desired) {
+		return nil
+	}
+	group := resourceSetGVK(set).Group
+	for _, or := range live.GetOwnerReferences() {
+		if isResourceSetRef(or, group) {
+			return nil
+		}
+	}
+	if opts.AdoptSelector.Matches(labels.Set(live.GetLabels())) {
+		return nil
+	}
+	return errors.Errorf("not adopting existing resource whose labels don't match %q", opts.AdoptSelector)
+}
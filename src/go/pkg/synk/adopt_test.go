@@ -0,0 +1,114 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestSynk_applyOneAdoptSelector(t *testing.T) {
+	migrate := labels.SelectorFromSet(labels.Set{"migrate-to-synk": "true"})
+	tests := []struct {
+		desc       string
+		labels     map[string]string
+		owned      bool
+		selector   labels.Selector
+		onConflict func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error)
+		wantAction apps.ResourceAction
+		wantErr    bool
+	}{
+		{desc: "no selector", wantAction: apps.ResourceActionUpdate},
+		{desc: "matching", labels: map[string]string{"migrate-to-synk": "true"}, selector: migrate, wantAction: apps.ResourceActionUpdate},
+		{desc: "not matching", labels: map[string]string{"app": "foo"}, selector: migrate, wantAction: apps.ResourceActionNone, wantErr: true},
+		{
+			desc:     "not matching skipped by OnConflict",
+			selector: migrate,
+			onConflict: func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error) {
+				return ConflictSkip, nil
+			},
+			wantAction: apps.ResourceActionSkip,
+		},
+		{desc: "already owned", owned: true, selector: migrate, wantAction: apps.ResourceActionUpdate},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			set := &apps.ResourceSet{}
+			set.Name = "test.v2"
+			set.UID = "uid2"
+
+			live := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+			live.SetLabels(tc.labels)
+			if tc.owned {
+				prev := &apps.ResourceSet{}
+				prev.Name = "test.v1"
+				setOwnerRef(live, prev, true)
+			}
+			f := newFixture(t)
+			f.addObjects(live)
+			s := f.newSynk()
+
+			desired := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+			desired.Object["data"] = map[string]interface{}{"foo": "bar"}
+			setOwnerRef(desired, set, true)
+			opts := newApplyOptions("test", &ApplyOptions{
+				PatchStrategy: PatchStrategyMergeOverLive,
+				AdoptSelector: tc.selector,
+				OnConflict:    tc.onConflict,
+			})
+			action, err := s.applyOne(ctx, desired, set, opts)
+			if gotErr := err != nil; gotErr != tc.wantErr || action != tc.wantAction {
+				t.Fatalf("expected action %q and error %v, got %q, %v", tc.wantAction, tc.wantErr, action, err)
+			}
+			got, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, adopted, _ := unstructured.NestedString(got.Object, "data", "foo")
+			if want := tc.wantAction == apps.ResourceActionUpdate; adopted != want {
+				t.Errorf("expected resource to be updated %v, got %v", want, got.Object)
+			}
+		})
+	}
+}
+
+func TestSynk_PlanApplyAdoptSelector(t *testing.T) {
+	f := newFixture(t)
+	matching := newUnstructured("v1", "ConfigMap", "ns1", "matching")
+	matching.SetLabels(map[string]string{"migrate-to-synk": "true"})
+	f.addObjects(matching, newUnstructured("v1", "ConfigMap", "ns1", "other"))
+	s := f.newSynk()
+
+	opts := &ApplyOptions{AdoptSelector: labels.SelectorFromSet(labels.Set{"migrate-to-synk": "true"})}
+	plan, err := s.PlanApply(context.Background(), "test", opts,
+		newUnstructured("v1", "ConfigMap", "ns1", "matching"),
+		newUnstructured("v1", "ConfigMap", "ns1", "other"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := plan.Changes[0]; c.Name != "matching" || c.Err != nil || c.Action != apps.ResourceActionUpdate {
+		t.Errorf("expected matching resource to be adopted, got %+v", c)
+	}
+	if c := plan.Changes[1]; c.Name != "other" || c.Err == nil {
+		t.Errorf("expected error for resource not matching the selector, got %+v", c)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+)
+
+// appliedConditionType is the type of the condition set with
+// ApplyOptions.AppliedCondition.
+const appliedConditionType = "SynkApplied"
+
+// setAppliedConditions sets the SynkApplied condition on the status of the
+// applied resources whose types have a status subresource. Failures are
+// recorded as warnings of the resource.
+func (s *Synk) setAppliedConditions(ctx context.Context, rs *apps.ResourceSet, results applyResults) {
+	hasStatus := map[schema.GroupVersionResource]bool{}
+	for _, r := range results.list() {
+		if r.err != nil || r.action == apps.ResourceActionSkip || isCustomResourceDefinition(r.resource) {
+			continue
+		}
+		gvk := r.resource.GroupVersionKind()
+		mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			r.warnings = append(r.warnings, fmt.Sprintf("set %s condition: get REST mapping: %s", appliedConditionType, err))
+			continue
+		}
+		ok, known := hasStatus[mapping.Resource]
+		if !known {
+			ok, err = s.hasStatusSubresource(mapping.Resource)
+			if err != nil {
+				r.warnings = append(r.warnings, fmt.Sprintf("set %s condition: %s", appliedConditionType, err))
+				continue
+			}
+			hasStatus[mapping.Resource] = ok
+		}
+		if !ok {
+			continue
+		}
+		if err := s.setAppliedCondition(ctx, r.resource, r.action, rs); err != nil {
+			r.warnings = append(r.warnings, fmt.Sprintf("set %s condition: %s", appliedConditionType, err))
+		}
+	}
+}
+
+// hasStatusSubresource returns true if the server serves the status
+// subresource for the resource type.
+func (s *Synk) hasStatusSubresource(gvr schema.GroupVersionResource) (bool, error) {
+	list, err := s.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false, errors.Wrapf(err, "discover resources of %s", gvr.GroupVersion())
+	}
+	for _, r := range list.APIResources {
+		if r.Name == gvr.Resource+"/status" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setAppliedCondition updates the SynkApplied condition of the live resource.
+func (s *Synk) setAppliedCondition(ctx context.Context, r *unstructured.Unstructured, action apps.ResourceAction, rs *apps.ResourceSet) error {
+	client, err := s.resourceClient(r)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		live, err := client.Get(ctx, r.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cond := map[string]interface{}{
+			"type":               appliedConditionType,
+			"status":             "True",
+			"reason":             string(action),
+			"message":            fmt.Sprintf("Applied by ResourceSet %s", rs.Name),
+			"lastTransitionTime": time.Now().UTC().Format(time.RFC3339),
+			"observedGeneration": live.GetGeneration(),
+		}
+		conds, _, _ := unstructured.NestedSlice(live.Object, "status", "conditions")
+		replaced := false
+		for i, c := range conds {
+			if m, ok := c.(map[string]interface{}); ok && m["type"] == appliedConditionType {
+				conds[i], replaced = cond, true
+			}
+		}
+		if !replaced {
+			conds = append(conds, cond)
+		}
+		if err := unstructured.SetNestedSlice(live.Object, conds, "status", "conditions"); err != nil {
+			return err
+		}
+		_, err = client.UpdateStatus(ctx, live, metav1.UpdateOptions{FieldManager: fieldManager})
+		return err
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSynk_ApplySetsAppliedCondition(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	s.discovery = &staticDiscovery{resources: []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}},
+	}, {
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true},
+			{Name: "deployments/status", Kind: "Deployment", Namespaced: true},
+		},
+	}}}
+
+	dp := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	dp.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{"type": "Available", "status": "True"}},
+	}
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{AppliedCondition: true},
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		dp,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range rs.Status.Applied {
+		for _, item := range g.Items {
+			if len(item.Warnings) > 0 {
+				t.Errorf("unexpected warnings for %s: %v", item.Name, item.Warnings)
+			}
+		}
+	}
+	live, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Get(ctx, "dp1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, ok := findCondition(live, "Available"); !ok || st != "True" {
+		t.Errorf("expected existing condition to be kept, got %v", live.Object["status"])
+	}
+	conds, _, _ := unstructured.NestedSlice(live.Object, "status", "conditions")
+	var applied map[string]interface{}
+	for _, c := range conds {
+		if m := c.(map[string]interface{}); m["type"] == appliedConditionType {
+			applied = m
+		}
+	}
+	if applied == nil || applied["status"] != "True" || applied["reason"] != string(apps.ResourceActionCreate) || applied["message"] != "Applied by ResourceSet test.v1" {
+		t.Errorf("unexpected %s condition %v", appliedConditionType, applied)
+	}
+	for _, a := range f.fake.Actions() {
+		if a.GetSubresource() == "status" && a.GetResource().Resource == "configmaps" {
+			t.Errorf("expected no status update for ConfigMaps, got %v", a)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ignoreFile lists patterns of files and directories that ApplyDir skips.
+const ignoreFile = ".synkignore"
+
+// ApplyDir applies all resources from the .yaml, .yml and .json files in the
+// directory tree as the ResourceSet specified by 'name'. Files may contain
+// multiple documents. With ApplyOptions.PreserveInputOrder, the files are
+// applied in lexical order and the resources of each file in kind order.
+//
+// A .synkignore file at the root of the directory excludes files and
+// directories. Each line is a pattern as understood by path.Match, which is
+// matched against the slash-separated path relative to the directory and
+// against the base name. Empty lines and lines starting with '#' are ignored.
+func ApplyDir(ctx context.Context, s *Synk, name, dir string, opts *ApplyOptions) (*apps.ResourceSet, error) {
+	resources, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.Apply(ctx, name, opts, resources...)
+}
+
+// readDir parses all resources in the directory tree in lexical file order.
+// The resources of each file are sorted by kind.
+func readDir(dir string) ([]*unstructured.Unstructured, error) {
+	ignore, err := readIgnorePatterns(filepath.Join(dir, ignoreFile))
+	if err != nil {
+		return nil, err
+	}
+	var resources []*unstructured.Unstructured
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if isIgnored(filepath.ToSlash(rel), ignore) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(p) {
+		case ".json", ".yml", ".yaml":
+		default:
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		res, err := decodeResources(f)
+		if err != nil {
+			return errors.Wrapf(err, "parse %q", p)
+		}
+		sortResources(res)
+		resources = append(resources, res...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "read directory %q", dir)
+	}
+	return resources, nil
+}
+
+// decodeResources parses a stream of YAML or JSON documents. Empty documents
+// are skipped and List kinds are flattened.
+func decodeResources(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var resources []*unstructured.Unstructured
+	dec := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err == io.EOF {
+			return resources, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: obj}
+		if !u.IsList() {
+			resources = append(resources, u)
+			continue
+		}
+		if err := u.EachListItem(func(item runtime.Object) error {
+			resources = append(resources, item.(*unstructured.Unstructured))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readIgnorePatterns(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSuffix(line, "/")
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q in %q", line, file)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, sc.Err()
+}
+
+func isIgnored(rel string, patterns []string) bool {
+	if rel == ignoreFile {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".synkignore": `
+# Comments and blank lines are skipped.
+
+skipped/
+*.tmp.yaml
+`,
+		"a.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+---
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm2
+`,
+		"b/c.json":        `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "s1"}}`,
+		"b/list.yml":      "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: Pod\n  metadata:\n    name: pod1\n",
+		"b/README.md":     "not a manifest",
+		"b/foo.tmp.yaml":  "apiVersion: v1\nkind: Pod\nmetadata:\n  name: tmp\n",
+		"skipped/cm.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: skipped\n",
+		"nested/x/d.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm3\n",
+	})
+
+	resources, err := readDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range resources {
+		got = append(got, r.GetKind()+"/"+r.GetName())
+	}
+	want := []string{"ConfigMap/cm1", "ConfigMap/cm2", "Secret/s1", "Pod/pod1", "ConfigMap/cm3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected resources %v, got %v", want, got)
+	}
+}
+
+func TestReadDir_invalidManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.yaml": "foo: [bar"})
+
+	if _, err := readDir(dir); err == nil {
+		t.Errorf("expected error for invalid manifest, got nil")
+	}
+}
+
+func TestApplyDir_preserveInputOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc1
+  namespace: ns1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: ns1
+`,
+		"b.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm0\n  namespace: ns1\n",
+	})
+	tests := []struct {
+		desc     string
+		preserve bool
+		want     []string
+	}{
+		{"sorted", false, []string{"configmaps/cm0", "configmaps/cm1", "services/svc1"}},
+		{"preserve input order", true, []string{"configmaps/cm1", "services/svc1", "configmaps/cm0"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			f := newFixture(t)
+			s := f.newSynk()
+			if _, err := ApplyDir(context.Background(), s, "test", dir, &ApplyOptions{PreserveInputOrder: tc.preserve}); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, a := range f.fake.Actions() {
+				if c, ok := a.(k8stest.CreateAction); ok && a.GetResource().Resource != "resourcesets" {
+					got = append(got, a.GetResource().Resource+"/"+c.GetObject().(*unstructured.Unstructured).GetName())
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected creates %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// auditLabel is set to the name of the applied set on audit ConfigMaps.
+	auditLabel = "core.cloudrobotics.com/audit-resource-set"
+	// auditKey is the key of the audit record in the audit ConfigMap.
+	auditKey = "audit.json"
+	// maxAuditSize leaves room for the ConfigMap's metadata within the 1MiB
+	// limit of etcd.
+	maxAuditSize = 900 * 1024
+)
+
+// auditRecord is the content of an audit ConfigMap.
+type auditRecord struct {
+	Actor   string        `json:"actor,omitempty"`
+	TraceID string        `json:"traceID,omitempty"`
+	Result  *ApplyResult  `json:"result"`
+	Plan    []auditChange `json:"plan"`
+	// Truncated is true if the changed fields or changes were dropped to
+	// stay within the size limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type auditChange struct {
+	Group     string              `json:"group,omitempty"`
+	Version   string              `json:"version"`
+	Kind      string              `json:"kind"`
+	Namespace string              `json:"namespace,omitempty"`
+	Name      string              `json:"name"`
+	Action    apps.ResourceAction `json:"action"`
+	Ownership Ownership           `json:"ownership,omitempty"`
+	Fields    []string            `json:"fields,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// writeAudit stores the plan and the result of the apply in an immutable
+// ConfigMap.
+func (s *Synk) writeAudit(ctx context.Context, rs *apps.ResourceSet, plan *Plan, opts *applyOptions) error {
+	rec := &auditRecord{
+		Actor:   opts.AuditActor,
+		TraceID: opts.Annotations[TraceIDAnnotation],
+		Result:  NewApplyResult(rs),
+	}
+	for _, c := range plan.Changes {
+		ac := auditChange{
+			Group:     c.Group,
+			Version:   c.Version,
+			Kind:      c.Kind,
+			Namespace: c.Namespace,
+			Name:      c.Name,
+			Action:    c.Action,
+			Ownership: c.Ownership,
+			Fields:    c.Fields,
+		}
+		if c.Err != nil {
+			ac.Error = c.Err.Error()
+		}
+		rec.Plan = append(rec.Plan, ac)
+	}
+	data, err := marshalAudit(rec)
+	if err != nil {
+		return err
+	}
+
+	vTrue := true
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: opts.AuditConfigMap.Namespace,
+			Name:      fmt.Sprintf("%s.v%d", opts.AuditConfigMap.Name, opts.version),
+			Labels:    map[string]string{auditLabel: opts.name},
+		},
+		Immutable: &vTrue,
+		Data:      map[string]string{auditKey: string(data)},
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cm)
+	if err != nil {
+		return err
+	}
+	client := s.client.Resource(corev1.SchemeGroupVersion.WithResource("configmaps")).Namespace(cm.Namespace)
+	_, err = client.Create(ctx, &unstructured.Unstructured{Object: u}, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		// A resumed apply of the same version replaces the record of the
+		// interrupted one.
+		if err := client.Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return errors.Wrapf(err, "delete ConfigMap %s/%s", cm.Namespace, cm.Name)
+		}
+		_, err = client.Create(ctx, &unstructured.Unstructured{Object: u}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "create ConfigMap %s/%s", cm.Namespace, cm.Name)
+	}
+	return nil
+}
+
+// marshalAudit encodes the record. If it exceeds maxAuditSize, the changed
+// fields are dropped first and then changes from the end of the plan.
+func marshalAudit(rec *auditRecord) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil || len(data) <= maxAuditSize {
+		return data, err
+	}
+	rec.Truncated = true
+	for i := range rec.Plan {
+		rec.Plan[i].Fields = nil
+	}
+	for {
+		data, err = json.Marshal(rec)
+		if err != nil || len(data) <= maxAuditSize || len(rec.Plan) == 0 {
+			return data, err
+		}
+		rec.Plan = rec.Plan[:len(rec.Plan)/2]
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSynk_ApplyWritesAuditConfigMap(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	opts := &ApplyOptions{
+		AuditConfigMap: types.NamespacedName{Namespace: "audit", Name: "test-audit"},
+		AuditActor:     "ci@example.com",
+		Annotations:    map[string]string{TraceIDAnnotation: "trace-1"},
+	}
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("audit").Get(ctx, "test-audit.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if immutable, _, _ := unstructured.NestedBool(cm.Object, "immutable"); !immutable {
+		t.Errorf("expected audit ConfigMap to be immutable")
+	}
+	data, _, _ := unstructured.NestedString(cm.Object, "data", auditKey)
+	var rec auditRecord
+	if err := json.Unmarshal([]byte(data), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Actor != "ci@example.com" {
+		t.Errorf("expected actor ci@example.com, got %q", rec.Actor)
+	}
+	if rec.TraceID != "trace-1" {
+		t.Errorf("expected trace ID trace-1, got %q", rec.TraceID)
+	}
+	if len(rec.Plan) != 1 || rec.Plan[0].Name != "cm1" || rec.Plan[0].Action != apps.ResourceActionCreate {
+		t.Errorf("expected planned creation of cm1, got %+v", rec.Plan)
+	}
+	if rec.Result.ResourceSet != "test.v1" || len(rec.Result.Resources) != 1 || rec.Result.Resources[0].Action != "Create" {
+		t.Errorf("expected result with creation of cm1, got %+v", rec.Result)
+	}
+}
+
+// ResourceSets and audit records only store references, checksums and field
+// paths, so Secret values never end up in them.
+func TestSynk_ApplyDoesNotStoreSecretValues(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	secret := newUnstructured("v1", "Secret", "ns1", "creds")
+	unstructured.SetNestedStringMap(secret.Object, map[string]string{"password": "c2VjcmV0LXZhbHVl"}, "data")
+	unstructured.SetNestedStringMap(secret.Object, map[string]string{"token": "plain-token"}, "stringData")
+	opts := &ApplyOptions{AuditConfigMap: types.NamespacedName{Namespace: "audit", Name: "test-audit"}}
+	if _, err := s.Apply(ctx, "test", opts, secret); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("audit").Get(ctx, "test-audit.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []*unstructured.Unstructured{rs, cm} {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range []string{"c2VjcmV0LXZhbHVl", "plain-token"} {
+			if strings.Contains(string(data), value) {
+				t.Errorf("%s %s contains Secret value %q", obj.GetKind(), obj.GetName(), value)
+			}
+		}
+	}
+}
+
+func TestMarshalAuditTruncates(t *testing.T) {
+	rec := &auditRecord{Result: &ApplyResult{}}
+	for i := 0; i < 20000; i++ {
+		rec.Plan = append(rec.Plan, auditChange{
+			Kind:   "ConfigMap",
+			Name:   fmt.Sprintf("cm%d", i),
+			Fields: []string{"data." + strings.Repeat("x", 100)},
+		})
+	}
+	data, err := marshalAudit(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > maxAuditSize {
+		t.Errorf("expected at most %d bytes, got %d", maxAuditSize, len(data))
+	}
+	if !rec.Truncated {
+		t.Errorf("expected record to be marked as truncated")
+	}
+	if len(rec.Plan) == 0 || rec.Plan[0].Fields != nil {
+		t.Errorf("expected fields to be dropped before changes")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// canaryAnnotation marks resources that are applied before the other
+// resources of the set, eg one replica of a sharded workload. Apply waits
+// for them to become ready, even without WaitForReady, and doesn't apply
+// the other resources if they fail. CRDs are always applied first and can't
+// be canaries. Sets with canaries wait for all CRDs like with CRDWaitAll.
+const canaryAnnotation = "core.cloudrobotics.com/canary"
+
+// ErrCanaryFailed is returned if canary resources failed to apply or to
+// become ready, so that the other resources weren't applied.
+var ErrCanaryFailed = errors.New("canary resources failed")
+
+func isCanary(r *unstructured.Unstructured) bool {
+	return r.GetAnnotations()[canaryAnnotation] == "true"
+}
+
+// separateCanaries splits the resources into canaries and the others,
+// keeping their order.
+func separateCanaries(resources []*unstructured.Unstructured) (canaries, others []*unstructured.Unstructured) {
+	for _, r := range resources {
+		if isCanary(r) {
+			canaries = append(canaries, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	return canaries, others
+}
+
+// applyCanaries applies the canaries and waits for them to become ready. If
+// any of them fails, the pending other resources are recorded as failed
+// without applying them and an error wrapping ErrCanaryFailed is returned.
+func (s *Synk) applyCanaries(
+	ctx context.Context,
+	rs *apps.ResourceSet,
+	opts *applyOptions,
+	results applyResults,
+	canaries, others []*unstructured.Unstructured,
+) error {
+	s.applyRegularsRetried(ctx, rs, opts, results, canaries)
+	// Only wait for the canaries, which share their results with the set.
+	waited := applyResults{}
+	for _, r := range canaries {
+		key := resourceKey(r)
+		waited[key] = results[key]
+	}
+	if err := s.waitForReady(ctx, opts, waited, true); err != nil && ctx.Err() != nil {
+		return err
+	}
+	n := countFailed(waited)
+	if n == 0 {
+		return nil
+	}
+	err := errors.Wrapf(ErrCanaryFailed, "%d/%d canary resources failed", n, len(canaries))
+	for _, r := range pendingResources(others, opts, results) {
+		results.set(r, apps.ResourceActionNone, errors.Wrap(ErrCanaryFailed, "not applied"))
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_ApplyCanariesFirst(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	canary := newUnstructured("v1", "ConfigMap", "ns1", "z-canary")
+	canary.SetAnnotations(map[string]string{canaryAnnotation: "true"})
+
+	rs, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "a-cm"), canary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created []string
+	for _, a := range filterReadActions(f.fake.Actions()) {
+		if a.GetVerb() == "create" && a.GetResource() == gvrs["configmaps"] {
+			created = append(created, a.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured).GetName())
+		}
+	}
+	if len(created) != 2 || created[0] != "z-canary" {
+		t.Errorf("expected canary to be created first, got %v", created)
+	}
+	for _, item := range rs.Status.Applied[0].Items {
+		if want := item.Name == "z-canary"; item.Canary != want {
+			t.Errorf("expected canary status %v for %s, got %v", want, item.Name, item.Canary)
+		}
+	}
+}
+
+func TestSynk_ApplyAbortsOnFailedCanary(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+	// The Deployment never becomes ready in the fake cluster.
+	canary := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	canary.SetAnnotations(map[string]string{canaryAnnotation: "true", readyTimeoutAnnotation: "10ms"})
+
+	rs, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"), canary)
+	if !errors.Is(err, ErrCanaryFailed) {
+		t.Fatalf("expected ErrCanaryFailed, got %v", err)
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected ConfigMap not to be applied, got %v", err)
+	}
+	if rs.Status.Phase != apps.ResourceSetPhaseFailed {
+		t.Errorf("expected phase Failed, got %q", rs.Status.Phase)
+	}
+	if len(rs.Status.Failed) != 2 {
+		t.Fatalf("expected canary and ConfigMap to fail, got %v", rs.Status.Failed)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// checksumLabel is set on ResourceSets to the checksum of their input resources.
+const checksumLabel = "core.cloudrobotics.com/checksum"
+
+const defaultContentLockTimeout = 10 * time.Minute
+
+// checksum returns a stable checksum over the given resources, which must
+// already be sorted. It is short enough to be used as a label value.
+func checksum(resources []*unstructured.Unstructured) (string, error) {
+	h := sha256.New()
+	for _, r := range resources {
+		// JSON encoding sorts map keys, so identical resources always
+		// result in identical bytes.
+		b, err := r.MarshalJSON()
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+		h.Write([]byte{'\n'})
+	}
+	// Label values are limited to 63 characters.
+	return hex.EncodeToString(h.Sum(nil))[:40], nil
+}
+
+// contentLocked returns true if the ResourceSet, which has the same checksum
+// as the inputs, has settled or is still being applied according to
+// DeferToSameContent.
+func (o *ApplyOptions) contentLocked(rs *apps.ResourceSet) bool {
+	switch rs.Status.Phase {
+	case apps.ResourceSetPhaseSettled:
+		return true
+	case apps.ResourceSetPhasePending:
+		timeout := o.ContentLockTimeout
+		if timeout <= 0 {
+			timeout = defaultContentLockTimeout
+		}
+		return time.Since(rs.Status.StartedAt.Time) < timeout
+	}
+	return false
+}
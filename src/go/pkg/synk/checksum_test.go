@@ -0,0 +1,211 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newChecksumInputs(t *testing.T) []*unstructured.Unstructured {
+	var cm unstructured.Unstructured
+	unmarshalYAML(t, &cm, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: ns1
+  name: cm1
+data:
+  foo1: bar1
+  foo2: bar2`)
+	return []*unstructured.Unstructured{
+		newUnstructured("v1", "Pod", "ns1", "pod1"),
+		&cm,
+	}
+}
+
+func TestChecksum_isDeterministic(t *testing.T) {
+	a, err := checksum(newChecksumInputs(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := checksum(newChecksumInputs(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("expected identical checksums for identical inputs, got %q and %q", a, b)
+	}
+	if len(a) > 63 {
+		t.Errorf("checksum %q is too long for a label value", a)
+	}
+
+	changed := newChecksumInputs(t)
+	changed[0].SetName("pod2")
+	c, err := checksum(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == c {
+		t.Errorf("expected different checksums for different inputs, got %q", a)
+	}
+}
+
+func TestSynk_initializeSkipsIfUnchanged(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	// The first version has to be applied.
+	opts := newApplyOptions("test", &ApplyOptions{SkipIfUnchanged: true})
+	rs, _, err := s.initialize(ctx, opts, newChecksumInputs(t)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.unchanged {
+		t.Fatalf("expected first version to be applied")
+	}
+	if err := s.updateResourceSetStatus(ctx, rs, applyResults{}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts = newApplyOptions("test", &ApplyOptions{SkipIfUnchanged: true})
+	got, _, err := s.initialize(ctx, opts, newChecksumInputs(t)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.unchanged {
+		t.Errorf("expected unchanged inputs to be skipped")
+	}
+	if got.Name != "test.v1" {
+		t.Errorf("expected ResourceSet %q but got %q", "test.v1", got.Name)
+	}
+	if _, err := s.client.Resource(resourceSetGVR).Get(ctx, "test.v2", metav1.GetOptions{}); err == nil {
+		t.Errorf("unexpected new ResourceSet version for unchanged inputs")
+	}
+	if got.Status.Phase != apps.ResourceSetPhaseSettled {
+		t.Errorf("expected phase %q but got %q", apps.ResourceSetPhaseSettled, got.Status.Phase)
+	}
+}
+
+func TestSynk_ApplySkipIfUnchangedReusingOptions(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+	opts := &ApplyOptions{SkipIfUnchanged: true, PatchStrategy: PatchStrategyMergeOverLive}
+
+	cm1 := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	for _, want := range []string{"test.v1", "test.v1"} {
+		rs, err := s.Apply(ctx, "test", opts, cm1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rs.Name != want {
+			t.Errorf("expected %s, got %s", want, rs.Name)
+		}
+	}
+
+	// The skipped apply must not affect the next one with the same options.
+	rs, err := s.Apply(ctx, "test", opts, cm1, newUnstructured("v1", "ConfigMap", "ns1", "cm2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name != "test.v2" || rs.Status.Phase != apps.ResourceSetPhaseSettled {
+		t.Errorf("expected settled test.v2, got %s in phase %q", rs.Name, rs.Status.Phase)
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected cm2 to be created: %v", err)
+	}
+}
+
+func TestSynk_initializeDefersToSameContent(t *testing.T) {
+	tests := []struct {
+		desc      string
+		phase     apps.ResourceSetPhase
+		startedAt time.Time
+		wantDefer bool
+	}{
+		{"settled", apps.ResourceSetPhaseSettled, time.Now().Add(-time.Hour), true},
+		{"applying", apps.ResourceSetPhasePending, time.Now(), true},
+		{"interrupted", apps.ResourceSetPhasePending, time.Now().Add(-time.Hour), false},
+		{"failed", apps.ResourceSetPhaseFailed, time.Now(), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFixture(t).newSynk()
+
+			// Another instance applies the same inputs first.
+			rs, _, err := s.initialize(ctx, newApplyOptions("test", nil), newChecksumInputs(t)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Status.Phase = tc.phase
+			rs.Status.StartedAt = metav1.NewTime(tc.startedAt)
+			if err := s.patchResourceSetStatus(ctx, rs); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := newApplyOptions("test", &ApplyOptions{DeferToSameContent: true})
+			got, _, err := s.initialize(ctx, opts, newChecksumInputs(t)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.unchanged != tc.wantDefer {
+				t.Errorf("expected deferral: %v, got %v", tc.wantDefer, opts.unchanged)
+			}
+			if tc.wantDefer && got.Name != "test.v1" {
+				t.Errorf("expected ResourceSet %q but got %q", "test.v1", got.Name)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyStoresDataInKeyOrder(t *testing.T) {
+	ctx := context.Background()
+	type stored struct {
+		applied, checksum string
+	}
+	apply := func(manifest string) stored {
+		var cm unstructured.Unstructured
+		if err := cm.UnmarshalJSON([]byte(manifest)); err != nil {
+			t.Fatal(err)
+		}
+		s := newFixture(t).newSynk()
+		rs, err := s.Apply(ctx, "test", nil, &cm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored{applied: string(getAppliedAnnotation(live)), checksum: rs.Labels[checksumLabel]}
+	}
+	a := apply(`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"namespace": "ns1", "name": "cm1"},
+		"data": {"foo1": "bar1", "foo2": "bar2", "foo3": "bar3"}}`)
+	b := apply(`{"kind": "ConfigMap", "data": {"foo3": "bar3", "foo1": "bar1", "foo2": "bar2"},
+		"metadata": {"name": "cm1", "namespace": "ns1"}, "apiVersion": "v1"}`)
+	if a.applied == "" || a.checksum == "" {
+		t.Fatalf("expected last-applied annotation and checksum, got %+v", a)
+	}
+	if a != b {
+		t.Errorf("expected identical stored manifests and checksums for different key orders, got\n%+v\nand\n%+v", a, b)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	readyConditionPath        = `{.status.conditions[?(@.type=="Ready")].status}`
+	readyConditionMessagePath = `{.status.conditions[?(@.type=="Ready")].message}`
+)
+
+// Condition selects the status a controller reports once it processed a
+// resource. The zero value waits for the Ready condition.
+type Condition struct {
+	// JSONPath selects the status, eg
+	// `{.status.conditions[?(@.type=="Ready")].status}`. The braces may be
+	// omitted.
+	JSONPath string
+	// Value is the status that means success. Defaults to "True".
+	Value string
+	// FailureValue is the status that means the controller rejected the
+	// resource. Defaults to "False".
+	FailureValue string
+	// MessagePath selects the message that's reported if the status has the
+	// FailureValue. Defaults to the message of the Ready condition if
+	// JSONPath is unset.
+	MessagePath string
+}
+
+// conditionFailedError is returned if the controller reported a failure.
+type conditionFailedError struct {
+	msg string
+}
+
+func (e *conditionFailedError) Error() string {
+	return e.msg
+}
+
+// conditionMet returns true if the status selected by c has the expected
+// value and a conditionFailedError if it has the failure value. Statuses
+// that weren't updated for the latest generation are not evaluated.
+func conditionMet(u *unstructured.Unstructured, c Condition) (bool, error) {
+	gen, _ := nestedInt(u.Object, "metadata", "generation")
+	if g, ok := nestedInt(u.Object, "status", "observedGeneration"); ok && g < gen {
+		return false, nil
+	}
+	path, msgPath := c.JSONPath, c.MessagePath
+	if path == "" {
+		path = readyConditionPath
+		if msgPath == "" {
+			msgPath = readyConditionMessagePath
+		}
+	}
+	value, failure := c.Value, c.FailureValue
+	if value == "" {
+		value = "True"
+	}
+	if failure == "" {
+		failure = "False"
+	}
+	status, err := evalJSONPath(u, path)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case value:
+		return true, nil
+	case failure:
+		msg := "condition is " + status
+		if msgPath != "" {
+			if m, err := evalJSONPath(u, msgPath); err == nil && m != "" {
+				msg += ": " + m
+			}
+		}
+		return false, &conditionFailedError{msg: msg}
+	}
+	return false, nil
+}
+
+// evalJSONPath returns the values selected by the path. Missing fields result
+// in an empty string.
+func evalJSONPath(u *unstructured.Unstructured, path string) (string, error) {
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	j := jsonpath.New("condition").AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return "", errors.Wrapf(err, "parse JSONPath %q", path)
+	}
+	var buf bytes.Buffer
+	if err := j.Execute(&buf, u.Object); err != nil {
+		return "", errors.Wrapf(err, "evaluate JSONPath %q", path)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestConditionMet(t *testing.T) {
+	const obj = `
+apiVersion: example.com/v1
+kind: Widget
+metadata: {generation: 2}
+status:
+  observedGeneration: 2
+  phase: Failed
+  conditions:
+  - {type: Synced, status: "True"}
+  - {type: Ready, status: "False", message: "invalid spec"}`
+	tests := []struct {
+		desc    string
+		cond    Condition
+		want    bool
+		wantErr string
+	}{
+		{"default ready", Condition{}, false, "condition is False: invalid spec"},
+		{"synced", Condition{JSONPath: `.status.conditions[?(@.type=="Synced")].status`}, true, ""},
+		{"phase failed", Condition{JSONPath: "{.status.phase}", Value: "Running", FailureValue: "Failed"}, false, "condition is Failed"},
+		{"phase pending", Condition{JSONPath: "{.status.phase}", Value: "Running", FailureValue: "Error"}, false, ""},
+		{"missing", Condition{JSONPath: "{.status.missing}"}, false, ""},
+		{"invalid path", Condition{JSONPath: "{.status[}"}, false, `parse JSONPath "{.status[}"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			var u unstructured.Unstructured
+			unmarshalYAML(t, &u.Object, obj)
+			got, err := conditionMet(&u, tc.cond)
+			if got != tc.want {
+				t.Errorf("conditionMet() = %v, want %v", got, tc.want)
+			}
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if tc.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tc.wantErr)) {
+				t.Errorf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConditionMetIgnoresOutdatedStatus(t *testing.T) {
+	var u unstructured.Unstructured
+	unmarshalYAML(t, &u.Object, `
+apiVersion: example.com/v1
+kind: Widget
+metadata: {generation: 3}
+status:
+  observedGeneration: 2
+  conditions: [{type: Ready, status: "False"}]`)
+	if ok, err := conditionMet(&u, Condition{}); ok || err != nil {
+		t.Errorf("conditionMet() = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestSynk_ApplyWaitsForCondition(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	tracker := s.client.(*dynamicfake.FakeDynamicClient).Tracker()
+	gets := 0
+	f.fake.PrependReactor("get", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+		get := action.(k8stest.GetAction)
+		obj, err := tracker.Get(get.GetResource(), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		cm := obj.(*unstructured.Unstructured).DeepCopy()
+		gets++
+		status := "Unknown"
+		if gets > 1 {
+			status = "False"
+		}
+		cm.Object["status"] = map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{
+				"type": "Ready", "status": status, "message": "rejected by operator",
+			}},
+		}
+		return true, cm, nil
+	})
+	cm := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{
+		PatchStrategy:    PatchStrategyMergeOverLive,
+		WaitForCondition: map[schema.GroupVersionKind]Condition{cm.GroupVersionKind(): {}},
+	},
+		cm,
+		newUnstructured("apps/v1", "Deployment", "ns1", "dp1"),
+	)
+	if err == nil {
+		t.Fatal("expected error for rejected resource")
+	}
+	if len(rs.Status.Failed) != 1 || rs.Status.Failed[0].Kind != "ConfigMap" {
+		t.Fatalf("expected ConfigMap to fail, got %v", rs.Status.Failed)
+	}
+	if got, want := rs.Status.Failed[0].Items[0].Error, "condition is False: rejected by operator"; got != want {
+		t.Errorf("expected error %q, got %q", want, got)
+	}
+	if gets < 2 {
+		t.Errorf("expected ConfigMap to be polled until it failed, got %d gets", gets)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"sort"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// currentLabel is set to "true" on the ResourceSet version that was applied
+// last successfully, so that the selector "name=foo,core.cloudrobotics.com/current=true"
+// returns the live version of the set foo.
+const currentLabel = "core.cloudrobotics.com/current"
+
+// markCurrent sets the current label on rs and then removes it from the other
+// versions of the set. The label is briefly set on two versions rather than
+// none. Readers must then prefer the higher version, like List does.
+func (s *Synk) markCurrent(ctx context.Context, rs *apps.ResourceSet, name string) error {
+	if rs.Labels[currentLabel] != "true" {
+		if rs.Labels == nil {
+			rs.Labels = map[string]string{}
+		}
+		rs.Labels[currentLabel] = "true"
+		if err := s.updateResourceSet(ctx, rs); err != nil {
+			return err
+		}
+	}
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{LabelSelector: currentLabel + "=true"})
+	if err != nil {
+		return errors.Wrap(err, "list current ResourceSets")
+	}
+	for i := range list.Items {
+		u := &list.Items[i]
+		if n, _, ok := decodeResourceSetName(u.GetName()); !ok || n != name || u.GetName() == rs.Name {
+			continue
+		}
+		labels := u.GetLabels()
+		delete(labels, currentLabel)
+		u.SetLabels(labels)
+		if _, err := s.resourceSets().Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+			return errors.Wrapf(err, "remove current label from ResourceSet %q", u.GetName())
+		}
+	}
+	return nil
+}
+
+// List returns the current version of each ResourceSet, sorted by name. The
+// current version is the one with the current label or, for sets that were
+// never applied successfully, the latest one.
+func (s *Synk) List(ctx context.Context) ([]*apps.ResourceSet, error) {
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(resourceSetErr(err), "list ResourceSets")
+	}
+	type candidate struct {
+		rs      *apps.ResourceSet
+		version int32
+		current bool
+	}
+	sets := map[string]candidate{}
+	for i := range list.Items {
+		n, v, ok := decodeResourceSetName(list.Items[i].GetName())
+		if !ok {
+			continue
+		}
+		c := candidate{version: v, current: list.Items[i].GetLabels()[currentLabel] == "true"}
+		prev, exists := sets[n]
+		// Prefer current versions, then higher ones.
+		if exists && (prev.current && !c.current || prev.current == c.current && prev.version > c.version) {
+			continue
+		}
+		c.rs = &apps.ResourceSet{}
+		if err := convert(&list.Items[i], c.rs); err != nil {
+			return nil, err
+		}
+		sets[n] = c
+	}
+	var res []*apps.ResourceSet
+	for _, c := range sets {
+		res = append(res, c.rs)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newResourceSet(name string, labels map[string]string) *apps.ResourceSet {
+	return &apps.ResourceSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+	}
+}
+
+func TestSynk_markCurrent(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addObjects(
+		newResourceSet("test.v1", map[string]string{"name": "test", currentLabel: "true"}),
+		newResourceSet("test.v2", map[string]string{"name": "test"}),
+		newResourceSet("other.v1", map[string]string{"name": "other", currentLabel: "true"}),
+	)
+	s := f.newSynk()
+
+	rs, err := s.resourceSets().Get(ctx, "test.v2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set apps.ResourceSet
+	if err := convert(rs, &set); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.markCurrent(ctx, &set, "test"); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{LabelSelector: "name=test," + currentLabel + "=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].GetName() != "test.v2" {
+		t.Errorf("expected only test.v2 to be current, got %v", list.Items)
+	}
+	other, err := s.resourceSets().Get(ctx, "other.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.GetLabels()[currentLabel] != "true" {
+		t.Errorf("expected other.v1 to remain current")
+	}
+}
+
+func TestSynk_ListReturnsCurrentResourceSets(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addObjects(
+		// test.v3 failed to apply, so test.v2 is still current.
+		newResourceSet("test.v2", map[string]string{"name": "test", currentLabel: "true"}),
+		newResourceSet("test.v3", map[string]string{"name": "test"}),
+		// During the label swap, both versions are current.
+		newResourceSet("swap.v1", map[string]string{"name": "swap", currentLabel: "true"}),
+		newResourceSet("swap.v2", map[string]string{"name": "swap", currentLabel: "true"}),
+		newResourceSet("new.v1", map[string]string{"name": "new"}),
+	)
+	s := f.newSynk()
+
+	sets, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rs := range sets {
+		got = append(got, rs.Name)
+	}
+	if want := []string{"new.v1", "swap.v2", "test.v2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected sets %v, got %v", want, got)
+	}
+}
+
+func TestSynk_ApplyMarksResourceSetCurrent(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	if _, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	opts := &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}
+	rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Labels[currentLabel] != "true" {
+		t.Errorf("expected returned ResourceSet to be current, got labels %v", rs.Labels)
+	}
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{LabelSelector: "name=test," + currentLabel + "=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].GetName() != "test.v2" {
+		t.Errorf("expected only test.v2 to be current, got %v", list.Items)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const defaultDependentsDepth = 3
+
+// defaultDependentKinds are the types that controllers commonly create for
+// the resources of a set.
+var defaultDependentKinds = []schema.GroupVersionKind{
+	{Group: "apps", Version: "v1", Kind: "ReplicaSet"},
+	{Group: "apps", Version: "v1", Kind: "ControllerRevision"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "", Version: "v1", Kind: "Pod"},
+}
+
+// DependentsOptions bounds the search of FindDependents.
+type DependentsOptions struct {
+	// Kinds are the types of the dependents to look for. Defaults to
+	// ReplicaSets, ControllerRevisions, Jobs and Pods.
+	Kinds []schema.GroupVersionKind
+	// MaxDepth is the number of owner references to follow from the
+	// resources of the set, eg 2 for the Pods of a Deployment. Defaults to 3.
+	MaxDepth int
+}
+
+// Dependent is a resource that is owned by a resource of the set, directly
+// or transitively.
+type Dependent struct {
+	*unstructured.Unstructured
+	// Owner is the resource that the owner reference points to, eg
+	// "apps/v1/Deployment/default/app".
+	Owner string
+	// Depth is 1 for resources that are owned by resources of the set, 2 for
+	// the resources that those own and so on.
+	Depth int
+}
+
+// FindDependents returns the resources that were created indirectly for the
+// latest version of the ResourceSet specified by 'name', eg the ReplicaSets
+// and Pods of a Deployment, by following owner references from the resources
+// of the set. It's meant for reports of what Delete would remove, which is
+// still left to the garbage collector. Only read requests are made.
+//
+// To avoid enumerating the whole cluster, only the given kinds are listed,
+// once per namespace of the owners, and the search stops after MaxDepth
+// levels. Namespaced dependents of cluster-scoped owners, like the contents
+// of a Namespace, are thus only found in namespaces of namespaced owners.
+// Dependents are ordered by depth and then like Changes of a Plan.
+func (s *Synk) FindDependents(ctx context.Context, name string, opts *DependentsOptions) ([]Dependent, error) {
+	if opts == nil {
+		opts = &DependentsOptions{}
+	}
+	kinds, depth := opts.Kinds, opts.MaxDepth
+	if len(kinds) == 0 {
+		kinds = defaultDependentKinds
+	}
+	if depth <= 0 {
+		depth = defaultDependentsDepth
+	}
+	rs, err := s.latest(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "get latest ResourceSet")
+	}
+	if rs == nil {
+		return nil, errors.Errorf("ResourceSet %q not found", name)
+	}
+
+	// owners are the resources whose dependents are searched next.
+	owners := map[types.UID]*unstructured.Unstructured{}
+	for _, g := range rs.Spec.Resources {
+		gvk := schema.GroupVersionKind{Group: g.Group, Version: g.Version, Kind: g.Kind}
+		for _, ref := range g.Items {
+			pr := prunedResource{gvk: gvk, ref: ref}
+			client, err := s.prunedClient(pr)
+			if err != nil {
+				return nil, err
+			} else if client == nil {
+				continue
+			}
+			live, err := client.Get(ctx, ref.Name, metav1.GetOptions{})
+			if k8serrors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "get %s %s/%s", gvk.Kind, ref.Namespace, ref.Name)
+			}
+			if uid := live.GetUID(); uid != "" {
+				owners[uid] = live
+			}
+		}
+	}
+
+	// Each type is listed at most once per namespace, even if owners are
+	// found there on several levels.
+	type listKey struct {
+		gvk       schema.GroupVersionKind
+		namespace string
+	}
+	lists := map[listKey][]unstructured.Unstructured{}
+	list := func(gvk schema.GroupVersionKind, namespace string) ([]unstructured.Unstructured, error) {
+		key := listKey{gvk, namespace}
+		if items, ok := lists[key]; ok {
+			return items, nil
+		}
+		mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			lists[key] = nil
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "get REST mapping")
+		}
+		var res *unstructured.UnstructuredList
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			key.namespace = ""
+			if items, ok := lists[key]; ok {
+				return items, nil
+			}
+			res, err = s.client.Resource(mapping.Resource).List(ctx, metav1.ListOptions{})
+		} else {
+			res, err = s.client.Resource(mapping.Resource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "list %s", mapping.Resource)
+		}
+		lists[key] = res.Items
+		return res.Items, nil
+	}
+
+	var (
+		result []Dependent
+		seen   = map[types.UID]bool{}
+	)
+	for uid := range owners {
+		seen[uid] = true
+	}
+	for level := 1; level <= depth && len(owners) > 0; level++ {
+		namespaces := map[string]bool{}
+		for _, o := range owners {
+			if ns := o.GetNamespace(); ns != "" {
+				namespaces[ns] = true
+			}
+		}
+		if s.namespace != "" {
+			namespaces = map[string]bool{s.namespace: true}
+		}
+		next := map[types.UID]*unstructured.Unstructured{}
+		for _, gvk := range kinds {
+			for ns := range namespaces {
+				items, err := list(gvk, ns)
+				if err != nil {
+					return nil, err
+				}
+				for i := range items {
+					u := &items[i]
+					if seen[u.GetUID()] {
+						continue
+					}
+					for _, or := range u.GetOwnerReferences() {
+						if o, ok := owners[or.UID]; ok {
+							seen[u.GetUID()] = true
+							next[u.GetUID()] = u
+							result = append(result, Dependent{Unstructured: u, Owner: resourceKey(o), Depth: level})
+							break
+						}
+					}
+				}
+			}
+		}
+		owners = next
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Depth != result[j].Depth {
+			return result[i].Depth < result[j].Depth
+		}
+		return lessUnstructured(result[i].Unstructured, result[j].Unstructured)
+	})
+	return result, nil
+}
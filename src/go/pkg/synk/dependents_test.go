@@ -0,0 +1,101 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestSynk_FindDependents(t *testing.T) {
+	ctx := context.Background()
+	ownerRef := func(kind, name string, uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: name, UID: uid}}
+	}
+	f := newFixture(t)
+	f.addObjects(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns1", Name: "dp1-abc", UID: "uid-rs",
+			OwnerReferences: ownerRef("Deployment", "dp1", "uid-dp"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns1", Name: "dp1-abc-xyz", UID: "uid-pod",
+			OwnerReferences: ownerRef("ReplicaSet", "dp1-abc", "uid-rs"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns1", Name: "other", UID: "uid-other",
+			OwnerReferences: ownerRef("ReplicaSet", "other", "uid-other-rs"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "unowned", UID: "uid-unowned"}},
+	)
+	s := f.newSynk()
+	if _, err := s.Apply(ctx, "test", nil, newUnstructured("apps/v1", "Deployment", "ns1", "dp1")); err != nil {
+		t.Fatal(err)
+	}
+	// The fake cluster doesn't assign UIDs.
+	tracker := s.client.(*dynamicfake.FakeDynamicClient).Tracker()
+	live, err := tracker.Get(gvrs["deployments"], "ns1", "dp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.(metav1.Object).SetUID("uid-dp")
+	if err := tracker.Update(gvrs["deployments"], live, "ns1"); err != nil {
+		t.Fatal(err)
+	}
+
+	applied := len(f.fake.Actions())
+
+	tests := []struct {
+		desc     string
+		maxDepth int
+		want     []string
+	}{
+		{"default depth", 0, []string{
+			"apps/v1/ReplicaSet/ns1/dp1-abc owned by apps/v1/Deployment/ns1/dp1",
+			"/v1/Pod/ns1/dp1-abc-xyz owned by apps/v1/ReplicaSet/ns1/dp1-abc",
+		}},
+		{"direct dependents only", 1, []string{
+			"apps/v1/ReplicaSet/ns1/dp1-abc owned by apps/v1/Deployment/ns1/dp1",
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			deps, err := s.FindDependents(ctx, "test", &DependentsOptions{MaxDepth: tc.maxDepth})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for i, d := range deps {
+				if d.Depth != i+1 {
+					t.Errorf("expected depth %d for %s, got %d", i+1, resourceKey(d.Unstructured), d.Depth)
+				}
+				got = append(got, resourceKey(d.Unstructured)+" owned by "+d.Owner)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected dependents\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+	if writes := filterReadActions(f.fake.Actions()[applied:]); len(writes) > 0 {
+		t.Errorf("expected only reads, got %s", sprintAction(writes[0]))
+	}
+}
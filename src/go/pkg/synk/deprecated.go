@@ -0,0 +1,210 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrNoSafeConversion is returned if a resource uses an API version that
+// isn't served, but can't be converted without changing its meaning.
+var ErrNoSafeConversion = errors.New("no safe conversion")
+
+// APIConversion rewrites resources of a deprecated API version to a served
+// one.
+type APIConversion struct {
+	// From is the deprecated kind and version. To is the kind and version it
+	// is converted to. If To is empty, the API was removed without a
+	// replacement and conversion fails.
+	From, To schema.GroupVersionKind
+	// Migrate adapts the fields of the resource after the apiVersion was
+	// rewritten. It is optional and returns an error wrapping
+	// ErrNoSafeConversion if the resource can't be converted.
+	Migrate func(r *unstructured.Unstructured) error
+}
+
+// DefaultAPIConversions are the built-in conversions for APIs that were
+// removed in Kubernetes 1.16 to 1.26. They only cover changes that keep the
+// behavior of the resource.
+var DefaultAPIConversions = defaultAPIConversions()
+
+func defaultAPIConversions() []APIConversion {
+	var cs []APIConversion
+	add := func(fromGroupVersion, toGroupVersion string, migrate func(*unstructured.Unstructured) error, kinds ...string) {
+		from, _ := schema.ParseGroupVersion(fromGroupVersion)
+		var to schema.GroupVersion
+		if toGroupVersion != "" {
+			to, _ = schema.ParseGroupVersion(toGroupVersion)
+		}
+		for _, k := range kinds {
+			c := APIConversion{From: from.WithKind(k), Migrate: migrate}
+			if !to.Empty() {
+				c.To = to.WithKind(k)
+			}
+			cs = append(cs, c)
+		}
+	}
+	workloads := []string{"DaemonSet", "Deployment", "ReplicaSet", "StatefulSet"}
+	add("extensions/v1beta1", "apps/v1", migrateSelector, "DaemonSet", "Deployment", "ReplicaSet")
+	add("apps/v1beta1", "apps/v1", migrateSelector, workloads...)
+	add("apps/v1beta2", "apps/v1", migrateSelector, workloads...)
+	add("extensions/v1beta1", "networking.k8s.io/v1", migrateIngress, "Ingress")
+	add("networking.k8s.io/v1beta1", "networking.k8s.io/v1", migrateIngress, "Ingress")
+	add("networking.k8s.io/v1beta1", "networking.k8s.io/v1", nil, "IngressClass")
+	add("extensions/v1beta1", "networking.k8s.io/v1", nil, "NetworkPolicy")
+	add("batch/v1beta1", "batch/v1", nil, "CronJob")
+	add("policy/v1beta1", "policy/v1", migratePodDisruptionBudget, "PodDisruptionBudget")
+	add("rbac.authorization.k8s.io/v1beta1", "rbac.authorization.k8s.io/v1", nil,
+		"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding")
+	add("scheduling.k8s.io/v1beta1", "scheduling.k8s.io/v1", nil, "PriorityClass")
+	add("autoscaling/v2beta2", "autoscaling/v2", nil, "HorizontalPodAutoscaler")
+	// The schemas of these APIs differ in ways that change the behavior of
+	// resources, or they were removed without a replacement.
+	add("apiextensions.k8s.io/v1beta1", "", nil, "CustomResourceDefinition")
+	add("autoscaling/v2beta1", "", nil, "HorizontalPodAutoscaler")
+	add("extensions/v1beta1", "", nil, "PodSecurityPolicy")
+	add("policy/v1beta1", "", nil, "PodSecurityPolicy")
+	return cs
+}
+
+// convertDeprecatedAPIs rewrites the resources whose kind isn't served in
+// their version according to the conversions, with those of
+// ApplyOptions.APIConversions taking precedence. Resources of kinds defined by
+// CRDs of the set are left alone, since they'll only be served once the CRDs
+// are applied.
+func (s *Synk) convertDeprecatedAPIs(resources []*unstructured.Unstructured, opts *applyOptions) error {
+	conversions := map[schema.GroupVersionKind]APIConversion{}
+	for _, c := range DefaultAPIConversions {
+		conversions[c.From] = c
+	}
+	for _, c := range opts.APIConversions {
+		conversions[c.From] = c
+	}
+	crds, _ := separateCRDsFromResources(resources)
+	for _, r := range resources {
+		gvk := r.GroupVersionKind()
+		c, ok := conversions[gvk]
+		if !ok || definesKind(crds, gvk.GroupKind()) {
+			continue
+		}
+		if _, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); !meta.IsNoMatchError(err) {
+			continue
+		}
+		if c.To.Empty() {
+			return errors.Wrapf(ErrNoSafeConversion, "%s was removed without a replacement", resourceKey(r))
+		}
+		converted := r.DeepCopy()
+		converted.SetGroupVersionKind(c.To)
+		if c.Migrate != nil {
+			if err := c.Migrate(converted); err != nil {
+				return errors.Wrapf(err, "convert %s to %s", resourceKey(r), c.To.GroupVersion())
+			}
+		}
+		*r = *converted
+		opts.warnf(r, "converted from deprecated %s", gvk.GroupVersion())
+	}
+	return nil
+}
+
+// migrateSelector sets the selector of workloads to the labels of their pod
+// template, which the beta versions did by default.
+func migrateSelector(r *unstructured.Unstructured) error {
+	if _, ok, _ := unstructured.NestedFieldNoCopy(r.Object, "spec", "selector"); ok {
+		return nil
+	}
+	labels, _, _ := unstructured.NestedStringMap(r.Object, "spec", "template", "metadata", "labels")
+	if len(labels) == 0 {
+		return errors.Wrap(ErrNoSafeConversion, "spec.selector is required and the pod template has no labels")
+	}
+	return unstructured.SetNestedStringMap(r.Object, labels, "spec", "selector", "matchLabels")
+}
+
+// migratePodDisruptionBudget rejects empty selectors, which select no pods in
+// policy/v1beta1 but all pods of the namespace in policy/v1.
+func migratePodDisruptionBudget(r *unstructured.Unstructured) error {
+	sel, _, _ := unstructured.NestedMap(r.Object, "spec", "selector")
+	if len(sel) == 0 {
+		return errors.Wrap(ErrNoSafeConversion, "an empty spec.selector selects all pods in policy/v1")
+	}
+	return nil
+}
+
+// migrateIngress moves the backends to the structure of networking.k8s.io/v1
+// and sets the path type that beta Ingresses defaulted to.
+func migrateIngress(r *unstructured.Unstructured) error {
+	spec, _, _ := unstructured.NestedMap(r.Object, "spec")
+	if spec == nil {
+		return nil
+	}
+	if b, ok := spec["backend"].(map[string]interface{}); ok {
+		delete(spec, "backend")
+		if err := migrateIngressBackend(b); err != nil {
+			return err
+		}
+		spec["defaultBackend"] = b
+	}
+	rules, _ := spec["rules"].([]interface{})
+	for _, rule := range rules {
+		paths, _, _ := unstructured.NestedSlice(asMap(rule), "http", "paths")
+		for _, p := range paths {
+			pm := asMap(p)
+			if pm == nil {
+				continue
+			}
+			if _, ok := pm["pathType"]; !ok {
+				pm["pathType"] = "ImplementationSpecific"
+			}
+			b, _ := pm["backend"].(map[string]interface{})
+			if err := migrateIngressBackend(b); err != nil {
+				return err
+			}
+		}
+		if len(paths) > 0 {
+			if err := unstructured.SetNestedSlice(asMap(rule), paths, "http", "paths"); err != nil {
+				return err
+			}
+		}
+	}
+	return unstructured.SetNestedMap(r.Object, spec, "spec")
+}
+
+// migrateIngressBackend replaces serviceName and servicePort by service.name
+// and service.port.
+func migrateIngressBackend(b map[string]interface{}) error {
+	if b == nil {
+		return nil
+	}
+	name, hasName := b["serviceName"]
+	port, hasPort := b["servicePort"]
+	if !hasName && !hasPort {
+		return nil
+	}
+	delete(b, "serviceName")
+	delete(b, "servicePort")
+	svc := map[string]interface{}{"name": name}
+	switch p := port.(type) {
+	case string:
+		svc["port"] = map[string]interface{}{"name": p}
+	case int, int64, float64:
+		svc["port"] = map[string]interface{}{"number": p}
+	default:
+		return errors.Wrapf(ErrNoSafeConversion, "invalid servicePort %v", port)
+	}
+	b["service"] = svc
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// newMapper returns a mapper that only serves the given namespaced kinds.
+func newMapper(gvks ...schema.GroupVersionKind) meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range gvks {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	return mapper
+}
+
+func TestSynk_ApplyConvertsDeprecatedAPIs(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	s.mapper = newMapper(
+		schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+		schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+	)
+	var ing, deploy unstructured.Unstructured
+	unmarshalYAML(t, &ing.Object, `
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  namespace: ns1
+  name: ing1
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          serviceName: svc1
+          servicePort: 80`)
+	unmarshalYAML(t, &deploy.Object, `
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  namespace: ns1
+  name: deploy1
+spec:
+  template:
+    metadata:
+      labels:
+        app: foo`)
+
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{ConvertDeprecatedAPIs: true, PatchStrategy: PatchStrategyMergeOverLive}, &ing, &deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := s.client.Resource(schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}).
+		Namespace("ns1").Get(ctx, "ing1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, _, _ := unstructured.NestedSlice(live.Object, "spec", "rules")
+	if len(paths) != 1 {
+		t.Fatalf("expected 1 rule, got %v", paths)
+	}
+	wantPath := map[string]interface{}{
+		"path":     "/",
+		"pathType": "ImplementationSpecific",
+		"backend": map[string]interface{}{
+			"service": map[string]interface{}{"name": "svc1", "port": map[string]interface{}{"number": float64(80)}},
+		},
+	}
+	if got, _, _ := unstructured.NestedSlice(paths[0].(map[string]interface{}), "http", "paths"); !reflect.DeepEqual(got, []interface{}{wantPath}) {
+		t.Errorf("expected paths %v, got %v", []interface{}{wantPath}, got)
+	}
+	liveDeploy, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Get(ctx, "deploy1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel, _, _ := unstructured.NestedStringMap(liveDeploy.Object, "spec", "selector", "matchLabels"); !reflect.DeepEqual(sel, map[string]string{"app": "foo"}) {
+		t.Errorf("expected selector from pod template labels, got %v", sel)
+	}
+	var warnings []string
+	for _, g := range rs.Status.Applied {
+		for _, it := range g.Items {
+			warnings = append(warnings, it.Warnings...)
+		}
+	}
+	want := []string{"converted from deprecated apps/v1beta1", "converted from deprecated extensions/v1beta1"}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("expected warnings %q, got %q", want, warnings)
+	}
+}
+
+func TestSynk_convertDeprecatedAPIs(t *testing.T) {
+	s := newFixture(t).newSynk()
+	s.mapper = newMapper(
+		schema.GroupVersionKind{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"},
+		schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"},
+	)
+	tests := []struct {
+		desc     string
+		resource *unstructured.Unstructured
+		opts     *ApplyOptions
+		want     string
+		wantErr  error
+	}{
+		{
+			desc:     "removed without replacement",
+			resource: newUnstructured("policy/v1beta1", "PodSecurityPolicy", "", "psp1"),
+			wantErr:  ErrNoSafeConversion,
+		},
+		{
+			desc:     "changed semantics",
+			resource: newUnstructured("policy/v1beta1", "PodDisruptionBudget", "ns1", "pdb1"),
+			wantErr:  ErrNoSafeConversion,
+		},
+		{
+			desc:     "served",
+			resource: newUnstructured("batch/v1beta1", "CronJob", "ns1", "cron1"),
+			want:     "batch/v1beta1",
+		},
+		{
+			desc:     "unknown",
+			resource: newUnstructured("example.com/v1beta1", "Widget", "ns1", "widget1"),
+			want:     "example.com/v1beta1",
+		},
+		{
+			desc:     "user conversion",
+			resource: newUnstructured("example.com/v1beta1", "Widget", "ns1", "widget1"),
+			opts: &ApplyOptions{APIConversions: []APIConversion{{
+				From: schema.GroupVersionKind{Group: "example.com", Version: "v1beta1", Kind: "Widget"},
+				To:   schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"},
+			}}},
+			want: "example.com/v1",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := tc.opts
+			if opts == nil {
+				opts = &ApplyOptions{}
+			}
+			err := s.convertDeprecatedAPIs([]*unstructured.Unstructured{tc.resource}, newApplyOptions("test", opts))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if got := tc.resource.GetAPIVersion(); got != tc.want {
+				t.Errorf("expected apiVersion %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMigrateIngress(t *testing.T) {
+	var got, want unstructured.Unstructured
+	unmarshalYAML(t, &got.Object, `
+spec:
+  backend:
+    serviceName: default
+    servicePort: http
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - path: /api
+        pathType: Prefix
+        backend:
+          serviceName: api
+          servicePort: 8080`)
+	unmarshalYAML(t, &want.Object, `
+spec:
+  defaultBackend:
+    service:
+      name: default
+      port:
+        name: http
+  rules:
+  - host: example.com
+    http:
+      paths:
+      - path: /api
+        pathType: Prefix
+        backend:
+          service:
+            name: api
+            port:
+              number: 8080`)
+	if err := migrateIngress(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Object, want.Object) {
+		t.Errorf("expected\n%v\nbut got\n%v", want.Object, got.Object)
+	}
+}
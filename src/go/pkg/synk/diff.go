@@ -0,0 +1,157 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// VersionDiff describes how the resources of two ResourceSet versions differ.
+type VersionDiff struct {
+	// From and To are the names of the compared ResourceSets.
+	From, To string
+	// Added and Removed are the resources that are only part of To or From.
+	Added, Removed []VersionDiffEntry
+	// Changed are the resources of both versions whose manifests differ.
+	Changed []VersionDiffEntry
+}
+
+// VersionDiffEntry identifies a resource in a VersionDiff. The version is the
+// one of the newer ResourceSet if the resource is part of both.
+type VersionDiffEntry struct {
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+}
+
+// DiffVersions compares the resources of two versions of the ResourceSet
+// specified by 'name'. Resources are matched regardless of their API version.
+// Since the manifests aren't stored, changes are detected by the checksums
+// recorded in the status. Resources without checksums, eg since they were
+// applied by an older Synk version, are only reported if added or removed.
+// Both versions must still exist, which is usually only the case for the
+// latest version and versions kept due to prune limits.
+func (s *Synk) DiffVersions(ctx context.Context, name string, from, to int32) (*VersionDiff, error) {
+	fromSet, err := s.getVersion(ctx, name, from)
+	if err != nil {
+		return nil, err
+	}
+	toSet, err := s.getVersion(ctx, name, to)
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		gk  schema.GroupKind
+		ref apps.ResourceRef
+	}
+	entries := func(rs *apps.ResourceSet) map[key]VersionDiffEntry {
+		m := map[key]VersionDiffEntry{}
+		for _, g := range rs.Spec.Resources {
+			gvk := schema.GroupVersionKind{Group: g.Group, Version: g.Version, Kind: g.Kind}
+			for _, ref := range g.Items {
+				m[key{gvk.GroupKind(), ref}] = VersionDiffEntry{gvk, ref.Namespace, ref.Name}
+			}
+		}
+		return m
+	}
+	checksums := func(rs *apps.ResourceSet) map[key]string {
+		m := map[key]string{}
+		for _, g := range append(append([]apps.ResourceSetStatusGroup(nil), rs.Status.Applied...), rs.Status.Failed...) {
+			gk := schema.GroupKind{Group: g.Group, Kind: g.Kind}
+			for _, st := range g.Items {
+				m[key{gk, apps.ResourceRef{Namespace: st.Namespace, Name: st.Name}}] = st.Checksum
+			}
+		}
+		return m
+	}
+	fromSums, toSums := checksums(fromSet), checksums(toSet)
+	diff := &VersionDiff{From: fromSet.Name, To: toSet.Name}
+	fromEntries, toEntries := entries(fromSet), entries(toSet)
+	for k, e := range toEntries {
+		if _, ok := fromEntries[k]; !ok {
+			diff.Added = append(diff.Added, e)
+		} else if a, b := fromSums[k], toSums[k]; a != "" && b != "" && a != b {
+			diff.Changed = append(diff.Changed, e)
+		}
+	}
+	for k, e := range fromEntries {
+		if _, ok := toEntries[k]; !ok {
+			diff.Removed = append(diff.Removed, e)
+		}
+	}
+	for _, l := range [][]VersionDiffEntry{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(l, func(i, j int) bool {
+			return less(
+				newGvknn(l[i].Group, l[i].Version, l[i].Kind, l[i].Namespace, l[i].Name),
+				newGvknn(l[j].Group, l[j].Version, l[j].Kind, l[j].Namespace, l[j].Name),
+			)
+		})
+	}
+	return diff, nil
+}
+
+// getVersion returns the given version of the ResourceSet.
+func (s *Synk) getVersion(ctx context.Context, name string, version int32) (*apps.ResourceSet, error) {
+	u, err := s.resourceSets().Get(ctx, resourceSetName(name, version), metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(resourceSetErr(err), "get ResourceSet %q", resourceSetName(name, version))
+	}
+	var rs apps.ResourceSet
+	if err := convert(u, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// manifestChecksum returns a hash of the resource. Fields that Synk sets when
+// applying, like the owner references, are ignored.
+func manifestChecksum(r *unstructured.Unstructured) string {
+	obj := map[string]interface{}{}
+	for k, v := range r.Object {
+		if k != "metadata" {
+			obj[k] = v
+		}
+	}
+	meta := map[string]interface{}{
+		"namespace": r.GetNamespace(),
+		"name":      r.GetName(),
+	}
+	if labels := r.GetLabels(); len(labels) > 0 {
+		delete(labels, generateNameLabel)
+		meta["labels"] = labels
+	}
+	if annotations := r.GetAnnotations(); len(annotations) > 0 {
+		delete(annotations, corev1.LastAppliedConfigAnnotation)
+		meta["annotations"] = annotations
+	}
+	obj["metadata"] = meta
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:16]
+}
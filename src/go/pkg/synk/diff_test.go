@@ -0,0 +1,69 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSynk_DiffVersions(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	cm := func(name, value string) *unstructured.Unstructured {
+		u := newUnstructured("v1", "ConfigMap", "ns1", name)
+		u.Object["data"] = map[string]interface{}{"key": value}
+		return u
+	}
+	if _, err := s.Apply(ctx, "test", nil, cm("same", "a"), cm("changed", "a"), cm("removed", "a")); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the first version by exceeding the prune limit.
+	opts := &ApplyOptions{MaxPruneFraction: 0.1, PatchStrategy: PatchStrategyMergeOverLive}
+	if _, err := s.Apply(ctx, "test", opts,
+		cm("same", "a"), cm("changed", "b"), newUnstructured("apps/v1", "Deployment", "ns1", "added"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := s.DiffVersions(ctx, "test", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := func(gvk schema.GroupVersionKind, name string) []VersionDiffEntry {
+		return []VersionDiffEntry{{gvk, "ns1", name}}
+	}
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	want := &VersionDiff{
+		From:    "test.v1",
+		To:      "test.v2",
+		Added:   entry(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "added"),
+		Removed: entry(configMap, "removed"),
+		Changed: entry(configMap, "changed"),
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("DiffVersions() = %+v, want %+v", diff, want)
+	}
+
+	if _, err := s.DiffVersions(ctx, "test", 1, 3); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected NotFound for missing version, got %v", err)
+	}
+}
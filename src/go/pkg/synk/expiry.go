@@ -0,0 +1,79 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+)
+
+// ExpiresAtAnnotation is set on the ResourceSets of sets applied with
+// ApplyOptions.TTL. The value is an RFC 3339 timestamp.
+const ExpiresAtAnnotation = "core.cloudrobotics.com/expires-at"
+
+// CollectExpired deletes the sets whose current version expired, with their
+// resources, like Delete. Sets without ExpiresAtAnnotation never expire.
+// Synk doesn't run a timer, so callers that apply sets with a TTL must call
+// CollectExpired periodically.
+func (s *Synk) CollectExpired(ctx context.Context) error {
+	sets, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var failed []string
+	for _, rs := range sets {
+		if rs.DeletionTimestamp != nil {
+			continue
+		}
+		ok, err := expired(rs, now)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", rs.Name, err))
+			continue
+		} else if !ok {
+			continue
+		}
+		name, _, _ := decodeResourceSetName(rs.Name)
+		slog.Info("Deleting expired ResourceSet",
+			slog.String("Name", name),
+			slog.String("ExpiresAt", rs.Annotations[ExpiresAtAnnotation]))
+		if err := s.Delete(ctx, name); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", rs.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("collect expired ResourceSets: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// expired returns true if the ResourceSet expired before now.
+func expired(rs *apps.ResourceSet, now time.Time) (bool, error) {
+	v, ok := rs.Annotations[ExpiresAtAnnotation]
+	if !ok {
+		return false, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid %s annotation", ExpiresAtAnnotation)
+	}
+	return now.After(t), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_ApplyTTL(t *testing.T) {
+	s := newFixture(t).newSynk()
+	before := time.Now().Truncate(time.Second)
+	rs, err := s.Apply(context.Background(), "test", &ApplyOptions{TTL: time.Hour}, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, rs.Annotations[ExpiresAtAnnotation])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt.Before(before.Add(time.Hour)) || expiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected expiry in one hour, got %s", expiresAt)
+	}
+}
+
+func TestSynk_CollectExpired(t *testing.T) {
+	newSet := func(name, expiresAt string) *apps.ResourceSet {
+		rs := &apps.ResourceSet{
+			TypeMeta: metav1.TypeMeta{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name + ".v1",
+				Labels: map[string]string{"name": name},
+			},
+		}
+		if expiresAt != "" {
+			rs.Annotations = map[string]string{ExpiresAtAnnotation: expiresAt}
+		}
+		return rs
+	}
+	f := newFixture(t)
+	f.addObjects(
+		newSet("expired", time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)),
+		newSet("valid", time.Now().Add(time.Hour).UTC().Format(time.RFC3339)),
+		newSet("permanent", ""),
+		newSet("invalid", "tomorrow"),
+	)
+	s := f.newSynk()
+
+	err := s.CollectExpired(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "invalid.v1: invalid "+ExpiresAtAnnotation) {
+		t.Errorf("expected error for invalid annotation, got %v", err)
+	}
+	var deleted []string
+	for _, a := range f.fake.Actions() {
+		if dc, ok := a.(k8stest.DeleteCollectionAction); ok && a.GetVerb() == "delete-collection" {
+			deleted = append(deleted, dc.GetListRestrictions().Labels.String())
+		}
+	}
+	if want := []string{"name=expired"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("expected deletions %v, got %v", want, deleted)
+	}
+}
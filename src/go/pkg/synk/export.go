@@ -0,0 +1,95 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// exportSanitizers turn live objects into manifests that can be applied to
+// another cluster.
+var exportSanitizers = []func(*unstructured.Unstructured) error{
+	StripServerMetadata,
+	StripStatus,
+	StripNulls,
+}
+
+// Export writes the live resources of the latest version of the ResourceSet
+// specified by 'name' to w as multi-document YAML, eg for a backup or to
+// migrate the set to another cluster. Server-managed metadata, owner
+// references and the status are removed, so that the output can be applied
+// again. Resources are written in apply order. Resources that no longer
+// exist are skipped with a warning.
+func (s *Synk) Export(ctx context.Context, name string, w io.Writer) error {
+	rs, err := s.latest(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "get latest ResourceSet")
+	}
+	if rs == nil {
+		return errors.Errorf("ResourceSet %q not found", name)
+	}
+	var resources []*unstructured.Unstructured
+	for _, g := range rs.Spec.Resources {
+		gvk := schema.GroupVersionKind{Group: g.Group, Version: g.Version, Kind: g.Kind}
+		for _, ref := range g.Items {
+			client, err := s.prunedClient(prunedResource{gvk: gvk, ref: ref})
+			if err != nil {
+				return err
+			}
+			if client == nil {
+				slog.Warn("Skipping export of resource with unknown type",
+					slog.String("Kind", gvk.Kind),
+					slog.String("Namespace", ref.Namespace),
+					slog.String("Name", ref.Name))
+				continue
+			}
+			live, err := client.Get(ctx, ref.Name, metav1.GetOptions{})
+			if k8serrors.IsNotFound(err) {
+				slog.Warn("Skipping export of missing resource",
+					slog.String("Kind", gvk.Kind),
+					slog.String("Namespace", ref.Namespace),
+					slog.String("Name", ref.Name))
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "get %s %s/%s", gvk.Kind, ref.Namespace, ref.Name)
+			}
+			resources = append(resources, live)
+		}
+	}
+	if err := sanitize(resources, exportSanitizers); err != nil {
+		return err
+	}
+	sortResources(resources)
+	for _, r := range resources {
+		data, err := yaml.Marshal(r.Object)
+		if err != nil {
+			return errors.Wrapf(err, "encode %s", describe(r))
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return errors.Wrap(err, "write manifest")
+		}
+	}
+	return nil
+}
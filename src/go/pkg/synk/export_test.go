@@ -0,0 +1,97 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSynk_Export(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	cm := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	unstructured.SetNestedField(cm.Object, "bar", "data", "foo")
+	dp := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	dp.SetAnnotations(map[string]string{"example.com/owner": "team"})
+	opts := &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}
+	if _, err := s.Apply(ctx, "test", opts, cm, dp, newUnstructured("v1", "ConfigMap", "ns1", "deleted")); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate fields set by the apiserver and controllers.
+	live, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Get(ctx, "dp1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.SetUID("uid1")
+	live.SetResourceVersion("42")
+	unstructured.SetNestedField(live.Object, int64(1), "status", "readyReplicas")
+	if _, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Delete(ctx, "deleted", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Export(ctx, "test", &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+apiVersion: v1
+data:
+  foo: bar
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: ns1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    example.com/owner: team
+  name: dp1
+  namespace: ns1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("expected export\n%s\nbut got\n%s", want, got)
+	}
+
+	// The export can be applied to another cluster.
+	var resources []*unstructured.Unstructured
+	for _, doc := range strings.Split(strings.TrimPrefix(buf.String(), "---\n"), "---\n") {
+		r := &unstructured.Unstructured{}
+		unmarshalYAML(t, &r.Object, doc)
+		resources = append(resources, r)
+	}
+	if _, err := newFixture(t).newSynk().Apply(ctx, "test", opts, resources...); err != nil {
+		t.Errorf("expected export to apply, got %v", err)
+	}
+}
+
+func TestSynk_ExportMissingResourceSet(t *testing.T) {
+	s := newFixture(t).newSynk()
+	if err := s.Export(context.Background(), "test", &bytes.Buffer{}); err == nil {
+		t.Error("expected error for missing ResourceSet")
+	}
+}
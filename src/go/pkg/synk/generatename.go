@@ -0,0 +1,80 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// generateNameLabel is set on resources that are created with generateName.
+// Its value is derived from the ResourceSet version and the resource's kind,
+// namespace and generateName, so that a retry finds the resource that a
+// failed attempt may have created rather than creating another one. The
+// generateName must therefore be unique per kind and namespace within a set.
+const generateNameLabel = "core.cloudrobotics.com/generate-name-key"
+
+// generateNameKey returns the value of the generateNameLabel.
+func generateNameKey(r *unstructured.Unstructured, set *apps.ResourceSet) string {
+	sum := sha256.Sum256([]byte(set.Name + "/" + resourceKey(r)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// resolveGeneratedName labels a resource without name but with generateName
+// and sets its name if it was already created by a previous attempt for the
+// same ResourceSet version. The name stays empty if the resource needs to be
+// created.
+func resolveGeneratedName(ctx context.Context, client dynamic.ResourceInterface, r *unstructured.Unstructured, set *apps.ResourceSet) error {
+	if r.GetName() != "" || r.GetGenerateName() == "" {
+		return nil
+	}
+	key := generateNameKey(r, set)
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: generateNameLabel + "=" + key})
+	if err != nil {
+		return errors.Wrap(err, "list resources created with generateName")
+	}
+	labels := r.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[generateNameLabel] = key
+	r.SetLabels(labels)
+	switch len(list.Items) {
+	case 0:
+	case 1:
+		r.SetName(list.Items[0].GetName())
+	default:
+		return errors.Errorf("found %d resources created for generateName %q", len(list.Items), r.GetGenerateName())
+	}
+	return nil
+}
+
+// hasGeneratedNames returns true if one of the resources was created with
+// generateName.
+func hasGeneratedNames(resources []*unstructured.Unstructured) bool {
+	for _, r := range resources {
+		if r.GetLabels()[generateNameLabel] != "" {
+			return true
+		}
+	}
+	return false
+}
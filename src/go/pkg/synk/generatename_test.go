@@ -0,0 +1,83 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_ApplyGenerateNameRetriesWithoutDuplicates(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	tracker := s.client.(*dynamicfake.FakeDynamicClient).Tracker()
+	jobs := schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+	creates := 0
+	// The fake client doesn't generate names. The first create is persisted
+	// but fails, eg due to a timeout.
+	f.fake.PrependReactor("create", "jobs", func(action k8stest.Action) (bool, runtime.Object, error) {
+		creates++
+		obj := action.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured).DeepCopy()
+		obj.SetName(fmt.Sprintf("%s%d", obj.GetGenerateName(), creates))
+		if err := tracker.Create(jobs, obj, obj.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		if creates == 1 {
+			return true, nil, k8serrors.NewServerTimeout(jobs.GroupResource(), "create", 1)
+		}
+		return true, obj, nil
+	})
+	job := newUnstructured("batch/v1", "Job", "ns1", "")
+	job.SetGenerateName("migrate-")
+
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creates != 1 {
+		t.Errorf("expected a single create, got %d", creates)
+	}
+	list, err := s.client.Resource(jobs).Namespace("ns1").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected one Job, got %d", len(list.Items))
+	}
+	if len(rs.Status.Applied) != 1 || len(rs.Status.Applied[0].Items) != 1 {
+		t.Fatalf("expected one applied resource, got %v", rs.Status.Applied)
+	}
+	st := rs.Status.Applied[0].Items[0]
+	if st.Name != "migrate-1" || st.GenerateName != "migrate-" || st.Action != apps.ResourceActionUpdate {
+		t.Errorf("expected migrate-1 to be updated for generateName migrate-, got %+v", st)
+	}
+	if len(rs.Status.Failed) != 0 {
+		t.Errorf("expected no failed resources, got %v", rs.Status.Failed)
+	}
+	if got := rs.Spec.Resources[0].Items[0].Name; got != "migrate-1" {
+		t.Errorf("expected generated name in spec, got %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultGovernanceKinds constrain what workloads may be admitted to a
+// namespace and are therefore applied before them.
+var defaultGovernanceKinds = []schema.GroupKind{
+	{Kind: "ResourceQuota"},
+	{Kind: "LimitRange"},
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"},
+}
+
+func (o *ApplyOptions) governanceKinds() []schema.GroupKind {
+	if o.GovernanceKinds == nil {
+		return defaultGovernanceKinds
+	}
+	return o.GovernanceKinds
+}
+
+func isGovernanceKind(r *unstructured.Unstructured, kinds []schema.GroupKind) bool {
+	gk := r.GroupVersionKind().GroupKind()
+	for _, k := range kinds {
+		if k == gk {
+			return true
+		}
+	}
+	return false
+}
+
+// sortGovernance moves the governance resources of the sorted list right
+// after the Namespaces, keeping the order otherwise.
+func sortGovernance(resources []*unstructured.Unstructured, kinds []schema.GroupKind) {
+	rank := func(r *unstructured.Unstructured) int {
+		switch {
+		case r.GroupVersionKind().GroupKind() == (schema.GroupKind{Kind: "Namespace"}):
+			return 0
+		case isGovernanceKind(r, kinds):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return rank(resources[i]) < rank(resources[j])
+	})
+}
+
+// governanceErr returns an error if r is a namespaced resource whose
+// Namespace or one of the governance resources of its namespace failed to
+// apply. Applying it anyway might admit workloads without their quota,
+// limits or network policies.
+func governanceErr(r *unstructured.Unstructured, results applyResults, kinds []schema.GroupKind) error {
+	ns := r.GetNamespace()
+	if ns == "" || isGovernanceKind(r, kinds) {
+		return nil
+	}
+	for _, res := range results {
+		if res.err == nil {
+			continue
+		}
+		g := res.resource
+		switch {
+		case g.GetKind() == "Namespace" && g.GetAPIVersion() == "v1" && g.GetName() == ns:
+			return errors.Errorf("namespace %s failed to apply", ns)
+		case g.GetNamespace() == ns && isGovernanceKind(g, kinds):
+			return errors.Errorf("%s %s/%s failed to apply", g.GetKind(), ns, g.GetName())
+		}
+	}
+	return nil
+}
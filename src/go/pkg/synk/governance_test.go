@@ -0,0 +1,107 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSortGovernance(t *testing.T) {
+	resources := []*unstructured.Unstructured{
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("networking.k8s.io/v1", "NetworkPolicy", "ns1", "np1"),
+		newUnstructured("v1", "Namespace", "", "ns1"),
+		newUnstructured("v1", "ServiceAccount", "ns1", "sa1"),
+		newUnstructured("v1", "ResourceQuota", "ns1", "quota1"),
+		newUnstructured("v1", "LimitRange", "ns1", "limits1"),
+	}
+	tests := []struct {
+		desc  string
+		kinds []schema.GroupKind
+		want  []string
+	}{{
+		desc: "default",
+		want: []string{"Namespace", "LimitRange", "ResourceQuota", "NetworkPolicy", "ServiceAccount", "ConfigMap"},
+	}, {
+		desc:  "custom",
+		kinds: []schema.GroupKind{{Kind: "ConfigMap"}},
+		want:  []string{"Namespace", "ConfigMap", "ServiceAccount", "LimitRange", "ResourceQuota", "NetworkPolicy"},
+	}, {
+		desc:  "disabled",
+		kinds: []schema.GroupKind{},
+		want:  []string{"Namespace", "ServiceAccount", "ConfigMap", "LimitRange", "ResourceQuota", "NetworkPolicy"},
+	}}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			res := append([]*unstructured.Unstructured(nil), resources...)
+			opts := &ApplyOptions{GovernanceKinds: tc.kinds}
+			sortResources(res)
+			sortGovernance(res, opts.governanceKinds())
+			var got []string
+			for _, r := range res {
+				got = append(got, r.GetKind())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected order %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSynk_applyAllBlocksNamespaceOnGovernanceFailure(t *testing.T) {
+	f := newFixture(t)
+	s := f.newSynk()
+	f.fake.PrependReactor("create", "resourcequotas", func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewForbidden(schema.GroupResource{Resource: "resourcequotas"}, "quota1", nil)
+	})
+	set := &apps.ResourceSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test.v1", UID: "uid"},
+	}
+	resources := []*unstructured.Unstructured{
+		newUnstructured("v1", "ResourceQuota", "ns1", "quota1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns2", "cm2"),
+	}
+	opts := newApplyOptions("test", nil)
+	sortGovernance(resources, opts.governanceKinds())
+
+	results, err := s.applyAll(context.Background(), set, opts, resources...)
+	if err == nil {
+		t.Fatal("applyAll() succeeded unexpectedly")
+	}
+	failed := map[string]bool{}
+	for _, r := range results.list() {
+		failed[r.resource.GetName()] = r.err != nil
+	}
+	if want := map[string]bool{"quota1": true, "cm1": true, "cm2": false}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("expected failures %v, got %v", want, failed)
+	}
+	for _, a := range f.fake.Actions() {
+		if c, ok := a.(k8stest.CreateAction); ok && c.GetNamespace() == "ns1" && a.GetResource().Resource == "configmaps" {
+			t.Errorf("expected no ConfigMap to be created in ns1, got %v", a)
+		}
+	}
+}
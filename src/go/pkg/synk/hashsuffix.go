@@ -0,0 +1,177 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// podSpecPaths are the locations of pod specs in the workload kinds.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// hashSuffixRenames holds the new names of renamed ConfigMaps and Secrets by
+// kind, namespace and old name.
+type hashSuffixRenames map[string]map[string]map[string]string
+
+func (r hashSuffixRenames) set(kind, namespace, from, to string) {
+	if r[kind] == nil {
+		r[kind] = map[string]map[string]string{}
+	}
+	if r[kind][namespace] == nil {
+		r[kind][namespace] = map[string]string{}
+	}
+	r[kind][namespace][from] = to
+}
+
+func (r hashSuffixRenames) get(kind, namespace, name string) (string, bool) {
+	to, ok := r[kind][namespace][name]
+	return to, ok
+}
+
+// applyHashSuffixes appends a hash of the content to the names of all
+// resources of the given kinds. References to renamed ConfigMaps and Secrets
+// are rewritten in the pod specs of workloads in the same namespace. These are
+// the references from env, envFrom, volumes and projected volumes. Other
+// references, eg from custom resources, are not rewritten.
+func applyHashSuffixes(resources []*unstructured.Unstructured, kinds []schema.GroupVersionKind) error {
+	if len(kinds) == 0 {
+		return nil
+	}
+	isHashed := map[schema.GroupVersionKind]bool{}
+	for _, k := range kinds {
+		isHashed[k] = true
+	}
+	renames := hashSuffixRenames{}
+	for _, r := range resources {
+		gvk := r.GroupVersionKind()
+		if !isHashed[gvk] {
+			continue
+		}
+		h, err := contentHash(r)
+		if err != nil {
+			return err
+		}
+		name := r.GetName() + "-" + h
+		if gvk.Group == "" {
+			renames.set(gvk.Kind, r.GetNamespace(), r.GetName(), name)
+		}
+		r.SetName(name)
+	}
+	for _, r := range resources {
+		path, ok := podSpecPaths[r.GetKind()]
+		if !ok {
+			continue
+		}
+		spec, ok, err := unstructured.NestedMap(r.Object, path...)
+		if err != nil || !ok {
+			continue
+		}
+		rewritePodSpecRefs(spec, r.GetNamespace(), renames)
+		if err := unstructured.SetNestedMap(r.Object, spec, path...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentHash returns a short hash over all fields except metadata.
+func contentHash(r *unstructured.Unstructured) (string, error) {
+	content := map[string]interface{}{}
+	for k, v := range r.Object {
+		if k != "metadata" {
+			content[k] = v
+		}
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:10], nil
+}
+
+func rewritePodSpecRefs(spec map[string]interface{}, namespace string, renames hashSuffixRenames) {
+	rename := func(m map[string]interface{}, kind, field string) {
+		if m == nil {
+			return
+		}
+		if name, ok := m[field].(string); ok {
+			if to, ok := renames.get(kind, namespace, name); ok {
+				m[field] = to
+			}
+		}
+	}
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, c := range nestedMaps(spec, field) {
+			for _, env := range nestedMaps(c, "env") {
+				valueFrom, _ := env["valueFrom"].(map[string]interface{})
+				if valueFrom == nil {
+					continue
+				}
+				rename(asMap(valueFrom["configMapKeyRef"]), "ConfigMap", "name")
+				rename(asMap(valueFrom["secretKeyRef"]), "Secret", "name")
+			}
+			for _, envFrom := range nestedMaps(c, "envFrom") {
+				rename(asMap(envFrom["configMapRef"]), "ConfigMap", "name")
+				rename(asMap(envFrom["secretRef"]), "Secret", "name")
+			}
+		}
+	}
+	for _, v := range nestedMaps(spec, "volumes") {
+		rename(asMap(v["configMap"]), "ConfigMap", "name")
+		rename(asMap(v["secret"]), "Secret", "secretName")
+		projected := asMap(v["projected"])
+		if projected == nil {
+			continue
+		}
+		for _, src := range nestedMaps(projected, "sources") {
+			rename(asMap(src["configMap"]), "ConfigMap", "name")
+			rename(asMap(src["secret"]), "Secret", "name")
+		}
+	}
+}
+
+// nestedMaps returns all elements of the list m[field] that are maps. The
+// returned maps are not copies.
+func nestedMaps(m map[string]interface{}, field string) []map[string]interface{} {
+	l, _ := m[field].([]interface{})
+	var res []map[string]interface{}
+	for _, v := range l {
+		if vm, ok := v.(map[string]interface{}); ok {
+			res = append(res, vm)
+		}
+	}
+	return res
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
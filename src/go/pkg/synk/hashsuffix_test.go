@@ -0,0 +1,149 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newHashSuffixInputs(t *testing.T, data string) (cm, secret, deploy *unstructured.Unstructured) {
+	cm, secret, deploy = &unstructured.Unstructured{}, &unstructured.Unstructured{}, &unstructured.Unstructured{}
+	unmarshalYAML(t, cm, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: ns1
+  name: config
+data:
+  foo: `+data)
+	unmarshalYAML(t, secret, `
+apiVersion: v1
+kind: Secret
+metadata:
+  namespace: ns1
+  name: creds
+data:
+  password: c2VjcmV0`)
+	unmarshalYAML(t, deploy, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: ns1
+  name: dp1
+spec:
+  template:
+    spec:
+      containers:
+      - name: c1
+        env:
+        - name: FOO
+          valueFrom:
+            configMapKeyRef:
+              name: config
+              key: foo
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: creds
+              key: password
+        envFrom:
+        - configMapRef:
+            name: config
+        - configMapRef:
+            name: other
+      volumes:
+      - name: v1
+        configMap:
+          name: config
+      - name: v2
+        secret:
+          secretName: creds
+      - name: v3
+        projected:
+          sources:
+          - configMap:
+              name: config`)
+	return cm, secret, deploy
+}
+
+var hashSuffixKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "Secret"},
+}
+
+func TestApplyHashSuffixes(t *testing.T) {
+	cm, secret, deploy := newHashSuffixInputs(t, "bar")
+	if err := applyHashSuffixes([]*unstructured.Unstructured{cm, secret, deploy}, hashSuffixKinds); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(cm.GetName(), "config-") || len(cm.GetName()) != len("config-")+10 {
+		t.Errorf("expected hash-suffixed ConfigMap name, got %q", cm.GetName())
+	}
+	if !strings.HasPrefix(secret.GetName(), "creds-") {
+		t.Errorf("expected hash-suffixed Secret name, got %q", secret.GetName())
+	}
+	if deploy.GetName() != "dp1" {
+		t.Errorf("unexpected rename of Deployment to %q", deploy.GetName())
+	}
+
+	spec := []string{"spec", "template", "spec"}
+	containers, _, _ := unstructured.NestedSlice(deploy.Object, append(spec, "containers")...)
+	c := containers[0].(map[string]interface{})
+	env := c["env"].([]interface{})
+	wantRefs := []struct {
+		got  interface{}
+		want string
+	}{
+		{env[0].(map[string]interface{})["valueFrom"].(map[string]interface{})["configMapKeyRef"].(map[string]interface{})["name"], cm.GetName()},
+		{env[1].(map[string]interface{})["valueFrom"].(map[string]interface{})["secretKeyRef"].(map[string]interface{})["name"], secret.GetName()},
+		{c["envFrom"].([]interface{})[0].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"], cm.GetName()},
+		{c["envFrom"].([]interface{})[1].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"], "other"},
+	}
+	volumes, _, _ := unstructured.NestedSlice(deploy.Object, append(spec, "volumes")...)
+	wantRefs = append(wantRefs, []struct {
+		got  interface{}
+		want string
+	}{
+		{volumes[0].(map[string]interface{})["configMap"].(map[string]interface{})["name"], cm.GetName()},
+		{volumes[1].(map[string]interface{})["secret"].(map[string]interface{})["secretName"], secret.GetName()},
+		{volumes[2].(map[string]interface{})["projected"].(map[string]interface{})["sources"].([]interface{})[0].(map[string]interface{})["configMap"].(map[string]interface{})["name"], cm.GetName()},
+	}...)
+	for i, ref := range wantRefs {
+		if ref.got != ref.want {
+			t.Errorf("reference %d: expected %q, got %q", i, ref.want, ref.got)
+		}
+	}
+}
+
+func TestApplyHashSuffixes_changesWithContent(t *testing.T) {
+	cm1, _, _ := newHashSuffixInputs(t, "bar")
+	cm2, _, _ := newHashSuffixInputs(t, "bar")
+	cm3, _, _ := newHashSuffixInputs(t, "baz")
+	for _, cm := range []*unstructured.Unstructured{cm1, cm2, cm3} {
+		if err := applyHashSuffixes([]*unstructured.Unstructured{cm}, hashSuffixKinds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cm1.GetName() != cm2.GetName() {
+		t.Errorf("expected identical names for identical content, got %q and %q", cm1.GetName(), cm2.GetName())
+	}
+	if cm1.GetName() == cm3.GetName() {
+		t.Errorf("expected different names for different content, got %q", cm1.GetName())
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Health is the verdict of Status for a ResourceSet or one of its resources.
+type Health string
+
+const (
+	// HealthHealthy is used if the resources exist, match the applied
+	// manifests and are ready.
+	HealthHealthy Health = "Healthy"
+	// HealthDegraded is used if resources failed to apply, drifted from the
+	// applied manifests, aren't ready or aren't owned by the set.
+	HealthDegraded Health = "Degraded"
+	// HealthMissing is used if the ResourceSet or resources don't exist.
+	HealthMissing Health = "Missing"
+)
+
+// SetHealth describes the health of the latest version of a ResourceSet.
+type SetHealth struct {
+	// ResourceSet is the name of the latest version. It is empty if the
+	// ResourceSet doesn't exist.
+	ResourceSet string
+	// Health is Missing if any resource is missing, otherwise Degraded if
+	// any resource is degraded or the set isn't Settled.
+	Health Health
+	// Message explains the verdict for the set as a whole.
+	Message   string
+	Resources []ResourceHealth
+}
+
+// ResourceHealth describes the health of a single resource of the set.
+type ResourceHealth struct {
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Health    Health
+	// Drifted are the paths of the fields whose live value differs from the
+	// last applied manifest.
+	Drifted []string
+	// Message explains why the resource isn't healthy.
+	Message string
+}
+
+// Status checks whether the latest version of the ResourceSet specified by
+// 'name' is fully reconciled, eg for a liveness probe of the set: all of its
+// resources must exist, be owned by it, match the manifests they were last
+// applied with and be ready. Readiness is judged like with
+// ApplyOptions.WaitForReady. Since the manifests aren't stored in the
+// ResourceSet, drift is detected with the last-applied annotation, so
+// resources without it are only checked for existence and readiness.
+// Resources that were skipped by the last apply are considered healthy.
+// Status only reads from the cluster.
+func (s *Synk) Status(ctx context.Context, name string) (SetHealth, error) {
+	rs, err := s.latest(ctx, name)
+	if err != nil {
+		return SetHealth{}, errors.Wrap(err, "get latest ResourceSet")
+	}
+	if rs == nil {
+		return SetHealth{Health: HealthMissing, Message: fmt.Sprintf("ResourceSet %q not found", name)}, nil
+	}
+	h := SetHealth{ResourceSet: rs.Name, Health: HealthHealthy}
+	if rs.Status.Phase != apps.ResourceSetPhaseSettled {
+		h.Health = HealthDegraded
+		h.Message = fmt.Sprintf("phase is %s", rs.Status.Phase)
+	}
+	applied := appliedStatuses(&rs.Status)
+	failed := appliedStatuses(&apps.ResourceSetStatus{Applied: rs.Status.Failed})
+	for _, g := range rs.Spec.Resources {
+		gvk := schema.GroupVersionKind{Group: g.Group, Version: g.Version, Kind: g.Kind}
+		for _, ref := range g.Items {
+			key := fmt.Sprintf("%s/%s/%s", gvkKey(g.Group, g.Version, g.Kind), ref.Namespace, ref.Name)
+			r := ResourceHealth{GroupVersionKind: gvk, Namespace: ref.Namespace, Name: ref.Name, Health: HealthHealthy}
+			if st, ok := failed[key]; ok {
+				r.Health, r.Message = HealthDegraded, "failed to apply: "+st.Error
+			} else if st, ok := applied[key]; ok && st.Action == apps.ResourceActionSkip {
+				h.Resources = append(h.Resources, r)
+				continue
+			}
+			if err := s.checkResourceHealth(ctx, rs, prunedResource{gvk: gvk, ref: ref}, &r); err != nil {
+				return h, errors.Wrapf(err, "check %s %s/%s", gvk.Kind, ref.Namespace, ref.Name)
+			}
+			switch {
+			case r.Health == HealthMissing:
+				h.Health = HealthMissing
+			case r.Health == HealthDegraded && h.Health == HealthHealthy:
+				h.Health = HealthDegraded
+			}
+			h.Resources = append(h.Resources, r)
+		}
+	}
+	return h, nil
+}
+
+// checkResourceHealth reads the resource and updates its health. Failures to
+// apply take precedence over drift and readiness.
+func (s *Synk) checkResourceHealth(ctx context.Context, rs *apps.ResourceSet, pr prunedResource, r *ResourceHealth) error {
+	client, err := s.prunedClient(pr)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		r.Health, r.Message = HealthMissing, "resource type is not served"
+		return nil
+	}
+	live, err := client.Get(ctx, pr.ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		r.Health, r.Message = HealthMissing, "not found"
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if r.Health != HealthHealthy {
+		return nil
+	}
+	var problems []string
+	if !isCustomResourceDefinition(live) && !ownedBy(live, rs) {
+		problems = append(problems, fmt.Sprintf("not owned by %s", rs.Name))
+	}
+	if raw := getAppliedAnnotation(live); len(raw) > 0 {
+		var lastApplied unstructured.Unstructured
+		if err := lastApplied.UnmarshalJSON(raw); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid last-applied annotation: %s", err))
+		} else if r.Drifted = changedFields(live.Object, lastApplied.Object, "", false); len(r.Drifted) > 0 {
+			problems = append(problems, fmt.Sprintf("drifted: %s", strings.Join(r.Drifted, ", ")))
+		}
+	}
+	if !resourceReady(live) {
+		problems = append(problems, "not ready")
+	}
+	if len(problems) > 0 {
+		r.Health, r.Message = HealthDegraded, strings.Join(problems, "; ")
+	}
+	return nil
+}
+
+// ownedBy returns true if the resource has an owner reference to the set.
+func ownedBy(r *unstructured.Unstructured, rs *apps.ResourceSet) bool {
+	group := resourceSetGVK(rs).Group
+	for _, or := range r.GetOwnerReferences() {
+		if isResourceSetRef(or, group) && or.Name == rs.Name {
+			return true
+		}
+	}
+	return false
+}
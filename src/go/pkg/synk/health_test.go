@@ -0,0 +1,118 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSynk_Status(t *testing.T) {
+	tests := []struct {
+		desc string
+		// change modifies the cluster after the apply.
+		change      func(t *testing.T, s *Synk)
+		deployment  bool
+		want        Health
+		wantDrifted []string
+		wantMessage string
+	}{
+		{
+			desc: "healthy",
+			want: HealthHealthy,
+		},
+		{
+			desc: "drifted",
+			change: func(t *testing.T, s *Synk) {
+				client := s.client.Resource(gvrs["configmaps"]).Namespace("ns1")
+				cm, err := client.Get(context.Background(), "cm1", metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				unstructured.SetNestedField(cm.Object, "changed", "data", "foo")
+				if _, err := client.Update(context.Background(), cm, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:        HealthDegraded,
+			wantDrifted: []string{"data.foo"},
+			wantMessage: "drifted: data.foo",
+		},
+		{
+			desc: "missing",
+			change: func(t *testing.T, s *Synk) {
+				if err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Delete(context.Background(), "cm1", metav1.DeleteOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:        HealthMissing,
+			wantMessage: "not found",
+		},
+		{
+			desc:        "not ready",
+			deployment:  true,
+			want:        HealthDegraded,
+			wantMessage: "not ready",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFixture(t).newSynk()
+			var r *unstructured.Unstructured
+			if tc.deployment {
+				r = newUnstructured("apps/v1", "Deployment", "ns1", "app")
+			} else {
+				r = newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+				unstructured.SetNestedField(r.Object, "bar", "data", "foo")
+			}
+			if _, err := s.Apply(ctx, "test", nil, r); err != nil {
+				t.Fatal(err)
+			}
+			if tc.change != nil {
+				tc.change(t, s)
+			}
+			h, err := s.Status(ctx, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Health != tc.want || h.ResourceSet != "test.v1" {
+				t.Errorf("expected %s for test.v1, got %s for %q", tc.want, h.Health, h.ResourceSet)
+			}
+			if len(h.Resources) != 1 {
+				t.Fatalf("expected one resource, got %v", h.Resources)
+			}
+			got := h.Resources[0]
+			if got.Health != tc.want || got.Message != tc.wantMessage || !reflect.DeepEqual(got.Drifted, tc.wantDrifted) {
+				t.Errorf("expected resource %s (%q, drifted %v), got %+v", tc.want, tc.wantMessage, tc.wantDrifted, got)
+			}
+		})
+	}
+}
+
+func TestSynk_StatusMissingSet(t *testing.T) {
+	s := newFixture(t).newSynk()
+	h, err := s.Status(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Health != HealthMissing || h.ResourceSet != "" {
+		t.Errorf("expected missing ResourceSet, got %+v", h)
+	}
+}
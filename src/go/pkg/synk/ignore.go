@@ -0,0 +1,50 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// changedFields returns the paths of the fields of desired whose live value
+// differs, like changedFields, but without the fields that IgnoreFields
+// lists for the resource's kind.
+func (o *ApplyOptions) changedFields(live, desired *unstructured.Unstructured) []string {
+	fields := changedFields(live.Object, desired.Object, "", o.ExactCompare)
+	ignored := o.IgnoreFields[desired.GroupVersionKind()]
+	if len(ignored) == 0 {
+		return fields
+	}
+	var res []string
+	for _, f := range fields {
+		if !isIgnoredField(f, ignored) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// isIgnoredField returns true if the path is one of the ignored paths or a
+// field below one of them.
+func isIgnoredField(path string, ignored []string) bool {
+	for _, p := range ignored {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestIsIgnoredField(t *testing.T) {
+	ignored := []string{"spec.template.spec.containers", "metadata.annotations.sidecar.istio.io/status"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"spec.template.spec.containers", true},
+		{"spec.template.spec.containers.foo", true},
+		{"spec.template.spec.containersX", false},
+		{"metadata.annotations.sidecar.istio.io/status", true},
+		{"metadata.annotations.other", false},
+		{"spec.replicas", false},
+	}
+	for _, tc := range tests {
+		if got := isIgnoredField(tc.path, ignored); got != tc.want {
+			t.Errorf("isIgnoredField(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestSynk_PlanApplyIgnoresFields(t *testing.T) {
+	var deploy appsv1.Deployment
+	unmarshalYAML(t, &deploy, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: ns1
+  name: app
+  annotations:
+    sidecar.istio.io/status: injected
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: test.v1
+    uid: test
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1
+      - name: istio-proxy
+        image: proxy:1`)
+	desiredYAML := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  namespace: ns1
+  name: app
+  annotations:
+    sidecar.istio.io/status: ""
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1`
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	tests := []struct {
+		desc       string
+		ignore     map[schema.GroupVersionKind][]string
+		wantAction apps.ResourceAction
+		wantFields []string
+	}{
+		{
+			desc:       "drift",
+			wantAction: apps.ResourceActionUpdate,
+			wantFields: []string{"metadata.annotations.sidecar.istio.io/status", "spec.template.spec.containers"},
+		},
+		{
+			desc: "ignored",
+			ignore: map[schema.GroupVersionKind][]string{
+				gvk: {"metadata.annotations.sidecar.istio.io/status", "spec.template.spec.containers"},
+			},
+			wantAction: apps.ResourceActionNone,
+		},
+		{
+			desc: "other kind",
+			ignore: map[schema.GroupVersionKind][]string{
+				{Group: "apps", Version: "v1", Kind: "StatefulSet"}: {"spec.template.spec.containers"},
+			},
+			wantAction: apps.ResourceActionUpdate,
+			wantFields: []string{"metadata.annotations.sidecar.istio.io/status", "spec.template.spec.containers"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			f := newFixture(t)
+			f.addObjects(deploy.DeepCopy())
+			s := f.newSynk()
+
+			var desired unstructured.Unstructured
+			unmarshalYAML(t, &desired, desiredYAML)
+			plan, err := s.PlanApply(context.Background(), "test", &ApplyOptions{IgnoreFields: tc.ignore}, &desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := plan.Changes[0]
+			if c.Action != tc.wantAction {
+				t.Errorf("expected action %q, got %q", tc.wantAction, c.Action)
+			}
+			if !reflect.DeepEqual(c.Fields, tc.wantFields) {
+				t.Errorf("expected fields %v, got %v", tc.wantFields, c.Fields)
+			}
+		})
+	}
+}
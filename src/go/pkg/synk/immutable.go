@@ -0,0 +1,75 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"encoding/base64"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ErrImmutableChanged is returned if the content of a ConfigMap or Secret
+// that is marked as immutable changed. Such resources are never replaced,
+// since pods that mount them would lose their volumes.
+var ErrImmutableChanged = errors.New("immutable resource changed")
+
+// checkImmutable returns an error wrapping ErrImmutableChanged if the live
+// resource is an immutable ConfigMap or Secret whose content differs from
+// the desired one, which the apiserver would reject. Changing the metadata is
+// still allowed.
+func checkImmutable(desired, live *unstructured.Unstructured) error {
+	gvk := live.GroupVersionKind()
+	if gvk.Group != "" || gvk.Kind != "ConfigMap" && gvk.Kind != "Secret" {
+		return nil
+	}
+	if immutable, _, _ := unstructured.NestedBool(live.Object, "immutable"); !immutable {
+		return nil
+	}
+	if immutable, _, _ := unstructured.NestedBool(desired.Object, "immutable"); !immutable {
+		return errors.Wrapf(ErrImmutableChanged, "%s %s/%s can't be made mutable again, apply it with a new name instead",
+			gvk.Kind, live.GetNamespace(), live.GetName())
+	}
+	for _, field := range []string{"data", "binaryData"} {
+		d, l := immutableContent(desired, field), immutableContent(live, field)
+		if (len(d) > 0 || len(l) > 0) && !reflect.DeepEqual(d, l) {
+			return errors.Wrapf(ErrImmutableChanged, "%s of %s %s/%s changed, which requires a new name, eg with ApplyOptions.HashSuffixKinds",
+				field, gvk.Kind, live.GetNamespace(), live.GetName())
+		}
+	}
+	return nil
+}
+
+// immutableContent returns the field's map of a ConfigMap or Secret. For
+// Secrets, data includes stringData in its encoded form, as the apiserver
+// stores it.
+func immutableContent(u *unstructured.Unstructured, field string) map[string]interface{} {
+	content, _, _ := unstructured.NestedMap(u.Object, field)
+	if field != "data" || u.GetKind() != "Secret" {
+		return content
+	}
+	stringData, _, _ := unstructured.NestedStringMap(u.Object, "stringData")
+	if len(stringData) == 0 {
+		return content
+	}
+	if content == nil {
+		content = map[string]interface{}{}
+	}
+	for k, v := range stringData {
+		content[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	return content
+}
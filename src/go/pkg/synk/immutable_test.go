@@ -0,0 +1,171 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCheckImmutable(t *testing.T) {
+	tests := []struct {
+		desc    string
+		live    string
+		desired string
+		wantErr bool
+	}{
+		{"mutable", `
+apiVersion: v1
+kind: ConfigMap
+data: {foo: bar}`, `
+apiVersion: v1
+kind: ConfigMap
+data: {foo: baz}`, false},
+		{"unchanged", `
+apiVersion: v1
+kind: ConfigMap
+immutable: true
+data: {foo: bar}`, `
+apiVersion: v1
+kind: ConfigMap
+metadata: {labels: {new: label}}
+immutable: true
+data: {foo: bar}`, false},
+		{"data changed", `
+apiVersion: v1
+kind: ConfigMap
+immutable: true
+data: {foo: bar}`, `
+apiVersion: v1
+kind: ConfigMap
+immutable: true
+data: {foo: baz}`, true},
+		{"binary data added", `
+apiVersion: v1
+kind: ConfigMap
+immutable: true`, `
+apiVersion: v1
+kind: ConfigMap
+immutable: true
+binaryData: {foo: YmFy}`, true},
+		{"made mutable", `
+apiVersion: v1
+kind: ConfigMap
+immutable: true
+data: {foo: bar}`, `
+apiVersion: v1
+kind: ConfigMap
+data: {foo: bar}`, true},
+		{"secret string data unchanged", `
+apiVersion: v1
+kind: Secret
+immutable: true
+data: {foo: YmFy}`, `
+apiVersion: v1
+kind: Secret
+immutable: true
+stringData: {foo: bar}`, false},
+		{"secret string data changed", `
+apiVersion: v1
+kind: Secret
+immutable: true
+data: {foo: YmFy}`, `
+apiVersion: v1
+kind: Secret
+immutable: true
+stringData: {foo: baz}`, true},
+		{"other kind", `
+apiVersion: example.com/v1
+kind: ConfigMap
+immutable: true
+data: {foo: bar}`, `
+apiVersion: example.com/v1
+kind: ConfigMap
+data: {foo: baz}`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			var live, desired unstructured.Unstructured
+			unmarshalYAML(t, &live.Object, tc.live)
+			unmarshalYAML(t, &desired.Object, tc.desired)
+			err := checkImmutable(&desired, &live)
+			if got := errors.Is(err, ErrImmutableChanged); got != tc.wantErr {
+				t.Errorf("expected ErrImmutableChanged: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyImmutableChanged(t *testing.T) {
+	var cm corev1.ConfigMap
+	unmarshalYAML(t, &cm, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: ns1
+  name: config
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: test.v1
+    uid: test
+immutable: true
+data:
+  foo: bar`)
+	f := newFixture(t)
+	f.addObjects(&cm)
+	s := f.newSynk()
+	ctx := context.Background()
+
+	desired := newUnstructured("v1", "ConfigMap", "ns1", "config")
+	unstructured.SetNestedField(desired.Object, true, "immutable")
+	unstructured.SetNestedField(desired.Object, "baz", "data", "foo")
+	// Replacing conflicting resources must not apply to immutable ones.
+	opts := &ApplyOptions{
+		PatchStrategy: PatchStrategyMergeOverLive,
+		OnConflict: func(_, _ *unstructured.Unstructured, _ error) (ConflictResolution, error) {
+			return ConflictForce, nil
+		},
+	}
+	rs, err := s.Apply(ctx, "test", opts, desired)
+	if err == nil {
+		t.Fatal("expected error for changed immutable ConfigMap")
+	}
+	if len(rs.Status.Failed) != 1 || !strings.Contains(rs.Status.Failed[0].Items[0].Error, "HashSuffixKinds") {
+		t.Errorf("expected failure recommending HashSuffixKinds, got %v", rs.Status.Failed)
+	}
+	for _, a := range f.fake.Actions() {
+		if a.GetVerb() == "delete" && a.GetResource().Resource == "configmaps" {
+			t.Errorf("expected ConfigMap not to be deleted, got %v", a)
+		}
+	}
+	live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := unstructured.NestedString(live.Object, "data", "foo"); v != "bar" {
+		t.Errorf("expected live data to be unchanged, got %q", v)
+	}
+	if rs.Status.Phase != apps.ResourceSetPhaseFailed {
+		t.Errorf("expected phase Failed, got %q", rs.Status.Phase)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"log/slog"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/googlecloudrobotics/ilog"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	// minK8sVersionAnnotation makes Synk skip a resource if the cluster runs
+	// an older Kubernetes version, eg "1.25".
+	minK8sVersionAnnotation = "core.cloudrobotics.com/min-k8s-version"
+	// maxK8sVersionAnnotation makes Synk skip a resource if the cluster runs
+	// a newer Kubernetes version. Components that are omitted match any
+	// value, eg "1.24" includes 1.24.5.
+	maxK8sVersionAnnotation = "core.cloudrobotics.com/max-k8s-version"
+)
+
+// serverVersion returns the Kubernetes version of the cluster if any of the
+// resources depends on it. If the version can't be determined, it returns nil
+// and the resources are applied regardless of their version annotations.
+func (s *Synk) serverVersion(resources []*unstructured.Unstructured) *version.Version {
+	needed := false
+	for _, r := range resources {
+		a := r.GetAnnotations()
+		if _, ok := a[minK8sVersionAnnotation]; ok {
+			needed = true
+		} else if _, ok := a[maxK8sVersionAnnotation]; ok {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+	info, err := s.discovery.ServerVersion()
+	if err != nil {
+		slog.Warn("Failed to get server version, ignoring version annotations", ilog.Err(err))
+		return nil
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		slog.Warn("Failed to parse server version, ignoring version annotations",
+			slog.String("Version", info.GitVersion), ilog.Err(err))
+		return nil
+	}
+	return v
+}
+
+// supportsK8sVersion returns false if the resource's version annotations
+// exclude the server version. It always returns true if the server version is
+// unknown.
+func supportsK8sVersion(r *unstructured.Unstructured, server *version.Version) (bool, error) {
+	if server == nil {
+		return true, nil
+	}
+	a := r.GetAnnotations()
+	if v, ok := a[minK8sVersionAnnotation]; ok {
+		min, err := version.ParseGeneric(v)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid value %q for annotation %q", v, minK8sVersionAnnotation)
+		}
+		if !server.AtLeast(min) {
+			return false, nil
+		}
+	}
+	if v, ok := a[maxK8sVersionAnnotation]; ok {
+		max, err := version.ParseGeneric(v)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid value %q for annotation %q", v, maxK8sVersionAnnotation)
+		}
+		s := server
+		if len(max.Components()) == 2 {
+			s = version.MajorMinor(server.Major(), server.Minor())
+		}
+		if max.LessThan(s) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// filterCRDsByK8sVersion records the CRDs whose version annotations exclude
+// the server version as skipped and returns the others. Unlike other
+// resources, skipped CRDs must not be waited for.
+func filterCRDsByK8sVersion(crds []*unstructured.Unstructured, opts *applyOptions, results applyResults) []*unstructured.Unstructured {
+	var res []*unstructured.Unstructured
+	for _, crd := range crds {
+		if ok, err := supportsK8sVersion(crd, opts.serverVersion); err != nil {
+			opts.errorf(crd, apps.ResourceActionNone, "failed to check Kubernetes version: %s", err)
+			results.set(crd, apps.ResourceActionNone, err)
+		} else if !ok {
+			opts.logf(crd, apps.ResourceActionSkip, "skipped since the cluster runs Kubernetes %s", opts.serverVersion)
+			results.set(crd, apps.ResourceActionSkip, nil)
+		} else {
+			res = append(res, crd)
+		}
+	}
+	return res
+}
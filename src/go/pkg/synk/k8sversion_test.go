@@ -0,0 +1,121 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+	k8sversion "k8s.io/apimachinery/pkg/version"
+)
+
+type versionDiscovery struct {
+	fakeCachedDiscoveryClient
+	gitVersion string
+}
+
+func (d *versionDiscovery) ServerVersion() (*k8sversion.Info, error) {
+	return &k8sversion.Info{GitVersion: d.gitVersion}, nil
+}
+
+func withK8sVersions(r *unstructured.Unstructured, min, max string) *unstructured.Unstructured {
+	a := map[string]string{}
+	if min != "" {
+		a[minK8sVersionAnnotation] = min
+	}
+	if max != "" {
+		a[maxK8sVersionAnnotation] = max
+	}
+	r.SetAnnotations(a)
+	return r
+}
+
+func TestSupportsK8sVersion(t *testing.T) {
+	tests := []struct {
+		server   string
+		min, max string
+		want     bool
+		wantErr  bool
+	}{
+		{server: "v1.24.3", want: true},
+		{server: "v1.25.0", min: "1.25", want: true},
+		{server: "v1.24.3", min: "1.25", want: false},
+		{server: "v1.27.3-gke.100", min: "1.25", max: "1.27", want: true},
+		{server: "v1.28.0", max: "1.27", want: false},
+		{server: "v1.27.4", max: "1.27.3", want: false},
+		{server: "v1.24.3", min: "latest", wantErr: true},
+		{server: "v1.24.3", max: "1", wantErr: true},
+	}
+	for _, tc := range tests {
+		r := withK8sVersions(newUnstructured("v1", "ConfigMap", "ns1", "cm1"), tc.min, tc.max)
+		got, err := supportsK8sVersion(r, version.MustParseGeneric(tc.server))
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("server %s, min %q, max %q: expected error %v, got %v", tc.server, tc.min, tc.max, tc.wantErr, err)
+		} else if got != tc.want {
+			t.Errorf("server %s, min %q, max %q: got %v, want %v", tc.server, tc.min, tc.max, got, tc.want)
+		}
+	}
+	if ok, err := supportsK8sVersion(withK8sVersions(newUnstructured("v1", "ConfigMap", "ns1", "cm1"), "1.99", ""), nil); err != nil || !ok {
+		t.Errorf("expected unknown server version to be supported, got %v, %v", ok, err)
+	}
+}
+
+func TestSynk_ApplySkipsResourcesForOtherK8sVersions(t *testing.T) {
+	tests := []struct {
+		desc      string
+		server    string
+		wantSkips int
+	}{
+		{desc: "supported", server: "v1.24.3", wantSkips: 1},
+		{desc: "unparseable server version", server: "unknown", wantSkips: 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFixture(t).newSynk()
+			s.discovery = &versionDiscovery{gitVersion: tc.server}
+
+			rs, err := s.Apply(ctx, "test", nil,
+				withK8sVersions(newUnstructured("v1", "ConfigMap", "ns1", "new"), "1.25", ""),
+				withK8sVersions(newUnstructured("v1", "ConfigMap", "ns1", "old"), "", "1.24"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			skips := 0
+			for _, g := range rs.Status.Applied {
+				for _, item := range g.Items {
+					if item.Action == apps.ResourceActionSkip {
+						skips++
+					}
+				}
+			}
+			if skips != tc.wantSkips {
+				t.Errorf("expected %d skipped resources, got %d", tc.wantSkips, skips)
+			}
+			_, err = s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "new", metav1.GetOptions{})
+			if gotCreated := err == nil; gotCreated != (tc.wantSkips == 0) {
+				t.Errorf("expected ConfigMap new to be created: %v, got error %v", tc.wantSkips == 0, err)
+			}
+			if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "old", metav1.GetOptions{}); err != nil {
+				t.Errorf("expected ConfigMap old to be created: %v", err)
+			}
+		})
+	}
+}
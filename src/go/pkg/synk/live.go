@@ -0,0 +1,133 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/googlecloudrobotics/ilog"
+	"go.opencensus.io/trace"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// liveIndex holds live objects that were listed in bulk, to avoid a Get
+// round-trip per resource. Each object is only served once, subsequent
+// lookups of the same resource must fetch it from the cluster again.
+type liveIndex struct {
+	// Objects by list key and name. Lists that could not be fetched are absent.
+	lists map[string]map[string]*unstructured.Unstructured
+
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func liveListKey(gvr schema.GroupVersionResource, namespace string) string {
+	return gvr.String() + "/" + namespace
+}
+
+// prefetch lists the live objects for all GVR and namespace combinations of
+// the given resources. Lists that fail, eg since they are not permitted by
+// RBAC, are skipped and the respective resources are fetched individually.
+func (s *Synk) prefetch(ctx context.Context, resources []*unstructured.Unstructured) *liveIndex {
+	ctx, span := trace.StartSpan(ctx, "Prefetch live resources")
+	defer span.End()
+
+	idx := &liveIndex{
+		lists: map[string]map[string]*unstructured.Unstructured{},
+		used:  map[string]bool{},
+	}
+	attempted := map[string]bool{}
+	for _, r := range resources {
+		gvk := r.GroupVersionKind()
+		mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			// Surfaced by applyOne.
+			continue
+		}
+		ns := r.GetNamespace()
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			ns = ""
+		}
+		key := liveListKey(mapping.Resource, ns)
+		if attempted[key] {
+			continue
+		}
+		attempted[key] = true
+
+		list, err := s.client.Resource(mapping.Resource).Namespace(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			slog.Info("Prefetching live resources failed, falling back to individual Gets",
+				slog.String("Resource", mapping.Resource.String()),
+				slog.String("Namespace", ns),
+				ilog.Err(err))
+			continue
+		}
+		objs := map[string]*unstructured.Unstructured{}
+		for i := range list.Items {
+			objs[list.Items[i].GetName()] = &list.Items[i]
+		}
+		idx.lists[key] = objs
+	}
+	return idx
+}
+
+// get returns the prefetched live object. ok is false if the object is not
+// known to the index and must be fetched from the cluster. If ok is true and
+// the object is nil, it didn't exist when prefetching.
+func (idx *liveIndex) get(gvr schema.GroupVersionResource, namespace, name string) (obj *unstructured.Unstructured, ok bool) {
+	if idx == nil {
+		return nil, false
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	key := liveListKey(gvr, namespace)
+	objs, ok := idx.lists[key]
+	if !ok || idx.used[key+"/"+name] {
+		return nil, false
+	}
+	idx.used[key+"/"+name] = true
+	return objs[name].DeepCopy(), true
+}
+
+// getLive returns the live state of the resource from the prefetched index if
+// possible or from the cluster otherwise.
+func (s *Synk) getLive(
+	ctx context.Context,
+	client dynamic.ResourceInterface,
+	mapping *meta.RESTMapping,
+	resource *unstructured.Unstructured,
+	opts *applyOptions,
+) (*unstructured.Unstructured, error) {
+	ns := resource.GetNamespace()
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		ns = ""
+	}
+	if obj, ok := opts.live.get(mapping.Resource, ns, resource.GetName()); ok {
+		if obj == nil {
+			return nil, k8serrors.NewNotFound(mapping.Resource.GroupResource(), resource.GetName())
+		}
+		return obj, nil
+	}
+	_, span := trace.StartSpan(ctx, "Get "+resource.GetName())
+	defer span.End()
+	return client.Get(ctx, resource.GetName(), metav1.GetOptions{})
+}
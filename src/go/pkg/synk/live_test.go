@@ -0,0 +1,111 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func countActions(f *fixture, verb, resource string) int {
+	n := 0
+	for _, a := range f.fake.Actions() {
+		if a.GetVerb() == verb && a.GetResource().Resource == resource {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSynk_applyAllPrefetchesLiveResources(t *testing.T) {
+	tests := []struct {
+		desc      string
+		forbidden bool
+		wantLists int
+		wantGets  int
+	}{
+		{desc: "list permitted", wantLists: 1, wantGets: 0},
+		{desc: "list forbidden", forbidden: true, wantLists: 1, wantGets: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			f := newFixture(t)
+			f.addObjects(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo1", Name: "cm1"},
+			})
+			s := f.newSynk()
+			if tc.forbidden {
+				f.fake.PrependReactor("list", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+					return true, nil, k8serrors.NewForbidden(gvrs["configmaps"].GroupResource(), "", errors.New("denied"))
+				})
+			}
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			set.UID = "deadbeef"
+
+			results, err := s.applyAll(context.Background(), set, newApplyOptions("test", &ApplyOptions{PrefetchLive: true}),
+				newUnstructured("v1", "ConfigMap", "foo1", "cm1"),
+				newUnstructured("v1", "ConfigMap", "foo1", "cm2"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results["/v1/ConfigMap/foo1/cm1"].action; got != apps.ResourceActionUpdate {
+				t.Errorf("expected action %q for existing ConfigMap, got %q", apps.ResourceActionUpdate, got)
+			}
+			if got := results["/v1/ConfigMap/foo1/cm2"].action; got != apps.ResourceActionCreate {
+				t.Errorf("expected action %q for new ConfigMap, got %q", apps.ResourceActionCreate, got)
+			}
+			if got := countActions(f, "list", "configmaps"); got != tc.wantLists {
+				t.Errorf("expected %d lists, got %d", tc.wantLists, got)
+			}
+			if got := countActions(f, "get", "configmaps"); got != tc.wantGets {
+				t.Errorf("expected %d gets, got %d", tc.wantGets, got)
+			}
+		})
+	}
+}
+
+func TestLiveIndex_servesObjectsOnce(t *testing.T) {
+	idx := &liveIndex{
+		lists: map[string]map[string]*unstructured.Unstructured{
+			liveListKey(gvrs["configmaps"], "foo1"): {
+				"cm1": newUnstructured("v1", "ConfigMap", "foo1", "cm1"),
+			},
+		},
+		used: map[string]bool{},
+	}
+	if obj, ok := idx.get(gvrs["configmaps"], "foo1", "cm1"); !ok || obj == nil {
+		t.Errorf("expected prefetched object, got %v, %v", obj, ok)
+	}
+	if _, ok := idx.get(gvrs["configmaps"], "foo1", "cm1"); ok {
+		t.Errorf("expected second lookup to miss the index")
+	}
+	if obj, ok := idx.get(gvrs["configmaps"], "foo1", "cm2"); !ok || obj != nil {
+		t.Errorf("expected known absent object, got %v, %v", obj, ok)
+	}
+	if _, ok := idx.get(gvrs["deployments"], "foo1", "dp1"); ok {
+		t.Errorf("expected lookup of unlisted type to miss the index")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// ssaDataServer models how the apiserver server-side applies the data of
+// ConfigMaps: keys that the manager applied before but no longer declares are
+// removed, unless another managedFields entry owns them as well.
+type ssaDataServer struct {
+	dynamic.Interface
+}
+
+func (c *ssaDataServer) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &ssaDataResource{c.Interface.Resource(gvr)}
+}
+
+type ssaDataResource struct {
+	dynamic.NamespaceableResourceInterface
+}
+
+func (r *ssaDataResource) Namespace(ns string) dynamic.ResourceInterface {
+	return &ssaDataNamespacedResource{r.NamespaceableResourceInterface.Namespace(ns)}
+}
+
+type ssaDataNamespacedResource struct {
+	dynamic.ResourceInterface
+}
+
+func (r *ssaDataNamespacedResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if pt != types.ApplyPatchType {
+		return r.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	var obj unstructured.Unstructured
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	applied, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	live, err := r.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		live = &unstructured.Unstructured{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	liveData, _, _ := unstructured.NestedStringMap(live.Object, "data")
+	var prev map[string]bool
+	others := map[string]bool{}
+	var entries []metav1.ManagedFieldsEntry
+	for _, e := range live.GetManagedFields() {
+		if e.Manager == opts.FieldManager && e.Operation == metav1.ManagedFieldsOperationApply {
+			prev = dataKeys(e)
+			continue
+		}
+		for k := range dataKeys(e) {
+			others[k] = true
+		}
+		entries = append(entries, e)
+	}
+	for k := range prev {
+		if _, ok := applied[k]; !ok && !others[k] {
+			delete(liveData, k)
+		}
+	}
+	if liveData == nil {
+		liveData = map[string]string{}
+	}
+	for k, v := range applied {
+		liveData[k] = v
+	}
+	if err := unstructured.SetNestedStringMap(obj.Object, liveData, "data"); err != nil {
+		return nil, err
+	}
+	obj.SetManagedFields(append([]metav1.ManagedFieldsEntry{dataEntry(opts.FieldManager, metav1.ManagedFieldsOperationApply, applied)}, entries...))
+	if live.GetName() == "" {
+		return r.Create(ctx, &obj, metav1.CreateOptions{})
+	}
+	obj.SetResourceVersion(live.GetResourceVersion())
+	return r.Update(ctx, &obj, metav1.UpdateOptions{})
+}
+
+// dataEntry returns a managedFields entry that owns the given data keys.
+func dataEntry(manager string, op metav1.ManagedFieldsOperationType, data map[string]string) metav1.ManagedFieldsEntry {
+	keys := map[string]interface{}{}
+	for k := range data {
+		keys["f:"+k] = map[string]interface{}{}
+	}
+	raw, _ := json.Marshal(map[string]interface{}{"f:data": keys})
+	return metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  op,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: raw},
+	}
+}
+
+// dataKeys returns the data keys that the entry owns.
+func dataKeys(e metav1.ManagedFieldsEntry) map[string]bool {
+	if e.FieldsV1 == nil {
+		return nil
+	}
+	var set struct {
+		Data map[string]interface{} `json:"f:data"`
+	}
+	if err := json.Unmarshal(e.FieldsV1.Raw, &set); err != nil {
+		return nil
+	}
+	keys := map[string]bool{}
+	for k := range set.Data {
+		keys[strings.TrimPrefix(k, "f:")] = true
+	}
+	return keys
+}
+
+func TestSynk_ApplyServerSideApplyRemovesDroppedFields(t *testing.T) {
+	tests := []struct {
+		desc string
+		// clientSide applies the first version with a client-side update.
+		clientSide bool
+		upgrade    bool
+		want       []string
+	}{
+		{"server-side applies", false, false, []string{"a"}},
+		{"after client-side update", true, false, []string{"a", "b"}},
+		{"after client-side update with upgrade", true, true, []string{"a"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			s.client = &ssaDataServer{Interface: s.client}
+
+			cm := func(data map[string]string) *unstructured.Unstructured {
+				u := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+				unstructured.SetNestedStringMap(u.Object, data, "data")
+				return u
+			}
+			first := cm(map[string]string{"a": "1", "b": "2"})
+			if tc.clientSide {
+				// The update entry of an earlier apply with another patch
+				// strategy.
+				first.SetManagedFields([]metav1.ManagedFieldsEntry{
+					dataEntry(fieldManager, metav1.ManagedFieldsOperationUpdate, map[string]string{"a": "1", "b": "2"}),
+				})
+				if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Create(ctx, first, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := &ApplyOptions{PatchStrategy: PatchStrategyServerSideApply, UpgradeManagedFields: tc.upgrade}
+			for _, r := range []*unstructured.Unstructured{first, cm(map[string]string{"a": "1"})} {
+				if _, err := s.Apply(ctx, "test", opts, r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _, _ := unstructured.NestedStringMap(live.Object, "data")
+			var got []string
+			for k := range data {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected data keys %v, got %v", tc.want, got)
+			}
+			if tc.upgrade {
+				for _, e := range live.GetManagedFields() {
+					if e.Manager == fieldManager && e.Operation != metav1.ManagedFieldsOperationApply {
+						t.Errorf("expected update entries to be merged into the apply entry, got %+v", e)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// mergeOverLive returns a copy of live with all fields of desired merged
+// over it. Maps are merged recursively. Lists whose elements are all maps
+// with a "name" key (eg containers, ports or volumes) are merged by name,
+// keeping the order of desired and dropping elements that only exist in live.
+// All other values of desired replace the live ones.
+func mergeOverLive(live, desired map[string]interface{}) map[string]interface{} {
+	out := runtime.DeepCopyJSON(live)
+	for k, v := range desired {
+		out[k] = mergeValue(out[k], runtime.DeepCopyJSONValue(v))
+	}
+	return out
+}
+
+func mergeValue(live, desired interface{}) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return d
+		}
+		for k, v := range d {
+			l[k] = mergeValue(l[k], v)
+		}
+		return l
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return d
+		}
+		liveByName, ok := indexByName(l)
+		if !ok {
+			return d
+		}
+		if _, ok := indexByName(d); !ok {
+			return d
+		}
+		for i, v := range d {
+			name := v.(map[string]interface{})["name"].(string)
+			if lv, ok := liveByName[name]; ok {
+				d[i] = mergeValue(lv, v)
+			}
+		}
+		return d
+	default:
+		return d
+	}
+}
+
+// indexByName returns the elements of the list by their "name" key. It
+// returns false if any element is not a map with a string "name".
+func indexByName(l []interface{}) (map[string]interface{}, bool) {
+	res := map[string]interface{}{}
+	for _, v := range l {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		res[name] = m
+	}
+	return res, true
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMergeOverLive(t *testing.T) {
+	var live, desired, want unstructured.Unstructured
+	unmarshalYAML(t, &live, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc1
+  resourceVersion: "3"
+  labels:
+    foo: bar
+spec:
+  sessionAffinity: None
+  type: ClusterIP
+  ports:
+  - name: http
+    port: 80
+    protocol: TCP
+  - name: https
+    port: 443
+    protocol: TCP`)
+	unmarshalYAML(t, &desired, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc1
+  labels:
+    baz: qux
+spec:
+  ports:
+  - name: http
+    port: 8080
+  selector:
+    app: foo`)
+	unmarshalYAML(t, &want, `
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc1
+  resourceVersion: "3"
+  labels:
+    foo: bar
+    baz: qux
+spec:
+  sessionAffinity: None
+  type: ClusterIP
+  ports:
+  - name: http
+    port: 8080
+    protocol: TCP
+  selector:
+    app: foo`)
+
+	got := mergeOverLive(live.Object, desired.Object)
+	if !reflect.DeepEqual(got, want.Object) {
+		t.Errorf("expected\n%v\nbut got\n%v", want.Object, got)
+	}
+	if _, ok, _ := unstructured.NestedString(live.Object, "spec", "selector", "app"); ok {
+		t.Errorf("live object was modified")
+	}
+}
+
+func TestSynk_applyAllMergesOverLive(t *testing.T) {
+	var svcBefore corev1.Service
+	unmarshalYAML(t, &svcBefore, `
+apiVersion: v1
+kind: Service
+metadata:
+  namespace: foo1
+  name: svc1
+spec:
+  sessionAffinity: ClientIP
+  ports:
+  - name: http
+    port: 80`)
+	f := newFixture(t)
+	f.addObjects(&svcBefore)
+	s := f.newSynk()
+
+	svc := newUnstructured("v1", "Service", "foo1", "svc1")
+	unstructured.SetNestedField(svc.Object, "ClusterIP", "spec", "type")
+
+	set := &apps.ResourceSet{}
+	set.Name = "test.v1"
+	set.UID = "deadbeef"
+
+	opts := newApplyOptions("test", &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive})
+	if _, err := s.applyAll(context.Background(), set, opts, svc); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.client.Resource(gvrs["services"]).Namespace("foo1").Get(context.Background(), "svc1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := unstructured.NestedString(got.Object, "spec", "sessionAffinity"); v != "ClientIP" {
+		t.Errorf("expected live sessionAffinity %q to be kept, got %q", "ClientIP", v)
+	}
+	if v, _, _ := unstructured.NestedString(got.Object, "spec", "type"); v != "ClusterIP" {
+		t.Errorf("expected desired type %q, got %q", "ClusterIP", v)
+	}
+	if refs := got.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "test.v1" {
+		t.Errorf("expected owner reference to test.v1, got %v", refs)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Metric is a gauge sample that describes the state of a ResourceSet.
+type Metric struct {
+	// Name is one of the names in MetricHelp.
+	Name string
+	// Labels always include "name", the name of the set.
+	Labels map[string]string
+	Value  float64
+}
+
+// MetricHelp describes the metrics returned by CollectMetrics by name.
+var MetricHelp = map[string]string{
+	"synk_resourceset_current_version":            "Version of the ResourceSet that was applied last successfully, or the latest version if none was.",
+	"synk_resourceset_latest_version":             "Latest version of the ResourceSet.",
+	"synk_resourceset_phase":                      "Phase of the latest version of the ResourceSet, 1 for the current phase and 0 for the others.",
+	"synk_resourceset_started_timestamp_seconds":  "Time at which the apply of the latest version started.",
+	"synk_resourceset_finished_timestamp_seconds": "Time at which the apply of the latest version finished, 0 while it is Pending.",
+	"synk_resourceset_resources":                  "Resources of the latest version of the ResourceSet by state, which is applied, failed or pruned.",
+}
+
+var metricPhases = []apps.ResourceSetPhase{
+	apps.ResourceSetPhasePending,
+	apps.ResourceSetPhaseSettled,
+	apps.ResourceSetPhaseDegraded,
+	apps.ResourceSetPhaseFailed,
+}
+
+// CollectMetrics returns gauges for the state of each ResourceSet, ordered by
+// set name, eg to serve them to Prometheus with WriteMetrics without running
+// a reconciler. The phase, timestamps and resource counts are those of the
+// latest version, which may not be the current one if its apply failed.
+// ResourceSets are listed once per call.
+func (s *Synk) CollectMetrics(ctx context.Context) ([]Metric, error) {
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(resourceSetErr(err), "list ResourceSets")
+	}
+	type versions struct {
+		latest, current int32
+		rs              *apps.ResourceSet
+	}
+	sets := map[string]*versions{}
+	for i := range list.Items {
+		n, v, ok := decodeResourceSetName(list.Items[i].GetName())
+		if !ok {
+			continue
+		}
+		vs := sets[n]
+		if vs == nil {
+			vs = &versions{}
+			sets[n] = vs
+		}
+		if list.Items[i].GetLabels()[currentLabel] == "true" && v > vs.current {
+			vs.current = v
+		}
+		if v < vs.latest {
+			continue
+		}
+		vs.latest = v
+		vs.rs = &apps.ResourceSet{}
+		if err := convert(&list.Items[i], vs.rs); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(sets))
+	for n := range sets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var metrics []Metric
+	for _, n := range names {
+		vs := sets[n]
+		gauge := func(name string, value float64, labels ...string) {
+			m := Metric{Name: name, Labels: map[string]string{"name": n}, Value: value}
+			for i := 0; i+1 < len(labels); i += 2 {
+				m.Labels[labels[i]] = labels[i+1]
+			}
+			metrics = append(metrics, m)
+		}
+		current := vs.current
+		if current == 0 {
+			current = vs.latest
+		}
+		gauge("synk_resourceset_current_version", float64(current))
+		gauge("synk_resourceset_latest_version", float64(vs.latest))
+		st := &vs.rs.Status
+		for _, p := range metricPhases {
+			value := 0.0
+			if st.Phase == p {
+				value = 1
+			}
+			gauge("synk_resourceset_phase", value, "phase", string(p))
+		}
+		gauge("synk_resourceset_started_timestamp_seconds", timestampSeconds(st.StartedAt))
+		gauge("synk_resourceset_finished_timestamp_seconds", timestampSeconds(st.FinishedAt))
+		gauge("synk_resourceset_resources", float64(countItems(st.Applied)), "state", "applied")
+		gauge("synk_resourceset_resources", float64(countItems(st.Failed)), "state", "failed")
+		gauge("synk_resourceset_resources", float64(countItems(st.Pruned)), "state", "pruned")
+	}
+	return metrics, nil
+}
+
+func timestampSeconds(t metav1.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixMilli()) / 1000
+}
+
+func countItems(groups []apps.ResourceSetStatusGroup) int {
+	n := 0
+	for _, g := range groups {
+		n += len(g.Items)
+	}
+	return n
+}
+
+// labelEscaper escapes label values for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes the metrics in the Prometheus text format, which
+// OpenMetrics scrapers accept as well. Samples are grouped by metric name in
+// the order in which the names first occur.
+func WriteMetrics(w io.Writer, metrics []Metric) error {
+	byName := map[string][]Metric{}
+	var names []string
+	for _, m := range metrics {
+		if _, ok := byName[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		byName[m.Name] = append(byName[m.Name], m)
+	}
+	var b strings.Builder
+	for _, name := range names {
+		if help, ok := MetricHelp[name]; ok {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, m := range byName[name] {
+			b.WriteString(name)
+			if len(m.Labels) > 0 {
+				keys := make([]string, 0, len(m.Labels))
+				for k := range m.Labels {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for i, k := range keys {
+					sep := ","
+					if i == 0 {
+						sep = "{"
+					}
+					fmt.Fprintf(&b, "%s%s=\"%s\"", sep, k, labelEscaper.Replace(m.Labels[k]))
+				}
+				b.WriteString("}")
+			}
+			fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(m.Value, 'g', -1, 64))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSynk_CollectMetrics(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	cm1 := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	cm2 := newUnstructured("v1", "ConfigMap", "ns1", "cm2")
+	if _, err := s.Apply(ctx, "test", nil, cm1, cm2); err != nil {
+		t.Fatal(err)
+	}
+	// The new version prunes both ConfigMaps.
+	if _, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm3")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Apply(ctx, "other", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm4")); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := s.CollectMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, m := range metrics {
+		got[m.Labels["name"]+" "+m.Name+" "+m.Labels["phase"]+m.Labels["state"]] = m.Value
+	}
+	want := map[string]float64{
+		"test synk_resourceset_current_version ":   2,
+		"test synk_resourceset_latest_version ":    2,
+		"test synk_resourceset_phase Pending":      0,
+		"test synk_resourceset_phase Settled":      1,
+		"test synk_resourceset_phase Degraded":     0,
+		"test synk_resourceset_phase Failed":       0,
+		"test synk_resourceset_resources applied":  1,
+		"test synk_resourceset_resources failed":   0,
+		"test synk_resourceset_resources pruned":   2,
+		"other synk_resourceset_current_version ":  1,
+		"other synk_resourceset_latest_version ":   1,
+		"other synk_resourceset_phase Settled":     1,
+		"other synk_resourceset_resources applied": 1,
+		"other synk_resourceset_resources pruned":  0,
+	}
+	for k, v := range want {
+		if g, ok := got[k]; !ok || g != v {
+			t.Errorf("expected %s = %v, got %v (present: %t)", k, v, g, ok)
+		}
+	}
+	if got["test synk_resourceset_finished_timestamp_seconds "] == 0 {
+		t.Errorf("expected finished timestamp for settled set")
+	}
+	if metrics[0].Labels["name"] != "other" {
+		t.Errorf("expected metrics ordered by set name, got %q first", metrics[0].Labels["name"])
+	}
+
+	var b strings.Builder
+	if err := WriteMetrics(&b, metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE synk_resourceset_latest_version gauge\n",
+		"synk_resourceset_latest_version{name=\"other\"} 1\nsynk_resourceset_latest_version{name=\"test\"} 2\n",
+		"synk_resourceset_phase{name=\"test\",phase=\"Settled\"} 1\n",
+		"synk_resourceset_resources{name=\"test\",state=\"pruned\"} 2\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, b.String())
+		}
+	}
+	if n := strings.Count(b.String(), "# TYPE synk_resourceset_phase gauge"); n != 1 {
+		t.Errorf("expected one TYPE line per metric, got %d for synk_resourceset_phase", n)
+	}
+}
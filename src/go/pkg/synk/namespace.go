@@ -0,0 +1,114 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const defaultNamespaceTimeout = 5 * time.Minute
+
+// namespaceWaitInterval is a variable to allow shorter intervals in tests.
+var namespaceWaitInterval = 2 * time.Second
+
+var namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// NamespaceTerminatingError is returned for resources whose namespace is
+// being deleted, since the apiserver rejects new resources in it.
+// ApplyOptions.WaitForNamespace waits for the deletion instead.
+type NamespaceTerminatingError struct {
+	Namespace string
+	Err       error
+}
+
+func (e *NamespaceTerminatingError) Error() string {
+	return fmt.Sprintf("namespace %q is terminating: %s", e.Namespace, e.Err)
+}
+
+func (e *NamespaceTerminatingError) Unwrap() error {
+	return e.Err
+}
+
+// isTerminatingNamespace returns true if the resource is a Namespace that is
+// being deleted.
+func isTerminatingNamespace(u *unstructured.Unstructured) bool {
+	if u.GetAPIVersion() != "v1" || u.GetKind() != "Namespace" {
+		return false
+	}
+	phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+	return phase == "Terminating" || u.GetDeletionTimestamp() != nil
+}
+
+// createErr wraps the error of a failed create. If the resource's namespace
+// is terminating, it returns a NamespaceTerminatingError or, with
+// WaitForNamespace, waits for the namespace to be deleted and retries.
+func (s *Synk) createErr(ctx context.Context, r *unstructured.Unstructured, mapping *meta.RESTMapping, opts *applyOptions, err error, msg string) error {
+	wrapped := errors.Wrap(err, msg)
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace || !k8serrors.IsForbidden(err) && !k8serrors.IsConflict(err) {
+		return wrapped
+	}
+	ns, nerr := s.client.Resource(namespaceGVR).Get(ctx, r.GetNamespace(), metav1.GetOptions{})
+	if nerr != nil || !isTerminatingNamespace(ns) {
+		return wrapped
+	}
+	if !opts.WaitForNamespace {
+		return &NamespaceTerminatingError{Namespace: ns.GetName(), Err: err}
+	}
+	opts.logf(r, apps.ResourceActionCreate, "namespace %s is terminating, waiting for its deletion", ns.GetName())
+	if err := s.waitForNamespaceDeletion(ctx, ns.GetName(), opts); err != nil {
+		return err
+	}
+	// The retry fails if the set doesn't create the namespace again.
+	return retryConflictErr{wrapped}
+}
+
+// waitForNamespaceDeletion waits until the namespace doesn't exist anymore or
+// was created again.
+func (s *Synk) waitForNamespaceDeletion(ctx context.Context, name string, opts *applyOptions) error {
+	if !opts.WaitForNamespace {
+		return &NamespaceTerminatingError{Namespace: name, Err: errors.New("namespace is being deleted")}
+	}
+	timeout := opts.NamespaceTimeout
+	if timeout <= 0 {
+		timeout = defaultNamespaceTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ns, err := s.client.Resource(namespaceGVR).Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) || err == nil && !isTerminatingNamespace(ns) {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "get namespace %s", name)
+		}
+		if time.Now().After(deadline) {
+			return &NamespaceTerminatingError{Namespace: name, Err: errors.Errorf("not deleted after %s", timeout)}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(namespaceWaitInterval):
+		}
+	}
+}
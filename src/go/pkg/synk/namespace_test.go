@@ -0,0 +1,122 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func terminatingNamespace(t *testing.T) *corev1.Namespace {
+	var ns corev1.Namespace
+	unmarshalYAML(t, &ns, `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns1
+  deletionTimestamp: "2024-01-01T00:00:00Z"
+  finalizers: [test]
+status:
+  phase: Terminating`)
+	return &ns
+}
+
+func TestSynk_ApplyTerminatingNamespace(t *testing.T) {
+	f := newFixture(t)
+	f.addObjects(terminatingNamespace(t))
+	s := f.newSynk()
+
+	rs, err := s.Apply(context.Background(), "test", nil,
+		newUnstructured("v1", "Namespace", "", "ns1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+	)
+	if err == nil {
+		t.Fatal("expected error for terminating namespace")
+	}
+	if len(rs.Status.Failed) == 0 || rs.Status.Failed[0].Kind != "Namespace" {
+		t.Fatalf("expected Namespace to fail, got %v", rs.Status.Failed)
+	}
+	if msg := rs.Status.Failed[0].Items[0].Error; !strings.Contains(msg, `namespace "ns1" is terminating`) {
+		t.Errorf("expected terminating namespace error, got %q", msg)
+	}
+}
+
+func TestSynk_ApplyIntoTerminatingNamespace(t *testing.T) {
+	f := newFixture(t)
+	f.addObjects(terminatingNamespace(t))
+	s := f.newSynk()
+	// The apiserver rejects new resources in terminating namespaces.
+	f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "cm1",
+			errors.New("unable to create new content in namespace ns1 because it is being terminated"))
+	})
+
+	r := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	_, err := s.applyOne(context.Background(), r, nil, newApplyOptions("test", nil))
+	var nsErr *NamespaceTerminatingError
+	if !errors.As(err, &nsErr) || nsErr.Namespace != "ns1" {
+		t.Errorf("expected NamespaceTerminatingError for ns1, got %v", err)
+	}
+}
+
+func TestSynk_ApplyWaitsForNamespace(t *testing.T) {
+	defer func(d time.Duration) { namespaceWaitInterval = d }(namespaceWaitInterval)
+	namespaceWaitInterval = time.Millisecond
+
+	f := newFixture(t)
+	f.addObjects(terminatingNamespace(t))
+	s := f.newSynk()
+	tracker := s.client.(*dynamicfake.FakeDynamicClient).Tracker()
+	// The namespace's finalizers complete after a few polls.
+	gets := 0
+	f.fake.PrependReactor("get", "namespaces", func(action k8stest.Action) (bool, runtime.Object, error) {
+		if gets++; gets == 3 {
+			if err := tracker.Delete(namespaceGVR, "", "ns1"); err != nil {
+				t.Error(err)
+			}
+		}
+		return false, nil, nil
+	})
+
+	ctx := context.Background()
+	_, err := s.Apply(ctx, "test", &ApplyOptions{WaitForNamespace: true},
+		newUnstructured("v1", "Namespace", "", "ns1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, err := s.client.Resource(namespaceGVR).Get(ctx, "ns1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isTerminatingNamespace(ns) {
+		t.Error("expected namespace to be created again")
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected ConfigMap to be created: %s", err)
+	}
+}
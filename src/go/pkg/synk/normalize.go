@@ -0,0 +1,173 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// quantityMaps are fields whose entries are resource amounts, eg the
+	// limits and requests of containers or the hard limits of quotas.
+	quantityMaps = map[string]bool{
+		"allocatable": true,
+		"capacity":    true,
+		"hard":        true,
+		"limits":      true,
+		"overhead":    true,
+		"requests":    true,
+	}
+	// quantityFields are other fields that hold a resource amount.
+	quantityFields = map[string]bool{
+		"sizeLimit": true,
+		"storage":   true,
+	}
+	// opaqueMaps are fields whose entries are arbitrary strings, which are
+	// always compared exactly.
+	opaqueMaps = map[string]bool{
+		"annotations": true,
+		"binaryData":  true,
+		"data":        true,
+		"labels":      true,
+		"stringData":  true,
+	}
+)
+
+// valuesEqual compares decoded JSON values like reflect.DeepEqual, but treats
+// semantically equal values as equal that differ after round-tripping or
+// defaulting by the apiserver:
+//   - numbers of different types, eg 1 and 1.0,
+//   - numbers and their string form, eg "80" and 80,
+//   - quantities in resource amount fields, eg "1000m" and "1" or "1Gi" and
+//     "1024Mi",
+//   - durations, eg "60s" and "1m".
+//
+// field is the name of the field holding the values and parent the name of the
+// enclosing field, which determine whether the values are resource amounts.
+// Entries of labels, annotations and ConfigMap or Secret data are compared
+// exactly.
+func valuesEqual(parent, field string, a, b interface{}) bool {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, x := range av {
+			y, ok := bv[k]
+			if !ok || !valuesEqual(field, k, x, y) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(parent, field, av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	if opaqueMaps[parent] {
+		return false
+	}
+	x, xs, xok := number(a)
+	y, ys, yok := number(b)
+	// Two different strings are never equal numbers, eg versions "1.0" and
+	// "1".
+	if xok && yok && !(xs && ys) {
+		return x == y
+	}
+	if quantityMaps[parent] || quantityFields[field] {
+		if x, ok := quantity(a); ok {
+			if y, ok := quantity(b); ok {
+				return x.Cmp(y) == 0
+			}
+		}
+	}
+	return durationsEqual(a, b)
+}
+
+// number returns the numeric value of v and whether it was parsed from a
+// string.
+func number(v interface{}) (n float64, fromString, ok bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), false, true
+	case int:
+		return float64(n), false, true
+	case int32:
+		return float64(n), false, true
+	case float64:
+		return n, false, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, false, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, true, err == nil
+	}
+	return 0, false, false
+}
+
+// quantity parses v as a resource.Quantity.
+func quantity(v interface{}) (resource.Quantity, bool) {
+	var s string
+	switch n := v.(type) {
+	case string:
+		s = n
+	case int64, int, int32, float64, json.Number:
+		f, _, _ := number(n)
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	default:
+		return resource.Quantity{}, false
+	}
+	q, err := resource.ParseQuantity(s)
+	return q, err == nil
+}
+
+// durationsEqual returns true if both values are strings that parse as the
+// same duration.
+func durationsEqual(a, b interface{}) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if !aok || !bok {
+		return false
+	}
+	x, err := time.ParseDuration(as)
+	if err != nil {
+		return false
+	}
+	y, err := time.ParseDuration(bs)
+	return err == nil && x == y
+}
+
+// lastField returns the last element of a dotted field path.
+func lastField(path string) string {
+	return path[strings.LastIndex(path, ".")+1:]
+}
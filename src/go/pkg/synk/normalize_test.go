@@ -0,0 +1,148 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestValuesEqual(t *testing.T) {
+	tests := []struct {
+		desc          string
+		parent, field string
+		a, b          interface{}
+		want          bool
+	}{
+		{"int and float", "", "replicas", int64(1), float64(1), true},
+		{"different numbers", "", "replicas", int64(1), float64(2), false},
+		{"port as string", "ports", "containerPort", "80", int64(80), true},
+		{"different port", "ports", "containerPort", "8080", int64(80), false},
+		{"numeric strings", "", "version", "1.0", "1", false},
+		{"cpu millis", "limits", "cpu", "1000m", "1", true},
+		{"cpu as number", "requests", "cpu", int64(2), "2000m", true},
+		{"cpu differs", "requests", "cpu", "500m", "1", false},
+		{"memory units", "limits", "memory", "1Gi", "1024Mi", true},
+		{"memory differs", "limits", "memory", "1G", "1Gi", false},
+		{"storage", "requests", "storage", "10Gi", "10240Mi", true},
+		{"quantity outside resources", "spec", "value", "1000m", "1", false},
+		{"duration", "spec", "timeout", "60s", "1m", true},
+		{"duration differs", "spec", "timeout", "30s", "1m", false},
+		{"label value", "labels", "timeout", "60s", "1m", false},
+		{"data value", "data", "port", "80", int64(80), false},
+		{"string and number", "", "name", "foo", int64(1), false},
+		{
+			"nested list",
+			"spec", "containers",
+			[]interface{}{map[string]interface{}{
+				"ports":     []interface{}{map[string]interface{}{"containerPort": float64(80)}},
+				"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1", "memory": "512Mi"}},
+			}},
+			[]interface{}{map[string]interface{}{
+				"ports":     []interface{}{map[string]interface{}{"containerPort": int64(80)}},
+				"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1000m", "memory": "0.5Gi"}},
+			}},
+			true,
+		},
+		{
+			"list length",
+			"spec", "args",
+			[]interface{}{"a"},
+			[]interface{}{"a", "b"},
+			false,
+		},
+		{
+			"missing key",
+			"spec", "selector",
+			map[string]interface{}{"a": "1"},
+			map[string]interface{}{"b": "1"},
+			false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := valuesEqual(tc.parent, tc.field, tc.a, tc.b); got != tc.want {
+				t.Errorf("valuesEqual(%q, %q, %#v, %#v) = %v, want %v", tc.parent, tc.field, tc.a, tc.b, got, tc.want)
+			}
+			if got := valuesEqual(tc.parent, tc.field, tc.b, tc.a); got != tc.want {
+				t.Errorf("valuesEqual(%q, %q, %#v, %#v) = %v, want %v", tc.parent, tc.field, tc.b, tc.a, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChangedFieldsNormalizesValues(t *testing.T) {
+	var live, desired unstructured.Unstructured
+	unmarshalYAML(t, &live, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: d1
+spec:
+  replicas: 1.0
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      terminationGracePeriodSeconds: 30
+      containers:
+      - name: c
+        ports:
+        - containerPort: 80
+        resources:
+          limits:
+            cpu: "1"
+            memory: 1Gi
+          requests:
+            cpu: 100m
+            memory: 128Mi`)
+	unmarshalYAML(t, &desired, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: d1
+spec:
+  replicas: 1
+  progressDeadlineSeconds: "600"
+  template:
+    spec:
+      terminationGracePeriodSeconds: 30
+      containers:
+      - name: c
+        ports:
+        - containerPort: "80"
+        resources:
+          limits:
+            cpu: 1000m
+            memory: 1024Mi
+          requests:
+            cpu: 0.1
+            memory: 128Mi`)
+	if got := changedFields(live.Object, desired.Object, "", false); len(got) > 0 {
+		t.Errorf("expected no changed fields, got %v", got)
+	}
+	want := []string{"spec.progressDeadlineSeconds", "spec.template.spec.containers"}
+	if got := changedFields(live.Object, desired.Object, "", true); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changed fields %v with exact comparison, got %v", want, got)
+	}
+
+	// A real change is still detected.
+	unstructured.SetNestedField(desired.Object, int64(2), "spec", "replicas")
+	want = []string{"spec.replicas"}
+	if got := changedFields(live.Object, desired.Object, "", false); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changed fields %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// defaultNotServedRetries is the default of
+	// ApplyOptions.NotServedRetries.
+	defaultNotServedRetries = 5
+	// notServedRetryDelay is the delay before the first retry, which doubles
+	// with each retry.
+	notServedRetryDelay = 500 * time.Millisecond
+)
+
+// isTypeNotServed returns true if the request failed since the apiserver
+// doesn't serve the resource type (yet), eg right after its CRD was
+// established. Unlike for a missing object, the NotFound response then
+// doesn't name an object.
+func isTypeNotServed(err error) bool {
+	var statusErr *k8serrors.StatusError
+	if !errors.As(err, &statusErr) || !k8serrors.IsNotFound(statusErr) {
+		return false
+	}
+	details := statusErr.Status().Details
+	return details == nil || details.Name == ""
+}
+
+// notServedRetries returns how often a resource is applied again if its type
+// isn't served.
+func (o *ApplyOptions) notServedRetries() int {
+	switch {
+	case o.NotServedRetries < 0:
+		return 0
+	case o.NotServedRetries == 0:
+		return defaultNotServedRetries
+	}
+	return o.NotServedRetries
+}
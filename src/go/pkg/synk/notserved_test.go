@@ -0,0 +1,122 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestIsTypeNotServed(t *testing.T) {
+	gr := schema.GroupResource{Group: "apps.cloudrobotics.com", Resource: "approllouts"}
+	tests := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{"type", k8serrors.NewGenericServerResponse(404, "POST", gr, "", "", 0, false), true},
+		{"object", k8serrors.NewNotFound(gr, "ar1"), false},
+		{"namespace", k8serrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "foo1"), false},
+		{"other", k8serrors.NewConflict(gr, "ar1", nil), false},
+		{"nil", nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := isTypeNotServed(tc.err); got != tc.want {
+				t.Errorf("isTypeNotServed(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneRetriesTypeNotServed(t *testing.T) {
+	defer func(w func(context.Context, time.Duration) error) { rateLimitWait = w }(rateLimitWait)
+	var delays []time.Duration
+	rateLimitWait = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	gr := schema.GroupResource{Group: "apps.cloudrobotics.com", Resource: "approllouts"}
+	tests := []struct {
+		desc       string
+		err        error
+		rejections int
+		retries    int
+		wantErr    bool
+		wantDelays []time.Duration
+	}{
+		{
+			desc:       "lagging apiserver",
+			err:        k8serrors.NewGenericServerResponse(404, "POST", gr, "", "", 0, false),
+			rejections: 2,
+			wantDelays: []time.Duration{500 * time.Millisecond, time.Second},
+		},
+		{
+			desc:       "retries exhausted",
+			err:        k8serrors.NewGenericServerResponse(404, "POST", gr, "", "", 0, false),
+			rejections: 3,
+			retries:    2,
+			wantErr:    true,
+			wantDelays: []time.Duration{500 * time.Millisecond, time.Second},
+		},
+		{
+			desc:       "disabled",
+			err:        k8serrors.NewGenericServerResponse(404, "POST", gr, "", "", 0, false),
+			rejections: 1,
+			retries:    -1,
+			wantErr:    true,
+		},
+		{
+			desc:       "missing namespace",
+			err:        k8serrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "foo1"),
+			rejections: 1,
+			wantErr:    true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			delays = nil
+			f := newFixture(t)
+			s := f.newSynk()
+			rejections := tc.rejections
+			f.fake.PrependReactor("create", "approllouts", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if rejections > 0 {
+					rejections--
+					return true, nil, tc.err
+				}
+				return false, nil, nil
+			})
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			ar := newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "foo1", "ar1")
+
+			_, err := s.applyOne(context.Background(), ar, set, newApplyOptions("test", &ApplyOptions{NotServedRetries: tc.retries}))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("applyOne() error = %v, want error: %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(delays, tc.wantDelays) {
+				t.Errorf("expected delays %v, got %v", tc.wantDelays, delays)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/googlecloudrobotics/ilog"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FindOrphans returns the resources that have an owner reference to a version
+// of the ResourceSet specified by 'name' that no longer exists, eg since it was
+// deleted manually or garbage collection failed. It lists all resource types of
+// the preferred API versions. Types that can't be listed, eg due to RBAC, are
+// skipped.
+func (s *Synk) FindOrphans(ctx context.Context, name string) ([]*unstructured.Unstructured, error) {
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, resourceSetErr(errors.Wrap(err, "list ResourceSets"))
+	}
+	existing := map[string]types.UID{}
+	for _, rs := range list.Items {
+		existing[rs.GetName()] = rs.GetUID()
+	}
+	groups, resources, err := s.discovery.ServerGroupsAndResources()
+	if err != nil && len(resources) == 0 {
+		return nil, errors.Wrap(err, "discover server resources")
+	}
+	preferred := map[string]bool{}
+	for _, g := range groups {
+		preferred[g.PreferredVersion.GroupVersion] = true
+	}
+
+	var orphans []*unstructured.Unstructured
+	for _, l := range resources {
+		if !preferred[l.GroupVersion] {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(l.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range l.APIResources {
+			if strings.Contains(r.Name, "/") || !hasVerb(r.Verbs, "list") {
+				continue
+			}
+			gvr := gv.WithResource(r.Name)
+			items, err := s.client.Resource(gvr).Namespace(s.namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				slog.Info("Skipping resource type that can't be listed",
+					slog.String("Resource", gvr.String()),
+					ilog.Err(err))
+				continue
+			}
+			for i := range items.Items {
+				if isOrphan(&items.Items[i], name, s.resourceSetGVR().Group, existing) {
+					orphans = append(orphans, &items.Items[i])
+				}
+			}
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return lessUnstructured(orphans[i], orphans[j])
+	})
+	return orphans, nil
+}
+
+// isOrphan returns true if the object is owned by a version of the named set
+// that doesn't exist anymore.
+func isOrphan(u *unstructured.Unstructured, name, group string, existing map[string]types.UID) bool {
+	for _, or := range u.GetOwnerReferences() {
+		if !isResourceSetRef(or, group) {
+			continue
+		}
+		if n, _, ok := decodeResourceSetName(or.Name); !ok || n != name {
+			continue
+		}
+		// A ResourceSet that was recreated with the same name doesn't
+		// own the object either.
+		if uid, ok := existing[or.Name]; !ok || (or.UID != "" && uid != "" && or.UID != uid) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVerb(verbs metav1.Verbs, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
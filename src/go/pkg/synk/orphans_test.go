@@ -0,0 +1,76 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSynk_FindOrphans(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	ownedBy := func(name string, uid types.UID, owners ...string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: name}}
+		for _, o := range owners {
+			cm.OwnerReferences = append(cm.OwnerReferences, metav1.OwnerReference{
+				APIVersion: "apps.cloudrobotics.com/v1alpha1",
+				Kind:       "ResourceSet",
+				Name:       o,
+				UID:        uid,
+			})
+		}
+		return cm
+	}
+	rs := &apps.ResourceSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test.v2", UID: "uid2"},
+	}
+	f.addObjects(
+		rs,
+		ownedBy("deleted", "uid1", "test.v1"),
+		ownedBy("existing", "uid2", "test.v2"),
+		ownedBy("recreated", "uid-old", "test.v2"),
+		ownedBy("other-set", "uid1", "other.v1"),
+		ownedBy("unowned", ""),
+	)
+	s := f.newSynk()
+	s.discovery = &staticDiscovery{resources: []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			{Name: "configmaps/status", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: metav1.Verbs{"create"}},
+		},
+	}}}
+
+	orphans, err := s.FindOrphans(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range orphans {
+		got = append(got, o.GetName())
+	}
+	if want := []string{"deleted", "recreated"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected orphans %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// validateAdditionalOwnerRefs checks ApplyOptions.AdditionalOwnerRefs against
+// the ResourceSets of the given group.
+func validateAdditionalOwnerRefs(refs []metav1.OwnerReference, group string) error {
+	controllers := 0
+	for _, or := range refs {
+		if or.APIVersion == "" || or.Kind == "" || or.Name == "" || or.UID == "" {
+			return errors.Errorf("additional owner reference %s %q must set apiVersion, kind, name and uid", or.Kind, or.Name)
+		}
+		if isResourceSetRef(or, group) {
+			return errors.Errorf("additional owner reference to ResourceSet %q is not allowed", or.Name)
+		}
+		if or.Controller != nil && *or.Controller {
+			controllers++
+		}
+	}
+	if controllers > 1 {
+		return errors.Errorf("%d additional owner references are controllers, at most one is allowed", controllers)
+	}
+	return nil
+}
+
+// addOwnerRefs adds the owner references to the resource. References with
+// the same UID as one of them are replaced. It fails if the resource would
+// have more than one controller reference.
+func addOwnerRefs(r *unstructured.Unstructured, refs []metav1.OwnerReference) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	added := map[string]bool{}
+	for _, or := range refs {
+		added[string(or.UID)] = true
+	}
+	var newRefs []metav1.OwnerReference
+	for _, or := range r.GetOwnerReferences() {
+		if !added[string(or.UID)] {
+			newRefs = append(newRefs, or)
+		}
+	}
+	newRefs = append(newRefs, refs...)
+	var controller *metav1.OwnerReference
+	for i, or := range newRefs {
+		if or.Controller == nil || !*or.Controller {
+			continue
+		}
+		if controller != nil {
+			return errors.Errorf("both %s %q and %s %q are controller owner references", controller.Kind, controller.Name, or.Kind, or.Name)
+		}
+		controller = &newRefs[i]
+	}
+	r.SetOwnerReferences(newRefs)
+	return nil
+}
+
+// dropDanglingOwnerRefs removes the ResourceSet owner references of the live
+// resource that point to ResourceSets that don't exist anymore, eg since the
+// set was deleted without cascading or recreated with a new UID. Only
+// references that validateOwnerRefs would reject are checked, so that
+// applying resources that are owned by predecessors costs no requests. It
+// returns true if the references were changed.
+func (s *Synk) dropDanglingOwnerRefs(ctx context.Context, live *unstructured.Unstructured, set *apps.ResourceSet) (bool, error) {
+	if set == nil {
+		return false, nil
+	}
+	name, version, ok := decodeResourceSetName(set.Name)
+	if !ok {
+		return false, errors.Errorf("invalid ResourceSet name %q", set.Name)
+	}
+	group := resourceSetGVK(set).Group
+	var refs []metav1.OwnerReference
+	for _, or := range live.GetOwnerReferences() {
+		if isResourceSetRef(or, group) && validateOwnerRef(or, name, version) != nil {
+			owner, err := s.resourceSets().Get(ctx, or.Name, metav1.GetOptions{})
+			if k8serrors.IsNotFound(err) || err == nil && owner.GetUID() != or.UID {
+				continue
+			} else if err != nil {
+				return false, errors.Wrapf(err, "get owner ResourceSet %q", or.Name)
+			}
+		}
+		refs = append(refs, or)
+	}
+	if len(refs) == len(live.GetOwnerReferences()) {
+		return false, nil
+	}
+	live.SetOwnerReferences(refs)
+	return true, nil
+}
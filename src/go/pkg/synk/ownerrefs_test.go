@@ -0,0 +1,214 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestValidateAdditionalOwnerRefs(t *testing.T) {
+	vTrue := true
+	app := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "App", Name: "app1", UID: "uid1", Controller: &vTrue}
+	tests := []struct {
+		desc    string
+		refs    []metav1.OwnerReference
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"controller", []metav1.OwnerReference{app}, false},
+		{"controller and owner", []metav1.OwnerReference{app, {APIVersion: "v1", Kind: "ConfigMap", Name: "cm1", UID: "uid2"}}, false},
+		{"two controllers", []metav1.OwnerReference{app, {APIVersion: "v1", Kind: "ConfigMap", Name: "cm1", UID: "uid2", Controller: &vTrue}}, true},
+		{"missing uid", []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "cm1"}}, true},
+		{"ResourceSet", []metav1.OwnerReference{{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet", Name: "other.v1", UID: "uid3"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := validateAdditionalOwnerRefs(tc.refs, resourceSetGVR.Group); (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestAddOwnerRefs(t *testing.T) {
+	vTrue := true
+	app := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "App", Name: "app1", UID: "uid1", Controller: &vTrue}
+
+	r := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	r.SetOwnerReferences([]metav1.OwnerReference{
+		{APIVersion: "example.com/v1", Kind: "App", Name: "app1", UID: "uid1"},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "cm0", UID: "uid0"},
+	})
+	if err := addOwnerRefs(r, []metav1.OwnerReference{app}); err != nil {
+		t.Fatal(err)
+	}
+	refs := r.GetOwnerReferences()
+	if len(refs) != 2 || refs[0].Name != "cm0" || refs[1].Name != "app1" || refs[1].Controller == nil {
+		t.Errorf("expected the reference with the same UID to be replaced, got %v", refs)
+	}
+
+	r.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "cm0", UID: "uid0", Controller: &vTrue}})
+	if err := addOwnerRefs(r, []metav1.OwnerReference{app}); err == nil {
+		t.Errorf("expected error for second controller reference, got %v", r.GetOwnerReferences())
+	}
+}
+
+func TestSynk_ApplyAdditionalOwnerRefs(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+	vTrue := true
+	opts := &ApplyOptions{
+		PatchStrategy: PatchStrategyMergeOverLive,
+		AdditionalOwnerRefs: []metav1.OwnerReference{
+			{APIVersion: "example.com/v1", Kind: "App", Name: "app1", UID: "uid1", Controller: &vTrue},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cm corev1.ConfigMap
+		if err := convert(live, &cm); err != nil {
+			t.Fatal(err)
+		}
+		refs := cm.OwnerReferences
+		if len(refs) != 2 || refs[0].Kind != "ResourceSet" || refs[0].Name != rs.Name || refs[1].Name != "app1" {
+			t.Errorf("apply %d: expected owner references to %s and app1, got %v", i, rs.Name, refs)
+		}
+	}
+
+	opts.AdditionalOwnerRefs = append(opts.AdditionalOwnerRefs, metav1.OwnerReference{
+		APIVersion: "example.com/v1", Kind: "App", Name: "app2", UID: "uid2", Controller: &vTrue,
+	})
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err == nil {
+		t.Error("expected error for two controller references")
+	}
+}
+
+func TestSynk_ApplyWithResourceSetGroupVersion(t *testing.T) {
+	ctx := context.Background()
+	gv := schema.GroupVersion{Group: "apps.example.com", Version: "v1beta1"}
+	sc := runtime.NewScheme()
+	scheme.AddToScheme(sc)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(sc, map[schema.GroupVersionResource]string{
+		gv.WithResource("resourcesets"): "ResourceSetList",
+	})
+	s := New(client, &fakeCachedDiscoveryClient{}).WithResourceSetGroupVersion(gv)
+	s.mapper = testrestmapper.TestOnlyStaticRESTMapper(sc)
+	s.resetMapper = func() {}
+
+	if _, err := s.Apply(ctx, "test", nil,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Resource(gv.WithResource("resourcesets")).Get(ctx, "test.v1", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected ResourceSet in group %s: %s", gv, err)
+	}
+
+	// The second version takes over cm1 and prunes cm2 explicitly, which
+	// requires recognizing the owner references of the first version.
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive, PruneConcurrency: 1}, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []metav1.OwnerReference{{APIVersion: "apps.example.com/v1beta1", Kind: "ResourceSet", Name: "test.v2", UID: rs.UID}}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].APIVersion != want[0].APIVersion || refs[0].Kind != want[0].Kind || refs[0].Name != want[0].Name || refs[0].UID != want[0].UID {
+		t.Errorf("expected owner references %v, got %v", want, refs)
+	}
+	if _, err := client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected cm2 to be pruned, got %v", err)
+	}
+	if _, err := client.Resource(gv.WithResource("resourcesets")).Get(ctx, "test.v1", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected test.v1 to be deleted, got %v", err)
+	}
+}
+
+func TestSynk_ApplyDropsDanglingOwnerRefs(t *testing.T) {
+	tests := []struct {
+		desc string
+		// ownerUID is the UID of the existing ResourceSet other.v1, if any.
+		ownerUID types.UID
+		wantErr  bool
+	}{
+		{desc: "deleted owner"},
+		{desc: "recreated owner", ownerUID: "uid-new"},
+		{desc: "existing owner", ownerUID: "uid-old", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFixture(t).newSynk()
+			if tc.ownerUID != "" {
+				owner := &unstructured.Unstructured{}
+				owner.SetGroupVersionKind(resourceSetGVR.GroupVersion().WithKind("ResourceSet"))
+				owner.SetName("other.v1")
+				owner.SetUID(tc.ownerUID)
+				if _, err := s.resourceSets().Create(ctx, owner, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			live := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+			live.SetOwnerReferences([]metav1.OwnerReference{
+				{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet", Name: "other.v1", UID: "uid-old"},
+			})
+			client := s.client.Resource(gvrs["configmaps"]).Namespace("ns1")
+			if _, err := client.Create(ctx, live, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			rs, err := s.Apply(ctx, "test", &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected owner conflict with existing ResourceSet")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			cm, err := client.Get(ctx, "cm1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			refs := cm.GetOwnerReferences()
+			if len(refs) != 1 || refs[0].Name != rs.Name {
+				t.Errorf("expected owner reference to %s, got %v", rs.Name, refs)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Plan describes the changes an Apply with the same arguments would make.
+type Plan struct {
+	// ResourceSet is the name of the ResourceSet version Apply would create.
+	ResourceSet string
+	// Changes for all resources of the set, followed by the resources of
+	// previous versions that would be pruned.
+	Changes []PlannedChange
+	// Prune lists the resources of previous versions that would be deleted,
+	// grouped by kind. It's derived from the Delete actions in Changes.
+	Prune []PruneGroup
+	// ResourceSetSize is the estimated size in bytes of the serialized
+	// ResourceSet after the apply, including its status.
+	ResourceSetSize int
+	// Warnings are set if the ResourceSet or a manifest approaches the size
+	// limit of etcd, or if pruning would exceed the prune limits.
+	Warnings []string
+}
+
+// PlannedChange describes the change to a single resource.
+type PlannedChange struct {
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+	// Action is Create, Update, Replace, Delete or Skip. Replace is planned
+	// if ApplyOptions.RecreateFields changed. It is None if the resource
+	// is unchanged apart from its owner reference, if it would be orphaned
+	// instead of pruned or if planning failed.
+	Action apps.ResourceAction
+	// Fields are the paths of the desired fields whose live value differs.
+	Fields []string
+	// Ownership describes how the live resource is owned.
+	Ownership Ownership
+	// PruneReason is set for resources that are no longer part of the set.
+	PruneReason apps.PruneReason
+	// Err is set if the change can't be planned, eg since the resource type
+	// is unknown.
+	Err error
+	// ManifestSize is the size in bytes of the serialized resource. It is
+	// zero for pruned resources.
+	ManifestSize int
+
+	// live and desired are the states of the resource for UnifiedDiff.
+	live, desired *unstructured.Unstructured
+}
+
+// PruneGroup lists the pruned resources of a kind.
+type PruneGroup struct {
+	schema.GroupVersionKind
+	// Resource is the resource type that the kind resolves to. It is empty
+	// if the kind is no longer served.
+	Resource schema.GroupVersionResource
+	Items    []apps.ResourceRef
+}
+
+// Ownership describes how a live resource is owned relative to the applied set.
+type Ownership string
+
+const (
+	// OwnershipNew is used for resources that don't exist yet.
+	OwnershipNew Ownership = "New"
+	// OwnershipManaged is used for resources owned by the ResourceSet.
+	OwnershipManaged Ownership = "Managed"
+	// OwnershipAdopt is used for existing resources that aren't owned by any
+	// ResourceSet and would be adopted.
+	OwnershipAdopt Ownership = "Adopt"
+	// OwnershipConflict is used for resources owned by another or a newer
+	// ResourceSet, which fail to apply.
+	OwnershipConflict Ownership = "Conflict"
+)
+
+// PlanApply returns the changes that Apply would make for the given
+// arguments without changing anything in the cluster. Replacements due to
+// immutable fields are planned as updates, since they can only be detected by
+// applying the change, unless ApplyOptions.RecreateFields lists them.
+// Resources that would be pruned are read as well, so that UnifiedDiff can
+// show them.
+func (s *Synk) PlanApply(
+	ctx context.Context,
+	name string,
+	opts *ApplyOptions,
+	resources ...*unstructured.Unstructured,
+) (*Plan, error) {
+	return s.planApply(ctx, newApplyOptions(name, opts), resources...)
+}
+
+func (s *Synk) planApply(ctx context.Context, opts *applyOptions, resources ...*unstructured.Unstructured) (*Plan, error) {
+	// Don't modify the caller's resources.
+	resources = append([]*unstructured.Unstructured(nil), resources...)
+	for i, r := range resources {
+		resources[i] = r.DeepCopy()
+	}
+	resources, err := s.prepare(ctx, opts, resources...)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := s.latest(ctx, opts.name)
+	if err != nil {
+		return nil, errors.Wrap(err, "get next ResourceSet version")
+	}
+	opts.version = nextVersion(prev)
+	plan := &Plan{ResourceSet: resourceSetName(opts.name, opts.version)}
+	set := &apps.ResourceSet{Spec: resourceSetSpec(resources)}
+	set.Name = plan.ResourceSet
+	set.APIVersion, set.Kind = s.resourceSetGVR().GroupVersion().String(), "ResourceSet"
+
+	crds, _ := separateCRDsFromResources(resources)
+	server := s.serverVersion(resources)
+	for _, r := range resources {
+		c := s.planOne(ctx, r, set, opts, crds, server)
+		if c.ManifestSize, err = manifestSize(r); err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, c)
+	}
+
+	removed, prevCount, err := s.removedResources(ctx, set, opts.name, opts.version)
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(removed))
+	for i := range removed {
+		r := &removed[i]
+		if r.reason, errs[i] = s.removedReason(ctx, *r, opts.PruneAllowList); errs[i] != nil || !isDeletedReason(r.reason) {
+			continue
+		}
+		if young, err := s.tooYoungToPrune(ctx, *r, opts.MinPruneAge); err != nil {
+			errs[i] = err
+		} else if young {
+			r.reason = apps.PruneReasonSkippedTooYoung
+		}
+	}
+	// Like Apply, keep all resources if the deletions exceed the limits.
+	limitErr := limitPrune(removed, prevCount, opts)
+	var pruned []PlannedChange
+	for i, r := range removed {
+		c := PlannedChange{
+			GroupVersionKind: r.gvk,
+			Namespace:        r.ref.Namespace,
+			Name:             r.ref.Name,
+			Action:           apps.ResourceActionDelete,
+			Ownership:        OwnershipManaged,
+			PruneReason:      r.reason,
+			Err:              errs[i],
+		}
+		if c.Err != nil || !isDeletedReason(c.PruneReason) {
+			c.Action = apps.ResourceActionNone
+		}
+		if c.Action == apps.ResourceActionDelete {
+			// The live state is only needed for UnifiedDiff, which shows
+			// the deletion without it if the resource can't be read.
+			if client, err := s.prunedClient(r); err == nil && client != nil {
+				if live, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{}); err == nil {
+					c.live = live
+				}
+			}
+		}
+		pruned = append(pruned, c)
+	}
+	sort.Slice(pruned, func(i, j int) bool {
+		return lessPlannedChange(&pruned[i], &pruned[j])
+	})
+	plan.Changes = append(plan.Changes, pruned...)
+	plan.Prune = s.pruneGroups(pruned)
+
+	if plan.ResourceSetSize, err = estimateResourceSetSize(set, opts, resources, plan.Changes); err != nil {
+		return nil, err
+	}
+	plan.Warnings = sizeWarnings(plan)
+	if limitErr != nil {
+		plan.Warnings = append(plan.Warnings, limitErr.Error())
+	}
+	return plan, nil
+}
+
+// pruneGroups groups the sorted pruned changes that would be deleted by kind
+// and resolves their resource types.
+func (s *Synk) pruneGroups(pruned []PlannedChange) []PruneGroup {
+	var groups []PruneGroup
+	for _, c := range pruned {
+		if c.Action != apps.ResourceActionDelete {
+			continue
+		}
+		if n := len(groups); n == 0 || groups[n-1].GroupVersionKind != c.GroupVersionKind {
+			g := PruneGroup{GroupVersionKind: c.GroupVersionKind}
+			if mapping, err := s.mapper.RESTMapping(c.GroupKind(), c.Version); err == nil {
+				g.Resource = mapping.Resource
+			}
+			groups = append(groups, g)
+		}
+		g := &groups[len(groups)-1]
+		g.Items = append(g.Items, apps.ResourceRef{Namespace: c.Namespace, Name: c.Name})
+	}
+	return groups
+}
+
+// planOne determines the change to a single resource by comparing it with
+// its live state.
+func (s *Synk) planOne(ctx context.Context, r *unstructured.Unstructured, set *apps.ResourceSet, opts *applyOptions, crds []*unstructured.Unstructured, server *version.Version) PlannedChange {
+	gvk := r.GroupVersionKind()
+	c := PlannedChange{
+		GroupVersionKind: gvk,
+		Namespace:        r.GetNamespace(),
+		Name:             r.GetName(),
+		desired:          r,
+	}
+	if ok, err := s.hasRequiredGVK(r); err != nil {
+		c.Action, c.Err = apps.ResourceActionNone, err
+		return c
+	} else if !ok {
+		c.Action = apps.ResourceActionSkip
+		return c
+	}
+	if ok, err := supportsK8sVersion(r, server); err != nil {
+		c.Action, c.Err = apps.ResourceActionNone, err
+		return c
+	} else if !ok {
+		c.Action = apps.ResourceActionSkip
+		return c
+	}
+	mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) && definesKind(crds, gvk.GroupKind()) {
+		// The type is only served once the CRD in the set was applied.
+		c.Action, c.Ownership = apps.ResourceActionCreate, OwnershipNew
+		return c
+	} else if err != nil {
+		c.Action, c.Err = apps.ResourceActionNone, errors.Wrap(err, "get REST mapping")
+		return c
+	}
+	mapping = opts.overrideScope(mapping)
+	if r.GetName() == "" {
+		// The apiserver generates the name of the new resource.
+		c.Action, c.Ownership = apps.ResourceActionCreate, OwnershipNew
+		return c
+	}
+	client := s.client.Resource(mapping.Resource)
+	var live *unstructured.Unstructured
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		live, err = client.Get(ctx, r.GetName(), metav1.GetOptions{})
+	} else {
+		live, err = client.Namespace(r.GetNamespace()).Get(ctx, r.GetName(), metav1.GetOptions{})
+	}
+	if k8serrors.IsNotFound(err) {
+		c.Action, c.Ownership = apps.ResourceActionCreate, OwnershipNew
+		return c
+	} else if err != nil {
+		c.Action, c.Err = apps.ResourceActionNone, errors.Wrap(err, "get resource")
+		return c
+	}
+	// Owner references to deleted ResourceSets are dropped by the apply.
+	if _, err := s.dropDanglingOwnerRefs(ctx, live, set); err != nil {
+		c.Action, c.Err = apps.ResourceActionNone, errors.Wrap(err, "check owner references")
+		return c
+	}
+	c.live = live
+	c.Ownership = ownership(live, set)
+	if c.Ownership == OwnershipConflict {
+		c.Action, c.Err = apps.ResourceActionNone, errors.Wrap(validateOwnerRefs(live, set), "owner conflict")
+		return c
+	}
+	if c.Ownership == OwnershipAdopt {
+		if err := checkAdopt(r, live, set, opts); err != nil {
+			c.Action, c.Err = apps.ResourceActionNone, err
+			return c
+		}
+	}
+	if err := checkImmutable(r, live); err != nil {
+		c.Action, c.Err = apps.ResourceActionNone, err
+		return c
+	}
+	c.Fields = opts.changedFields(live, r)
+	c.Action = apps.ResourceActionNone
+	if opts.recreateField(live, r) != "" {
+		c.Action = apps.ResourceActionReplace
+	} else if len(c.Fields) > 0 || c.Ownership == OwnershipAdopt {
+		// Adopted resources get the owner reference to the set.
+		c.Action = apps.ResourceActionUpdate
+	}
+	return c
+}
+
+func ownership(live *unstructured.Unstructured, set *apps.ResourceSet) Ownership {
+	if validateOwnerRefs(live, set) != nil {
+		return OwnershipConflict
+	}
+	group := resourceSetGVK(set).Group
+	for _, or := range live.GetOwnerReferences() {
+		if isResourceSetRef(or, group) {
+			return OwnershipManaged
+		}
+	}
+	return OwnershipAdopt
+}
+
+// definesKind returns true if one of the CRDs defines the kind.
+func definesKind(crds []*unstructured.Unstructured, gk schema.GroupKind) bool {
+	for _, crd := range crds {
+		var typed apiextensions.CustomResourceDefinition
+		if err := convert(crd, &typed); err != nil {
+			continue
+		}
+		if typed.Spec.Group == gk.Group && typed.Spec.Names.Kind == gk.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFields returns the paths of all fields in desired whose value differs
+// from live. Lists are compared as a whole. The status and fields that are
+// managed by Synk are ignored. Unless exact is set, values are compared with
+// valuesEqual.
+func changedFields(live, desired map[string]interface{}, prefix string, exact bool) []string {
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var fields []string
+	for _, k := range keys {
+		p := k
+		if prefix != "" {
+			p = prefix + "." + k
+		}
+		switch p {
+		case "status", "metadata.ownerReferences", "metadata.annotations." + corev1.LastAppliedConfigAnnotation:
+			continue
+		}
+		dm, ok := desired[k].(map[string]interface{})
+		lm, lok := live[k].(map[string]interface{})
+		if ok && (lok || live[k] == nil) {
+			fields = append(fields, changedFields(lm, dm, p, exact)...)
+			continue
+		}
+		equal := reflect.DeepEqual(live[k], desired[k])
+		if !exact {
+			equal = valuesEqual(lastField(prefix), k, live[k], desired[k])
+		}
+		if !equal {
+			fields = append(fields, p)
+		}
+	}
+	return fields
+}
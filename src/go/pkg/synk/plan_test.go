@@ -0,0 +1,202 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestChangedFields(t *testing.T) {
+	var live, desired unstructured.Unstructured
+	unmarshalYAML(t, &live, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  resourceVersion: "3"
+  labels:
+    foo: bar
+data:
+  a: "1"
+  b: "2"`)
+	unmarshalYAML(t, &desired, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  labels:
+    foo: baz
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+data:
+  a: "1"
+  b: "3"
+  c: "4"`)
+	want := []string{"data.b", "data.c", "metadata.labels.foo"}
+	if got := changedFields(live.Object, desired.Object, "", false); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changed fields %v, got %v", want, got)
+	}
+}
+
+func TestSynk_PlanApply(t *testing.T) {
+	var cmManaged, cmUnowned, cmConflict corev1.ConfigMap
+	unmarshalYAML(t, &cmManaged, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: ns1
+  name: managed
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: test.v1
+    uid: test
+data:
+  foo: bar`)
+	unmarshalYAML(t, &cmUnowned, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: ns1
+  name: unowned`)
+	unmarshalYAML(t, &cmConflict, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: ns1
+  name: conflict
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: other.v1
+    uid: other`)
+	var prev apps.ResourceSet
+	unmarshalYAML(t, &prev, `
+apiVersion: apps.cloudrobotics.com/v1alpha1
+kind: ResourceSet
+metadata:
+  name: test.v1
+spec:
+  resources:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - namespace: ns1
+      name: managed
+    - namespace: ns1
+      name: removed`)
+	other := &apps.ResourceSet{}
+	other.Name = "other.v1"
+	other.UID = "other"
+	f := newFixture(t)
+	f.addObjects(&cmManaged, &cmUnowned, &cmConflict, &prev, other)
+	s := f.newSynk()
+
+	managed := newUnstructured("v1", "ConfigMap", "ns1", "managed")
+	unstructured.SetNestedField(managed.Object, "baz", "data", "foo")
+	plan, err := s.PlanApply(context.Background(), "test", nil,
+		managed,
+		newUnstructured("v1", "ConfigMap", "ns1", "unowned"),
+		newUnstructured("v1", "ConfigMap", "ns1", "conflict"),
+		newUnstructured("apps/v1", "Deployment", "ns1", "new"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.ResourceSet != "test.v2" {
+		t.Errorf("expected ResourceSet %q, got %q", "test.v2", plan.ResourceSet)
+	}
+	type change struct {
+		name        string
+		action      apps.ResourceAction
+		ownership   Ownership
+		fields      []string
+		pruneReason apps.PruneReason
+		failed      bool
+	}
+	want := []change{
+		{"conflict", apps.ResourceActionNone, OwnershipConflict, nil, "", true},
+		{"managed", apps.ResourceActionUpdate, OwnershipManaged, []string{"data.foo"}, "", false},
+		{"unowned", apps.ResourceActionUpdate, OwnershipAdopt, nil, "", false},
+		{"new", apps.ResourceActionCreate, OwnershipNew, nil, "", false},
+		{"removed", apps.ResourceActionDelete, OwnershipManaged, nil, apps.PruneReasonRemovedFromSet, false},
+	}
+	var got []change
+	for _, c := range plan.Changes {
+		got = append(got, change{c.Name, c.Action, c.Ownership, c.Fields, c.PruneReason, c.Err != nil})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes\n%v\nbut got\n%v", want, got)
+	}
+	if writes := filterReadActions(f.fake.Actions()); len(writes) > 0 {
+		t.Errorf("expected no writes, got %v", writes)
+	}
+}
+
+func TestSynk_PlanApplyGroupsPrunedResources(t *testing.T) {
+	var prev apps.ResourceSet
+	unmarshalYAML(t, &prev, `
+apiVersion: apps.cloudrobotics.com/v1alpha1
+kind: ResourceSet
+metadata:
+  name: test.v1
+spec:
+  resources:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - namespace: ns1
+      name: kept
+    - namespace: ns1
+      name: removed1
+    - namespace: ns2
+      name: removed2
+  - group: apps
+    version: v1
+    kind: Deployment
+    items:
+    - namespace: ns1
+      name: removed3`)
+	f := newFixture(t)
+	f.addObjects(&prev)
+	s := f.newSynk()
+
+	plan, err := s.PlanApply(context.Background(), "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PruneGroup{{
+		GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Items:            []apps.ResourceRef{{Namespace: "ns1", Name: "removed1"}, {Namespace: "ns2", Name: "removed2"}},
+	}, {
+		GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Resource:         schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		Items:            []apps.ResourceRef{{Namespace: "ns1", Name: "removed3"}},
+	}}
+	if !reflect.DeepEqual(plan.Prune, want) {
+		t.Errorf("expected prune groups\n%v\nbut got\n%v", want, plan.Prune)
+	}
+	if writes := filterReadActions(f.fake.Actions()); len(writes) > 0 {
+		t.Errorf("expected no writes, got %v", writes)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrMissingPermissions is returned by Apply with PreflightRBAC if the client
+// lacks permissions to apply the set.
+var ErrMissingPermissions = errors.New("missing permissions")
+
+var selfSubjectAccessReviewGVR = authorizationv1.SchemeGroupVersion.WithResource("selfsubjectaccessreviews")
+
+// accessCheck is a permission that an apply needs.
+type accessCheck struct {
+	verb      string
+	group     string
+	resource  string
+	namespace string
+}
+
+func (c accessCheck) String() string {
+	r := c.resource
+	if c.group != "" {
+		r += "." + c.group
+	}
+	if c.namespace != "" {
+		return fmt.Sprintf("%s %s in namespace %s", c.verb, r, c.namespace)
+	}
+	return c.verb + " " + r
+}
+
+// preflightRBAC reviews the permissions for applying the resources and
+// returns an error listing the denied ones.
+func (s *Synk) preflightRBAC(ctx context.Context, opts *applyOptions, prev *apps.ResourceSet, resources []*unstructured.Unstructured) error {
+	checks, err := s.requiredAccess(ctx, opts, prev, resources)
+	if err != nil {
+		return errors.Wrap(err, "preflight RBAC")
+	}
+	var denied []string
+	for _, c := range checks {
+		ok, err := s.reviewAccess(ctx, c)
+		if err != nil {
+			return errors.Wrapf(err, "preflight RBAC: review %s", c)
+		}
+		if !ok {
+			denied = append(denied, c.String())
+		}
+	}
+	if len(denied) > 0 {
+		return errors.Wrapf(ErrMissingPermissions, "cannot %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// requiredAccess returns the distinct permissions needed to write the
+// ResourceSet, apply the resources and prune the resources of previous
+// versions, sorted by resource, namespace and verb.
+func (s *Synk) requiredAccess(ctx context.Context, opts *applyOptions, prev *apps.ResourceSet, resources []*unstructured.Unstructured) ([]accessCheck, error) {
+	seen := map[accessCheck]bool{}
+	add := func(gr schema.GroupResource, namespace string, verbs ...string) {
+		for _, v := range verbs {
+			seen[accessCheck{verb: v, group: gr.Group, resource: gr.Resource, namespace: namespace}] = true
+		}
+	}
+	resource := func(gk schema.GroupKind, version, namespace string) (schema.GroupResource, string, bool) {
+		mapping, err := s.mapper.RESTMapping(gk, version)
+		if err != nil {
+			return schema.GroupResource{}, "", false
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			namespace = ""
+		}
+		return mapping.Resource.GroupResource(), namespace, true
+	}
+
+	add(s.resourceSetGVR().GroupResource(), s.namespace, "create", "update")
+	if prev != nil {
+		add(s.resourceSetGVR().GroupResource(), s.namespace, "delete")
+	}
+	verbs := func(strategy PatchStrategy) []string {
+		var updateVerbs []string
+		switch strategy {
+		case PatchStrategyServerSideApply:
+			updateVerbs = []string{"patch"}
+		case PatchStrategyMergeOverLive:
+			updateVerbs = []string{"update"}
+		default:
+			// Three-way patches fall back to updates.
+			updateVerbs = []string{"patch", "update"}
+		}
+		switch opts.CreateStrategy {
+		case CreateStrategyCreateOnly:
+			return []string{"create"}
+		case CreateStrategyUpdateOnly:
+			return append([]string{"get"}, updateVerbs...)
+		default:
+			return append([]string{"get", "create"}, updateVerbs...)
+		}
+	}
+	for _, r := range resources {
+		gvk := r.GroupVersionKind()
+		if gr, ns, ok := resource(gvk.GroupKind(), gvk.Version, r.GetNamespace()); ok {
+			// Invalid apply methods fail when the resource is applied.
+			strategy, _ := opts.patchStrategy(r)
+			add(gr, ns, verbs(strategy)...)
+		}
+	}
+
+	set := &apps.ResourceSet{Spec: resourceSetSpec(resources)}
+	removed, _, err := s.removedResources(ctx, set, opts.name, nextVersion(prev))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range removed {
+		if gr, ns, ok := resource(r.gvk.GroupKind(), r.gvk.Version, r.ref.Namespace); ok {
+			add(gr, ns, "delete")
+		}
+	}
+
+	checks := make([]accessCheck, 0, len(seen))
+	for c := range seen {
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		a, b := checks[i], checks[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.resource != b.resource {
+			return a.resource < b.resource
+		}
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		return a.verb < b.verb
+	})
+	return checks, nil
+}
+
+// reviewAccess creates a SelfSubjectAccessReview for the permission.
+func (s *Synk) reviewAccess(ctx context.Context, c accessCheck) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: authorizationv1.SchemeGroupVersion.String(), Kind: "SelfSubjectAccessReview"},
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: c.namespace,
+				Verb:      c.verb,
+				Group:     c.group,
+				Resource:  c.resource,
+			},
+		},
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(review)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.client.Resource(selfSubjectAccessReviewGVR).Create(ctx, &unstructured.Unstructured{Object: u}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	allowed, _, _ := unstructured.NestedBool(res.Object, "status", "allowed")
+	return allowed, nil
+}
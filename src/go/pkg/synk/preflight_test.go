@@ -0,0 +1,112 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+// reviewAccessReactor answers SelfSubjectAccessReviews, denying the given
+// permissions, and records the reviewed ones.
+func reviewAccessReactor(reviewed *[]string, denied ...string) k8stest.ReactionFunc {
+	return func(action k8stest.Action) (bool, runtime.Object, error) {
+		u := action.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured)
+		var review authorizationv1.SelfSubjectAccessReview
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &review); err != nil {
+			return true, nil, err
+		}
+		a := review.Spec.ResourceAttributes
+		c := accessCheck{verb: a.Verb, group: a.Group, resource: a.Resource, namespace: a.Namespace}.String()
+		*reviewed = append(*reviewed, c)
+		allowed := true
+		for _, d := range denied {
+			if c == d {
+				allowed = false
+			}
+		}
+		u = u.DeepCopy()
+		unstructured.SetNestedField(u.Object, allowed, "status", "allowed")
+		return true, u, nil
+	}
+}
+
+func TestSynk_ApplyPreflightRBAC(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	if _, err := s.Apply(ctx, "test", nil,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "Secret", "ns1", "s1"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var reviewed []string
+	f.fake.PrependReactor("create", "selfsubjectaccessreviews", reviewAccessReactor(&reviewed,
+		"update configmaps in namespace ns1",
+		"delete secrets in namespace ns1",
+	))
+	// The fake client doesn't support strategic merge patches.
+	opts := &ApplyOptions{PreflightRBAC: true, PatchStrategy: PatchStrategyMergeOverLive}
+	before := len(f.fake.Actions())
+	_, err := s.Apply(ctx, "test", opts,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+	)
+	if !errors.Is(err, ErrMissingPermissions) {
+		t.Fatalf("expected ErrMissingPermissions, got %v", err)
+	}
+	if want := "cannot update configmaps in namespace ns1, delete secrets in namespace ns1"; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error to list %q, got %q", want, err)
+	}
+	want := []string{
+		"create configmaps in namespace ns1",
+		"get configmaps in namespace ns1",
+		"update configmaps in namespace ns1",
+		"delete secrets in namespace ns1",
+		"create resourcesets.apps.cloudrobotics.com",
+		"delete resourcesets.apps.cloudrobotics.com",
+		"update resourcesets.apps.cloudrobotics.com",
+	}
+	if strings.Join(reviewed, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected reviews\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(reviewed, "\n"))
+	}
+	for _, a := range f.fake.Actions()[before:] {
+		if a.GetVerb() != "create" || a.GetResource().Resource != "selfsubjectaccessreviews" {
+			if a.GetVerb() != "get" && a.GetVerb() != "list" {
+				t.Errorf("expected no changes before the preflight check passed, got %s %s", a.GetVerb(), a.GetResource().Resource)
+			}
+		}
+	}
+
+	reviewed = nil
+	f.fake.PrependReactor("create", "selfsubjectaccessreviews", reviewAccessReactor(&reviewed))
+	if _, err := s.Apply(ctx, "test", opts,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+	); err != nil {
+		t.Fatalf("expected apply to pass the preflight check, got %v", err)
+	}
+	if len(reviewed) != len(want) {
+		t.Errorf("expected %d reviews, got %v", len(want), reviewed)
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// defaultPruneTimeout bounds the wait for pruned resources to be removed with
+// PruneWaitForDeletion.
+const defaultPruneTimeout = 5 * time.Minute
+
+// prunedResource is a resource of a previous ResourceSet version that is no
+// longer part of the set.
+type prunedResource struct {
+	gvk    schema.GroupVersionKind
+	ref    apps.ResourceRef
+	reason apps.PruneReason
+}
+
+// pruneReason decides whether a resource of the given kind that was removed
+// from the set is pruned.
+func pruneReason(gk schema.GroupKind, allowList []schema.GroupKind) apps.PruneReason {
+	if gk == (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+		return apps.PruneReasonExemptCRD
+	}
+	return allowListReason(gk, allowList)
+}
+
+// allowListReason decides whether a removed resource is pruned based on the
+// PruneAllowList.
+func allowListReason(gk schema.GroupKind, allowList []schema.GroupKind) apps.PruneReason {
+	if len(allowList) == 0 {
+		return apps.PruneReasonRemovedFromSet
+	}
+	for _, a := range allowList {
+		if a == gk {
+			return apps.PruneReasonPrunedByAllowList
+		}
+	}
+	return apps.PruneReasonSkippedNotInAllowList
+}
+
+// removedReason is like pruneReason, but CRDs that opted into ownership are
+// treated like other resources, since they are deleted with the previous
+// ResourceSets.
+func (s *Synk) removedReason(ctx context.Context, r prunedResource, allowList []schema.GroupKind) (apps.PruneReason, error) {
+	reason := pruneReason(r.gvk.GroupKind(), allowList)
+	if reason != apps.PruneReasonExemptCRD {
+		return reason, nil
+	}
+	client, err := s.prunedClient(r)
+	if err != nil || client == nil {
+		return reason, err
+	}
+	live, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return reason, nil
+	} else if err != nil {
+		return "", err
+	}
+	if !ownsCRD(live) {
+		return reason, nil
+	}
+	return allowListReason(r.gvk.GroupKind(), allowList), nil
+}
+
+// removedResources returns the resources of the previous ResourceSet versions
+// that are not part of the given set and the number of resources in the
+// latest previous version. Resources are matched regardless of their API
+// version.
+func (s *Synk) removedResources(ctx context.Context, rs *apps.ResourceSet, name string, version int32) ([]prunedResource, int, error) {
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "list existing ResourceSets")
+	}
+	type key struct {
+		gk  schema.GroupKind
+		ref apps.ResourceRef
+	}
+	seen := map[key]bool{}
+	for _, g := range rs.Spec.Resources {
+		for _, ref := range g.Items {
+			seen[key{schema.GroupKind{Group: g.Group, Kind: g.Kind}, ref}] = true
+		}
+	}
+	var (
+		removed     []prunedResource
+		prevVersion int32
+		prevCount   int
+	)
+	for i := range list.Items {
+		n, v, ok := decodeResourceSetName(list.Items[i].GetName())
+		if !ok || n != name || v >= version {
+			continue
+		}
+		var prev apps.ResourceSet
+		if err := convert(&list.Items[i], &prev); err != nil {
+			return nil, 0, err
+		}
+		if v > prevVersion {
+			prevVersion, prevCount = v, 0
+			for _, g := range prev.Spec.Resources {
+				prevCount += len(g.Items)
+			}
+		}
+		for _, g := range prev.Spec.Resources {
+			gk := schema.GroupKind{Group: g.Group, Kind: g.Kind}
+			for _, ref := range g.Items {
+				if k := (key{gk, ref}); !seen[k] {
+					seen[k] = true
+					removed = append(removed, prunedResource{
+						gvk: gk.WithVersion(g.Version),
+						ref: ref,
+					})
+				}
+			}
+		}
+	}
+	return removed, prevCount, nil
+}
+
+// prune records in the status which resources of previous versions are pruned
+// and orphans those that must be kept. The pruned resources are deleted by
+// the garbage collector once the previous ResourceSets are deleted. They are
+// deleted explicitly instead if PrunePropagation, PruneConcurrency or
+// PruneWaitForDeletion is set, or if other resources are too young to be
+// pruned, since the previous ResourceSets are kept then. If the prune limits
+// are exceeded, nothing is deleted and the resources are recorded with a
+// warning instead.
+func (s *Synk) prune(ctx context.Context, rs *apps.ResourceSet, opts *applyOptions) error {
+	removed, prevCount, err := s.removedResources(ctx, rs, opts.name, opts.version)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return lessPrunedResource(&removed[i], &removed[j])
+	})
+	opts.pruneDeferred = false
+	for i := range removed {
+		r := &removed[i]
+		if r.reason, err = s.removedReason(ctx, *r, opts.PruneAllowList); err != nil {
+			return errors.Wrapf(err, "check ownership of %s %s", r.gvk.Kind, r.ref.Name)
+		}
+		if !isDeletedReason(r.reason) {
+			continue
+		}
+		if young, err := s.tooYoungToPrune(ctx, *r, opts.MinPruneAge); err != nil {
+			return errors.Wrapf(err, "check age of %s %s/%s", r.gvk.Kind, r.ref.Namespace, r.ref.Name)
+		} else if young {
+			r.reason = apps.PruneReasonSkippedTooYoung
+			opts.pruneDeferred = true
+		}
+	}
+	limitErr := limitPrune(removed, prevCount, opts)
+	opts.pruneLimited = limitErr != nil
+	groups := map[schema.GroupVersionKind][]apps.ResourceStatus{}
+	for i := range removed {
+		r := &removed[i]
+		var warnings []string
+		if r.reason == apps.PruneReasonExceedsPruneLimit {
+			warnings = []string{limitErr.Error()}
+		}
+		action := apps.ResourceActionDelete
+		if !isDeletedReason(r.reason) {
+			action = apps.ResourceActionNone
+		}
+		if r.reason == apps.PruneReasonSkippedNotInAllowList {
+			if err := s.orphan(ctx, *r, opts.name, opts.version); err != nil {
+				return errors.Wrapf(err, "orphan %s %s/%s", r.gvk.Kind, r.ref.Namespace, r.ref.Name)
+			}
+		}
+		groups[r.gvk] = append(groups[r.gvk], apps.ResourceStatus{
+			Namespace:   r.ref.Namespace,
+			Name:        r.ref.Name,
+			Action:      action,
+			Warnings:    warnings,
+			PruneReason: r.reason,
+		})
+	}
+	rs.Status.Pruned = nil
+	for gvk, items := range groups {
+		rs.Status.Pruned = append(rs.Status.Pruned, apps.ResourceSetStatusGroup{
+			Group:   gvk.Group,
+			Version: gvk.Version,
+			Kind:    gvk.Kind,
+			Items:   items,
+		})
+	}
+	sort.Slice(rs.Status.Pruned, func(i, j int) bool {
+		return lessResourceSetStatusGroup(&rs.Status.Pruned[i], &rs.Status.Pruned[j])
+	})
+	// Above the limits, nothing is deleted and the previous ResourceSets keep
+	// the resources they own. Deferred resources keep them as well, so the
+	// others are deleted explicitly.
+	if !opts.pruneLimited && (len(opts.PrunePropagation) > 0 || opts.pruneDeferred || opts.PruneConcurrency > 0 || opts.PruneWaitForDeletion) {
+		if err := s.deletePrunedResources(ctx, removed, opts); err != nil {
+			return err
+		}
+	}
+	if opts.StatusUpdateMode == StatusUpdateNone {
+		return nil
+	}
+	return s.patchResourceSetStatus(ctx, rs)
+}
+
+// deletePrunedResources deletes the pruned resources in reverse apply order,
+// so that eg namespaces go last. Up to opts.PruneConcurrency resources of the
+// same kind are deleted in parallel, and all of them are deleted before the
+// next kind.
+func (s *Synk) deletePrunedResources(ctx context.Context, removed []prunedResource, opts *applyOptions) error {
+	var pending []prunedResource
+	for i := len(removed) - 1; i >= 0; i-- {
+		if r := removed[i]; r.reason == apps.PruneReasonRemovedFromSet || r.reason == apps.PruneReasonPrunedByAllowList {
+			pending = append(pending, r)
+		}
+	}
+	concurrency := opts.PruneConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	for len(pending) > 0 {
+		n := 1
+		for n < len(pending) && pending[n].gvk == pending[0].gvk {
+			n++
+		}
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			firstErr error
+		)
+		for _, r := range pending[:n] {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(r prunedResource) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := s.deletePrunedAndWait(ctx, r, opts); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = errors.Wrapf(err, "delete %s %s/%s", r.gvk.Kind, r.ref.Namespace, r.ref.Name)
+					}
+					mu.Unlock()
+				}
+			}(r)
+		}
+		wg.Wait()
+		if firstErr != nil {
+			return firstErr
+		}
+		pending = pending[n:]
+	}
+	return nil
+}
+
+// deletePrunedAndWait deletes the resource and, with PruneWaitForDeletion,
+// waits until it is gone, ie its finalizers completed.
+func (s *Synk) deletePrunedAndWait(ctx context.Context, r prunedResource, opts *applyOptions) error {
+	policy, ok := opts.PrunePropagation[r.gvk]
+	if !ok {
+		policy = metav1.DeletePropagationBackground
+	}
+	deleted, err := s.deletePruned(ctx, r, opts.name, opts.version, policy)
+	if err != nil || deleted == nil {
+		return err
+	}
+	opts.logf(deleted, apps.ResourceActionDelete, "pruned")
+	if !opts.PruneWaitForDeletion {
+		return nil
+	}
+	timeout := opts.PruneTimeout
+	if timeout <= 0 {
+		timeout = defaultPruneTimeout
+	}
+	client, err := s.prunedClient(r)
+	if err != nil || client == nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		live, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) || err == nil && live.GetUID() != deleted.GetUID() {
+			opts.logf(deleted, apps.ResourceActionDelete, "removed")
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("not removed after %s, finalizers: %v", timeout, live.GetFinalizers())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
+
+// errPruneLimitExceeded is the cause of the warning for resources that were
+// kept since pruning would exceed MaxPruneFraction or MaxPruneCount.
+var errPruneLimitExceeded = errors.New("prune limit exceeded")
+
+// isDeletedReason returns true if resources with the prune reason are deleted.
+func isDeletedReason(reason apps.PruneReason) bool {
+	return reason == apps.PruneReasonRemovedFromSet || reason == apps.PruneReasonPrunedByAllowList
+}
+
+// limitPrune keeps all removed resources that would be deleted with
+// PruneReasonExceedsPruneLimit if their number exceeds the limits in opts.
+// It returns the error that describes the exceeded limit.
+func limitPrune(removed []prunedResource, prevCount int, opts *applyOptions) error {
+	count := 0
+	for _, r := range removed {
+		if isDeletedReason(r.reason) {
+			count++
+		}
+	}
+	err := checkPruneLimit(count, prevCount, opts)
+	if err == nil {
+		return nil
+	}
+	for i := range removed {
+		if isDeletedReason(removed[i].reason) {
+			removed[i].reason = apps.PruneReasonExceedsPruneLimit
+		}
+	}
+	return err
+}
+
+// checkPruneLimit returns an error if pruning count of the prevCount resources
+// of the previous version exceeds the limits in opts.
+func checkPruneLimit(count, prevCount int, opts *applyOptions) error {
+	if opts.MaxPruneCount > 0 && count > opts.MaxPruneCount {
+		return errors.Wrapf(errPruneLimitExceeded, "%d resources would be pruned, the maximum is %d", count, opts.MaxPruneCount)
+	}
+	if opts.MaxPruneFraction > 0 && prevCount > 0 {
+		if f := float64(count) / float64(prevCount); f > opts.MaxPruneFraction {
+			return errors.Wrapf(errPruneLimitExceeded, "%d of %d resources (%.0f%%) would be pruned, the maximum is %.0f%%",
+				count, prevCount, 100*f, 100*opts.MaxPruneFraction)
+		}
+	}
+	return nil
+}
+
+// tooYoungToPrune returns true if the resource was created less than minAge
+// ago.
+func (s *Synk) tooYoungToPrune(ctx context.Context, r prunedResource, minAge time.Duration) (bool, error) {
+	if minAge <= 0 {
+		return false, nil
+	}
+	client, err := s.prunedClient(r)
+	if err != nil || client == nil {
+		return false, err
+	}
+	obj, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return time.Since(obj.GetCreationTimestamp().Time) < minAge, nil
+}
+
+// prunedClient returns the client for the resource. It is nil if the resource
+// type no longer exists.
+func (s *Synk) prunedClient(r prunedResource) (dynamic.ResourceInterface, error) {
+	mapping, err := s.mapper.RESTMapping(r.gvk.GroupKind(), r.gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "get REST mapping")
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return s.client.Resource(mapping.Resource), nil
+	}
+	return s.client.Resource(mapping.Resource).Namespace(r.ref.Namespace), nil
+}
+
+// deletePruned deletes the resource with the given propagation policy unless
+// it isn't owned by a previous version of the set anymore. It returns the
+// deleted resource, which is nil if nothing was deleted.
+func (s *Synk) deletePruned(ctx context.Context, r prunedResource, name string, version int32, policy metav1.DeletionPropagation) (*unstructured.Unstructured, error) {
+	client, err := s.prunedClient(r)
+	if err != nil || client == nil {
+		return nil, err
+	}
+	obj, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, or := range obj.GetOwnerReferences() {
+		if !isResourceSetRef(or, s.resourceSetGVR().Group) {
+			continue
+		}
+		if n, v, ok := decodeResourceSetName(or.Name); !ok || n != name || v >= version {
+			return nil, nil
+		}
+	}
+	uid := obj.GetUID()
+	err = client.Delete(ctx, r.ref.Name, metav1.DeleteOptions{
+		PropagationPolicy: &policy,
+		Preconditions:     &metav1.Preconditions{UID: &uid},
+	})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// orphan releases the resource from the previous versions of the set so that
+// it isn't garbage collected with them and is managed manually from now on.
+func (s *Synk) orphan(ctx context.Context, r prunedResource, name string, version int32) error {
+	client, err := s.prunedClient(r)
+	if err != nil || client == nil {
+		return err
+	}
+	obj, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !releaseOwnerRef(obj, name, s.resourceSetGVR().Group, version) {
+		return nil
+	}
+	_, err = client.Update(ctx, obj, metav1.UpdateOptions{FieldManager: fieldManager})
+	return err
+}
+
+// releaseOwnerRef reverses setOwnerRef for the versions of the set below the
+// given version, which are ResourceSets of the given group. Other owner
+// references are kept. It returns false if there was nothing to remove.
+func releaseOwnerRef(r *unstructured.Unstructured, name, group string, version int32) bool {
+	var refs []metav1.OwnerReference
+	for _, or := range r.GetOwnerReferences() {
+		if isResourceSetRef(or, group) {
+			if n, v, ok := decodeResourceSetName(or.Name); ok && n == name && v < version {
+				continue
+			}
+		}
+		refs = append(refs, or)
+	}
+	if len(refs) == len(r.GetOwnerReferences()) {
+		return false
+	}
+	r.SetOwnerReferences(refs)
+	return true
+}
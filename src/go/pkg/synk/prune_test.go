@@ -0,0 +1,629 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestPruneReason(t *testing.T) {
+	var (
+		crd    = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+		cm     = schema.GroupKind{Kind: "ConfigMap"}
+		deploy = schema.GroupKind{Group: "apps", Kind: "Deployment"}
+	)
+	tests := []struct {
+		desc      string
+		gk        schema.GroupKind
+		allowList []schema.GroupKind
+		want      apps.PruneReason
+	}{
+		{"crd", crd, nil, apps.PruneReasonExemptCRD},
+		{"crd in allow-list", crd, []schema.GroupKind{crd}, apps.PruneReasonExemptCRD},
+		{"no allow-list", cm, nil, apps.PruneReasonRemovedFromSet},
+		{"in allow-list", cm, []schema.GroupKind{cm}, apps.PruneReasonPrunedByAllowList},
+		{"not in allow-list", deploy, []schema.GroupKind{cm}, apps.PruneReasonSkippedNotInAllowList},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := pruneReason(tc.gk, tc.allowList); got != tc.want {
+				t.Errorf("pruneReason(%v, %v) = %q, want %q", tc.gk, tc.allowList, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyRecordsPrunedResources(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	if _, err := s.Apply(ctx, "test", nil,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+		newUnstructured("apps/v1", "Deployment", "ns1", "dp1"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	opts := &ApplyOptions{
+		PruneAllowList: []schema.GroupKind{{Kind: "ConfigMap"}},
+		// The fake client can't strategic-merge-patch unstructured objects.
+		PatchStrategy: PatchStrategyMergeOverLive,
+	}
+	rs, err := s.Apply(ctx, "test", opts,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want apps.ResourceSetStatus
+	unmarshalYAML(t, &want, `
+pruned:
+- version: v1
+  kind: ConfigMap
+  items:
+  - namespace: ns1
+    name: cm2
+    action: Delete
+    pruneReason: PrunedByAllowList
+- group: apps
+  version: v1
+  kind: Deployment
+  items:
+  - namespace: ns1
+    name: dp1
+    action: None
+    pruneReason: SkippedNotInAllowList`)
+	if !reflect.DeepEqual(rs.Status.Pruned, want.Pruned) {
+		t.Errorf("expected pruned status\n%v\nbut got\n%v", want.Pruned, rs.Status.Pruned)
+	}
+
+	dp, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Get(ctx, "dp1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := dp.GetOwnerReferences(); len(refs) != 0 {
+		t.Errorf("expected orphaned deployment without owner references, got %v", refs)
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "test.v1" {
+		t.Errorf("expected pruned ConfigMap to be owned by test.v1, got %v", refs)
+	}
+}
+
+// deleteRecorder records the deletions of resources other than ResourceSets
+// with their propagation policy, which the fake client doesn't keep track of.
+type deleteRecorder struct {
+	dynamic.Interface
+	deletes *[]string
+}
+
+func (c *deleteRecorder) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &recordingResource{c.Interface.Resource(gvr), gvr, c.deletes}
+}
+
+type recordingResource struct {
+	dynamic.NamespaceableResourceInterface
+	gvr     schema.GroupVersionResource
+	deletes *[]string
+}
+
+func (r *recordingResource) Namespace(ns string) dynamic.ResourceInterface {
+	return &recordingNamespacedResource{r.NamespaceableResourceInterface.Namespace(ns), r.gvr, r.deletes}
+}
+
+func (r *recordingResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	recordDelete(r.deletes, r.gvr, name, opts)
+	return r.NamespaceableResourceInterface.Delete(ctx, name, opts, subresources...)
+}
+
+type recordingNamespacedResource struct {
+	dynamic.ResourceInterface
+	gvr     schema.GroupVersionResource
+	deletes *[]string
+}
+
+func (r *recordingNamespacedResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	recordDelete(r.deletes, r.gvr, name, opts)
+	return r.ResourceInterface.Delete(ctx, name, opts, subresources...)
+}
+
+// recordDeleteMu guards the recorded deletions of concurrent prunes.
+var recordDeleteMu sync.Mutex
+
+func recordDelete(deletes *[]string, gvr schema.GroupVersionResource, name string, opts metav1.DeleteOptions) {
+	if gvr == resourceSetGVR {
+		return
+	}
+	recordDeleteMu.Lock()
+	defer recordDeleteMu.Unlock()
+	policy := "default"
+	if opts.PropagationPolicy != nil {
+		policy = string(*opts.PropagationPolicy)
+	}
+	*deletes = append(*deletes, fmt.Sprintf("%s:%s", name, policy))
+}
+
+func TestSynk_ApplyDeletesPrunedResourcesWithPropagation(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	if _, err := s.Apply(ctx, "test", nil,
+		newUnstructured("v1", "Namespace", "", "ns2"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+		newUnstructured("apps/v1", "Deployment", "ns1", "dp1"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	s.client = &deleteRecorder{Interface: s.client, deletes: &got}
+	opts := &ApplyOptions{
+		PrunePropagation: map[schema.GroupVersionKind]metav1.DeletionPropagation{
+			{Group: "apps", Version: "v1", Kind: "Deployment"}: metav1.DeletePropagationForeground,
+		},
+		PatchStrategy: PatchStrategyMergeOverLive,
+	}
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Namespaces are deleted last.
+	want := []string{"dp1:Foreground", "cm2:Background", "ns2:Background"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected deletions %v, got %v", want, got)
+	}
+	if _, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Get(ctx, "dp1", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected dp1 to be deleted")
+	}
+}
+
+func TestSynk_ApplyPrunesConcurrentlyByKind(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	resources := []*unstructured.Unstructured{
+		newUnstructured("v1", "Namespace", "", "ns2"),
+		newUnstructured("apps/v1", "Deployment", "ns1", "dp1"),
+		newUnstructured("apps/v1", "Deployment", "ns1", "dp2"),
+	}
+	for i := 1; i <= 5; i++ {
+		resources = append(resources, newUnstructured("v1", "ConfigMap", "ns1", fmt.Sprintf("cm%d", i)))
+	}
+	if _, err := s.Apply(ctx, "test", nil, resources...); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	s.client = &deleteRecorder{Interface: s.client, deletes: &got}
+	var (
+		mu     sync.Mutex
+		pruned []string
+	)
+	opts := &ApplyOptions{
+		PruneConcurrency: 3,
+		PatchStrategy:    PatchStrategyMergeOverLive,
+		Log: func(r *unstructured.Unstructured, a apps.ResourceAction, status, msg string) {
+			if a == apps.ResourceActionDelete {
+				mu.Lock()
+				defer mu.Unlock()
+				pruned = append(pruned, r.GetKind()+"/"+r.GetName()+": "+msg)
+			}
+		},
+	}
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deployments go before ConfigMaps and namespaces last, but the order
+	// within a kind depends on the scheduling.
+	kinds := map[string]string{"dp1": "dp", "dp2": "dp", "ns2": "ns"}
+	var order []string
+	for _, d := range got {
+		k, ok := kinds[strings.Split(d, ":")[0]]
+		if !ok {
+			k = "cm"
+		}
+		if len(order) == 0 || order[len(order)-1] != k {
+			order = append(order, k)
+		}
+	}
+	if want := []string{"dp", "cm", "ns"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("expected deletions by kind in order %v, got %v", want, got)
+	}
+	if len(got) != 7 {
+		t.Errorf("expected 7 deletions, got %v", got)
+	}
+	sort.Strings(pruned)
+	if len(pruned) != 7 || pruned[0] != "ConfigMap/cm2: pruned" {
+		t.Errorf("expected progress for each pruned resource, got %v", pruned)
+	}
+}
+
+func TestSynk_ApplyPruneWaitsForDeletion(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	tests := []struct {
+		desc string
+		// polls is the number of Gets after which the finalizers
+		// completed. Zero means never.
+		polls   int
+		wantErr string
+	}{
+		{"removed after finalizers", 3, ""},
+		{"finalizers don't complete", 0, "not removed after 20ms"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			if _, err := s.Apply(ctx, "test", nil,
+				newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+				newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+			); err != nil {
+				t.Fatal(err)
+			}
+			// The apiserver keeps cm2 until its finalizers completed.
+			deleted, polls := false, 0
+			f.fake.PrependReactor("delete", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+				deleted = true
+				return true, nil, nil
+			})
+			f.fake.PrependReactor("get", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if !deleted || action.(k8stest.GetAction).GetName() != "cm2" {
+					return false, nil, nil
+				}
+				polls++
+				if tc.polls > 0 && polls >= tc.polls {
+					return true, nil, k8serrors.NewNotFound(corev1.Resource("configmaps"), "cm2")
+				}
+				return false, nil, nil
+			})
+			var logged []string
+			opts := &ApplyOptions{
+				PruneWaitForDeletion: true,
+				PruneTimeout:         20 * time.Millisecond,
+				PatchStrategy:        PatchStrategyMergeOverLive,
+				Log: func(r *unstructured.Unstructured, a apps.ResourceAction, status, msg string) {
+					if a == apps.ResourceActionDelete {
+						logged = append(logged, r.GetName()+": "+msg)
+					}
+				},
+			}
+			_, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"cm2: pruned", "cm2: removed"}; !reflect.DeepEqual(logged, want) {
+				t.Errorf("expected progress %v, got %v", want, logged)
+			}
+			if polls != tc.polls {
+				t.Errorf("expected %d polls, got %d", tc.polls, polls)
+			}
+		})
+	}
+}
+
+func TestCheckPruneLimit(t *testing.T) {
+	tests := []struct {
+		desc             string
+		count, prevCount int
+		opts             *ApplyOptions
+		wantErr          bool
+	}{
+		{"no limit", 10, 10, &ApplyOptions{}, false},
+		{"below count", 2, 10, &ApplyOptions{MaxPruneCount: 2}, false},
+		{"above count", 3, 10, &ApplyOptions{MaxPruneCount: 2}, true},
+		{"below fraction", 5, 10, &ApplyOptions{MaxPruneFraction: 0.5}, false},
+		{"above fraction", 6, 10, &ApplyOptions{MaxPruneFraction: 0.5}, true},
+		{"no previous resources", 1, 0, &ApplyOptions{MaxPruneFraction: 0.5}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := checkPruneLimit(tc.count, tc.prevCount, newApplyOptions("test", tc.opts))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("checkPruneLimit(%d, %d) = %v, want error: %v", tc.count, tc.prevCount, err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, errPruneLimitExceeded) {
+				t.Errorf("expected errPruneLimitExceeded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyKeepsResourcesAbovePruneLimit(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	if _, err := s.Apply(ctx, "test", nil,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm3"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	opts := &ApplyOptions{
+		MaxPruneFraction: 0.5,
+		PatchStrategy:    PatchStrategyMergeOverLive,
+	}
+	// PlanApply keeps the resources as well.
+	plan, err := s.PlanApply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 3 {
+		t.Fatalf("expected 3 planned changes, got %d", len(plan.Changes))
+	}
+	for _, c := range plan.Changes[1:] {
+		if c.Action != apps.ResourceActionNone || c.PruneReason != apps.PruneReasonExceedsPruneLimit {
+			t.Errorf("expected %s to be kept in plan, got action %q, reason %q", c.Name, c.Action, c.PruneReason)
+		}
+	}
+	if len(plan.Prune) != 0 {
+		t.Errorf("expected no planned prunes, got %v", plan.Prune)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "maximum is 50%") {
+		t.Errorf("expected prune limit warning in plan, got %q", plan.Warnings)
+	}
+
+	rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Status.Phase != apps.ResourceSetPhaseSettled {
+		t.Errorf("expected resources to be applied, got phase %q", rs.Status.Phase)
+	}
+	if rs.Labels[currentLabel] != "true" {
+		t.Errorf("expected %s to be marked current", rs.Name)
+	}
+	for _, g := range rs.Status.Pruned {
+		for _, item := range g.Items {
+			if item.Action != apps.ResourceActionNone || item.PruneReason != apps.PruneReasonExceedsPruneLimit {
+				t.Errorf("expected %s to be kept, got action %q, reason %q", item.Name, item.Action, item.PruneReason)
+			}
+			if len(item.Warnings) != 1 || !strings.Contains(item.Warnings[0], "maximum is 50%") {
+				t.Errorf("expected prune limit warning for %s, got %q", item.Name, item.Warnings)
+			}
+		}
+	}
+	// The previous version is kept to prune its resources later.
+	if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected previous ResourceSet to be kept: %v", err)
+	}
+	for _, name := range []string{"cm2", "cm3"} {
+		if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+
+	opts.MaxPruneFraction = 0
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected previous ResourceSet to be deleted")
+	}
+}
+
+func TestSynk_ApplyDefersPruningYoungResources(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	old := newUnstructured("v1", "ConfigMap", "ns1", "old")
+	old.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-2 * time.Hour)))
+	young := newUnstructured("v1", "ConfigMap", "ns1", "young")
+	young.SetCreationTimestamp(metav1.Now())
+	if _, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"), old, young); err != nil {
+		t.Fatal(err)
+	}
+	opts := &ApplyOptions{
+		MinPruneAge:   time.Hour,
+		PatchStrategy: PatchStrategyMergeOverLive,
+	}
+	rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]apps.PruneReason{}
+	for _, g := range rs.Status.Pruned {
+		for _, item := range g.Items {
+			reasons[item.Name] = item.PruneReason
+		}
+	}
+	want := map[string]apps.PruneReason{
+		"old":   apps.PruneReasonRemovedFromSet,
+		"young": apps.PruneReasonSkippedTooYoung,
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("expected prune reasons %v, got %v", want, reasons)
+	}
+	cms := s.client.Resource(corev1.SchemeGroupVersion.WithResource("configmaps")).Namespace("ns1")
+	if _, err := cms.Get(ctx, "old", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected old ConfigMap to be deleted, got %v", err)
+	}
+	if _, err := cms.Get(ctx, "young", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected young ConfigMap to be kept: %v", err)
+	}
+	// The previous version is kept to prune the young resource later.
+	if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected previous ResourceSet to be kept: %v", err)
+	}
+
+	opts.MinPruneAge = 0
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected previous ResourceSet to be deleted")
+	}
+}
+
+func TestSynk_ApplyReleasesResourcesExcludedFromPruning(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	var deletes []string
+	s := f.newSynk()
+	s.client = &deleteRecorder{s.client, &deletes}
+
+	controller := metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "controller", UID: "pod-uid"}
+	dp := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	dp.SetOwnerReferences([]metav1.OwnerReference{controller})
+	if _, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"), dp); err != nil {
+		t.Fatal(err)
+	}
+	opts := &ApplyOptions{
+		PruneAllowList:   []schema.GroupKind{{Kind: "ConfigMap"}},
+		PrunePropagation: map[schema.GroupVersionKind]metav1.DeletionPropagation{},
+		PatchStrategy:    PatchStrategyMergeOverLive,
+	}
+	opts.PrunePropagation[dp.GroupVersionKind()] = metav1.DeletePropagationForeground
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := s.client.Resource(gvrs["deployments"]).Namespace("ns1").Get(ctx, "dp1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected released Deployment to survive: %v", err)
+	}
+	if refs := live.GetOwnerReferences(); !reflect.DeepEqual(refs, []metav1.OwnerReference{controller}) {
+		t.Errorf("expected only the controller owner reference, got %v", refs)
+	}
+	if len(deletes) != 0 {
+		t.Errorf("expected no deletions, got %v", deletes)
+	}
+	if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected previous ResourceSet to be deleted")
+	}
+}
+
+func TestReleaseOwnerRef(t *testing.T) {
+	r := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	ref := func(name string) metav1.OwnerReference {
+		return metav1.OwnerReference{APIVersion: "apps.cloudrobotics.com/v1alpha1", Kind: "ResourceSet", Name: name}
+	}
+	r.SetOwnerReferences([]metav1.OwnerReference{ref("test.v1"), ref("other.v1"), ref("test.v3")})
+
+	if !releaseOwnerRef(r, "test", resourceSetGVR.Group, 3) {
+		t.Fatal("expected owner reference to be released")
+	}
+	if got, want := r.GetOwnerReferences(), []metav1.OwnerReference{ref("other.v1"), ref("test.v3")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected owner references %v, got %v", want, got)
+	}
+	if releaseOwnerRef(r, "test", resourceSetGVR.Group, 3) {
+		t.Error("expected nothing to release")
+	}
+}
+
+func TestSynk_ApplyOwnsOptedInCRDs(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	s.mapper = mapper
+
+	newCRD := func(plural, kind string, owned bool) *unstructured.Unstructured {
+		crd := &unstructured.Unstructured{}
+		unmarshalYAML(t, &crd.Object, fmt.Sprintf(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: %[1]s.example.com
+spec:
+  group: example.com
+  names:
+    kind: %[2]s
+    plural: %[1]s
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true`, plural, kind))
+		if owned {
+			crd.SetAnnotations(map[string]string{ownCRDAnnotation: "true"})
+		}
+		return crd
+	}
+	opts := &ApplyOptions{SkipCRDWait: true, PatchStrategy: PatchStrategyMergeOverLive}
+	rs, err := s.Apply(ctx, "test", opts, newCRD("widgets", "Widget", true), newCRD("gadgets", "Gadget", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crds := s.client.Resource(schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"})
+	for _, tc := range []struct {
+		name      string
+		wantOwned bool
+	}{
+		{"widgets.example.com", true},
+		{"gadgets.example.com", false},
+	} {
+		live, err := crds.Get(ctx, tc.name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs := live.GetOwnerReferences()
+		if owned := len(refs) == 1 && refs[0].Name == rs.Name; owned != tc.wantOwned {
+			t.Errorf("expected %s to be owned %v, got owner references %v", tc.name, tc.wantOwned, refs)
+		}
+	}
+
+	// Removing the CRDs prunes the owned one only.
+	rs, err = s.Apply(ctx, "test", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]apps.PruneReason{}
+	for _, g := range rs.Status.Pruned {
+		for _, item := range g.Items {
+			reasons[item.Name] = item.PruneReason
+		}
+	}
+	want := map[string]apps.PruneReason{
+		"widgets.example.com": apps.PruneReasonRemovedFromSet,
+		"gadgets.example.com": apps.PruneReasonExemptCRD,
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("expected prune reasons %v, got %v", want, reasons)
+	}
+}
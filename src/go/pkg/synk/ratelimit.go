@@ -0,0 +1,62 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// maxRateLimitRetries bounds how often a resource is applied again after
+	// the apiserver responded with 429 TooManyRequests.
+	maxRateLimitRetries = 5
+	// defaultRateLimitDelay is used if the response doesn't suggest a delay.
+	defaultRateLimitDelay = time.Second
+	// maxRateLimitDelay bounds the delay suggested by the apiserver.
+	maxRateLimitDelay = time.Minute
+)
+
+// rateLimitWait waits before retrying a rate-limited or unauthorized request.
+// It is a variable to allow tests to skip and record the delays.
+var rateLimitWait = func(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// rateLimitDelay returns how long to wait before retrying if err is a 429
+// TooManyRequests response. The delay is the Retry-After suggested by the
+// apiserver.
+func rateLimitDelay(err error) (time.Duration, bool) {
+	err = errors.Cause(err)
+	if !k8serrors.IsTooManyRequests(err) {
+		return 0, false
+	}
+	d := defaultRateLimitDelay
+	if secs, ok := k8serrors.SuggestsClientDelay(err); ok && secs > 0 {
+		d = time.Duration(secs) * time.Second
+	}
+	if d > maxRateLimitDelay {
+		d = maxRateLimitDelay
+	}
+	return d, true
+}
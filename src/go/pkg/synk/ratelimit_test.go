@@ -0,0 +1,128 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestRateLimitDelay(t *testing.T) {
+	tests := []struct {
+		desc   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{"nil", nil, 0, false},
+		{"conflict", k8serrors.NewConflict(gvrs["configmaps"].GroupResource(), "cm1", errors.New("conflict")), 0, false},
+		{"retry after", k8serrors.NewTooManyRequests("slow down", 3), 3 * time.Second, true},
+		{"wrapped", errors.Wrap(k8serrors.NewTooManyRequests("slow down", 3), "apply"), 3 * time.Second, true},
+		{"no retry after", k8serrors.NewTooManyRequests("slow down", 0), defaultRateLimitDelay, true},
+		{"capped", k8serrors.NewTooManyRequests("slow down", 3600), maxRateLimitDelay, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := rateLimitDelay(tc.err)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("rateLimitDelay() = %s, %v, want %s, %v", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneBacksOffWhenRateLimited(t *testing.T) {
+	defer func(w func(context.Context, time.Duration) error) { rateLimitWait = w }(rateLimitWait)
+	var delays []time.Duration
+	rateLimitWait = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	tests := []struct {
+		desc       string
+		rejections int
+		wantErr    bool
+	}{
+		{"retried until accepted", 2, false},
+		{"fails after retries", maxRateLimitRetries + 1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			delays = nil
+			f := newFixture(t)
+			s := f.newSynk()
+			rejected := 0
+			f.fake.PrependReactor("create", "configmaps", func(k8stest.Action) (bool, runtime.Object, error) {
+				if rejected == tc.rejections {
+					return false, nil, nil
+				}
+				rejected++
+				return true, nil, k8serrors.NewTooManyRequests("slow down", 2)
+			})
+			var logs []string
+			opts := &ApplyOptions{
+				PatchStrategy: PatchStrategyMergeOverLive,
+				Log: func(_ *unstructured.Unstructured, _ apps.ResourceAction, _, msg string) {
+					logs = append(logs, msg)
+				},
+			}
+			_, err := s.applyOne(context.Background(), newUnstructured("v1", "ConfigMap", "ns1", "cm1"), nil, newApplyOptions("test", opts))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr && !k8serrors.IsTooManyRequests(errors.Cause(err)) {
+				t.Errorf("expected TooManyRequests error, got %v", err)
+			}
+			retries := tc.rejections
+			if retries > maxRateLimitRetries {
+				retries = maxRateLimitRetries
+			}
+			var want []time.Duration
+			for i := 0; i < retries; i++ {
+				want = append(want, 2*time.Second)
+			}
+			if !reflect.DeepEqual(delays, want) {
+				t.Errorf("expected delays %v, got %v", want, delays)
+			}
+			if len(logs) != retries || logs[0] != "rate limited, retrying in 2s" {
+				t.Errorf("expected %d backoff logs, got %q", retries, logs)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneStopsBackoffOnCancel(t *testing.T) {
+	f := newFixture(t)
+	s := f.newSynk()
+	f.fake.PrependReactor("create", "configmaps", func(k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewTooManyRequests("slow down", 60)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.applyOne(ctx, newUnstructured("v1", "ConfigMap", "ns1", "cm1"), nil, newApplyOptions("test", &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}))
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// readyTimeoutAnnotation overrides ApplyOptions.ReadyTimeout for a
+	// resource. The value is a duration as understood by time.ParseDuration,
+	// eg "10m".
+	readyTimeoutAnnotation = "core.cloudrobotics.com/ready-timeout"
+	// healthGateAnnotation designates the resource of a set whose readiness
+	// decides the set's outcome, eg a Job that runs smoke tests. Apply waits
+	// for it even without WaitForReady and marks the ResourceSet as Failed
+	// if it fails to apply or doesn't become ready. A gated Job fails as soon
+	// as its Failed condition is true. At most one resource of a set may have
+	// the annotation with the value "true".
+	healthGateAnnotation = "core.cloudrobotics.com/health-gate"
+
+	defaultReadyTimeout = 5 * time.Minute
+)
+
+// readyPollInterval is a variable to allow shorter intervals in tests.
+var readyPollInterval = 2 * time.Second
+
+// resourceClient returns the client for the resource's type and namespace.
+func (s *Synk) resourceClient(r *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := r.GroupVersionKind()
+	mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, errors.Wrap(err, "get REST mapping")
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return s.client.Resource(mapping.Resource), nil
+	}
+	return s.client.Resource(mapping.Resource).Namespace(r.GetNamespace()), nil
+}
+
+// readyTimeout returns the time to wait for the resource to become ready.
+func readyTimeout(r *unstructured.Unstructured, opts *applyOptions) (time.Duration, error) {
+	if v, ok := r.GetAnnotations()[readyTimeoutAnnotation]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid %s annotation", readyTimeoutAnnotation)
+		}
+		return d, nil
+	}
+	if opts.ReadyTimeout > 0 {
+		return opts.ReadyTimeout, nil
+	}
+	return defaultReadyTimeout, nil
+}
+
+// waitForReadyAndPrune waits for the resources to become ready like
+// waitForReady and prunes the resources of previous versions meanwhile. It is
+// only called once all resources were applied successfully, so that the
+// replacements of pruned resources exist. Both stages are bounded by their own
+// concurrency, ReadyConcurrency and PruneConcurrency. A readiness error takes
+// precedence over a prune error, so that Reconcile still requeues while
+// resources may become ready.
+func (s *Synk) waitForReadyAndPrune(ctx context.Context, rs *apps.ResourceSet, opts *applyOptions, results applyResults) error {
+	// Include the applied resources in the status that prune writes.
+	setStatusGroups(rs, results)
+	var (
+		wg       sync.WaitGroup
+		pruneErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pruneErr = s.prune(ctx, rs, opts)
+	}()
+	readyErr := s.waitForReady(ctx, opts, results, false)
+	wg.Wait()
+	switch {
+	case pruneErr == nil:
+		return readyErr
+	case readyErr == nil:
+		return errors.Wrap(pruneErr, "prune")
+	default:
+		return errors.Wrapf(readyErr, "prune: %s; wait for readiness", pruneErr)
+	}
+}
+
+// waitForReady polls all successfully applied resources until they are ready
+// or their timeout expired. Resources that don't become ready are recorded as
+// failed. Without WaitForReady or all, only resources with a WaitForCondition
+// and the health gate are polled.
+func (s *Synk) waitForReady(ctx context.Context, opts *applyOptions, results applyResults, all bool) error {
+	type pending struct {
+		res      *applyResult
+		deadline time.Time
+		index    int
+	}
+	var (
+		start    = time.Now()
+		waiting  []pending
+		failed   int
+		timedOut int
+	)
+	for _, r := range results.list() {
+		if r.err != nil || r.action == apps.ResourceActionSkip || isCustomResourceDefinition(r.resource) {
+			continue
+		}
+		if _, ok := opts.WaitForCondition[r.resource.GroupVersionKind()]; !ok && !opts.WaitForReady && !all && !isHealthGate(r.resource) {
+			continue
+		}
+		timeout, err := readyTimeout(r.resource, opts)
+		if err != nil {
+			r.err = err
+			failed++
+			continue
+		}
+		r.readyTimeout = &metav1.Duration{Duration: timeout}
+		waiting = append(waiting, pending{res: r, deadline: start.Add(timeout), index: len(waiting)})
+	}
+	concurrency := opts.ReadyConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	for len(waiting) > 0 {
+		var (
+			next []pending
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+		)
+		check := func(p pending) {
+			ready, err := s.isReady(ctx, p.res.resource, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			var condErr *conditionFailedError
+			switch {
+			case errors.As(err, &condErr):
+				p.res.err = condErr
+				opts.errorf(p.res.resource, p.res.action, "%s", condErr)
+				failed++
+			case err != nil:
+				p.res.err = errors.Wrap(err, "check readiness")
+				failed++
+			case ready:
+				opts.logf(p.res.resource, p.res.action, "ready")
+			case time.Now().After(p.deadline):
+				p.res.err = errors.Errorf("not ready after %s", p.res.readyTimeout.Duration)
+				opts.errorf(p.res.resource, p.res.action, "%s", p.res.err)
+				failed++
+				timedOut++
+			default:
+				next = append(next, p)
+			}
+		}
+		for _, p := range waiting {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(p pending) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				check(p)
+			}(p)
+		}
+		wg.Wait()
+		// Keep the order of the results for the next poll.
+		sort.Slice(next, func(i, j int) bool { return next[i].index < next[j].index })
+		waiting = next
+		if len(waiting) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readyPollInterval):
+		}
+	}
+	if failed > 0 && failed == timedOut {
+		return &notReadyError{count: failed}
+	} else if failed > 0 {
+		return errors.Errorf("%d resources did not become ready", failed)
+	}
+	return nil
+}
+
+// notReadyError is returned if resources didn't fail but only timed out
+// waiting to become ready, so they may still become ready.
+type notReadyError struct {
+	count int
+}
+
+func (e *notReadyError) Error() string {
+	return fmt.Sprintf("%d resources did not become ready", e.count)
+}
+
+// isReady fetches the resource and checks whether it is ready or its
+// WaitForCondition is met.
+func (s *Synk) isReady(ctx context.Context, r *unstructured.Unstructured, opts *applyOptions) (bool, error) {
+	client, err := s.resourceClient(r)
+	if err != nil {
+		return false, err
+	}
+	live, err := client.Get(ctx, r.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if c, ok := opts.WaitForCondition[r.GroupVersionKind()]; ok {
+		return conditionMet(live, c)
+	}
+	if isHealthGate(r) && live.GroupVersionKind().GroupKind().String() == "Job.batch" && hasCondition(live, "Failed", "True") {
+		return false, &conditionFailedError{msg: "health gate Job failed: " + conditionMessage(live, "Failed")}
+	}
+	return resourceReady(live), nil
+}
+
+// isHealthGate returns true if the resource has the health-gate annotation.
+func isHealthGate(r *unstructured.Unstructured) bool {
+	return r.GetAnnotations()[healthGateAnnotation] == "true"
+}
+
+// validateHealthGate checks that at most one resource is the health gate.
+func validateHealthGate(resources []*unstructured.Unstructured) error {
+	var gates []string
+	for _, r := range resources {
+		if isHealthGate(r) {
+			gates = append(gates, resourceKey(r))
+		}
+	}
+	if len(gates) > 1 {
+		return errors.Errorf("only one resource may have the %s annotation, got %d: %s", healthGateAnnotation, len(gates), strings.Join(gates, ", "))
+	}
+	return nil
+}
+
+// healthGateFailed returns true if the health gate failed to apply or to
+// become ready.
+func healthGateFailed(results applyResults) bool {
+	for _, r := range results {
+		if r.err != nil && isHealthGate(r.resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHealthGate returns true if a successfully applied resource is the health
+// gate, so that Apply needs to wait for it.
+func hasHealthGate(results applyResults) bool {
+	for _, r := range results {
+		if r.err == nil && isHealthGate(r.resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceReady returns true if the workload controllers have rolled out the
+// resource's latest generation. Types without a known notion of readiness are
+// ready if they don't have a Ready condition or if it's true.
+func resourceReady(u *unstructured.Unstructured) bool {
+	gen, _ := nestedInt(u.Object, "metadata", "generation")
+	if g, ok := nestedInt(u.Object, "status", "observedGeneration"); ok && g < gen {
+		return false
+	}
+	status := func(field string) int64 {
+		v, _ := nestedInt(u.Object, "status", field)
+		return v
+	}
+	replicas, ok := nestedInt(u.Object, "spec", "replicas")
+	if !ok {
+		replicas = 1
+	}
+	switch u.GroupVersionKind().GroupKind().String() {
+	case "Deployment.apps":
+		return status("updatedReplicas") >= replicas && status("availableReplicas") >= replicas
+	case "StatefulSet.apps":
+		return status("updatedReplicas") >= replicas && status("readyReplicas") >= replicas
+	case "DaemonSet.apps":
+		desired := status("desiredNumberScheduled")
+		return status("updatedNumberScheduled") >= desired && status("numberReady") >= desired
+	case "Job.batch":
+		return hasCondition(u, "Complete", "True")
+	case "PersistentVolumeClaim":
+		phase, _, _ := unstructured.NestedString(u.Object, "status", "phase")
+		return phase == "Bound"
+	}
+	if cond, ok := findCondition(u, "Ready"); ok {
+		return cond == "True"
+	}
+	return true
+}
+
+// nestedInt returns an integer field, which may have been decoded as a float,
+// eg from YAML.
+func nestedInt(obj map[string]interface{}, fields ...string) (int64, bool) {
+	v, ok, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func hasCondition(u *unstructured.Unstructured, typ, status string) bool {
+	s, ok := findCondition(u, typ)
+	return ok && s == status
+}
+
+// conditionMessage returns the message of the condition of the given type.
+func conditionMessage(u *unstructured.Unstructured, typ string) string {
+	conds, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conds {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["type"] != typ {
+			continue
+		}
+		msg, _ := m["message"].(string)
+		return msg
+	}
+	return ""
+}
+
+// findCondition returns the status of the condition of the given type.
+func findCondition(u *unstructured.Unstructured, typ string) (string, bool) {
+	conds, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conds {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["type"] != typ {
+			continue
+		}
+		s, _ := m["status"].(string)
+		return s, true
+	}
+	return "", false
+}
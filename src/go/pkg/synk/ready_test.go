@@ -0,0 +1,256 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestResourceReady(t *testing.T) {
+	tests := []struct {
+		desc string
+		obj  string
+		want bool
+	}{
+		{"configmap", `
+apiVersion: v1
+kind: ConfigMap`, true},
+		{"deployment rolled out", `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, updatedReplicas: 2, availableReplicas: 2}`, true},
+		{"deployment not observed", `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 3}
+spec: {replicas: 2}
+status: {observedGeneration: 2, updatedReplicas: 2, availableReplicas: 2}`, false},
+		{"deployment unavailable", `
+apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 2}
+status: {updatedReplicas: 2, availableReplicas: 1}`, false},
+		{"statefulset ready", `
+apiVersion: apps/v1
+kind: StatefulSet
+status: {updatedReplicas: 1, readyReplicas: 1}`, true},
+		{"daemonset rolling", `
+apiVersion: apps/v1
+kind: DaemonSet
+status: {desiredNumberScheduled: 3, updatedNumberScheduled: 2, numberReady: 3}`, false},
+		{"job complete", `
+apiVersion: batch/v1
+kind: Job
+status:
+  conditions: [{type: Complete, status: "True"}]`, true},
+		{"job running", `
+apiVersion: batch/v1
+kind: Job`, false},
+		{"pvc pending", `
+apiVersion: v1
+kind: PersistentVolumeClaim
+status: {phase: Pending}`, false},
+		{"custom resource not ready", `
+apiVersion: example.com/v1
+kind: Widget
+status:
+  conditions: [{type: Ready, status: "False"}]`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			var u unstructured.Unstructured
+			unmarshalYAML(t, &u.Object, tc.obj)
+			if got := resourceReady(&u); got != tc.want {
+				t.Errorf("resourceReady() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyWaitsForReady(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+	deploy := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	deploy.SetAnnotations(map[string]string{readyTimeoutAnnotation: "10ms"})
+
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{WaitForReady: true},
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		deploy,
+	)
+	if err == nil {
+		t.Fatal("expected error for resource that didn't become ready")
+	}
+	if len(rs.Status.Failed) != 1 || rs.Status.Failed[0].Kind != "Deployment" {
+		t.Fatalf("expected Deployment to fail, got %v", rs.Status.Failed)
+	}
+	failed := rs.Status.Failed[0].Items[0]
+	if failed.Error != "not ready after 10ms" {
+		t.Errorf("unexpected error %q", failed.Error)
+	}
+	if want := (&metav1.Duration{Duration: 10 * time.Millisecond}); failed.ReadyTimeout == nil || *failed.ReadyTimeout != *want {
+		t.Errorf("expected ready timeout %v, got %v", want, failed.ReadyTimeout)
+	}
+	applied := rs.Status.Applied[0].Items[0]
+	if applied.Action != apps.ResourceActionCreate || applied.ReadyTimeout == nil || applied.ReadyTimeout.Duration != defaultReadyTimeout {
+		t.Errorf("expected ConfigMap to be ready with default timeout, got %+v", applied)
+	}
+}
+
+func TestSynk_ApplyPrunesDuringReadiness(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	tests := []struct {
+		desc        string
+		overlap     bool
+		wantRemoved bool
+	}{
+		{"prune after readiness", false, false},
+		{"prune during readiness", true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFixture(t).newSynk()
+			if _, err := s.Apply(ctx, "test", nil,
+				newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+				newUnstructured("v1", "ConfigMap", "ns1", "removed"),
+			); err != nil {
+				t.Fatal(err)
+			}
+			// The Deployment never becomes ready in the fake cluster.
+			deploy := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+			deploy.SetAnnotations(map[string]string{readyTimeoutAnnotation: "20ms"})
+			opts := &ApplyOptions{
+				PatchStrategy:        PatchStrategyMergeOverLive,
+				WaitForReady:         true,
+				ReadyConcurrency:     2,
+				PruneConcurrency:     2,
+				PruneDuringReadiness: tc.overlap,
+			}
+			rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"), deploy)
+			var notReady *notReadyError
+			if !errors.As(err, &notReady) {
+				t.Fatalf("expected notReadyError, got %v", err)
+			}
+			_, err = s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "removed", metav1.GetOptions{})
+			if removed := k8serrors.IsNotFound(err); removed != tc.wantRemoved {
+				t.Errorf("expected removed ConfigMap to be pruned: %v, got error %v", tc.wantRemoved, err)
+			}
+			if got := len(rs.Status.Pruned); tc.wantRemoved && got != 1 {
+				t.Errorf("expected pruned ConfigMap in status, got %v", rs.Status.Pruned)
+			}
+			if rs.Status.Phase != apps.ResourceSetPhaseDegraded {
+				t.Errorf("expected phase Degraded, got %q", rs.Status.Phase)
+			}
+			// The previous version is kept while resources aren't ready.
+			if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); err != nil {
+				t.Errorf("expected previous ResourceSet to be kept: %s", err)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyHealthGate(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	tests := []struct {
+		desc      string
+		condition string
+		wantErr   bool
+		wantPhase apps.ResourceSetPhase
+	}{
+		{"completed", "Complete", false, apps.ResourceSetPhaseSettled},
+		{"failed", "Failed", true, apps.ResourceSetPhaseFailed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			// The fake cluster doesn't run Jobs, so report the outcome on reads
+			// once the Job was created.
+			created := false
+			f.fake.PrependReactor("create", "jobs", func(action k8stest.Action) (bool, runtime.Object, error) {
+				created = true
+				return false, nil, nil
+			})
+			f.fake.PrependReactor("get", "jobs", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if !created {
+					return false, nil, nil
+				}
+				job := newUnstructured("batch/v1", "Job", "ns1", "smoke-test")
+				job.Object["status"] = map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": tc.condition, "status": "True", "message": "BackoffLimitExceeded"},
+					},
+				}
+				return true, job, nil
+			})
+			job := newUnstructured("batch/v1", "Job", "ns1", "smoke-test")
+			job.SetAnnotations(map[string]string{healthGateAnnotation: "true"})
+
+			// Only the gate is waited for without WaitForReady.
+			rs, err := s.Apply(ctx, "test", nil,
+				newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+				job,
+			)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", tc.wantErr, err)
+			}
+			if rs.Status.Phase != tc.wantPhase {
+				t.Errorf("expected phase %q, got %q", tc.wantPhase, rs.Status.Phase)
+			}
+			if !tc.wantErr {
+				return
+			}
+			if len(rs.Status.Applied) != 1 || rs.Status.Applied[0].Kind != "ConfigMap" {
+				t.Errorf("expected ConfigMap to be applied, got %v", rs.Status.Applied)
+			}
+			if len(rs.Status.Failed) != 1 || rs.Status.Failed[0].Items[0].Error != "health gate Job failed: BackoffLimitExceeded" {
+				t.Errorf("expected failed Job in status, got %v", rs.Status.Failed)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyRejectsSeveralHealthGates(t *testing.T) {
+	s := newFixture(t).newSynk()
+	var resources []*unstructured.Unstructured
+	for _, name := range []string{"cm1", "cm2"} {
+		r := newUnstructured("v1", "ConfigMap", "ns1", name)
+		r.SetAnnotations(map[string]string{healthGateAnnotation: "true"})
+		resources = append(resources, r)
+	}
+	if _, err := s.Apply(context.Background(), "test", nil, resources...); err == nil {
+		t.Fatal("expected error for several health gates")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const defaultRequeueInterval = 30 * time.Second
+
+// Result tells a controller whether the set needs to be reconciled again. It
+// corresponds to reconcile.Result of controller-runtime.
+type Result struct {
+	// Requeue is set if the apply failed with a transient error and should
+	// be retried with backoff, including an UnauthorizedError, since the
+	// client may have refreshed its credentials by then.
+	Requeue bool
+	// RequeueAfter is set if the set hasn't settled yet but may settle
+	// without changes, eg since resources timed out becoming ready, CRDs
+	// are still being established or resources were too young to be pruned.
+	RequeueAfter time.Duration
+}
+
+// Reconcile applies the set like Apply and reports whether a requeue is
+// needed. A controller can map the outcome onto its reconcile contract as
+// follows:
+//
+//	_, res, err := s.Reconcile(ctx, name, opts, resources...)
+//	switch {
+//	case err == nil || res.RequeueAfter > 0:
+//		// Settled if res is zero. Otherwise, the set may still settle
+//		// and is checked again after RequeueAfter.
+//		return reconcile.Result{RequeueAfter: res.RequeueAfter}, nil
+//	case res.Requeue:
+//		// Transient failure, retried with the controller's backoff.
+//		return reconcile.Result{}, err
+//	default:
+//		// Permanent failure, eg an invalid manifest. Retrying won't help
+//		// until the inputs change.
+//		return reconcile.Result{}, reconcile.TerminalError(err)
+//	}
+func (s *Synk) Reconcile(
+	ctx context.Context,
+	name string,
+	opts *ApplyOptions,
+	resources ...*unstructured.Unstructured,
+) (*apps.ResourceSet, Result, error) {
+	o := newApplyOptions(name, opts)
+	rs, err := s.apply(ctx, o, resources...)
+	return rs, reconcileResult(o, err), err
+}
+
+// reconcileResult computes the Result for the outcome of Apply.
+func reconcileResult(opts *applyOptions, err error) Result {
+	interval := opts.RequeueInterval
+	if interval <= 0 {
+		interval = defaultRequeueInterval
+	}
+	var (
+		notReady  *notReadyError
+		notServed *crdNotServedError
+	)
+	switch {
+	case err == nil && opts.pruneDeferred:
+		return Result{RequeueAfter: interval}
+	case err == nil:
+		return Result{}
+	case errors.As(err, &notReady), errors.As(err, &notServed):
+		return Result{RequeueAfter: interval}
+	case IsTransientErr(err), isUnauthorized(err), errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return Result{Requeue: true}
+	}
+	return Result{}
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestReconcileResult(t *testing.T) {
+	tests := []struct {
+		desc     string
+		err      error
+		deferred bool
+		want     Result
+	}{
+		{"settled", nil, false, Result{}},
+		{"prune deferred", nil, true, Result{RequeueAfter: time.Minute}},
+		{"transient", transientErr{errors.New("1/1 resources failed to apply")}, false, Result{Requeue: true}},
+		{"canceled", errors.Wrap(context.Canceled, "apply"), false, Result{Requeue: true}},
+		{"not ready", &notReadyError{count: 2}, false, Result{RequeueAfter: time.Minute}},
+		{"crd not served", errors.Wrap(&crdNotServedError{name: "widgets.example.com"}, "wait for CRDs"), false, Result{RequeueAfter: time.Minute}},
+		{"unauthorized", &UnauthorizedError{Err: errors.New("1/1 resources failed to apply")}, false, Result{Requeue: true}},
+		{"permanent", errors.New("1/1 resources failed to apply: invalid"), false, Result{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := newApplyOptions("test", &ApplyOptions{RequeueInterval: time.Minute})
+			opts.pruneDeferred = tc.deferred
+			if got := reconcileResult(opts, tc.err); got != tc.want {
+				t.Errorf("reconcileResult(%v) = %+v, want %+v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReconcileResult_defaultInterval(t *testing.T) {
+	if got := reconcileResult(newApplyOptions("test", nil), &notReadyError{count: 1}); got.RequeueAfter != defaultRequeueInterval {
+		t.Errorf("expected default requeue interval %s, got %+v", defaultRequeueInterval, got)
+	}
+}
+
+func TestSynk_Reconcile(t *testing.T) {
+	defer func(d time.Duration) { readyPollInterval = d }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+	ctx := context.Background()
+
+	t.Run("settled", func(t *testing.T) {
+		s := newFixture(t).newSynk()
+		rs, res, err := s.Reconcile(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rs == nil || res != (Result{}) {
+			t.Errorf("expected settled set without requeue, got %+v", res)
+		}
+	})
+	t.Run("not ready", func(t *testing.T) {
+		s := newFixture(t).newSynk()
+		deploy := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+		deploy.SetAnnotations(map[string]string{readyTimeoutAnnotation: "10ms"})
+		opts := &ApplyOptions{WaitForReady: true, RequeueInterval: time.Minute}
+		_, res, err := s.Reconcile(ctx, "test", opts, deploy)
+		if err == nil {
+			t.Fatal("expected error for resource that didn't become ready")
+		}
+		if want := (Result{RequeueAfter: time.Minute}); res != want {
+			t.Errorf("expected %+v, got %+v", want, res)
+		}
+	})
+	t.Run("transient error", func(t *testing.T) {
+		f := newFixture(t)
+		s := f.newSynk()
+		f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+			return true, nil, k8serrors.NewInternalError(errors.New("etcd unavailable"))
+		})
+		_, res, err := s.Reconcile(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if want := (Result{Requeue: true}); res != want {
+			t.Errorf("expected %+v, got %+v", want, res)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// recreateField returns the first changed field of the resource that is
+// listed in RecreateFields for its kind, or "" if it can be updated.
+func (o *ApplyOptions) recreateField(live, desired *unstructured.Unstructured) string {
+	triggers := o.RecreateFields[desired.GroupVersionKind()]
+	if len(triggers) == 0 || isCustomResourceDefinition(desired) {
+		return ""
+	}
+	for _, f := range o.changedFields(live, desired) {
+		if isIgnoredField(f, triggers) {
+			return f
+		}
+	}
+	return ""
+}
+
+// replaceOnError returns true if the resource may be replaced after the
+// update failed with err. Kinds with RecreateFields are only replaced if
+// those fields change.
+func (o *ApplyOptions) replaceOnError(r *unstructured.Unstructured, err error) bool {
+	return len(o.RecreateFields[r.GroupVersionKind()]) == 0 && canReplace(r, err)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSynk_ApplyRecreatesOnTriggerFields(t *testing.T) {
+	service := func(t *testing.T, typ string, port int) *unstructured.Unstructured {
+		u := newUnstructured("v1", "Service", "ns1", "svc1")
+		u.Object["spec"] = map[string]interface{}{
+			"type":  typ,
+			"ports": []interface{}{map[string]interface{}{"port": int64(port)}},
+		}
+		return u
+	}
+	tests := []struct {
+		desc       string
+		typ        string
+		port       int
+		wantAction apps.ResourceAction
+	}{
+		{"other field changed", "ClusterIP", 8080, apps.ResourceActionUpdate},
+		{"trigger field changed", "NodePort", 80, apps.ResourceActionReplace},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			opts := func() *ApplyOptions {
+				return &ApplyOptions{
+					PatchStrategy: PatchStrategyMergeOverLive,
+					RecreateFields: map[schema.GroupVersionKind][]string{
+						{Version: "v1", Kind: "Service"}: {"spec.type"},
+					},
+				}
+			}
+			if _, err := s.Apply(ctx, "test", opts(), service(t, "ClusterIP", 80)); err != nil {
+				t.Fatal(err)
+			}
+			desired := service(t, tc.typ, tc.port)
+			plan, err := s.PlanApply(ctx, "test", opts(), desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plan.Changes[0].Action; got != tc.wantAction {
+				t.Errorf("expected planned action %s, got %s", tc.wantAction, got)
+			}
+			applied := len(f.fake.Actions())
+			rs, err := s.Apply(ctx, "test", opts(), desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rs.Status.Applied[0].Items[0].Action; got != tc.wantAction {
+				t.Errorf("expected action %s, got %s", tc.wantAction, got)
+			}
+			deleted := false
+			for _, a := range f.fake.Actions()[applied:] {
+				if a.GetVerb() == "delete" && a.GetResource().Resource == "services" {
+					deleted = true
+				}
+			}
+			if want := tc.wantAction == apps.ResourceActionReplace; deleted != want {
+				t.Errorf("expected Service to be deleted: %v, got %v", want, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"math"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// renamedFromAnnotation is set on the ResourceSet created by Rename to the
+// previous name of the set.
+const renamedFromAnnotation = "core.cloudrobotics.com/renamed-from"
+
+// Rename transfers the resources of the latest ResourceSet of oldName to a new
+// ResourceSet for newName and deletes the ResourceSets of oldName. Afterwards
+// the resources can be applied as newName without owner conflicts.
+//
+// Rename fails if a ResourceSet for newName exists, unless it was created by
+// an interrupted Rename from oldName, which is then completed. Resources of
+// older versions of oldName that weren't pruned yet are deleted by the garbage
+// collector with the old ResourceSets.
+func (s *Synk) Rename(ctx context.Context, oldName, newName string) error {
+	if oldName == newName {
+		return errors.Errorf("can't rename ResourceSet %q to itself", oldName)
+	}
+	old, err := s.latest(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	target, err := s.latest(ctx, newName)
+	if err != nil {
+		return err
+	}
+	if target != nil && target.Annotations[renamedFromAnnotation] != oldName {
+		return errors.Errorf("can't rename %q to %q: ResourceSet %q already exists", oldName, newName, target.Name)
+	}
+	if old == nil {
+		if target != nil {
+			// An interrupted Rename deleted the old ResourceSets already.
+			return nil
+		}
+		return errors.Errorf("no ResourceSet found for %q", oldName)
+	}
+	if target == nil {
+		target = &apps.ResourceSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      resourceSetName(newName, 1),
+				Namespace: s.namespace,
+				Labels: map[string]string{
+					"name":        newName,
+					checksumLabel: old.Labels[checksumLabel],
+					currentLabel:  "true",
+				},
+				Annotations: map[string]string{renamedFromAnnotation: oldName},
+			},
+			Spec:   old.Spec,
+			Status: old.Status,
+		}
+		if err := s.createResourceSet(ctx, target); err != nil {
+			return errors.Wrapf(err, "create ResourceSet %q", target.Name)
+		}
+	}
+	for _, g := range old.Spec.Resources {
+		gvk := schema.GroupVersionKind{Group: g.Group, Version: g.Version, Kind: g.Kind}
+		for _, ref := range g.Items {
+			if err := s.transferOwnership(ctx, prunedResource{gvk: gvk, ref: ref}, oldName, target); err != nil {
+				return errors.Wrapf(err, "transfer %s %s/%s", gvk.Kind, ref.Namespace, ref.Name)
+			}
+		}
+	}
+	return s.deleteResourceSets(ctx, oldName, math.MaxInt32)
+}
+
+// transferOwnership replaces the owner reference to a ResourceSet of oldName
+// with one to the target set. Resources that don't exist anymore or aren't
+// owned by oldName are left unchanged.
+func (s *Synk) transferOwnership(ctx context.Context, r prunedResource, oldName string, target *apps.ResourceSet) error {
+	client, err := s.prunedClient(r)
+	if err != nil || client == nil {
+		return err
+	}
+	live, err := client.Get(ctx, r.ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, or := range live.GetOwnerReferences() {
+		if !isResourceSetRef(or, s.resourceSetGVR().Group) {
+			continue
+		}
+		if n, _, ok := decodeResourceSetName(or.Name); !ok || n != oldName {
+			continue
+		}
+		block := or.BlockOwnerDeletion != nil && *or.BlockOwnerDeletion
+		setOwnerRef(live, target, block)
+		_, err := client.Update(ctx, live, metav1.UpdateOptions{FieldManager: fieldManager})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSynk_Rename(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	if _, err := s.Apply(ctx, "app", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rename(ctx, "app", "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.resourceSets().Get(ctx, "app.v1", metav1.GetOptions{}); err == nil {
+		t.Errorf("expected ResourceSet app.v1 to be deleted")
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "myapp.v1" {
+		t.Errorf("expected owner reference to myapp.v1, got %v", refs)
+	}
+
+	// Repeating an interrupted Rename completes it.
+	if err := s.Rename(ctx, "app", "myapp"); err != nil {
+		t.Errorf("expected repeated Rename to succeed, got %v", err)
+	}
+
+	// The resources can be applied under the new name.
+	opts := &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}
+	rs, err := s.Apply(ctx, "myapp", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name != "myapp.v2" {
+		t.Errorf("expected ResourceSet myapp.v2, got %q", rs.Name)
+	}
+}
+
+func TestSynk_RenameRejectsExistingTarget(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	if _, err := s.Apply(ctx, "app", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Apply(ctx, "myapp", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm2")); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Rename(ctx, "app", "myapp")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected error for existing target, got %v", err)
+	}
+	if _, err := s.resourceSets().Get(ctx, "app.v1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected ResourceSet app.v1 to be kept: %v", err)
+	}
+}
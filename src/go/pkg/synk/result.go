@@ -0,0 +1,105 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"sort"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ApplyResultVersion is the schema version of ApplyResult.
+//
+// Within a schema version, fields of ApplyResult and ResourceResult and the
+// values of their string enums are only ever added, never removed, renamed or
+// changed in meaning. Consumers must ignore unknown fields and values.
+const ApplyResultVersion = "synk.cloudrobotics.com/v1"
+
+// ApplyResult is a stable summary of the outcome of an apply, eg for status
+// reporting in dashboards. It is decoupled from the ResourceSet API, which may
+// change between releases.
+type ApplyResult struct {
+	// Version is always ApplyResultVersion.
+	Version string `json:"version"`
+	// Name of the applied set and of the ResourceSet version.
+	Name        string `json:"name"`
+	ResourceSet string `json:"resourceSet"`
+	// SourceRevision is the ApplyOptions.SourceRevision of the apply.
+	SourceRevision string `json:"sourceRevision,omitempty"`
+	// Phase is one of Pending, Settled, Degraded and Failed.
+	Phase      string      `json:"phase"`
+	StartedAt  metav1.Time `json:"startedAt,omitempty"`
+	FinishedAt metav1.Time `json:"finishedAt,omitempty"`
+	// Resources of the set, followed by the pruned resources of previous
+	// versions.
+	Resources []ResourceResult `json:"resources"`
+}
+
+// ResourceResult is the outcome of applying or pruning a single resource.
+type ResourceResult struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Action is one of None, Create, Update, Replace, Skip and Delete.
+	Action   string   `json:"action"`
+	Error    string   `json:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	// PruneReason is only set for pruned resources.
+	PruneReason string `json:"pruneReason,omitempty"`
+}
+
+// NewApplyResult returns the ApplyResult for the ResourceSet returned by
+// Apply.
+func NewApplyResult(rs *apps.ResourceSet) *ApplyResult {
+	name, _, _ := decodeResourceSetName(rs.Name)
+	res := &ApplyResult{
+		Version:        ApplyResultVersion,
+		Name:           name,
+		ResourceSet:    rs.Name,
+		SourceRevision: rs.Annotations[SourceRevisionAnnotation],
+		Phase:          string(rs.Status.Phase),
+		StartedAt:      rs.Status.StartedAt,
+		FinishedAt:     rs.Status.FinishedAt,
+		Resources:      []ResourceResult{},
+	}
+	add := func(groups []apps.ResourceSetStatusGroup) []ResourceResult {
+		var l []ResourceResult
+		for _, g := range groups {
+			for _, item := range g.Items {
+				l = append(l, ResourceResult{
+					Group:       g.Group,
+					Version:     g.Version,
+					Kind:        g.Kind,
+					Namespace:   item.Namespace,
+					Name:        item.Name,
+					Action:      string(item.Action),
+					Error:       item.Error,
+					Warnings:    item.Warnings,
+					PruneReason: string(item.PruneReason),
+				})
+			}
+		}
+		sort.SliceStable(l, func(i, j int) bool {
+			return lessResourceResult(&l[i], &l[j])
+		})
+		return l
+	}
+	res.Resources = append(res.Resources, add(append(rs.Status.Applied, rs.Status.Failed...))...)
+	res.Resources = append(res.Resources, add(rs.Status.Pruned)...)
+	return res
+}
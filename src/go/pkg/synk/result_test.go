@@ -0,0 +1,69 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"encoding/json"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+)
+
+func TestNewApplyResult(t *testing.T) {
+	var rs apps.ResourceSet
+	unmarshalYAML(t, &rs, `
+metadata:
+  name: test.v3
+status:
+  phase: Failed
+  applied:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - namespace: ns1
+      name: cm2
+      action: Create
+      warnings: ["deprecated"]
+  failed:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - namespace: ns1
+      name: cm1
+      action: Update
+      error: invalid
+  pruned:
+  - group: apps
+    version: v1
+    kind: Deployment
+    items:
+    - namespace: ns1
+      name: dp1
+      action: Delete
+      pruneReason: RemovedFromSet`)
+
+	b, err := json.Marshal(NewApplyResult(&rs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":"synk.cloudrobotics.com/v1","name":"test","resourceSet":"test.v3","phase":"Failed",` +
+		`"startedAt":null,"finishedAt":null,"resources":[` +
+		`{"version":"v1","kind":"ConfigMap","namespace":"ns1","name":"cm1","action":"Update","error":"invalid"},` +
+		`{"version":"v1","kind":"ConfigMap","namespace":"ns1","name":"cm2","action":"Create","warnings":["deprecated"]},` +
+		`{"group":"apps","version":"v1","kind":"Deployment","namespace":"ns1","name":"dp1","action":"Delete","pruneReason":"RemovedFromSet"}]}`
+	if string(b) != want {
+		t.Errorf("unexpected JSON\nwant: %s\ngot:  %s", want, b)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// StripNulls is a sanitizer for ApplyOptions.Sanitizers that removes fields
+// with null values, eg "creationTimestamp: null" in generated manifests.
+// Null list items are kept.
+func StripNulls(r *unstructured.Unstructured) error {
+	stripNulls(r.Object)
+	return nil
+}
+
+func stripNulls(m map[string]interface{}) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			stripNulls(v)
+		case []interface{}:
+			for _, item := range v {
+				if im, ok := item.(map[string]interface{}); ok {
+					stripNulls(im)
+				}
+			}
+		}
+	}
+}
+
+// StripStatus is a sanitizer for ApplyOptions.Sanitizers that removes the
+// status, which is ignored when applying but stored in the manifests of
+// exported objects.
+func StripStatus(r *unstructured.Unstructured) error {
+	unstructured.RemoveNestedField(r.Object, "status")
+	return nil
+}
+
+// StripServerMetadata is a sanitizer for ApplyOptions.Sanitizers that
+// removes the metadata set by the apiserver and by Synk, eg the UID and owner
+// references, from manifests of exported objects.
+func StripServerMetadata(r *unstructured.Unstructured) error {
+	for _, f := range []string{
+		"uid",
+		"resourceVersion",
+		"generation",
+		"creationTimestamp",
+		"deletionTimestamp",
+		"deletionGracePeriodSeconds",
+		"selfLink",
+		"managedFields",
+		"ownerReferences",
+	} {
+		unstructured.RemoveNestedField(r.Object, "metadata", f)
+	}
+	if ann := r.GetAnnotations(); ann != nil {
+		delete(ann, corev1.LastAppliedConfigAnnotation)
+		if len(ann) == 0 {
+			ann = nil
+		}
+		r.SetAnnotations(ann)
+	}
+	return nil
+}
+
+// sanitize runs the sanitizers on all resources in order.
+func sanitize(resources []*unstructured.Unstructured, sanitizers []func(*unstructured.Unstructured) error) error {
+	for _, r := range resources {
+		for _, f := range sanitizers {
+			if err := f(r); err != nil {
+				return errors.Wrapf(err, "sanitize %s", resourceKey(r))
+			}
+		}
+	}
+	return nil
+}
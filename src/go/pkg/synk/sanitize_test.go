@@ -0,0 +1,113 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSanitize(t *testing.T) {
+	var r, want unstructured.Unstructured
+	unmarshalYAML(t, &r.Object, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: d1
+  namespace: ns1
+  creationTimestamp: null
+spec:
+  template:
+    metadata:
+      creationTimestamp: null
+    spec:
+      containers:
+      - name: c1
+        resources: null
+      - null
+status: {}
+`)
+	unmarshalYAML(t, &want.Object, `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: d1
+  namespace: ns1
+spec:
+  template:
+    metadata: {}
+    spec:
+      containers:
+      - name: c1
+      - null
+`)
+	var order []string
+	record := func(name string) func(*unstructured.Unstructured) error {
+		return func(*unstructured.Unstructured) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	sanitizers := []func(*unstructured.Unstructured) error{record("first"), StripNulls, StripStatus, record("last")}
+	if err := sanitize([]*unstructured.Unstructured{&r}, sanitizers); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Object, want.Object) {
+		t.Errorf("unexpected result:\n%v\nwant:\n%v", r.Object, want.Object)
+	}
+	if want := []string{"first", "last"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("expected sanitizers to run in order %v, got %v", want, order)
+	}
+
+	failing := func(*unstructured.Unstructured) error { return errors.New("boom") }
+	if err := sanitize([]*unstructured.Unstructured{&r}, []func(*unstructured.Unstructured) error{failing}); err == nil {
+		t.Errorf("expected error from failing sanitizer")
+	}
+}
+
+func TestStripServerMetadata(t *testing.T) {
+	r := &unstructured.Unstructured{}
+	unmarshalYAML(t, &r.Object, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  uid: uid1
+  resourceVersion: "1"
+  generation: 2
+  creationTimestamp: "2024-01-01T00:00:00Z"
+  managedFields:
+  - manager: synk
+  ownerReferences:
+  - kind: ResourceSet
+    name: test.v1
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+  labels:
+    app: foo`)
+	if err := StripServerMetadata(r); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":   "cm1",
+		"labels": map[string]interface{}{"app": "foo"},
+	}
+	if got := r.Object["metadata"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected metadata %v, got %v", want, got)
+	}
+}
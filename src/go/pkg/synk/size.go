@@ -0,0 +1,139 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// maxObjectSize is the default request size limit of etcd, which bounds
+	// the size of the ResourceSet and of every applied resource.
+	maxObjectSize = 1536 * 1024
+	// sizeWarningThreshold is the size above which plans warn that an object
+	// approaches maxObjectSize.
+	sizeWarningThreshold = maxObjectSize * 8 / 10
+	// placeholderUID has the length of the UIDs assigned by the apiserver.
+	placeholderUID = "00000000-0000-0000-0000-000000000000"
+)
+
+// estimateResourceSetSize returns the size of the serialized ResourceSet
+// after the apply, with the status that the planned changes would produce.
+// changes must start with the changes for resources, in the same order,
+// followed by the pruned resources.
+func estimateResourceSetSize(
+	set *apps.ResourceSet,
+	opts *applyOptions,
+	resources []*unstructured.Unstructured,
+	changes []PlannedChange,
+) (int, error) {
+	sum, err := checksum(resources)
+	if err != nil {
+		return 0, errors.Wrap(err, "compute checksum")
+	}
+	rs := set.DeepCopy()
+	gvk := resourceSetGVK(set)
+	rs.TypeMeta = metav1.TypeMeta{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind}
+	rs.UID = placeholderUID
+	rs.Labels = map[string]string{
+		"name":        opts.name,
+		checksumLabel: sum,
+		currentLabel:  "true",
+	}
+	setAnnotations(rs, opts.resourceSetAnnotations())
+
+	results := applyResults{}
+	for i, r := range resources {
+		applied := r.DeepCopy()
+		applied.SetUID(placeholderUID)
+		applied.SetGeneration(1)
+		results[resourceKey(r)] = &applyResult{
+			resource: applied,
+			action:   changes[i].Action,
+			err:      changes[i].Err,
+			checksum: manifestChecksum(r),
+		}
+	}
+	setStatusGroups(rs, results)
+
+	pruned := map[schema.GroupVersionKind][]apps.ResourceStatus{}
+	for _, c := range changes[len(resources):] {
+		pruned[c.GroupVersionKind] = append(pruned[c.GroupVersionKind], apps.ResourceStatus{
+			Namespace:   c.Namespace,
+			Name:        c.Name,
+			Action:      c.Action,
+			PruneReason: c.PruneReason,
+		})
+	}
+	for gvk, items := range pruned {
+		rs.Status.Pruned = append(rs.Status.Pruned, apps.ResourceSetStatusGroup{
+			Group:   gvk.Group,
+			Version: gvk.Version,
+			Kind:    gvk.Kind,
+			Items:   items,
+		})
+	}
+	sort.Slice(rs.Status.Pruned, func(i, j int) bool {
+		return lessResourceSetStatusGroup(&rs.Status.Pruned[i], &rs.Status.Pruned[j])
+	})
+	rs.Status.StartedAt = metav1.Now()
+	rs.Status.FinishedAt = rs.Status.StartedAt
+	rs.Status.Phase = resourceSetPhase(&rs.Status)
+
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return 0, errors.Wrap(err, "encode ResourceSet")
+	}
+	return len(data), nil
+}
+
+// manifestSize returns the size of the serialized resource.
+func manifestSize(r *unstructured.Unstructured) (int, error) {
+	data, err := json.Marshal(r.Object)
+	if err != nil {
+		return 0, errors.Wrapf(err, "encode %s", describe(r))
+	}
+	return len(data), nil
+}
+
+// sizeWarnings returns warnings for the ResourceSet and the manifests of the
+// plan that approach the size limit of etcd.
+func sizeWarnings(plan *Plan) []string {
+	var warnings []string
+	if plan.ResourceSetSize > sizeWarningThreshold {
+		warnings = append(warnings, fmt.Sprintf("ResourceSet %s is %d bytes, close to the limit of %d bytes",
+			plan.ResourceSet, plan.ResourceSetSize, maxObjectSize))
+	}
+	for _, c := range plan.Changes {
+		if c.ManifestSize <= sizeWarningThreshold {
+			continue
+		}
+		name := c.Name
+		if c.Namespace != "" {
+			name = c.Namespace + "/" + c.Name
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %s is %d bytes, close to the limit of %d bytes",
+			c.Kind, name, c.ManifestSize, maxObjectSize))
+	}
+	return warnings
+}
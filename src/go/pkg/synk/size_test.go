@@ -0,0 +1,116 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_PlanApplyEstimatesResourceSetSize(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	var resources []*unstructured.Unstructured
+	for i := 0; i < 50; i++ {
+		resources = append(resources, newUnstructured("v1", "ConfigMap", "ns1", fmt.Sprintf("cm%02d", i)))
+	}
+	plan, err := s.PlanApply(ctx, "test", nil, resources...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Warnings) > 0 {
+		t.Errorf("expected no warnings, got %v", plan.Warnings)
+	}
+	for _, c := range plan.Changes {
+		if c.ManifestSize == 0 {
+			t.Errorf("expected manifest size for %s", c.Name)
+		}
+	}
+
+	// Like the apiserver, assign UIDs, which are recorded in the status.
+	f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured)
+		obj.SetUID(placeholderUID)
+		obj.SetGeneration(1)
+		return false, nil, nil
+	})
+	if _, err := s.Apply(ctx, "test", &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}, resources...); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := s.resourceSets().Get(ctx, plan.ResourceSet, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stored object has a few more fields, eg the resource version.
+	unstructured.RemoveNestedField(rs.Object, "metadata", "resourceVersion")
+	data, err := json.Marshal(rs.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := plan.ResourceSetSize - len(data); d < -256 || d > 256 {
+		t.Errorf("expected estimated size %d to be close to stored size %d", plan.ResourceSetSize, len(data))
+	}
+}
+
+func TestSynk_PlanApplyWarnsAboutLargeManifests(t *testing.T) {
+	f := newFixture(t)
+	s := f.newSynk()
+
+	large := newUnstructured("v1", "ConfigMap", "ns1", "large")
+	unstructured.SetNestedField(large.Object, strings.Repeat("x", sizeWarningThreshold), "data", "blob")
+	plan, err := s.PlanApply(context.Background(), "test", nil,
+		newUnstructured("v1", "ConfigMap", "ns1", "small"),
+		large,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.Changes[0].ManifestSize; got <= sizeWarningThreshold {
+		t.Errorf("expected size of large manifest above %d, got %d", sizeWarningThreshold, got)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "ConfigMap ns1/large") {
+		t.Errorf("expected warning about ConfigMap ns1/large, got %v", plan.Warnings)
+	}
+}
+
+func TestSizeWarnings(t *testing.T) {
+	plan := &Plan{
+		ResourceSet:     "test.v1",
+		ResourceSetSize: sizeWarningThreshold + 1,
+		Changes: []PlannedChange{
+			{Name: "small", ManifestSize: 10},
+			{Name: "ns", ManifestSize: maxObjectSize},
+		},
+	}
+	plan.Changes[1].Kind = "Namespace"
+	want := []string{
+		fmt.Sprintf("ResourceSet test.v1 is %d bytes, close to the limit of %d bytes", sizeWarningThreshold+1, maxObjectSize),
+		fmt.Sprintf("Namespace ns is %d bytes, close to the limit of %d bytes", maxObjectSize, maxObjectSize),
+	}
+	got := sizeWarnings(plan)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected warnings\n%v\nbut got\n%v", want, got)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+)
+
+// slowApplyTimer calls ApplyOptions.OnSlowApply once the apply has been
+// running for SlowApplyThreshold.
+type slowApplyTimer struct {
+	timer *time.Timer
+
+	mu sync.Mutex
+	// rs is a copy of the applied ResourceSet, since the original is
+	// modified while the callback may run.
+	rs *apps.ResourceSet
+}
+
+// startSlowApplyTimer returns nil unless both SlowApplyThreshold and
+// OnSlowApply are set.
+func startSlowApplyTimer(opts *applyOptions) *slowApplyTimer {
+	if opts.SlowApplyThreshold <= 0 || opts.OnSlowApply == nil {
+		return nil
+	}
+	t := &slowApplyTimer{}
+	start := time.Now()
+	t.timer = time.AfterFunc(opts.SlowApplyThreshold, func() {
+		t.mu.Lock()
+		rs := t.rs
+		t.mu.Unlock()
+		opts.OnSlowApply(time.Since(start), rs)
+	})
+	return t
+}
+
+// setResourceSet sets the ResourceSet that is passed to the callback.
+func (t *slowApplyTimer) setResourceSet(rs *apps.ResourceSet) {
+	if t == nil || rs == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rs = rs.DeepCopy()
+}
+
+// stop cancels the callback if the threshold hasn't passed yet.
+func (t *slowApplyTimer) stop() {
+	if t == nil {
+		return
+	}
+	t.timer.Stop()
+}
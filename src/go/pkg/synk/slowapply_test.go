@@ -0,0 +1,88 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_ApplyCallsOnSlowApply(t *testing.T) {
+	tests := []struct {
+		desc      string
+		threshold time.Duration
+		wantCall  bool
+	}{
+		{"slow", 5 * time.Millisecond, true},
+		{"fast", time.Hour, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			f := newFixture(t)
+			s := f.newSynk()
+			// Simulate a slow admission webhook.
+			f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if tc.wantCall {
+					time.Sleep(50 * time.Millisecond)
+				}
+				return false, nil, nil
+			})
+			var (
+				mu      sync.Mutex
+				calls   int
+				elapsed time.Duration
+				rsName  string
+			)
+			opts := &ApplyOptions{
+				SlowApplyThreshold: tc.threshold,
+				OnSlowApply: func(d time.Duration, rs *apps.ResourceSet) {
+					mu.Lock()
+					defer mu.Unlock()
+					calls++
+					elapsed = d
+					if rs != nil {
+						rsName = rs.Name
+					}
+				},
+			}
+			if _, err := s.Apply(context.Background(), "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !tc.wantCall {
+				if calls != 0 {
+					t.Errorf("expected no call for fast apply, got %d", calls)
+				}
+				return
+			}
+			if calls != 1 {
+				t.Fatalf("expected one call, got %d", calls)
+			}
+			if elapsed < tc.threshold {
+				t.Errorf("expected elapsed time of at least %s, got %s", tc.threshold, elapsed)
+			}
+			if rsName != "test.v1" {
+				t.Errorf("expected ResourceSet test.v1, got %q", rsName)
+			}
+		})
+	}
+}
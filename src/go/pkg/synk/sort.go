@@ -67,6 +67,10 @@ func gvknnRStatusG(r *apps.ResourceSetStatusGroup) *gvknn {
 	return newGvknn(r.Group, r.Version, r.Kind, "", "")
 }
 
+func gvknnPlannedChange(c *PlannedChange) *gvknn {
+	return newGvknn(c.Group, c.Version, c.Kind, c.Namespace, c.Name)
+}
+
 func lessUnstructured(l, r *unstructured.Unstructured) bool {
 	return less(gvknnUnstructured(l), gvknnUnstructured(r))
 }
@@ -78,3 +82,21 @@ func lessResourceSetSpecGroup(l, r *apps.ResourceSetSpecGroup) bool {
 func lessResourceSetStatusGroup(l, r *apps.ResourceSetStatusGroup) bool {
 	return less(gvknnRStatusG(l), gvknnRStatusG(r))
 }
+
+func lessPlannedChange(l, r *PlannedChange) bool {
+	return less(gvknnPlannedChange(l), gvknnPlannedChange(r))
+}
+
+func lessPrunedResource(l, r *prunedResource) bool {
+	return less(
+		newGvknn(l.gvk.Group, l.gvk.Version, l.gvk.Kind, l.ref.Namespace, l.ref.Name),
+		newGvknn(r.gvk.Group, r.gvk.Version, r.gvk.Kind, r.ref.Namespace, r.ref.Name),
+	)
+}
+
+func lessResourceResult(l, r *ResourceResult) bool {
+	return less(
+		newGvknn(l.Group, l.Version, l.Kind, l.Namespace, l.Name),
+		newGvknn(r.Group, r.Version, r.Kind, r.Namespace, r.Name),
+	)
+}
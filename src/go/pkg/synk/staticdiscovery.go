@@ -0,0 +1,173 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"sync"
+
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// NewWithResources returns a new Synk object that uses a fixed list of API
+// resources instead of the discovery API, eg on clusters where discovery is
+// slow or unreliable. The lists must contain all resource types that are
+// applied, including ResourceSets, and each list must set GroupVersion. The
+// first version of a group that appears in the lists is its preferred version.
+//
+// CRDs applied by Synk add their served versions to the list once they were
+// applied, so that their instances can be applied in the same set. Other
+// types, eg from aggregated API servers, can be added with AddResources.
+func NewWithResources(client dynamic.Interface, resources []*metav1.APIResourceList) *Synk {
+	d := &staticDiscovery{}
+	for _, l := range resources {
+		d.add(l)
+	}
+	return New(client, d)
+}
+
+// AddResources adds a list of API resources to a Synk object returned by
+// NewWithResources. It returns false for other Synk objects, which use the
+// discovery API.
+func (s *Synk) AddResources(list *metav1.APIResourceList) bool {
+	d, ok := s.discovery.(*staticDiscovery)
+	if !ok {
+		return false
+	}
+	d.add(list)
+	s.resetMapper()
+	return true
+}
+
+// staticDiscovery implements the parts of the discovery API that are used by
+// Synk and the REST mapper from a fixed list of resources. Other methods panic.
+type staticDiscovery struct {
+	discovery.CachedDiscoveryInterface
+
+	mu        sync.Mutex
+	resources []*metav1.APIResourceList
+}
+
+// add adds the resources of the list, replacing resources of the same name.
+func (d *staticDiscovery) add(list *metav1.APIResourceList) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, l := range d.resources {
+		if l.GroupVersion != list.GroupVersion {
+			continue
+		}
+		for _, r := range list.APIResources {
+			replaced := false
+			for i := range l.APIResources {
+				if l.APIResources[i].Name == r.Name {
+					l.APIResources[i], replaced = r, true
+				}
+			}
+			if !replaced {
+				l.APIResources = append(l.APIResources, r)
+			}
+		}
+		return
+	}
+	d.resources = append(d.resources, list.DeepCopy())
+}
+
+// addCRD adds the served versions of the CRD.
+func (d *staticDiscovery) addCRD(ucrd *unstructured.Unstructured) error {
+	var crd apiextensions.CustomResourceDefinition
+	if err := convert(ucrd, &crd); err != nil {
+		return err
+	}
+	for _, v := range crd.Spec.Versions {
+		if !v.Served {
+			continue
+		}
+		d.add(&metav1.APIResourceList{
+			GroupVersion: schema.GroupVersion{Group: crd.Spec.Group, Version: v.Name}.String(),
+			APIResources: []metav1.APIResource{{
+				Name:         crd.Spec.Names.Plural,
+				SingularName: crd.Spec.Names.Singular,
+				Namespaced:   crd.Spec.Scope == apiextensions.NamespaceScoped,
+				Kind:         crd.Spec.Names.Kind,
+				ShortNames:   crd.Spec.Names.ShortNames,
+				Verbs:        metav1.Verbs{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"},
+			}},
+		})
+	}
+	return nil
+}
+
+func (d *staticDiscovery) Fresh() bool { return true }
+
+func (d *staticDiscovery) Invalidate() {}
+
+func (d *staticDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	groups := &metav1.APIGroupList{}
+	index := map[string]int{}
+	for _, l := range d.resources {
+		gv, err := schema.ParseGroupVersion(l.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		v := metav1.GroupVersionForDiscovery{GroupVersion: l.GroupVersion, Version: gv.Version}
+		if i, ok := index[gv.Group]; ok {
+			groups.Groups[i].Versions = append(groups.Groups[i].Versions, v)
+			continue
+		}
+		index[gv.Group] = len(groups.Groups)
+		groups.Groups = append(groups.Groups, metav1.APIGroup{
+			Name:             gv.Group,
+			Versions:         []metav1.GroupVersionForDiscovery{v},
+			PreferredVersion: v,
+		})
+	}
+	return groups, nil
+}
+
+func (d *staticDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, l := range d.resources {
+		if l.GroupVersion == groupVersion {
+			return l.DeepCopy(), nil
+		}
+	}
+	return nil, k8serrors.NewNotFound(schema.GroupResource{}, groupVersion)
+}
+
+func (d *staticDiscovery) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	groups, err := d.ServerGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+	gs := make([]*metav1.APIGroup, len(groups.Groups))
+	for i := range groups.Groups {
+		gs[i] = &groups.Groups[i]
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rs := make([]*metav1.APIResourceList, len(d.resources))
+	for i, l := range d.resources {
+		rs[i] = l.DeepCopy()
+	}
+	return gs, rs, nil
+}
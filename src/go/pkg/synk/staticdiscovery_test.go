@@ -0,0 +1,122 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestNewWithResources(t *testing.T) {
+	s := NewWithResources(nil, []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "namespaces", Kind: "Namespace"},
+			},
+		},
+	})
+	mapping, err := s.mapper.RESTMapping(schema.GroupKind{Kind: "ConfigMap"}, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.Resource.Resource != "configmaps" || mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		t.Errorf("unexpected mapping for ConfigMap: %v, scope %s", mapping.Resource, mapping.Scope.Name())
+	}
+
+	var crd unstructured.Unstructured
+	unmarshalYAML(t, &crd.Object, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: robots.registry.cloudrobotics.com
+spec:
+  group: registry.cloudrobotics.com
+  names:
+    kind: Robot
+    plural: robots
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true
+  - name: v1alpha0
+    served: false`)
+	robot := schema.GroupKind{Group: "registry.cloudrobotics.com", Kind: "Robot"}
+	if _, err := s.mapper.RESTMapping(robot, "v1alpha1"); !meta.IsNoMatchError(err) {
+		t.Fatalf("expected no match for Robot before adding the CRD, got %v", err)
+	}
+	if err := s.discovery.(*staticDiscovery).addCRD(&crd); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.crdAvailable(&crd); err != nil || !ok {
+		t.Errorf("expected CRD to be available, got %v, %v", ok, err)
+	}
+	s.resetMapper()
+	if _, err := s.mapper.RESTMapping(robot, "v1alpha1"); err != nil {
+		t.Errorf("expected mapping for Robot after adding the CRD, got %v", err)
+	}
+	if _, err := s.mapper.RESTMapping(robot, "v1alpha0"); err == nil {
+		t.Errorf("expected no mapping for unserved version")
+	}
+
+	if !s.AddResources(&metav1.APIResourceList{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "secrets", Kind: "Secret", Namespaced: true}},
+	}) {
+		t.Fatal("AddResources() = false, want true")
+	}
+	for _, kind := range []string{"ConfigMap", "Secret"} {
+		if _, err := s.mapper.RESTMapping(schema.GroupKind{Kind: kind}, "v1"); err != nil {
+			t.Errorf("expected mapping for %s, got %v", kind, err)
+		}
+	}
+}
+
+func TestSynk_WithClientDoesNotShareMapper(t *testing.T) {
+	widgets := &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{{Name: "widgets", Kind: "Widget", Namespaced: true}},
+	}
+	gadgets := &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{{Name: "gadgets", Kind: "Gadget"}},
+	}
+	s1 := NewNamespaced(nil, &staticDiscovery{}, "tenant")
+	s1.AddResources(widgets)
+	s2 := s1.WithClient(nil, &staticDiscovery{})
+	s2.AddResources(gadgets)
+
+	if s2.namespace != "tenant" {
+		t.Errorf("expected namespace %q, got %q", "tenant", s2.namespace)
+	}
+	check := func(s *Synk, kind string, want bool) {
+		t.Helper()
+		_, err := s.mapper.RESTMapping(schema.GroupKind{Group: "example.com", Kind: kind}, "v1")
+		if want && err != nil {
+			t.Errorf("expected mapping for %s: %v", kind, err)
+		} else if !want && !meta.IsNoMatchError(err) {
+			t.Errorf("expected no mapping for %s, got %v", kind, err)
+		}
+	}
+	check(s1, "Widget", true)
+	check(s1, "Gadget", false)
+	check(s2, "Widget", false)
+	check(s2, "Gadget", true)
+}
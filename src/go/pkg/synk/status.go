@@ -0,0 +1,88 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/googlecloudrobotics/ilog"
+)
+
+const defaultStatusUpdateInterval = 10 * time.Second
+
+// statusUpdater writes the progress of an apply to the ResourceSet status
+// with StatusUpdatePeriodic. Changes are coalesced, so that the status is
+// written at most once per interval.
+type statusUpdater struct {
+	s        *Synk
+	interval time.Duration
+
+	mu sync.Mutex
+	// rs is a copy of the applied ResourceSet, so that writes don't race
+	// with readers of the original.
+	rs      *apps.ResourceSet
+	last    time.Time
+	written bool
+}
+
+// newStatusUpdater returns nil unless opts.StatusUpdateMode is Periodic.
+func newStatusUpdater(s *Synk, rs *apps.ResourceSet, opts *applyOptions) *statusUpdater {
+	if opts.StatusUpdateMode != StatusUpdatePeriodic {
+		return nil
+	}
+	interval := opts.StatusUpdateInterval
+	if interval <= 0 {
+		interval = defaultStatusUpdateInterval
+	}
+	return &statusUpdater{s: s, interval: interval, rs: rs.DeepCopy(), last: time.Now()}
+}
+
+// changed writes the status for the results if the interval passed since the
+// last write. Callers must not modify results concurrently.
+func (u *statusUpdater) changed(ctx context.Context, results applyResults) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if time.Since(u.last) < u.interval {
+		return
+	}
+	u.last = time.Now()
+	setStatusGroups(u.rs, results)
+	if err := u.s.patchResourceSetStatus(ctx, u.rs); err != nil {
+		// The final status update will report any persistent error.
+		slog.Warn("Failed to update ResourceSet status", slog.String("Name", u.rs.Name), ilog.Err(err))
+		return
+	}
+	u.written = true
+}
+
+// finish copies the resource version of the last write to rs, which is then
+// used for the final status update.
+func (u *statusUpdater) finish(rs *apps.ResourceSet) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.written {
+		rs.ResourceVersion = u.rs.ResourceVersion
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_ApplyStatusUpdateMode(t *testing.T) {
+	tests := []struct {
+		mode        StatusUpdateMode
+		interval    time.Duration
+		wantUpdates int
+		wantPhase   apps.ResourceSetPhase
+	}{
+		// The status and the current label.
+		{mode: StatusUpdateFinal, wantUpdates: 2, wantPhase: apps.ResourceSetPhaseSettled},
+		// Additionally once per resource.
+		{mode: StatusUpdatePeriodic, interval: time.Nanosecond, wantUpdates: 5, wantPhase: apps.ResourceSetPhaseSettled},
+		// The writes are coalesced within the interval.
+		{mode: StatusUpdatePeriodic, interval: time.Hour, wantUpdates: 2, wantPhase: apps.ResourceSetPhaseSettled},
+		// Only the current label.
+		{mode: StatusUpdateNone, wantUpdates: 1, wantPhase: apps.ResourceSetPhasePending},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.mode)+"/"+tc.interval.String(), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			// Status writes are patches, other writes are updates.
+			updates := 0
+			for _, verb := range []string{"update", "patch"} {
+				f.fake.PrependReactor(verb, "resourcesets", func(action k8stest.Action) (bool, runtime.Object, error) {
+					updates++
+					return false, nil, nil
+				})
+			}
+
+			opts := &ApplyOptions{StatusUpdateMode: tc.mode, StatusUpdateInterval: tc.interval}
+			rs, err := s.Apply(ctx, "test", opts,
+				newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+				newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+				newUnstructured("v1", "ConfigMap", "ns1", "cm3"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updates != tc.wantUpdates {
+				t.Errorf("expected %d ResourceSet updates, got %d", tc.wantUpdates, updates)
+			}
+			if rs.Status.Phase != apps.ResourceSetPhaseSettled {
+				t.Errorf("expected returned phase %q, got %q", apps.ResourceSetPhaseSettled, rs.Status.Phase)
+			}
+			stored, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if phase, _, _ := unstructured.NestedString(stored.Object, "status", "phase"); phase != string(tc.wantPhase) {
+				t.Errorf("expected stored phase %q, got %q", tc.wantPhase, phase)
+			}
+		})
+	}
+}
+
+func TestSynk_patchResourceSetStatus(t *testing.T) {
+	for _, subresource := range []bool{true, false} {
+		t.Run(fmt.Sprintf("subresource=%v", subresource), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			var patched []string
+			f.fake.PrependReactor("patch", "resourcesets", func(action k8stest.Action) (bool, runtime.Object, error) {
+				patched = append(patched, action.GetSubresource())
+				if !subresource && action.GetSubresource() == "status" {
+					return true, nil, k8serrors.NewNotFound(schema.GroupResource{Group: "apps.cloudrobotics.com", Resource: "resourcesets"}, "test.v1")
+				}
+				return false, nil, nil
+			})
+			rs := &apps.ResourceSet{Status: apps.ResourceSetStatus{
+				Phase:  apps.ResourceSetPhaseFailed,
+				Failed: []apps.ResourceSetStatusGroup{{Version: "v1", Kind: "ConfigMap", Items: []apps.ResourceStatus{{Name: "cm1"}}}},
+			}}
+			rs.Name = "test.v1"
+			if err := s.createResourceSet(ctx, rs); err != nil {
+				t.Fatal(err)
+			}
+			// A concurrent change makes the resource version stale.
+			stale := rs.DeepCopy()
+			live, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			live.SetLabels(map[string]string{"foo": "bar"})
+			if _, err := s.resourceSets().Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			stale.Status = apps.ResourceSetStatus{
+				Phase:   apps.ResourceSetPhaseSettled,
+				Applied: []apps.ResourceSetStatusGroup{{Version: "v1", Kind: "ConfigMap", Items: []apps.ResourceStatus{{Name: "cm1"}}}},
+			}
+			if err := s.patchResourceSetStatus(ctx, stale); err != nil {
+				t.Fatal(err)
+			}
+			if stale.Labels["foo"] != "bar" {
+				t.Errorf("expected concurrent label change to be kept, got labels %v", stale.Labels)
+			}
+			if stale.Status.Phase != apps.ResourceSetPhaseSettled || len(stale.Status.Applied) != 1 || len(stale.Status.Failed) != 0 {
+				t.Errorf("expected status to be replaced, got %+v", stale.Status)
+			}
+			want := []string{"status"}
+			if !subresource {
+				want = []string{"status", ""}
+			}
+			if !reflect.DeepEqual(patched, want) {
+				t.Errorf("expected patches of subresources %q, got %q", want, patched)
+			}
+		})
+	}
+}
+
+func TestSynk_createResourceSetWithStatusSubresource(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	// Like the apiserver with the status subresource, drop the status on
+	// creation.
+	tracker := s.client.(*dynamicfake.FakeDynamicClient).Tracker()
+	f.fake.PrependReactor("create", "resourcesets", func(action k8stest.Action) (bool, runtime.Object, error) {
+		u := action.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured).DeepCopy()
+		unstructured.RemoveNestedField(u.Object, "status")
+		return true, u, tracker.Create(resourceSetGVR, u, "")
+	})
+	rs := &apps.ResourceSet{Status: apps.ResourceSetStatus{Phase: apps.ResourceSetPhasePending}}
+	rs.Name = "test.v1"
+	if err := s.createResourceSet(ctx, rs); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phase, _, _ := unstructured.NestedString(stored.Object, "status", "phase"); phase != string(apps.ResourceSetPhasePending) {
+		t.Errorf("expected stored phase %q, got %q", apps.ResourceSetPhasePending, phase)
+	}
+}
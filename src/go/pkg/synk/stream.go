@@ -0,0 +1,318 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ApplyStream applies the resources received from ch as a new version of the
+// ResourceSet specified by 'name', like Apply, but without holding all of
+// them in memory, eg for generated sets with tens of thousands of objects.
+// Each resource is applied as soon as it is received and only its reference
+// and status are kept. The ResourceSet is created with an empty spec, which
+// is completed once ch is closed, before the previous versions are pruned.
+//
+// Since the resources aren't known in advance, they are applied in the order
+// they are received rather than by kind, and options that need the whole set,
+// like HashSuffixKinds, AuditConfigMap, ExpectedCount and SkipIfUnchanged,
+// are rejected or have no effect. Interrupted streams aren't resumed.
+//
+// CRDs are applied as they arrive. Custom resources whose type isn't served
+// yet, eg since their CRD is part of the stream, are buffered until ch is
+// closed and applied after the CRDs were established. Streams with many such
+// resources thus still need memory for them, which is avoided by sending the
+// CRDs ahead of time, eg with a separate Apply.
+//
+// ApplyStream returns once ch is closed or ctx is done. Senders must stop
+// sending when ctx is done.
+func (s *Synk) ApplyStream(
+	ctx context.Context,
+	name string,
+	opts *ApplyOptions,
+	ch <-chan *unstructured.Unstructured,
+) (*apps.ResourceSet, error) {
+	return s.applyStream(ctx, newApplyOptions(name, opts), ch)
+}
+
+func (s *Synk) applyStream(ctx context.Context, opts *applyOptions, ch <-chan *unstructured.Unstructured) (*apps.ResourceSet, error) {
+	if len(opts.HashSuffixKinds) > 0 || opts.AuditConfigMap.Name != "" {
+		return nil, errors.New("HashSuffixKinds and AuditConfigMap are not supported when streaming")
+	}
+	if err := validateAdditionalOwnerRefs(opts.AdditionalOwnerRefs, s.resourceSetGVR().Group); err != nil {
+		return nil, err
+	}
+	slow := startSlowApplyTimer(opts)
+	defer slow.stop()
+
+	prev, err := s.latest(ctx, opts.name)
+	if err != nil {
+		return nil, errors.Wrap(err, "get next ResourceSet version")
+	}
+	if prev != nil && prev.Spec.Suspended {
+		return prev, nil
+	}
+	opts.version = nextVersion(prev)
+	rs := &apps.ResourceSet{}
+	rs.Name = resourceSetName(opts.name, opts.version)
+	rs.Namespace = s.namespace
+	rs.Labels = map[string]string{"name": opts.name}
+	setAnnotations(rs, opts.resourceSetAnnotations())
+	rs.Status = apps.ResourceSetStatus{
+		Phase:     apps.ResourceSetPhasePending,
+		StartedAt: metav1.Now(),
+	}
+	if err := s.createResourceSet(ctx, rs); err != nil {
+		return nil, errors.Wrapf(err, "create resources object %q", rs.Name)
+	}
+	slow.setResourceSet(rs)
+	opts.status = newStatusUpdater(s, rs, opts)
+
+	var (
+		results  = applyResults{}
+		refs     = map[schema.GroupVersionKind][]apps.ResourceRef{}
+		crds     []*unstructured.Unstructured
+		buffered []*unstructured.Unstructured
+	)
+	// record keeps only what the status needs of an applied resource.
+	record := func(r *unstructured.Unstructured, action apps.ResourceAction, err error) {
+		results.set(streamedStatusObject(r), action, err, opts.takeWarnings(r)...)
+		gvk := r.GroupVersionKind()
+		refs[gvk] = append(refs[gvk], apps.ResourceRef{Namespace: r.GetNamespace(), Name: r.GetName()})
+		opts.status.changed(ctx, results)
+	}
+	apply := func(r *unstructured.Unstructured) {
+		sum := manifestChecksum(r)
+		action, err := s.applyRegular(ctx, rs, opts, r)
+		record(r, action, err)
+		results[resourceKey(r)].checksum = sum
+	}
+
+loop:
+	for {
+		var r *unstructured.Unstructured
+		select {
+		case <-ctx.Done():
+			return rs, ctx.Err()
+		case res, ok := <-ch:
+			if !ok {
+				break loop
+			}
+			r = res.DeepCopy()
+		}
+		if reflect.DeepEqual(*r, unstructured.Unstructured{}) || isTestResource(r) {
+			continue
+		}
+		if err := s.prepareStreamed(opts, r); err != nil {
+			record(r, apps.ResourceActionNone, err)
+			continue
+		}
+		if isCustomResourceDefinition(r) {
+			sum := manifestChecksum(r)
+			if ownsCRD(r) {
+				setOwnerRef(r, rs, opts.blockOwnerDeletion())
+			}
+			action, err := s.applyOne(ctx, r, rs, opts)
+			record(r, action, err)
+			results[resourceKey(r)].checksum = sum
+			if err == nil {
+				crds = append(crds, r)
+			}
+			continue
+		}
+		gvk := r.GroupVersionKind()
+		mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			buffered = append(buffered, r)
+			continue
+		} else if err != nil {
+			record(r, apps.ResourceActionNone, errors.Wrap(err, "get REST mapping"))
+			continue
+		}
+		if err := s.defaultStreamedNamespace(opts, r, opts.overrideScope(mapping)); err != nil {
+			record(r, apps.ResourceActionNone, err)
+			continue
+		}
+		apply(r)
+	}
+
+	if len(buffered) > 0 {
+		if len(crds) > 0 && !opts.SkipCRDWait {
+			if err := s.waitForCRDs(ctx, opts, crds); err != nil {
+				return rs, err
+			}
+		}
+		s.resetMapper()
+		sortResources(buffered)
+		for _, r := range buffered {
+			gvk := r.GroupVersionKind()
+			mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err == nil {
+				err = s.defaultStreamedNamespace(opts, r, opts.overrideScope(mapping))
+			}
+			if err != nil {
+				record(r, apps.ResourceActionNone, errors.Wrap(err, "get REST mapping"))
+				continue
+			}
+			apply(r)
+		}
+	}
+
+	rs.Spec.Resources = nil
+	for gvk, items := range refs {
+		rs.Spec.Resources = append(rs.Spec.Resources, apps.ResourceSetSpecGroup{
+			Group:   gvk.Group,
+			Version: gvk.Version,
+			Kind:    gvk.Kind,
+			Items:   items,
+		})
+	}
+	sort.Slice(rs.Spec.Resources, func(i, j int) bool {
+		return lessResourceSetSpecGroup(&rs.Spec.Resources[i], &rs.Spec.Resources[j])
+	})
+	opts.status.finish(rs)
+	if err := s.updateResourceSet(ctx, rs); err != nil {
+		return rs, err
+	}
+
+	var (
+		applyErr error
+		pruned   bool
+	)
+	if n := countFailed(results); n > 0 {
+		applyErr = errors.Errorf("%d/%d resources failed to apply", n, len(results))
+	} else if wait := opts.WaitForReady || len(opts.WaitForCondition) > 0 || hasHealthGate(results); wait && opts.PruneDuringReadiness {
+		applyErr = s.waitForReadyAndPrune(ctx, rs, opts, results)
+		pruned = true
+	} else if wait {
+		applyErr = s.waitForReady(ctx, opts, results, false)
+	}
+	if err := s.updateResourceSetStatus(ctx, rs, results); err != nil {
+		return rs, err
+	}
+	if applyErr != nil {
+		return rs, applyErr
+	}
+	if !pruned {
+		if err := s.prune(ctx, rs, opts); err != nil {
+			return rs, errors.Wrap(err, "prune")
+		}
+	}
+	if err := s.markCurrent(ctx, rs, opts.name); err != nil {
+		return rs, err
+	}
+	if !opts.pruneDeferred && !opts.pruneLimited {
+		if err := s.deleteResourceSets(ctx, opts.name, opts.version); err != nil {
+			return rs, err
+		}
+	}
+	return rs, nil
+}
+
+// prepareStreamed applies the options that modify a single streamed resource,
+// like prepare does for the whole set.
+func (s *Synk) prepareStreamed(opts *applyOptions, r *unstructured.Unstructured) error {
+	single := []*unstructured.Unstructured{r}
+	if err := sanitize(single, opts.Sanitizers); err != nil {
+		return err
+	}
+	if err := substituteVars(single, opts.Vars); err != nil {
+		return err
+	}
+	if opts.ConvertDeprecatedAPIs {
+		if err := s.convertDeprecatedAPIs(single, opts); err != nil {
+			return err
+		}
+	}
+	if opts.PropagateSourceRevision && opts.SourceRevision != "" {
+		ann := r.GetAnnotations()
+		if ann == nil {
+			ann = map[string]string{}
+		}
+		ann[SourceRevisionAnnotation] = opts.SourceRevision
+		r.SetAnnotations(ann)
+	}
+	if r.GetAPIVersion() == "v1" && r.GetKind() == "Namespace" {
+		setMissingLabels(r, opts.NamespaceLabels)
+	}
+	return nil
+}
+
+// defaultStreamedNamespace sets the default namespace on a namespaced
+// resource and checks it against the namespace restrictions.
+func (s *Synk) defaultStreamedNamespace(opts *applyOptions, r *unstructured.Unstructured, mapping *meta.RESTMapping) error {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		ns := opts.Namespace
+		if ns == "" {
+			ns = s.namespace
+		}
+		if opts.NamespaceOverride != "" {
+			r.SetNamespace(opts.NamespaceOverride)
+		} else if r.GetNamespace() == "" {
+			r.SetNamespace(ns)
+		}
+	}
+	if s.namespace != "" && r.GetNamespace() != s.namespace {
+		return errors.Errorf("resource %q is outside of namespace %q", resourceKey(r), s.namespace)
+	}
+	if ns := r.GetNamespace(); opts.EnforceNamespace && ns != "" && ns != opts.enforcedNamespace() && ns != "kube-system" {
+		return errors.Errorf("invalid namespace %q on %q, expected %q or \"kube-system\"", ns, resourceKey(r), opts.enforcedNamespace())
+	}
+	return nil
+}
+
+// streamedStatusObject returns a copy of the resource with only the metadata
+// that its status and readiness checks need.
+func streamedStatusObject(r *unstructured.Unstructured) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(r.GetAPIVersion())
+	u.SetKind(r.GetKind())
+	u.SetNamespace(r.GetNamespace())
+	u.SetName(r.GetName())
+	u.SetGenerateName(r.GetGenerateName())
+	u.SetUID(r.GetUID())
+	u.SetGeneration(r.GetGeneration())
+	u.SetLabels(r.GetLabels())
+	ann := map[string]string{}
+	for _, k := range []string{readyTimeoutAnnotation, healthGateAnnotation} {
+		if v, ok := r.GetAnnotations()[k]; ok {
+			ann[k] = v
+		}
+	}
+	if len(ann) > 0 {
+		u.SetAnnotations(ann)
+	}
+	return u
+}
+
+// countFailed returns the number of resources that failed to apply.
+func countFailed(results applyResults) int {
+	n := 0
+	for _, r := range results {
+		if r.err != nil {
+			n++
+		}
+	}
+	return n
+}
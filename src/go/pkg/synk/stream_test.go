@@ -0,0 +1,165 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// stream sends the resources on a closed channel.
+func stream(resources ...*unstructured.Unstructured) <-chan *unstructured.Unstructured {
+	ch := make(chan *unstructured.Unstructured, len(resources))
+	for _, r := range resources {
+		ch <- r
+	}
+	close(ch)
+	return ch
+}
+
+func TestSynk_ApplyStream(t *testing.T) {
+	var prev apps.ResourceSet
+	unmarshalYAML(t, &prev, `
+apiVersion: apps.cloudrobotics.com/v1alpha1
+kind: ResourceSet
+metadata:
+  name: test.v1
+  labels:
+    name: test
+spec:
+  resources:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - namespace: ns1
+      name: removed
+status:
+  phase: Settled`)
+	f := newFixture(t)
+	f.addObjects(&prev)
+	s := f.newSynk()
+	ctx := context.Background()
+
+	rs, err := s.ApplyStream(ctx, "test", &ApplyOptions{Namespace: "ns1"}, stream(
+		newUnstructured("v1", "ConfigMap", "", "cm2"),
+		newUnstructured("v1", "ConfigMap", "ns2", "cm1"),
+		newUnstructured("v1", "Namespace", "", "ns2"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name != "test.v2" {
+		t.Errorf("expected ResourceSet test.v2, got %q", rs.Name)
+	}
+	if rs.Status.Phase != apps.ResourceSetPhaseSettled {
+		t.Errorf("expected phase Settled, got %q", rs.Status.Phase)
+	}
+	want := []apps.ResourceSetSpecGroup{{
+		Version: "v1",
+		Kind:    "Namespace",
+		Items:   []apps.ResourceRef{{Name: "ns2"}},
+	}, {
+		Version: "v1",
+		Kind:    "ConfigMap",
+		Items:   []apps.ResourceRef{{Namespace: "ns1", Name: "cm2"}, {Namespace: "ns2", Name: "cm1"}},
+	}}
+	if !reflect.DeepEqual(rs.Spec.Resources, want) {
+		t.Errorf("expected spec\n%v\nbut got\n%v", want, rs.Spec.Resources)
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "test.v2" {
+		t.Errorf("expected owner reference to test.v2, got %v", refs)
+	}
+	if _, err := s.resourceSets().Get(ctx, "test.v1", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected previous ResourceSet to be deleted, got %v", err)
+	}
+}
+
+func TestSynk_ApplyStreamBuffersCustomResources(t *testing.T) {
+	defer func(d time.Duration) { crdWaitInterval = d }(crdWaitInterval)
+	crdWaitInterval = time.Millisecond
+
+	f := newFixture(t)
+	s := f.newSynk()
+	s.discovery = &servingDiscovery{client: s.client}
+	rolloutGVK := schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "AppRollout"}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "ResourceSet"}, meta.RESTScopeRoot)
+	s.mapper = mapper
+	s.resetMapper = func() { mapper.Add(rolloutGVK, meta.RESTScopeNamespace) }
+
+	crd := &unstructured.Unstructured{}
+	unmarshalYAML(t, &crd.Object, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: approllouts.apps.cloudrobotics.com
+spec:
+  group: apps.cloudrobotics.com
+  names:
+    kind: AppRollout
+    plural: approllouts
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true`)
+	// The custom resource arrives before its CRD.
+	rs, err := s.ApplyStream(context.Background(), "test", nil, stream(
+		newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "foo1", "ar1"),
+		crd,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.Resource(gvrs["approllouts"]).Namespace("foo1").Get(context.Background(), "ar1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected AppRollout to be applied: %s", err)
+	}
+	if got := rs.Status.Counts; got == nil || got.CRDs != 1 || got.Namespaced != 1 {
+		t.Errorf("expected one CRD and one namespaced resource, got %+v", got)
+	}
+}
+
+func TestSynk_ApplyStreamRejectsHashSuffixes(t *testing.T) {
+	s := newFixture(t).newSynk()
+	opts := &ApplyOptions{HashSuffixKinds: []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}}}
+	if _, err := s.ApplyStream(context.Background(), "test", opts, stream()); err == nil {
+		t.Error("expected error for HashSuffixKinds")
+	}
+}
+
+func TestSynk_ApplyStreamEnforceNamespaceOverride(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+	opts := &ApplyOptions{NamespaceOverride: "tenant-1", EnforceNamespace: true}
+	if _, err := s.ApplyStream(ctx, "test", opts, stream(newUnstructured("v1", "ConfigMap", "ns1", "cm1"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("tenant-1").Get(ctx, "cm1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected ConfigMap in namespace tenant-1: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"log/slog"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ApplySubset applies only the resources whose resourceKey is in keys, eg
+// "apps/v1/Deployment/default/app", with the latest version of the
+// ResourceSet specified by 'name' as owner. It's meant for reconcilers that
+// watch the applied resources and correct drift of individual objects
+// without comparing the whole set. No new version is created, nothing is
+// pruned and the status of the ResourceSet is left as is.
+//
+// The resources are prepared like by Apply with default options, so keys
+// must use the namespaces that resources end up in. Resources that aren't
+// part of the latest version fail, since the next Apply wouldn't prune them.
+// Nothing is applied if the ResourceSet doesn't exist or is suspended.
+func (s *Synk) ApplySubset(
+	ctx context.Context,
+	name string,
+	keys []string,
+	resources ...*unstructured.Unstructured,
+) error {
+	rs, err := s.latest(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "get latest ResourceSet")
+	}
+	if rs == nil {
+		return errors.Errorf("ResourceSet %q not found", name)
+	}
+	if rs.Spec.Suspended {
+		slog.Info("Skipping apply of suspended ResourceSet", slog.String("Name", rs.Name))
+		return nil
+	}
+	opts := newApplyOptions(name, nil)
+	_, opts.version, _ = decodeResourceSetName(rs.Name)
+
+	// prepare() updates the resources in place.
+	resources = append([]*unstructured.Unstructured(nil), resources...)
+	for i, r := range resources {
+		resources[i] = r.DeepCopy()
+	}
+	resources, err = s.prepare(ctx, opts, resources...)
+	if err != nil {
+		return err
+	}
+	opts.serverVersion = s.serverVersion(resources)
+
+	wanted := map[string]bool{}
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	type key struct {
+		gk  schema.GroupKind
+		ref apps.ResourceRef
+	}
+	inSet := map[key]bool{}
+	for _, g := range rs.Spec.Resources {
+		for _, ref := range g.Items {
+			inSet[key{schema.GroupKind{Group: g.Group, Kind: g.Kind}, ref}] = true
+		}
+	}
+	var (
+		applied  int
+		failures int
+		firstErr error
+	)
+	for _, r := range resources {
+		if !wanted[resourceKey(r)] {
+			continue
+		}
+		applied++
+		var err error
+		if !inSet[key{r.GroupVersionKind().GroupKind(), apps.ResourceRef{Namespace: r.GetNamespace(), Name: r.GetName()}}] {
+			err = errors.Errorf("not part of ResourceSet %q", rs.Name)
+		} else if isCustomResourceDefinition(r) {
+			if ownsCRD(r) {
+				setOwnerRef(r, rs, opts.blockOwnerDeletion())
+			}
+			_, err = s.applyOne(ctx, r, rs, opts)
+		} else {
+			_, err = s.applyRegular(ctx, rs, opts, r)
+		}
+		if err != nil {
+			failures++
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, resourceKey(r))
+			}
+		}
+	}
+	if failures > 0 {
+		return errors.Wrapf(firstErr, "%d/%d resources failed to apply", failures, applied)
+	}
+	return nil
+}
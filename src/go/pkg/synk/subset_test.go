@@ -0,0 +1,86 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSynk_ApplySubset(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	withData := func(name, value string) *unstructured.Unstructured {
+		u := newUnstructured("v1", "ConfigMap", "ns1", name)
+		unstructured.SetNestedField(u.Object, value, "data", "foo")
+		return u
+	}
+	if _, err := s.Apply(ctx, "test", nil, withData("cm1", "v1"), withData("cm2", "v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// cm1 was deleted by hand. Updates aren't supported by the fake client.
+	if err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Delete(ctx, "cm1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := s.ApplySubset(ctx, "test", []string{"/v1/ConfigMap/ns1/cm1"},
+		withData("cm1", "v2"),
+		withData("cm2", "v2"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := func(name string) string {
+		cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _, _ := unstructured.NestedString(cm.Object, "data", "foo")
+		return v
+	}
+	if got := data("cm1"); got != "v2" {
+		t.Errorf("expected cm1 to be recreated, got %q", got)
+	}
+	if got := data("cm2"); got != "v1" {
+		t.Errorf("expected cm2 to be unchanged, got %q", got)
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "test.v1" {
+		t.Errorf("expected owner reference to test.v1, got %v", refs)
+	}
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].GetName() != "test.v1" {
+		t.Errorf("expected only ResourceSet test.v1, got %d", len(list.Items))
+	}
+
+	// Resources outside of the set aren't applied.
+	err = s.ApplySubset(ctx, "test", []string{"/v1/ConfigMap/ns1/cm3"}, withData("cm3", "v1"))
+	if err == nil {
+		t.Error("expected error for resource outside of the set")
+	}
+	if err := s.ApplySubset(ctx, "other", nil); err == nil {
+		t.Error("expected error for missing ResourceSet")
+	}
+}
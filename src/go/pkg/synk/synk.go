@@ -26,6 +26,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -39,12 +40,14 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
 	"k8s.io/apimachinery/pkg/util/mergepatch"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/discovery"
 	cacheddiscovery "k8s.io/client-go/discovery/cached"
 	"k8s.io/client-go/dynamic"
@@ -62,6 +65,13 @@ type Synk struct {
 	client      dynamic.Interface
 	mapper      meta.RESTMapper
 	resetMapper func()
+
+	// namespace restricts ResourceSets and the resources they own to a single
+	// namespace. It is empty for cluster-wide operation.
+	namespace string
+	// resourceSetGV is the group and version of the ResourceSet CRD. It is
+	// empty for the default, apps.cloudrobotics.com/v1alpha1.
+	resourceSetGV schema.GroupVersion
 }
 
 // New returns a new Synk object that acts against the cluster for the given configuration.
@@ -78,7 +88,29 @@ func New(client dynamic.Interface, discovery discovery.CachedDiscoveryInterface)
 	return s
 }
 
+// NewNamespaced returns a new Synk object that keeps its ResourceSets in the
+// given namespace and only applies resources into that namespace. This allows
+// using Synk with a service account that can't access other namespaces.
+// Cluster-scoped resources, including CRDs, can't be applied in this mode.
+//
+// The ResourceSet CRD must have been installed in namespaced scope, e.g. by
+// calling Init on a Synk object returned by NewNamespaced with sufficient
+// permissions. Afterwards the service account needs a Role in the namespace
+// that grants get, list, create, update, patch, delete and deletecollection on
+// resourcesets.apps.cloudrobotics.com and patch on its status subresource,
+// resourcesets/status, plus the verbs required for the applied resources
+// themselves. The discovery client additionally needs read access to
+// the discovery endpoints, which is granted to all authenticated users by
+// default.
+func NewNamespaced(client dynamic.Interface, discovery discovery.CachedDiscoveryInterface, namespace string) *Synk {
+	s := New(client, discovery)
+	s.namespace = namespace
+	return s
+}
+
 func NewForConfig(cfg *rest.Config) (*Synk, error) {
+	cfg = rest.CopyConfig(cfg)
+	ForwardWarnings(cfg)
 	client, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
@@ -94,34 +126,685 @@ func NewForConfig(cfg *rest.Config) (*Synk, error) {
 	return New(client, cachedDiscovery), nil
 }
 
+// NewForConfigAs returns a new Synk object that impersonates the given user or
+// service account, so that applies are subject to their RBAC permissions.
+// Synk sends all requests, including those for ResourceSets, through the
+// clients created from the configuration. Callers that pass their own clients
+// to New must configure impersonation on them.
+func NewForConfigAs(cfg *rest.Config, impersonate rest.ImpersonationConfig) (*Synk, error) {
+	cfg = rest.CopyConfig(cfg)
+	cfg.Impersonate = impersonate
+	return NewForConfig(cfg)
+}
+
+// WithClient returns a new Synk object that targets another API server, eg a
+// virtual cluster, and keeps its ResourceSets in the same namespace as s. It
+// shares no state with s: its REST mapper is built from the given discovery
+// client, so that type mappings of one server never leak into another. The
+// discovery client must therefore not be shared across servers either.
+func (s *Synk) WithClient(client dynamic.Interface, discovery discovery.CachedDiscoveryInterface) *Synk {
+	c := NewNamespaced(client, discovery, s.namespace)
+	c.resourceSetGV = s.resourceSetGV
+	return c
+}
+
+// WithResourceSetGroupVersion returns a new Synk object that shares the
+// clients of s but keeps its ResourceSets under the given group and version,
+// eg for forks that serve the ResourceSet CRD under their own group. Init
+// installs the CRD under that group, and the owner references of the applied
+// resources refer to it, so that the garbage collector deletes them with
+// their ResourceSet.
+func (s *Synk) WithResourceSetGroupVersion(gv schema.GroupVersion) *Synk {
+	c := *s
+	c.resourceSetGV = gv
+	return &c
+}
+
+// ApplyOptions configure Apply and the functions like it. They aren't
+// modified by the calls and can be reused.
+//
 // TODO: determine options that allow us to be semantically compatible with
 // vanilla kubectl apply.
 type ApplyOptions struct {
-	name    string
-	version int32
-
 	// Namespace that's set for all namespaced resources that have no
 	// other namespace set yet.
 	Namespace string
+	// NamespaceOverride replaces the namespace of all namespaced resources,
+	// including resources that have a namespace set already. This allows
+	// deploying the same bundle into different namespaces. Cluster-scoped
+	// resources are not changed.
+	NamespaceOverride string
 	// EnforceNamespace causes apply to fail if a resource has a namespace set
-	// that's different from Namespace.
+	// that's different from Namespace, or from NamespaceOverride if it is set.
 	EnforceNamespace bool
-
+	// Vars are substituted for ${VAR} placeholders in the metadata.namespace
+	// and metadata.name of the resources, eg to apply the same set into a
+	// namespace per tenant. Apply fails if a placeholder has no value.
+	Vars map[string]string
+
+	// Sanitizers normalize the resources before they are applied and stored
+	// in the ResourceSet, eg with StripNulls and StripStatus. They run in
+	// order and may modify the resources. Apply fails if one returns an
+	// error.
+	Sanitizers []func(*unstructured.Unstructured) error
+
+	// NamespaceLabels are added to all Namespace resources, eg to configure
+	// Pod Security admission with "pod-security.kubernetes.io/enforce".
+	// Labels that are already set on a Namespace are not overwritten.
+	NamespaceLabels map[string]string
+	// WaitForNamespace causes Apply to wait for a terminating namespace to
+	// be deleted, rather than failing with a NamespaceTerminatingError.
+	// Namespaces of the set are then created again, and their resources are
+	// applied to the new namespace. NamespaceTimeout limits the wait and
+	// defaults to five minutes.
+	WaitForNamespace bool
+	NamespaceTimeout time.Duration
+	// GovernanceKinds are applied right after the Namespaces and before all
+	// other namespaced resources. If one of them fails to apply, the other
+	// resources in its namespace fail as well, so that workloads aren't
+	// admitted without their quota or network policies. Defaults to
+	// ResourceQuota, LimitRange and NetworkPolicy. An empty, non-nil list
+	// disables this.
+	GovernanceKinds []schema.GroupKind
+	// PreserveInputOrder applies the resources in the order they are passed
+	// rather than sorted by kind and name. Namespaces and GovernanceKinds are
+	// still applied first, and CRDs and canaries are handled as before.
+	PreserveInputOrder bool
+
+	// Annotations are set on the ResourceSet rather than on the resources,
+	// eg TraceIDAnnotation to correlate the apply with an external request.
+	Annotations map[string]string
+	// SourceRevision, eg the git commit of the manifests, is recorded in the
+	// SourceRevisionAnnotation of the ResourceSet and in ApplyResult.
+	SourceRevision string
+	// PropagateSourceRevision also sets the SourceRevisionAnnotation on the
+	// applied resources. Resources are then updated whenever the revision
+	// changes, even if the manifests didn't.
+	PropagateSourceRevision bool
+	// TTL makes the set ephemeral. The time at which it expires is stored in
+	// the ExpiresAtAnnotation of the ResourceSet and renewed by every apply.
+	// Synk doesn't delete expired sets by itself, callers must invoke
+	// CollectExpired periodically.
+	TTL time.Duration
+
+	// SkipIfUnchanged causes apply to return the latest ResourceSet without
+	// applying anything if it has settled and its inputs had the same checksum.
+	SkipIfUnchanged bool
+	// DeferToSameContent causes Apply to return the latest ResourceSet
+	// without applying anything if its inputs had the same checksum and it
+	// has settled or is Pending since less than ContentLockTimeout, eg since
+	// another instance of an active/active deployment is applying it. This
+	// is an advisory lock based on the checksum label of the ResourceSet,
+	// not a hard one: instances that start at the same time may both apply,
+	// and older Pending versions are resumed, assuming that their apply was
+	// interrupted. ContentLockTimeout defaults to ten minutes.
+	DeferToSameContent bool
+	ContentLockTimeout time.Duration
+
+	// HashSuffixKinds are the kinds whose names get a suffix with a hash of
+	// their content, like kustomize's configMapGenerator. References to renamed
+	// ConfigMaps and Secrets in the pod specs of workloads in the set are
+	// updated, which causes a rollout whenever their content changes. Objects
+	// with outdated names are pruned with the previous ResourceSet.
+	HashSuffixKinds []schema.GroupVersionKind
+
+	// BlockOwnerDeletion is set on the ResourceSet owner references of all
+	// resources. Defaults to true. It requires permission to update the
+	// finalizers of the ResourceSet, which may not be available in restricted
+	// RBAC environments.
+	BlockOwnerDeletion *bool
+	// AdditionalOwnerRefs are set on all resources except CRDs alongside the
+	// ResourceSet owner reference, eg so that deleting the custom resource
+	// of a controller cascades to the resources it applied. At most one of
+	// them may be a controller reference, and none may refer to a
+	// ResourceSet.
+	AdditionalOwnerRefs []metav1.OwnerReference
+
+	// PruneAllowList restricts pruning of resources that were removed from
+	// the set to the given kinds. Removed resources of other kinds are
+	// orphaned instead of being deleted with the previous ResourceSet. All
+	// removed resources are pruned if the list is empty.
+	PruneAllowList []schema.GroupKind
+	// PrunePropagation causes pruned resources to be deleted explicitly, in
+	// reverse apply order, rather than by the garbage collector. The deletion
+	// propagation policy is looked up by kind and defaults to background
+	// deletion. Foreground deletion of a Deployment, for example, waits for
+	// its pods to be deleted.
+	PrunePropagation map[schema.GroupVersionKind]metav1.DeletionPropagation
+	// PruneConcurrency is the number of pruned resources of the same kind
+	// that are deleted in parallel. Setting it causes pruned resources to be
+	// deleted explicitly, like PrunePropagation. Kinds are still deleted one
+	// after another in reverse apply order, so that controllers and
+	// finalizers aren't flooded with deletions. Log reports each deletion.
+	// Defaults to one.
+	PruneConcurrency int
+	// PruneWaitForDeletion deletes pruned resources explicitly as well and
+	// waits for each one to be removed, ie for its finalizers to complete,
+	// before deleting the resources of the next kind. Resources that aren't removed within
+	// PruneTimeout fail the apply. PruneTimeout defaults to five minutes.
+	PruneWaitForDeletion bool
+	PruneTimeout         time.Duration
+	// MaxPruneFraction and MaxPruneCount limit how many of the resources of
+	// the previous version may be pruned, eg to guard against a rendering
+	// bug producing an empty set. If the limit is exceeded, nothing is pruned
+	// but the set still becomes current. The resources are recorded in
+	// Status.Pruned with PruneReasonExceedsPruneLimit and a warning that
+	// names the limit. The previous ResourceSets are kept in this case, so
+	// that the next Apply within the limits prunes the resources. Zero means
+	// no limit.
+	MaxPruneFraction float64
+	MaxPruneCount    int
+	// ExpectedCount, if set, is the number of resources the set must contain
+	// after empty and test resources were dropped. Otherwise Apply fails
+	// with an error wrapping ErrUnexpectedCount before changing anything,
+	// eg to catch a template that renders too few resources.
+	ExpectedCount *int
+	// PreflightRBAC checks with SelfSubjectAccessReviews that the client may
+	// read, create, update and prune the resources of the set and write the
+	// ResourceSet before changing anything. Apply fails with an error
+	// wrapping ErrMissingPermissions that lists all denied permissions, rather
+	// than with the first Forbidden error partway through the apply. Types
+	// that aren't served yet, eg those of CRDs in the set, aren't checked.
+	PreflightRBAC bool
+	// MinPruneAge protects resources that were created more recently than
+	// the given duration from pruning, eg since another process is still
+	// creating them. They are kept with the previous ResourceSets and pruned
+	// by a later apply, while the other removed resources are deleted
+	// explicitly.
+	MinPruneAge time.Duration
+
+	// PatchStrategy determines how resources that already exist are updated.
+	// Defaults to PatchStrategyThreeWay. The annotation
+	// core.cloudrobotics.com/apply-method, "server-side" or "client-side",
+	// overrides it per resource.
+	PatchStrategy PatchStrategy
+	// UpgradeManagedFields merges the managedFields entries that Synk wrote
+	// with client-side updates into its server-side apply entry before
+	// applying a resource with PatchStrategyServerSideApply. Otherwise, fields
+	// that Synk set with another PatchStrategy remain owned by its update
+	// entry and are never removed from the live object when they are dropped
+	// from the manifest. The entries are checked on every apply and only
+	// rewritten if necessary.
+	UpgradeManagedFields bool
+	// CreateStrategy determines whether resources are created, updated or
+	// both. Defaults to CreateStrategyCreateOrUpdate.
+	CreateStrategy CreateStrategy
+	// TakeoverWarningThreshold enables a warning in the resource's status
+	// if an update changes more than this many fields that other field
+	// managers set, according to the live object's managedFields. Synk
+	// writes as field manager "synk". Zero disables the check. It doesn't
+	// apply to PatchStrategyServerSideApply, where the apiserver detects
+	// conflicts.
+	TakeoverWarningThreshold int
+	// BlockTakeover fails such updates instead of warning. OnConflict can
+	// resolve them, eg with ConflictForce to apply them anyway.
+	BlockTakeover bool
+	// AdoptSelector restricts the adoption of existing resources that aren't
+	// owned by a ResourceSet, eg to migrate only objects labeled
+	// "migrate-to-synk=true" into the set. Other existing resources fail
+	// unless OnConflict resolves them, eg with ConflictSkip to leave them
+	// unmanaged. All resources are adopted if it is nil.
+	AdoptSelector labels.Selector
+
+	// SkipCRDWait skips waiting for the CRDs in the set to be served before
+	// the other resources are applied. Custom resources whose CRD isn't
+	// served yet fail to apply, which is faster for sets whose CRDs are
+	// usually installed already.
+	SkipCRDWait bool
+	// CRDMaxTimeout extends the wait for CRDs to be served beyond two
+	// minutes while they are progressing, ie the apiserver accepted their
+	// names but didn't establish them yet, eg on slow clusters. The wait
+	// still fails after CRDMaxTimeout or once a CRD doesn't progress. Zero
+	// disables the extension.
+	CRDMaxTimeout time.Duration
+	// StatusUpdateMode determines when the ResourceSet status is written.
+	// Defaults to StatusUpdateFinal.
+	StatusUpdateMode StatusUpdateMode
+	// StatusUpdateInterval is the minimum time between status writes with
+	// StatusUpdatePeriodic. Defaults to 10s.
+	StatusUpdateInterval time.Duration
+
+	// CRDWait determines whether resources wait for all CRDs in the set or
+	// only for their own. Defaults to CRDWaitPerCRD.
+	CRDWait CRDWaitPolicy
+	// MapperRefresh determines when the REST mapper is reset to pick up
+	// newly served resource types. Defaults to MapperRefreshOnce.
+	MapperRefresh MapperRefreshPolicy
+	// NotServedRetries is how often a resource is applied again with
+	// exponential backoff if the apiserver responds that its resource type
+	// isn't found, which may briefly happen after its CRD was established.
+	// Missing objects are not retried. Defaults to 5, a negative value
+	// disables the retries.
+	NotServedRetries int
+	// ScopeOverrides replace the scope that discovery reports for the given
+	// kinds when a resource is applied, as a workaround for CRDs whose scope
+	// is misreported or not yet updated. Values must be meta.RESTScopeNameRoot
+	// or meta.RESTScopeNameNamespace. Other kinds use the REST mapper's scope.
+	ScopeOverrides map[schema.GroupKind]meta.RESTScopeName
+	// ConvertDeprecatedAPIs rewrites resources whose API version isn't
+	// served by the cluster according to DefaultAPIConversions and
+	// APIConversions, eg extensions/v1beta1 Ingresses to
+	// networking.k8s.io/v1. Conversions are recorded as warnings. If a
+	// removed API has no safe conversion, the apply fails with
+	// ErrNoSafeConversion.
+	ConvertDeprecatedAPIs bool
+	// APIConversions extend and take precedence over DefaultAPIConversions.
+	APIConversions []APIConversion
+
+	// OnConflict is called when a resource is owned by another ResourceSet,
+	// when an update is blocked by BlockTakeover or AdoptSelector or when a
+	// resource can't be updated due to a conflict or an invalid, eg
+	// immutable, change. It decides how the conflict is resolved. If it is
+	// nil or returns an empty resolution, conflicting resources are replaced
+	// if that's known to be safe and fail otherwise. The desired object may
+	// be modified before returning ConflictRetry.
+	OnConflict func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error)
+	// NoReplaceErrors classify update errors that never lead to deleting and
+	// recreating the resource, even if the message indicates an immutable
+	// field. The resource fails and is retried instead, without calling
+	// OnConflict. Defaults to forbidden, unauthorized, timeout, throttling
+	// and unavailability errors. An empty, non-nil list disables this, but
+	// unauthorized errors never lead to replacing resources.
+	NoReplaceErrors []func(error) bool
+	// RetryUnauthorized applies a resource once more after a short delay if
+	// the apiserver rejected the credentials with 401 Unauthorized, eg since
+	// a short-lived token expired during a long apply and the client needs
+	// to refresh it. Resources that keep failing, and the apply if all
+	// failures are of this kind, fail with an UnauthorizedError.
+	RetryUnauthorized bool
+
+	// PrefetchLive lists the live objects for each resource type and namespace
+	// once instead of fetching each resource individually. This saves
+	// round-trips for sets with many resources of the same kind but may transfer
+	// objects that are not part of the set. If listing is not permitted, Synk
+	// falls back to fetching resources individually.
+	PrefetchLive bool
+
+	// VerifyAfterApply re-reads each created, updated or replaced resource
+	// and records a warning in its status if fields differ from the applied
+	// state, eg since a mutating webhook changed or dropped them. This costs
+	// an additional request per resource.
+	VerifyAfterApply bool
+	// ExactCompare disables the normalization of field values when comparing
+	// desired and live resources for the plan, the verification after apply
+	// and takeover warnings. By default, semantically equal numbers,
+	// quantities and durations compare equal, eg 1 and 1.0, "80" and 80,
+	// "1000m" and "1" or "60s" and "1m".
+	ExactCompare bool
+	// IgnoreFields are the paths of fields, by kind, that are ignored when
+	// comparing desired and live resources for the plan, the verification
+	// after apply and takeover warnings, eg annotations and sidecar
+	// containers injected by mutating webhooks. Paths have the format of
+	// PlannedChange.Fields, eg "spec.template.spec.containers" or
+	// "metadata.annotations.sidecar.istio.io/status", and cover all fields
+	// below them. A resource whose other fields are unchanged is planned
+	// with action None.
+	IgnoreFields map[schema.GroupVersionKind][]string
+	// RecreateFields are the paths of fields, by kind, whose changes cause
+	// the resource to be deleted and created again instead of updated, eg
+	// "spec.template" of Jobs or "spec.type" of Services. Paths have the
+	// format of IgnoreFields and cover all fields below them. Changes to
+	// other fields update the resource, and resources of these kinds aren't
+	// replaced if the update fails. CRDs are never recreated.
+	RecreateFields map[schema.GroupVersionKind][]string
+	// AppliedCondition sets a SynkApplied condition with the action and the
+	// ResourceSet version on the status of each applied resource whose type
+	// has a status subresource, eg for kubectl describe. Other types are
+	// skipped. The schema of custom resources must allow the condition.
+	// Failures to set it are recorded as warnings.
+	AppliedCondition bool
+
+	// WaitForReady causes Apply to wait until the applied resources are
+	// ready, eg until Deployments are rolled out and Jobs completed.
+	// Resources that don't become ready within ReadyTimeout are recorded as
+	// failed. The annotation core.cloudrobotics.com/ready-timeout, eg "10m",
+	// overrides the timeout per resource. ReadyTimeout defaults to five
+	// minutes. The resource with the annotation
+	// core.cloudrobotics.com/health-gate: "true" is waited for even without
+	// WaitForReady, and the ResourceSet is marked as Failed rather than
+	// Degraded if it doesn't become ready.
+	// Resources with the annotation core.cloudrobotics.com/canary: "true" are
+	// applied and waited for before the others, which aren't applied if the
+	// canaries fail.
+	WaitForReady bool
+	ReadyTimeout time.Duration
+	// WaitForCondition causes Apply to wait for the status that controllers
+	// report on resources of the given kinds, even without WaitForReady.
+	// Resources whose status has the condition's failure value are recorded
+	// as failed with the reported message, eg if an operator rejected a
+	// custom resource. ReadyTimeout applies as well.
+	WaitForCondition map[schema.GroupVersionKind]Condition
+	// ReadyConcurrency is the number of resources whose readiness is checked
+	// in parallel in each poll. Defaults to one.
+	ReadyConcurrency int
+	// PruneDuringReadiness starts pruning as soon as all resources were
+	// applied, while waiting for them to become ready, rather than after
+	// they are ready. This speeds up rollouts of large sets whose pruned
+	// resources are deleted explicitly, eg with PruneConcurrency. Removed
+	// resources are still only pruned if all resources of the set applied
+	// successfully. If some don't become ready, the pruned resources are
+	// deleted nonetheless, but the previous ResourceSets are kept, as
+	// without this option.
+	PruneDuringReadiness bool
+	// RequeueInterval is the delay that Reconcile requests if resources may
+	// still become ready, CRDs are still being established or pruning was
+	// deferred. Defaults to 30s.
+	RequeueInterval time.Duration
+
+	// AuditConfigMap causes Apply to store the plan and the result in an
+	// immutable ConfigMap, as an audit trail in the cluster. The ConfigMap is
+	// named after the ResourceSet version, eg "audit.v3" for the name "audit",
+	// and is created once the apply completed, regardless of whether it
+	// succeeded. A resumed apply replaces the record of the interrupted one.
+	// Planning costs an additional read per resource. If the
+	// record exceeds the size limit of ConfigMaps, the changed fields and
+	// then changes are dropped from it.
+	AuditConfigMap types.NamespacedName
+	// AuditActor is recorded in the audit ConfigMap as the user or system
+	// that triggered the apply.
+	AuditActor string
+
+	// Concurrency is the number of resources of the same kind that are
+	// applied in parallel. Kinds are still applied one after another in the
+	// usual order, so that eg namespaces exist before the resources in them.
+	// Combined with PrefetchLive, this considerably reduces the time to apply
+	// large sets. If it is larger than one, Log and OnConflict may be called
+	// concurrently. Defaults to one.
+	Concurrency int
+
+	// OnLiveObject is called with the object that the apiserver returned
+	// for each resource that was created, updated or replaced, eg to read
+	// server-assigned fields like the UID, generated names or a Service's
+	// clusterIP without another Get. The key is ResourceKey of the resource
+	// before the apply, which contains the default namespace if the resource
+	// had none and the generateName if the apiserver generated the name. It
+	// may be called concurrently with Concurrency above one.
+	OnLiveObject func(resourceKey string, live *unstructured.Unstructured)
+	// WarningFunc is called with the key of the resource, as returned by
+	// ResourceKey, for each warning that the apiserver returns while
+	// applying it, eg about deprecated APIs or unknown fields, so that tools
+	// can print them as they arrive. It may be called concurrently with
+	// Concurrency above one. The warnings aren't stored in the ResourceSet
+	// status. The dynamic client must be created by NewForConfig or from a
+	// config passed to ForwardWarnings.
+	WarningFunc func(resourceKey, warning string)
+	// OnSlowApply is called once if the apply is still running after
+	// SlowApplyThreshold, eg to alert on applies that are slow but don't
+	// fail, like with slow admission webhooks. The ResourceSet is a copy of
+	// the applied version before its resources were applied, or nil if it
+	// wasn't created yet.
+	// The callback runs on its own goroutine and must not block for long.
+	SlowApplyThreshold time.Duration
+	OnSlowApply        func(elapsed time.Duration, rs *apps.ResourceSet)
 	// Log functions to report progress and failures while applying resources.
 	Log func(r *unstructured.Unstructured, a apps.ResourceAction, status, msg string)
 }
 
+// applyOptions are the ApplyOptions of a single call to Apply, ApplyStream,
+// ApplyOne or PlanApply together with the state of the call, so that callers
+// can reuse their ApplyOptions.
+type applyOptions struct {
+	ApplyOptions
+
+	name    string
+	version int32
+	// unchanged is set if the inputs are unchanged and nothing was applied.
+	unchanged bool
+	// resumed holds the statuses of resources that were applied successfully
+	// by an interrupted run of the ResourceSet version resumedVersion, by
+	// resource key.
+	resumed        map[string]apps.ResourceStatus
+	resumedVersion int32
+	// serverVersion is the Kubernetes version of the cluster if resources
+	// have version annotations and it is known.
+	serverVersion *version.Version
+	// pruneDeferred is set if resources were too young to be pruned and the
+	// previous ResourceSets must be kept.
+	pruneDeferred bool
+	// pruneLimited is set if pruning would have exceeded the prune limits
+	// and the previous ResourceSets must be kept.
+	pruneLimited bool
+	// status writes the progress with StatusUpdatePeriodic.
+	status *statusUpdater
+	// live holds the prefetched objects with PrefetchLive.
+	live *liveIndex
+
+	// mu guards warnings while resources are applied concurrently.
+	mu sync.Mutex
+	// warnings for the resources by resourceKey, which are moved to the
+	// results once a resource was applied.
+	warnings map[string][]string
+}
+
+// newApplyOptions returns the options for a call for the ResourceSet
+// specified by 'name'. opts may be nil.
+func newApplyOptions(name string, opts *ApplyOptions) *applyOptions {
+	o := &applyOptions{name: name}
+	if opts != nil {
+		o.ApplyOptions = *opts
+	}
+	return o
+}
+
+// PatchStrategy determines how an existing resource is updated to its desired state.
+type PatchStrategy string
+
+const (
+	// PatchStrategyThreeWay computes a three-way merge patch between the
+	// last applied, the desired and the live state, like `kubectl apply`.
+	// Falls back to a full update if the last applied state is unknown.
+	PatchStrategyThreeWay PatchStrategy = "ThreeWay"
+	// PatchStrategyMergeOverLive merges the desired fields over the live object
+	// and updates it. Fields that are not declared in the desired state keep
+	// their live value, which preserves defaults set by the apiserver or by
+	// controllers. Fields that were removed from the desired state are not
+	// removed from the live object.
+	PatchStrategyMergeOverLive PatchStrategy = "MergeOverLive"
+	// PatchStrategyServerSideApply applies the desired state with server-side
+	// apply as field manager "synk". Conflicts with fields of other managers
+	// fail the apply, unless the resource has the annotation
+	// core.cloudrobotics.com/force-conflicts: "true", in which case Synk takes
+	// ownership of the conflicting fields.
+	PatchStrategyServerSideApply PatchStrategy = "ServerSideApply"
+)
+
+const (
+	fieldManager             = "synk"
+	forceConflictsAnnotation = "core.cloudrobotics.com/force-conflicts"
+	// applyMethodAnnotation overrides ApplyOptions.PatchStrategy for a
+	// resource, eg to migrate a set to server-side apply one resource at a
+	// time. The value is "server-side" for PatchStrategyServerSideApply or
+	// "client-side" for the set's PatchStrategy, or PatchStrategyThreeWay
+	// if that is server-side apply.
+	applyMethodAnnotation = "core.cloudrobotics.com/apply-method"
+)
+
+// patchStrategy returns the PatchStrategy for the resource, which may be
+// overridden by its apply-method annotation.
+func (o *ApplyOptions) patchStrategy(r *unstructured.Unstructured) (PatchStrategy, error) {
+	method, ok := r.GetAnnotations()[applyMethodAnnotation]
+	switch {
+	case !ok:
+		return o.PatchStrategy, nil
+	case method == "server-side":
+		return PatchStrategyServerSideApply, nil
+	case method == "client-side" && o.PatchStrategy == PatchStrategyServerSideApply:
+		return PatchStrategyThreeWay, nil
+	case method == "client-side":
+		return o.PatchStrategy, nil
+	}
+	return "", errors.Errorf("invalid value %q for annotation %s, expected \"server-side\" or \"client-side\"", method, applyMethodAnnotation)
+}
+
+// TraceIDAnnotation can be set with ApplyOptions.Annotations to correlate an
+// apply with an external request. Besides the ResourceSet, the trace ID is
+// recorded on the tracing spans of the applied resources and in the audit
+// ConfigMap.
+const TraceIDAnnotation = "core.cloudrobotics.com/trace-id"
+
+// SourceRevisionAnnotation records ApplyOptions.SourceRevision on the
+// ResourceSet, eg to find out which commit is live with List.
+const SourceRevisionAnnotation = "core.cloudrobotics.com/source-revision"
+
+// CreateStrategy determines whether a resource is created or updated.
+type CreateStrategy string
+
+const (
+	// CreateStrategyCreateOrUpdate creates missing resources and updates
+	// existing ones.
+	CreateStrategyCreateOrUpdate CreateStrategy = "CreateOrUpdate"
+	// CreateStrategyCreateOnly creates resources without reading them
+	// first, eg for events. Existing resources are left unchanged.
+	CreateStrategyCreateOnly CreateStrategy = "CreateOnly"
+	// CreateStrategyUpdateOnly only updates existing resources and fails for
+	// resources that don't exist.
+	CreateStrategyUpdateOnly CreateStrategy = "UpdateOnly"
+)
+
+// ConflictResolution determines how a conflict while applying a resource is
+// resolved.
+type ConflictResolution string
+
+const (
+	// ConflictSkip leaves the live object unchanged. The resource is reported
+	// as skipped rather than failed.
+	ConflictSkip ConflictResolution = "Skip"
+	// ConflictForce applies the resource anyway. Ownership by another
+	// ResourceSet is ignored and failed updates are resolved by deleting and
+	// recreating the resource. CRDs are never replaced.
+	ConflictForce ConflictResolution = "Force"
+	// ConflictRetry applies the, possibly modified, desired object again.
+	ConflictRetry ConflictResolution = "Retry"
+	// ConflictFail fails the resource without attempting to replace it.
+	ConflictFail ConflictResolution = "Fail"
+)
+
+// maxConflictRetries bounds how often a resource is applied again due to
+// ConflictRetry.
+const maxConflictRetries = 3
+
+// retryConflictErr is returned by applyOneAttempt if OnConflict asked to
+// retry.
+type retryConflictErr struct {
+	error
+}
+
+// MapperRefreshPolicy determines when the REST mapper discards its cached
+// discovery information.
+type MapperRefreshPolicy string
+
+const (
+	// MapperRefreshOnce resets the mapper once after the CRDs were applied,
+	// before the other resources are applied.
+	MapperRefreshOnce MapperRefreshPolicy = "Once"
+	// MapperRefreshOnMiss additionally resets the mapper whenever a resource
+	// type can't be mapped, eg since its CRD was applied in the same set and
+	// only became served after the first reset.
+	MapperRefreshOnMiss MapperRefreshPolicy = "OnMiss"
+)
+
+// CRDWaitPolicy determines how resources wait for the CRDs applied in the
+// same set to be served.
+type CRDWaitPolicy string
+
+const (
+	// CRDWaitPerCRD applies the instances of each CRD as soon as it is
+	// served. Other resources are applied right away and CRDs that failed
+	// to apply are retried meanwhile.
+	CRDWaitPerCRD CRDWaitPolicy = "PerCRD"
+	// CRDWaitAll waits for all CRDs to be served before any other resource
+	// is applied.
+	CRDWaitAll CRDWaitPolicy = "All"
+)
+
+// StatusUpdateMode determines when the ResourceSet status is written while
+// applying.
+type StatusUpdateMode string
+
+const (
+	// StatusUpdateFinal writes the status once all resources were applied.
+	StatusUpdateFinal StatusUpdateMode = "Final"
+	// StatusUpdatePeriodic additionally writes the progress while applying,
+	// at most once per StatusUpdateInterval, so that UIs can watch it.
+	StatusUpdatePeriodic StatusUpdateMode = "Periodic"
+	// StatusUpdateNone doesn't write the status at all. It is only returned
+	// by Apply. The ResourceSet stays Pending, so the next Apply of the same
+	// resources applies them again as the same version and SkipIfUnchanged
+	// has no effect.
+	StatusUpdateNone StatusUpdateMode = "None"
+)
+
+// crdWaitInterval and crdWaitRetries bound the time to wait for CRDs to be
+// served. crdWaitInterval is a variable to allow shorter intervals in tests.
+var crdWaitInterval = 2 * time.Second
+
+const crdWaitRetries = 60
+
 const (
 	StatusSuccess = "success"
 	StatusFailure = "failure"
 )
 
+// enforcedNamespace returns the namespace that EnforceNamespace requires.
+func (o *ApplyOptions) enforcedNamespace() string {
+	if o.NamespaceOverride != "" {
+		return o.NamespaceOverride
+	}
+	return o.Namespace
+}
+
+func (o *ApplyOptions) blockOwnerDeletion() bool {
+	if o.BlockOwnerDeletion == nil {
+		return true
+	}
+	return *o.BlockOwnerDeletion
+}
+
+// resume records the previous result of a resource that was already applied
+// by an interrupted run of the resumed ResourceSet. It returns false if the
+// resource must be applied.
+func (o *applyOptions) resume(r *unstructured.Unstructured, results applyResults) bool {
+	if o.resumedVersion != o.version {
+		return false
+	}
+	st, ok := o.resumed[resourceKey(r)]
+	if !ok {
+		return false
+	}
+	r.SetUID(types.UID(st.UID))
+	r.SetGeneration(st.Generation)
+	results.set(r, st.Action, nil)
+	results[resourceKey(r)].checksum = st.Checksum
+	o.logf(r, st.Action, "already applied, resuming")
+	return true
+}
+
 func (o *ApplyOptions) logf(r *unstructured.Unstructured, action apps.ResourceAction, msg string, args ...interface{}) {
 	if o.Log != nil {
 		o.Log(r, action, StatusSuccess, fmt.Sprintf(msg, args...))
 	}
 }
 
+func (o *applyOptions) warnf(r *unstructured.Unstructured, msg string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.warnings == nil {
+		o.warnings = map[string][]string{}
+	}
+	k := resourceKey(r)
+	o.warnings[k] = append(o.warnings[k], fmt.Sprintf(msg, args...))
+}
+
+// takeWarnings returns and clears the warnings for the resource.
+func (o *applyOptions) takeWarnings(r *unstructured.Unstructured) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	k := resourceKey(r)
+	w := o.warnings[k]
+	delete(o.warnings, k)
+	return w
+}
+
 func (o *ApplyOptions) errorf(r *unstructured.Unstructured, action apps.ResourceAction, msg string, args ...interface{}) {
 	if o.Log != nil {
 		o.Log(r, action, StatusFailure, fmt.Sprintf(msg, args...))
@@ -130,7 +813,10 @@ func (o *ApplyOptions) errorf(r *unstructured.Unstructured, action apps.Resource
 
 // Init installs the ResourceSet CRD into the cluster and waits for
 // it to become available.
-// It does not need to be called before each use of Synk.
+// It does not need to be called before each use of Synk. Calling it again
+// upgrades CRDs that were installed without the status subresource, which
+// older Synk versions must not be used with since their status writes would
+// be ignored.
 func (s *Synk) Init() error {
 	vTrue := true
 	crd := &apiextensions.CustomResourceDefinition{
@@ -139,20 +825,23 @@ func (s *Synk) Init() error {
 			Kind:       "CustomResourceDefinition",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "resourcesets.apps.cloudrobotics.com",
+			Name: s.resourceSetGVR().GroupResource().String(),
 		},
 		Spec: apiextensions.CustomResourceDefinitionSpec{
-			Group: "apps.cloudrobotics.com",
+			Group: s.resourceSetGVR().Group,
 			Names: apiextensions.CustomResourceDefinitionNames{
 				Kind:     "ResourceSet",
 				Plural:   "resourcesets",
 				Singular: "resourceset",
 			},
-			Scope: apiextensions.ClusterScoped,
+			Scope: s.resourceSetScope(),
 			Versions: []apiextensions.CustomResourceDefinitionVersion{{
-				Name:    "v1alpha1",
+				Name:    s.resourceSetGVR().Version,
 				Served:  true,
 				Storage: true,
+				Subresources: &apiextensions.CustomResourceSubresources{
+					Status: &apiextensions.CustomResourceSubresourceStatus{},
+				},
 				// TODO(ensonic): replace with the actual schema
 				Schema: &apiextensions.CustomResourceValidation{
 					OpenAPIV3Schema: &apiextensions.JSONSchemaProps{
@@ -176,7 +865,7 @@ func (s *Synk) Init() error {
 	if err := convert(crd, &u); err != nil {
 		return err
 	}
-	if _, err := s.applyOne(context.Background(), &u, nil); err != nil {
+	if _, err := s.applyOne(context.Background(), &u, nil, nil); err != nil {
 		return errors.Wrap(err, "create ResourceSet CRD")
 	}
 
@@ -215,22 +904,33 @@ func (s *Synk) Init() error {
 func (s *Synk) Delete(ctx context.Context, name string) error {
 	policy := metav1.DeletePropagationForeground
 	deleteOpts := metav1.DeleteOptions{PropagationPolicy: &policy}
-	return s.client.Resource(resourceSetGVR).DeleteCollection(ctx, deleteOpts, metav1.ListOptions{
+	err := s.resourceSets().DeleteCollection(ctx, deleteOpts, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("name=%s", name),
 	})
+	return resourceSetErr(err)
 }
 
 // Apply installs or updates the ResourceSet specified by 'name'.
+// If the latest version is still Pending for the same inputs, eg because a
+// previous Apply was interrupted, it is resumed and only resources that were
+// not yet applied successfully are applied.
+// If the latest version is suspended, it is returned without applying anything.
 func (s *Synk) Apply(
 	ctx context.Context,
 	name string,
 	opts *ApplyOptions,
 	resources ...*unstructured.Unstructured,
 ) (*apps.ResourceSet, error) {
-	if opts == nil {
-		opts = &ApplyOptions{}
-	}
-	opts.name = name
+	return s.apply(ctx, newApplyOptions(name, opts), resources...)
+}
+
+func (s *Synk) apply(
+	ctx context.Context,
+	opts *applyOptions,
+	resources ...*unstructured.Unstructured,
+) (*apps.ResourceSet, error) {
+	slow := startSlowApplyTimer(opts)
+	defer slow.stop()
 
 	// applyAll() updates the resources in place. To avoid modifying the
 	// caller's slice, copy the resources first.
@@ -239,23 +939,153 @@ func (s *Synk) Apply(
 		resources[i] = r.DeepCopy()
 	}
 
+	var plan *Plan
+	if opts.AuditConfigMap.Name != "" {
+		var err error
+		if plan, err = s.PlanApply(ctx, opts.name, &opts.ApplyOptions, resources...); err != nil {
+			return nil, errors.Wrap(err, "plan for audit")
+		}
+	}
 	rs, resources, err := s.initialize(ctx, opts, resources...)
 	if err != nil {
 		return rs, err
 	}
+	if opts.unchanged {
+		return rs, nil
+	}
+	slow.setResourceSet(rs)
+	opts.status = newStatusUpdater(s, rs, opts)
 	results, applyErr := s.applyAll(ctx, rs, opts, resources...)
+	if opts.AppliedCondition {
+		s.setAppliedConditions(ctx, rs, results)
+	}
+	generated := hasGeneratedNames(resources)
+	if generated {
+		// Store the names that the apiserver generated.
+		rs.Spec.Resources = resourceSetSpec(resources).Resources
+	}
+	opts.status.finish(rs)
+	pruned := false
+	if applyErr == nil && (opts.WaitForReady || len(opts.WaitForCondition) > 0 || hasHealthGate(results)) {
+		if opts.PruneDuringReadiness {
+			applyErr = s.waitForReadyAndPrune(ctx, rs, opts, results)
+			pruned = true
+		} else {
+			applyErr = s.waitForReady(ctx, opts, results, false)
+		}
+	}
 
-	if err := s.updateResourceSetStatus(ctx, rs, results); err != nil {
+	// With StatusUpdateNone, the status is only set on the returned copy.
+	stored := rs
+	if opts.StatusUpdateMode == StatusUpdateNone {
+		rs = rs.DeepCopy()
+		setResourceSetStatus(rs, results)
+	} else if err := s.storeGeneratedNames(ctx, rs, generated); err != nil {
+		return rs, err
+	} else if err := s.updateResourceSetStatus(ctx, rs, results); err != nil {
 		return rs, err
 	}
 	if applyErr == nil {
-		if err := s.deleteResourceSets(ctx, opts.name, opts.version); err != nil {
-			return rs, err
+		var err error
+		if !pruned {
+			err = s.prune(ctx, rs, opts)
+		}
+		if err != nil {
+			applyErr = errors.Wrap(err, "prune")
+		} else if err := s.markCurrent(ctx, stored, opts.name); err != nil {
+			applyErr = err
+		} else if !opts.pruneDeferred && !opts.pruneLimited {
+			// Otherwise, the previous versions are kept while they own
+			// resources that are too young or too many to be pruned.
+			if err := s.deleteResourceSets(ctx, opts.name, opts.version); err != nil {
+				applyErr = err
+			}
+		}
+		if rs != stored {
+			rs.Labels, rs.ResourceVersion = stored.Labels, stored.ResourceVersion
+		}
+	}
+	if plan != nil {
+		if err := s.writeAudit(ctx, rs, plan, opts); err != nil && applyErr == nil {
+			return rs, errors.Wrap(err, "write audit ConfigMap")
 		}
 	}
 	return rs, applyErr
 }
 
+// Suspend suspends the latest version of the ResourceSet specified by 'name'.
+// Subsequent calls to Apply return the suspended ResourceSet without applying
+// anything until Resume is called. Callers that periodically re-apply to
+// correct drift, like the chartassignment controller, thus leave manual
+// changes to the resources in place while the set is suspended.
+func (s *Synk) Suspend(ctx context.Context, name string) error {
+	return s.setSuspended(ctx, name, true)
+}
+
+// Resume resumes a ResourceSet that was suspended with Suspend. The next
+// Apply applies all resources again.
+func (s *Synk) Resume(ctx context.Context, name string) error {
+	return s.setSuspended(ctx, name, false)
+}
+
+func (s *Synk) setSuspended(ctx context.Context, name string, suspended bool) error {
+	rs, err := s.latest(ctx, name)
+	if err != nil {
+		return err
+	}
+	if rs == nil {
+		return errors.Errorf("no ResourceSet found for %q", name)
+	}
+	if rs.Spec.Suspended == suspended {
+		return nil
+	}
+	rs.Spec.Suspended = suspended
+	return s.updateResourceSet(ctx, rs)
+}
+
+// ApplyOne applies a single resource as part of the latest ResourceSet
+// specified by 'name'. Unlike Apply, it doesn't create a new ResourceSet
+// version and doesn't affect any other resources. The resource is added to the
+// ResourceSet if it isn't part of it yet and its status is updated.
+func (s *Synk) ApplyOne(ctx context.Context, name string, resource *unstructured.Unstructured) (apps.ResourceAction, error) {
+	rs, err := s.latest(ctx, name)
+	if err != nil {
+		return apps.ResourceActionNone, err
+	}
+	if rs == nil {
+		return apps.ResourceActionNone, errors.Errorf("no ResourceSet found for %q", name)
+	}
+	opts := newApplyOptions(name, nil)
+	_, opts.version, _ = decodeResourceSetName(rs.Name)
+
+	r := resource.DeepCopy()
+	if s.namespace != "" {
+		if r.GetNamespace() == "" {
+			r.SetNamespace(s.namespace)
+		}
+		if r.GetNamespace() != s.namespace {
+			return apps.ResourceActionNone, errors.Errorf("resource %q is outside of namespace %q", resourceKey(r), s.namespace)
+		}
+	}
+	if !isCustomResourceDefinition(r) || ownsCRD(r) {
+		setOwnerRef(r, rs, opts.blockOwnerDeletion())
+	}
+	action, applyErr := s.applyOne(ctx, r, rs, opts)
+	if setResourceStatus(rs, &applyResult{resource: r, action: action, err: applyErr, warnings: opts.takeWarnings(r)}) {
+		// The update returns the stored status, since the apiserver ignores
+		// the status outside of the status subresource.
+		status := rs.Status.DeepCopy()
+		if err := s.updateResourceSet(ctx, rs); err != nil {
+			return action, err
+		}
+		rs.Status = *status
+	}
+	if err := s.patchResourceSetStatus(ctx, rs); err != nil {
+		return action, err
+	}
+	return action, applyErr
+}
+
 type transientErr struct {
 	error
 }
@@ -301,79 +1131,49 @@ func IsTransientErr(err error) bool {
 func (s *Synk) applyAll(
 	ctx context.Context,
 	rs *apps.ResourceSet,
-	opts *ApplyOptions,
+	opts *applyOptions,
 	resources ...*unstructured.Unstructured,
 ) (applyResults, error) {
 	results := applyResults{}
 
 	crds, regulars := separateCRDsFromResources(resources)
+	crds = filterCRDsByK8sVersion(crds, opts, results)
+	if opts.resumed != nil {
+		crds = s.skipEstablishedCRDs(ctx, crds, opts, results)
+	}
+	canaries, regulars := separateCanaries(regulars)
 
-	// Insert CRDs and wait for them to become available.
-	for _, crd := range crds {
-		// CRDs must never be replaced as deleting them will delete
-		// all its current instances. Update conflicts must be resolved manually.
-		action, err := s.applyOne(ctx, crd, rs)
-		if err != nil {
-			opts.errorf(crd, action, "failed to apply: %s", err)
-		} else {
-			opts.logf(crd, action, "applied successfully")
+	if len(crds) > 0 && !opts.SkipCRDWait && opts.CRDWait != CRDWaitAll && len(canaries) == 0 {
+		if err := s.applyInterleaved(ctx, rs, opts, results, crds, regulars); err != nil {
+			return results, err
 		}
-		results.set(crd, action, err)
-	}
-	err := backoff.Retry(
-		func() error {
-			s.discovery.Invalidate()
-			for _, crd := range crds {
-				if ok, err := s.crdAvailable(crd); err != nil {
-					return backoff.Permanent(err)
-				} else if !ok {
-					return fmt.Errorf("crd not yet available: %q", crd.GetName())
-				}
+	} else {
+		// Insert CRDs and wait for them to become available.
+		if err := s.applyCRDs(ctx, rs, opts, results, pendingResources(crds, opts, results)); err != nil {
+			return results, err
+		}
+		if !opts.SkipCRDWait {
+			if err := s.waitForCRDs(ctx, opts, crds); err != nil {
+				return results, err
 			}
-			return nil
-		},
-		backoff.WithMaxRetries(backoff.NewConstantBackOff(2*time.Second), 60),
-	)
-	if err != nil {
-		return results, errors.Wrap(err, "wait for CRDs")
-	}
-	// Reset all discovery and mapping once again.
-	s.resetMapper()
-
-	// Try applying until the errors stay the same between iterations. Put in
-	// an upper bound just in case of flapping errors.
-	prevFailures := 0
-
-	for i := 0; i < 10; i++ {
-		curFailures := 0
+		}
+		// Reset all discovery and mapping once again to pick up the new CRDs.
+		s.resetMapper()
 
-		for _, r := range regulars {
-			// Don't retry resources that were applied successfully
-			// in the first iteration.
-			if i > 0 && !results.failed(r) {
-				continue
-			}
-			// Attach the ResourceSet as owner. CRDs are exempt since
-			// the risk of unintended deletion of all its instances is too high.
-			setOwnerRef(r, rs)
-			action, err := s.applyOne(ctx, r, rs)
-			if err != nil {
-				curFailures++
-				opts.errorf(r, action, "failed to apply, may retry: %s", err)
-			} else {
-				opts.logf(r, action, "applied successfully")
-			}
-			results.set(r, action, err)
+		if opts.PrefetchLive {
+			opts.live = s.prefetch(ctx, append(canaries, regulars...))
 		}
-		if curFailures == 0 || curFailures == prevFailures {
-			break
+	}
+	if len(canaries) > 0 {
+		if err := s.applyCanaries(ctx, rs, opts, results, canaries, regulars); err != nil {
+			return results, err
 		}
-		prevFailures = curFailures
 	}
+	s.applyRegularsRetried(ctx, rs, opts, results, regulars)
 	// The overall error we return is a transient error if all resource errors
 	// are transient. If there's at least one permanent failure, retrying
 	// will never make Apply overall successful.
-	allTransient := true
+	allTransient, allUnauthorized := true, true
 	numErrors := 0
 	var firstFailure *applyResult
 	for _, r := range results {
@@ -381,6 +1181,9 @@ func (s *Synk) applyAll(
 			if !IsTransientErr(r.err) {
 				allTransient = false
 			}
+			if !isUnauthorized(r.err) {
+				allUnauthorized = false
+			}
 			if firstFailure == nil {
 				firstFailure = r
 			}
@@ -390,7 +1193,11 @@ func (s *Synk) applyAll(
 	if numErrors == 0 {
 		return results, nil
 	}
-	err = fmt.Errorf("%d/%d resources failed to apply", numErrors, len(results))
+	if allUnauthorized {
+		// The details are the same for all resources.
+		return results, &UnauthorizedError{Err: fmt.Errorf("%d/%d resources failed to apply", numErrors, len(results))}
+	}
+	err := fmt.Errorf("%d/%d resources failed to apply", numErrors, len(results))
 	if numErrors == 1 {
 		err = fmt.Errorf("%s: %s: %s", err, resourceKey(firstFailure.resource), firstFailure.err)
 	} else {
@@ -402,45 +1209,505 @@ func (s *Synk) applyAll(
 	return results, err
 }
 
-// initialize a new ResourceSet version for the given name and prepare resources
-// for it.
-func (s *Synk) initialize(
+// applyCRDs applies the CRDs and, with static discovery, adds their types.
+func (s *Synk) applyCRDs(
 	ctx context.Context,
-	opts *ApplyOptions,
+	rs *apps.ResourceSet,
+	opts *applyOptions,
+	results applyResults,
+	crds []*unstructured.Unstructured,
+) error {
+	for _, crd := range crds {
+		// CRDs must never be replaced as deleting them will delete
+		// all its current instances. Update conflicts must be resolved manually.
+		sum := manifestChecksum(crd)
+		if ownsCRD(crd) {
+			setOwnerRef(crd, rs, opts.blockOwnerDeletion())
+		}
+		action, err := s.applyOne(ctx, crd, rs, opts)
+		if err != nil {
+			opts.errorf(crd, action, "failed to apply: %s", err)
+		} else {
+			opts.logf(crd, action, "applied successfully")
+		}
+		results.set(crd, action, err, opts.takeWarnings(crd)...)
+		results[resourceKey(crd)].checksum = sum
+		opts.status.changed(ctx, results)
+		if d, ok := s.discovery.(*staticDiscovery); ok && err == nil {
+			if err := d.addCRD(crd); err != nil {
+				return errors.Wrapf(err, "add CRD %q to static discovery", crd.GetName())
+			}
+		}
+	}
+	return nil
+}
+
+// skipEstablishedCRDs returns the CRDs that must be applied and waited for
+// when resuming an interrupted apply. CRDs that are served and were applied
+// with the same content, eg by the interrupted apply, are recorded as
+// resumed without applying them again.
+func (s *Synk) skipEstablishedCRDs(
+	ctx context.Context,
+	crds []*unstructured.Unstructured,
+	opts *applyOptions,
+	results applyResults,
+) []*unstructured.Unstructured {
+	s.discovery.Invalidate()
+	served := s.servedResources()
+	var pending []*unstructured.Unstructured
+	for _, crd := range crds {
+		if ok, err := crdServed(crd, served); err != nil || !ok {
+			pending = append(pending, crd)
+			continue
+		}
+		if opts.resume(crd, results) {
+			continue
+		}
+		if !s.appliedUnchanged(ctx, crd) {
+			pending = append(pending, crd)
+			continue
+		}
+		opts.logf(crd, apps.ResourceActionNone, "already applied and served, resuming")
+		results.set(crd, apps.ResourceActionNone, nil)
+	}
+	if len(pending) < len(crds) {
+		s.resetMapper()
+	}
+	return pending
+}
+
+// appliedUnchanged returns true if the live object was last applied with the
+// same content as desired.
+func (s *Synk) appliedUnchanged(ctx context.Context, desired *unstructured.Unstructured) bool {
+	client, err := s.resourceClient(desired)
+	if err != nil {
+		return false
+	}
+	live, err := client.Get(ctx, desired.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	d := desired.DeepCopy()
+	if err := setAppliedAnnotation(d); err != nil {
+		return false
+	}
+	return string(getAppliedAnnotation(live)) == string(getAppliedAnnotation(d))
+}
+
+// applyRegularsRetried applies the pending resources until the errors stay
+// the same between iterations. There's an upper bound just in case of
+// flapping errors.
+func (s *Synk) applyRegularsRetried(
+	ctx context.Context,
+	rs *apps.ResourceSet,
+	opts *applyOptions,
+	results applyResults,
+	resources []*unstructured.Unstructured,
+) {
+	prevFailures := 0
+	for i := 0; i < 10; i++ {
+		curFailures := s.applyRegulars(ctx, rs, opts, results, pendingResources(resources, opts, results))
+		if curFailures == 0 || curFailures == prevFailures {
+			break
+		}
+		prevFailures = curFailures
+	}
+}
+
+// pendingResources returns the resources that weren't applied yet or failed.
+// Resources that were applied by an interrupted apply are resumed instead.
+func pendingResources(resources []*unstructured.Unstructured, opts *applyOptions, results applyResults) []*unstructured.Unstructured {
+	var pending []*unstructured.Unstructured
+	for _, r := range resources {
+		if _, ok := results[resourceKey(r)]; ok {
+			if results.failed(r) {
+				pending = append(pending, r)
+			}
+			continue
+		}
+		if !opts.resume(r, results) {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
+
+// applyInterleaved applies the CRDs and then the instances of each CRD as
+// soon as it is served, rather than waiting for all CRDs. Resources that
+// don't depend on the CRDs are applied right away. This avoids stalls when
+// a CRD is only served once a controller started that uses another CRD's
+// instances. CRDs that failed to apply are retried while waiting.
+//
+// Instances of CRDs that fail permanently are left to the caller, which
+// applies them and reports their errors.
+func (s *Synk) applyInterleaved(
+	ctx context.Context,
+	rs *apps.ResourceSet,
+	opts *applyOptions,
+	results applyResults,
+	crds, regulars []*unstructured.Unstructured,
+) error {
+	crdsByKind := map[schema.GroupKind]*unstructured.Unstructured{}
+	for _, crd := range crds {
+		crdsByKind[crdGroupKind(crd)] = crd
+	}
+	var ready []*unstructured.Unstructured
+	blocked := map[*unstructured.Unstructured][]*unstructured.Unstructured{}
+	for _, r := range regulars {
+		if crd, ok := crdsByKind[r.GroupVersionKind().GroupKind()]; ok {
+			blocked[crd] = append(blocked[crd], r)
+		} else {
+			ready = append(ready, r)
+		}
+	}
+
+	waiting := crds
+	prevFailures := -1
+	start := time.Now()
+	for i := 0; ; i++ {
+		if err := s.applyCRDs(ctx, rs, opts, results, pendingResources(waiting, opts, results)); err != nil {
+			return err
+		}
+		if i == 0 && opts.PrefetchLive {
+			opts.live = s.prefetch(ctx, regulars)
+		}
+		s.discovery.Invalidate()
+		served := s.servedResources()
+		var (
+			next     []*unstructured.Unstructured
+			progress bool
+		)
+		for _, crd := range waiting {
+			ok, err := crdServed(crd, served)
+			if err != nil {
+				return errors.Wrap(err, "wait for CRDs")
+			}
+			if !ok {
+				next = append(next, crd)
+				if !results.failed(crd) {
+					progress = true
+				}
+				continue
+			}
+			ready = append(ready, blocked[crd]...)
+			progress = true
+		}
+		if len(next) < len(waiting) {
+			s.resetMapper()
+		}
+		waiting = next
+		s.applyRegulars(ctx, rs, opts, results, pendingResources(ready, opts, results))
+
+		// Like regular resources, failed CRDs are retried until the
+		// errors stay the same between iterations.
+		failures := 0
+		for _, r := range results {
+			if r.err != nil {
+				failures++
+			}
+		}
+		if failures != prevFailures {
+			progress = true
+		}
+		prevFailures = failures
+		if len(waiting) == 0 || !progress {
+			// All CRDs are served or the remaining ones keep failing
+			// to apply.
+			return nil
+		}
+		if i >= crdWaitRetries && !s.extendCRDWait(ctx, opts, waiting, start) {
+			return errors.Wrap(&crdNotServedError{name: waiting[0].GetName()}, "wait for CRDs")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(crdWaitInterval):
+		}
+	}
+}
+
+// waitForCRDs polls discovery until all CRDs are served.
+func (s *Synk) waitForCRDs(ctx context.Context, opts *applyOptions, crds []*unstructured.Unstructured) error {
+	start := time.Now()
+	for i := 0; ; i++ {
+		s.discovery.Invalidate()
+		served := s.servedResources()
+		var waiting []*unstructured.Unstructured
+		for _, crd := range crds {
+			if ok, err := crdServed(crd, served); err != nil {
+				return errors.Wrap(err, "wait for CRDs")
+			} else if !ok {
+				waiting = append(waiting, crd)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		if i >= crdWaitRetries && !s.extendCRDWait(ctx, opts, waiting, start) {
+			return errors.Wrap(&crdNotServedError{name: waiting[0].GetName()}, "wait for CRDs")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(crdWaitInterval):
+		}
+	}
+}
+
+// extendCRDWait returns true if the wait for the CRDs that aren't served yet
+// should continue beyond crdWaitRetries, since they are progressing towards
+// being established and CRDMaxTimeout hasn't passed since start. A CRD is
+// progressing once the apiserver accepted its names, which it does before
+// establishing it.
+func (s *Synk) extendCRDWait(ctx context.Context, opts *applyOptions, waiting []*unstructured.Unstructured, start time.Time) bool {
+	if opts.CRDMaxTimeout <= 0 || time.Since(start) >= opts.CRDMaxTimeout {
+		return false
+	}
+	for _, crd := range waiting {
+		client, err := s.resourceClient(crd)
+		if err != nil {
+			return false
+		}
+		live, err := client.Get(ctx, crd.GetName(), metav1.GetOptions{})
+		if err != nil || !hasCondition(live, "NamesAccepted", "True") {
+			return false
+		}
+	}
+	return true
+}
+
+// crdNotServedError is returned if a CRD of the set wasn't served in time,
+// eg since it is still being established.
+type crdNotServedError struct {
+	name string
+}
+
+func (e *crdNotServedError) Error() string {
+	return fmt.Sprintf("crd not yet available: %q", e.name)
+}
+
+// crdGroupKind returns the group and kind of the CRD's instances.
+func crdGroupKind(crd *unstructured.Unstructured) schema.GroupKind {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	return schema.GroupKind{Group: group, Kind: kind}
+}
+
+// prepare filters and sorts the resources and applies the options that
+// modify them, such as default namespaces and hash suffixes.
+func (s *Synk) prepare(
+	ctx context.Context,
+	opts *applyOptions,
 	resources ...*unstructured.Unstructured,
-) (*apps.ResourceSet, []*unstructured.Unstructured, error) {
+) ([]*unstructured.Unstructured, error) {
 	// Cleanup and sort resources.
 	resources = filter(resources, func(r *unstructured.Unstructured) bool {
 		return !reflect.DeepEqual(*r, unstructured.Unstructured{}) && !isTestResource(r)
 	})
-	sortResources(resources)
+	if err := validateAdditionalOwnerRefs(opts.AdditionalOwnerRefs, s.resourceSetGVR().Group); err != nil {
+		return nil, err
+	}
+	for gk, scope := range opts.ScopeOverrides {
+		if scope != meta.RESTScopeNameRoot && scope != meta.RESTScopeNameNamespace {
+			return nil, errors.Errorf("invalid scope override %q for %s", scope, gk)
+		}
+	}
+	if opts.ExpectedCount != nil && len(resources) != *opts.ExpectedCount {
+		return nil, errors.Wrapf(ErrUnexpectedCount, "got %d resources, expected %d", len(resources), *opts.ExpectedCount)
+	}
+	if err := validateHealthGate(resources); err != nil {
+		return nil, err
+	}
+	if err := sanitize(resources, opts.Sanitizers); err != nil {
+		return nil, err
+	}
+	if err := substituteVars(resources, opts.Vars); err != nil {
+		return nil, err
+	}
+	if opts.ConvertDeprecatedAPIs {
+		if err := s.convertDeprecatedAPIs(resources, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PropagateSourceRevision && opts.SourceRevision != "" {
+		for _, r := range resources {
+			ann := r.GetAnnotations()
+			if ann == nil {
+				ann = map[string]string{}
+			}
+			ann[SourceRevisionAnnotation] = opts.SourceRevision
+			r.SetAnnotations(ann)
+		}
+	}
+	if !opts.PreserveInputOrder {
+		sortResources(resources)
+	}
+	sortGovernance(resources, opts.governanceKinds())
 
 	crds, regulars := separateCRDsFromResources(resources)
 
-	if err := s.populateNamespaces(ctx, opts.Namespace, crds, regulars...); err != nil {
-		return nil, nil, errors.Wrap(err, "set default namespaces")
+	ns := opts.Namespace
+	if ns == "" {
+		ns = s.namespace
+	}
+	override := opts.NamespaceOverride != ""
+	if override {
+		ns = opts.NamespaceOverride
+	}
+	if err := s.populateNamespaces(ctx, ns, override, crds, regulars...); err != nil {
+		return nil, errors.Wrap(err, "set default namespaces")
+	}
+	// A namespaced ResourceSet can only own resources in its own namespace.
+	if s.namespace != "" {
+		for _, r := range resources {
+			if r.GetNamespace() != s.namespace {
+				return nil, errors.Errorf("resource %q is outside of namespace %q", resourceKey(r), s.namespace)
+			}
+		}
 	}
 	// TODO: consider putting this and other validation as a step after initialize
 	// so we can give validation errors in batch in the ResourceSet status.
 	if opts.EnforceNamespace {
 		for _, r := range regulars {
-			if ns := r.GetNamespace(); ns != "" && ns != opts.Namespace && ns != "kube-system" {
-				return nil, nil, errors.Errorf("invalid namespace %q on %q, expected %q or \"kube-system\"", ns, resourceKey(r), opts.Namespace)
+			if ns := r.GetNamespace(); ns != "" && ns != opts.enforcedNamespace() && ns != "kube-system" {
+				return nil, errors.Errorf("invalid namespace %q on %q, expected %q or \"kube-system\"", ns, resourceKey(r), opts.enforcedNamespace())
 			}
 		}
 	}
 
+	if err := applyHashSuffixes(regulars, opts.HashSuffixKinds); err != nil {
+		return nil, errors.Wrap(err, "add hash suffixes")
+	}
+	for _, r := range regulars {
+		if r.GetAPIVersion() == "v1" && r.GetKind() == "Namespace" {
+			setMissingLabels(r, opts.NamespaceLabels)
+		}
+	}
+	return resources, nil
+}
+
+// initialize a new ResourceSet version for the given name and prepare resources
+// for it.
+func (s *Synk) initialize(
+	ctx context.Context,
+	opts *applyOptions,
+	resources ...*unstructured.Unstructured,
+) (*apps.ResourceSet, []*unstructured.Unstructured, error) {
+	resources, err := s.prepare(ctx, opts, resources...)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.serverVersion = s.serverVersion(resources)
+	sum, err := checksum(resources)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "compute checksum")
+	}
+
 	// Initialize and create next ResourceSet.
-	var err error
-	opts.version, err = s.next(ctx, opts.name)
+	prev, err := s.latest(ctx, opts.name)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "get next ResourceSet version")
 	}
+	if prev != nil && prev.Spec.Suspended {
+		slog.Info("Skipping apply of suspended ResourceSet", slog.String("Name", prev.Name))
+		opts.unchanged = true
+		return prev, nil, nil
+	}
+	if opts.SkipIfUnchanged && prev != nil &&
+		prev.Status.Phase == apps.ResourceSetPhaseSettled && prev.Labels[checksumLabel] == sum {
+		opts.unchanged = true
+		return prev, nil, nil
+	}
+	if opts.DeferToSameContent && prev != nil && prev.Labels[checksumLabel] == sum && opts.contentLocked(prev) {
+		slog.Info("Deferring to ResourceSet with the same content",
+			slog.String("Name", prev.Name),
+			slog.String("Phase", string(prev.Status.Phase)))
+		opts.unchanged = true
+		return prev, nil, nil
+	}
+	if opts.PreflightRBAC {
+		if err := s.preflightRBAC(ctx, opts, prev, resources); err != nil {
+			return nil, nil, err
+		}
+	}
+	// A Pending ResourceSet with the same checksum is left over from an
+	// interrupted apply of the same inputs. Resume it rather than creating
+	// a new version.
+	if prev != nil && prev.Status.Phase == apps.ResourceSetPhasePending && prev.Labels[checksumLabel] == sum {
+		_, opts.version, _ = decodeResourceSetName(prev.Name)
+		opts.resumed, opts.resumedVersion = appliedStatuses(&prev.Status), opts.version
+		if setAnnotations(prev, opts.resourceSetAnnotations()) {
+			if err := s.updateResourceSet(ctx, prev); err != nil {
+				return nil, nil, err
+			}
+		}
+		return prev, resources, nil
+	}
+	opts.version = nextVersion(prev)
 
 	var rs apps.ResourceSet
 	rs.Name = resourceSetName(opts.name, opts.version)
-	rs.Labels = map[string]string{"name": opts.name}
+	rs.Namespace = s.namespace
+	rs.Labels = map[string]string{
+		"name":        opts.name,
+		checksumLabel: sum,
+	}
+	setAnnotations(&rs, opts.resourceSetAnnotations())
+
+	rs.Spec = resourceSetSpec(resources)
+
+	rs.Status = apps.ResourceSetStatus{
+		Phase:     apps.ResourceSetPhasePending,
+		StartedAt: metav1.Now(),
+	}
+	if err := s.createResourceSet(ctx, &rs); err != nil {
+		return nil, nil, errors.Wrapf(err, "create resources object %q", rs.Name)
+	}
+
+	return &rs, resources, nil
+}
+
+// resourceSetAnnotations returns the Annotations, the source revision and the
+// expiry time.
+func (o *ApplyOptions) resourceSetAnnotations() map[string]string {
+	if o.SourceRevision == "" && o.TTL <= 0 {
+		return o.Annotations
+	}
+	ann := map[string]string{}
+	if o.SourceRevision != "" {
+		ann[SourceRevisionAnnotation] = o.SourceRevision
+	}
+	if o.TTL > 0 {
+		ann[ExpiresAtAnnotation] = time.Now().Add(o.TTL).UTC().Format(time.RFC3339)
+	}
+	for k, v := range o.Annotations {
+		ann[k] = v
+	}
+	return ann
+}
+
+// setAnnotations adds the annotations to the ResourceSet. It returns true if
+// any of them changed.
+func setAnnotations(rs *apps.ResourceSet, annotations map[string]string) bool {
+	if len(annotations) == 0 {
+		return false
+	}
+	if rs.Annotations == nil {
+		rs.Annotations = map[string]string{}
+	}
+	changed := false
+	for k, v := range annotations {
+		if old, ok := rs.Annotations[k]; !ok || old != v {
+			rs.Annotations[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
 
+// resourceSetSpec returns the spec of a ResourceSet for the resources.
+func resourceSetSpec(resources []*unstructured.Unstructured) apps.ResourceSetSpec {
+	var spec apps.ResourceSetSpec
 	groupedResources := map[schema.GroupVersionKind][]apps.ResourceRef{}
 	for _, r := range resources {
 		gvk := r.GroupVersionKind()
@@ -450,32 +1717,24 @@ func (s *Synk) initialize(
 		})
 	}
 	for gvk, res := range groupedResources {
-		rs.Spec.Resources = append(rs.Spec.Resources, apps.ResourceSetSpecGroup{
+		spec.Resources = append(spec.Resources, apps.ResourceSetSpecGroup{
 			Group:   gvk.Group,
 			Version: gvk.Version,
 			Kind:    gvk.Kind,
 			Items:   res,
 		})
 	}
-	sort.Slice(rs.Spec.Resources, func(i, j int) bool {
-		return lessResourceSetSpecGroup(&rs.Spec.Resources[i], &rs.Spec.Resources[j])
+	sort.Slice(spec.Resources, func(i, j int) bool {
+		return lessResourceSetSpecGroup(&spec.Resources[i], &spec.Resources[j])
 	})
-
-	rs.Status = apps.ResourceSetStatus{
-		Phase:     apps.ResourceSetPhasePending,
-		StartedAt: metav1.Now(),
-	}
-	if err := s.createResourceSet(ctx, &rs); err != nil {
-		return nil, nil, errors.Wrapf(err, "create resources object %q", rs.Name)
-	}
-
-	return &rs, resources, nil
+	return spec
 }
 
 // Set default namespace on all namespaced resources.
 func (s *Synk) populateNamespaces(
 	ctx context.Context,
 	ns string,
+	override bool,
 	crds []*unstructured.Unstructured,
 	resources ...*unstructured.Unstructured,
 ) error {
@@ -511,13 +1770,30 @@ func (s *Synk) populateNamespaces(
 		}
 	}
 	for _, r := range resources {
-		if r.GetNamespace() == "" && isNamespaced[r.GetAPIVersion()+"/"+r.GetKind()] {
+		if (override || r.GetNamespace() == "") && isNamespaced[r.GetAPIVersion()+"/"+r.GetKind()] {
 			r.SetNamespace(ns)
 		}
 	}
 	return nil
 }
 
+// setMissingLabels adds all labels that are not set on the resource yet.
+func setMissingLabels(r *unstructured.Unstructured, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	l := r.GetLabels()
+	if l == nil {
+		l = map[string]string{}
+	}
+	for k, v := range labels {
+		if _, ok := l[k]; !ok {
+			l[k] = v
+		}
+	}
+	r.SetLabels(l)
+}
+
 func deleteAppliedAnnotation(u *unstructured.Unstructured) {
 	anns := u.GetAnnotations()
 	if anns == nil {
@@ -528,6 +1804,9 @@ func deleteAppliedAnnotation(u *unstructured.Unstructured) {
 	u.SetAnnotations(anns)
 }
 
+// setAppliedAnnotation stores the resource as JSON in the last-applied
+// annotation. JSON encoding sorts map keys, so the annotation, like the
+// checksum, doesn't depend on the key order of the input manifests.
 func setAppliedAnnotation(u *unstructured.Unstructured) error {
 	deleteAppliedAnnotation(u)
 
@@ -559,45 +1838,156 @@ func validateOwnerRefs(r *unstructured.Unstructured, set *apps.ResourceSet) erro
 	if !ok {
 		return errors.Errorf("invalid ResourceSet name %q", set.Name)
 	}
+	group := resourceSetGVK(set).Group
 	for _, or := range r.GetOwnerReferences() {
-		if or.APIVersion != "apps.cloudrobotics.com/v1alpha1" || or.Kind != "ResourceSet" {
+		if !isResourceSetRef(or, group) {
 			continue
 		}
-		n, v, ok := decodeResourceSetName(or.Name)
-		if !ok {
-			return errors.Errorf("ResourceSet owner reference with invalid name %q", or.Name)
-		}
-		if n != name {
-			return errors.Errorf("owned by conflicting ResourceSet object %q", or.Name)
-		}
-		if v > version {
-			// TODO(rodrigoq): should this be transient to cope with concurrent synk runs?
-			return errors.Errorf("owned by newer ResourceSet %q > v%d", or.Name, version)
+		if err := validateOwnerRef(or, name, version); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// validateOwnerRef returns an error if the ResourceSet owner reference isn't
+// to a predecessor of name/version.
+func validateOwnerRef(or metav1.OwnerReference, name string, version int32) error {
+	n, v, ok := decodeResourceSetName(or.Name)
+	if !ok {
+		return errors.Errorf("ResourceSet owner reference with invalid name %q", or.Name)
+	}
+	if n != name {
+		return errors.Errorf("owned by conflicting ResourceSet object %q", or.Name)
+	}
+	if v > version {
+		// TODO(rodrigoq): should this be transient to cope with concurrent synk runs?
+		return errors.Errorf("owned by newer ResourceSet %q > v%d", or.Name, version)
+	}
+	return nil
+}
+
+// ownCRDAnnotation opts a CRD into ownership by the ResourceSet if set to
+// "true". CRDs are otherwise exempt, since deleting a CRD deletes all of its
+// instances. An owned CRD is deleted by the garbage collector, together with
+// all instances in the cluster, when the ResourceSet is deleted or when the
+// CRD is pruned from the set. Only use it for CRDs whose instances can be
+// lost, eg since they are never created.
+const ownCRDAnnotation = "core.cloudrobotics.com/own-crd"
+
+// ownsCRD returns true if the CRD opted into ownership by the ResourceSet.
+func ownsCRD(r *unstructured.Unstructured) bool {
+	return r.GetAnnotations()[ownCRDAnnotation] == "true"
+}
+
 // setOwnerRef sets the ResourceSet as the owner and removers all other ResourceSet
-// owner references.
-func setOwnerRef(r *unstructured.Unstructured, set *apps.ResourceSet) {
+// owner references. The reference has the ResourceSet's API version and kind.
+func setOwnerRef(r *unstructured.Unstructured, set *apps.ResourceSet, blockOwnerDeletion bool) {
+	gvk := resourceSetGVK(set)
 	var newRefs []metav1.OwnerReference
 	for _, or := range r.GetOwnerReferences() {
-		if or.APIVersion != "apps.cloudrobotics.com/v1alpha1" || or.Kind != "ResourceSet" {
+		if !isResourceSetRef(or, gvk.Group) {
 			newRefs = append(newRefs, or)
 		}
 	}
-	_true := true
 	newRefs = append(newRefs, metav1.OwnerReference{
-		APIVersion:         "apps.cloudrobotics.com/v1alpha1",
-		Kind:               "ResourceSet",
+		APIVersion:         gvk.GroupVersion().String(),
+		Kind:               gvk.Kind,
 		Name:               set.Name,
 		UID:                set.UID,
-		BlockOwnerDeletion: &_true,
+		BlockOwnerDeletion: &blockOwnerDeletion,
 	})
 	r.SetOwnerReferences(newRefs)
 }
 
+// requiredGVKAnnotation makes Synk skip a resource if the cluster doesn't
+// serve the given "group/version/Kind", eg "monitoring.coreos.com/v1/ServiceMonitor".
+// The group is omitted for core APIs, eg "v1/Pod".
+const requiredGVKAnnotation = "core.cloudrobotics.com/required-gvk"
+
+// hasRequiredGVK returns false if the resource requires a GVK that can't be
+// mapped to a resource of the cluster.
+func (s *Synk) hasRequiredGVK(r *unstructured.Unstructured) (bool, error) {
+	v, ok := r.GetAnnotations()[requiredGVKAnnotation]
+	if !ok {
+		return true, nil
+	}
+	parts := strings.Split(v, "/")
+	var gvk schema.GroupVersionKind
+	switch len(parts) {
+	case 2:
+		gvk = schema.GroupVersionKind{Version: parts[0], Kind: parts[1]}
+	case 3:
+		gvk = schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
+	default:
+		return false, errors.Errorf("invalid value %q for annotation %q, expected group/version/Kind", v, requiredGVKAnnotation)
+	}
+	if _, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); meta.IsNoMatchError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "get REST mapping")
+	}
+	return true, nil
+}
+
+// overrideScope returns the mapping with the scope from ScopeOverrides.
+func (o *ApplyOptions) overrideScope(mapping *meta.RESTMapping) *meta.RESTMapping {
+	scope, ok := o.ScopeOverrides[mapping.GroupVersionKind.GroupKind()]
+	if !ok || scope == mapping.Scope.Name() {
+		return mapping
+	}
+	m := *mapping
+	m.Scope = meta.RESTScopeNamespace
+	if scope == meta.RESTScopeNameRoot {
+		m.Scope = meta.RESTScopeRoot
+	}
+	return &m
+}
+
+// isConflict returns true if the update failed due to a concurrent change or
+// an invalid change, such as an update of an immutable field.
+func isConflict(err error) bool {
+	return k8serrors.IsConflict(err) || k8serrors.IsInvalid(err)
+}
+
+func (o *ApplyOptions) onConflict(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error) {
+	if o.OnConflict == nil {
+		return "", nil
+	}
+	res, cerr := o.OnConflict(desired, live, err)
+	if cerr != nil {
+		return "", errors.Wrap(cerr, "resolve conflict")
+	}
+	return res, nil
+}
+
+// defaultNoReplaceErrors are the default NoReplaceErrors.
+var defaultNoReplaceErrors = []func(error) bool{
+	k8serrors.IsForbidden,
+	k8serrors.IsUnauthorized,
+	k8serrors.IsTimeout,
+	k8serrors.IsServerTimeout,
+	k8serrors.IsTooManyRequests,
+	k8serrors.IsServiceUnavailable,
+}
+
+// noReplace returns true if the error must not lead to replacing the resource.
+func (o *ApplyOptions) noReplace(err error) bool {
+	if k8serrors.IsUnauthorized(err) {
+		return true
+	}
+	classes := o.NoReplaceErrors
+	if classes == nil {
+		classes = defaultNoReplaceErrors
+	}
+	for _, is := range classes {
+		if is(err) {
+			return true
+		}
+	}
+	return false
+}
+
 // canReplace determines whether an "apply patch/update" error is likely to be
 // resolved by deleting and recreating the resource. Some resources have
 // immutable fields (eg Job.spec.template) that can only be changed this way.
@@ -631,67 +2021,265 @@ func replace(ctx context.Context, client dynamic.ResourceInterface, resource *un
 	// pods are gone, so updates to a currently-running job are safer.
 	policy := metav1.DeletePropagationForeground
 	deleteOpts := metav1.DeleteOptions{PropagationPolicy: &policy}
-	if err := client.Delete(ctx, resource.GetName(), deleteOpts); err != nil {
+	if err := client.Delete(ctx, resource.GetName(), deleteOpts); err != nil && !k8serrors.IsNotFound(err) {
 		return nil, errors.Wrap(err, "delete")
 	}
-	res, err := client.Create(ctx, resource, metav1.CreateOptions{})
-	if err != nil {
-		// This is likely to occur if deletion is not immediate, in which case
-		// this returns a transient AlreadyExists error, and the outer loop will
-		// retry until the resource is deleted.
-		return nil, errors.Wrap(err, "create")
+	// The resource version of the deleted object must not be set on create.
+	resource.SetResourceVersion("")
+	for i := 0; ; i++ {
+		res, err := client.Create(ctx, resource, metav1.CreateOptions{FieldManager: fieldManager})
+		if err == nil {
+			return res, nil
+		}
+		if !k8serrors.IsAlreadyExists(err) || i == 2 {
+			return nil, errors.Wrap(err, "create")
+		}
+		live, err := client.Get(ctx, resource.GetName(), metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			// Deleted in the meantime, try to create it again.
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "get after create conflict")
+		}
+		if live.GetDeletionTimestamp() != nil {
+			// Deletion is not immediate, eg due to finalizers or foreground
+			// deletion. The outer loop will retry until the resource is
+			// deleted.
+			return nil, transientErr{errors.Errorf("waiting for deletion of %q", resource.GetName())}
+		}
+		// Another actor, eg a controller, recreated the resource after it was
+		// deleted. Update the new object instead.
+		u := resource.DeepCopy()
+		u.SetResourceVersion(live.GetResourceVersion())
+		res, err = client.Update(ctx, u, metav1.UpdateOptions{FieldManager: fieldManager})
+		if err != nil {
+			return nil, errors.Wrap(err, "update recreated resource")
+		}
+		return res, nil
+	}
+}
+
+func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured, set *apps.ResourceSet, opts *applyOptions) (apps.ResourceAction, error) {
+	if opts == nil {
+		opts = &applyOptions{}
+	}
+	var desired *unstructured.Unstructured
+	if opts.VerifyAfterApply {
+		desired = resource.DeepCopy()
+	}
+	// The key changes if the apiserver generates the name.
+	key := resourceKey(resource)
+	ctx = opts.warningContext(ctx, resource)
+	conflicts, rateLimited, notServed, unauthorized := 0, 0, 0, false
+	for {
+		action, err := s.applyOneAttempt(ctx, resource, set, opts)
+		if isUnauthorized(err) {
+			if opts.RetryUnauthorized && !unauthorized {
+				unauthorized = true
+				opts.logf(resource, action, "unauthorized, retrying in %s", unauthorizedRetryDelay)
+				if err := rateLimitWait(ctx, unauthorizedRetryDelay); err != nil {
+					return action, err
+				}
+				continue
+			}
+			return action, &UnauthorizedError{Err: err}
+		}
+		if delay, ok := rateLimitDelay(err); ok && rateLimited < maxRateLimitRetries {
+			rateLimited++
+			slog.Info("Rate limited by the apiserver, backing off",
+				slog.String("Resource", resourceKey(resource)),
+				slog.Duration("Delay", delay))
+			opts.logf(resource, action, "rate limited, retrying in %s", delay)
+			if err := rateLimitWait(ctx, delay); err != nil {
+				return action, err
+			}
+			continue
+		}
+		if isTypeNotServed(err) && notServed < opts.notServedRetries() {
+			delay := notServedRetryDelay << notServed
+			notServed++
+			opts.logf(resource, action, "resource type not served yet, retrying in %s", delay)
+			if err := rateLimitWait(ctx, delay); err != nil {
+				return action, err
+			}
+			continue
+		}
+		rerr, ok := err.(retryConflictErr)
+		if !ok {
+			if err == nil && desired != nil && action != apps.ResourceActionNone && action != apps.ResourceActionSkip {
+				s.verifyApplied(ctx, desired, opts)
+			}
+			if err == nil && opts.OnLiveObject != nil && action != apps.ResourceActionNone && action != apps.ResourceActionSkip {
+				// The resource was replaced by the apiserver's response.
+				opts.OnLiveObject(key, resource.DeepCopy())
+			}
+			return action, err
+		}
+		if conflicts == maxConflictRetries {
+			return action, errors.Wrap(rerr.error, "conflict persisted after retries")
+		}
+		conflicts++
 	}
-	return res, nil
 }
 
-func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured, set *apps.ResourceSet) (apps.ResourceAction, error) {
-	// If name is unset, we'd retrieve a list below and panic.
-	// TODO: This may be valid if generateName is set instead. In this case we
-	// want to create the resource in any case.
-	if resource.GetName() == "" {
+func (s *Synk) applyOneAttempt(ctx context.Context, resource *unstructured.Unstructured, set *apps.ResourceSet, opts *applyOptions) (apps.ResourceAction, error) {
+	// If name is unset, we'd retrieve a list below and panic. Resources with
+	// generateName are created unless a previous attempt created them.
+	if resource.GetName() == "" && resource.GetGenerateName() == "" {
 		return apps.ResourceActionNone, errors.New("missing resource name")
 	}
 	ctx, span := trace.StartSpan(ctx, "Apply "+resource.GetName())
 	defer span.End()
+	if id := opts.Annotations[TraceIDAnnotation]; id != "" {
+		span.AddAttributes(trace.StringAttribute("trace-id", id))
+	}
 	// GroupVersionKind is not sufficient to determine the REST API path to use
 	// for the resource. We need to get this information from the RESTMapper,
 	// which uses the discovery API to determine the right GroupVersionResource.
 	gvk := resource.GroupVersionKind()
 
 	mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) && opts.MapperRefresh == MapperRefreshOnMiss {
+		s.resetMapper()
+		mapping, err = s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
 	if err != nil {
 		return apps.ResourceActionNone, errors.Wrap(err, "get REST mapping")
 	}
+	mapping = opts.overrideScope(mapping)
 	var client dynamic.ResourceInterface
 	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
 		client = s.client.Resource(mapping.Resource)
 	} else {
 		client = s.client.Resource(mapping.Resource).Namespace(resource.GetNamespace())
 	}
+	if err := resolveGeneratedName(ctx, client, resource, set); err != nil {
+		return apps.ResourceActionNone, err
+	}
+	strategy, err := opts.patchStrategy(resource)
+	if err != nil {
+		return apps.ResourceActionNone, err
+	}
 	resetAppliedAnnotation := false
 	if err := setAppliedAnnotation(resource); err != nil {
 		slog.Warn("Storing Applied Annotation failed", ilog.Err(err))
 		resetAppliedAnnotation = true
 	}
 
+	if opts.CreateStrategy == CreateStrategyCreateOnly || resource.GetName() == "" {
+		_, createSpan := trace.StartSpan(ctx, "Create "+resource.GetName())
+		res, err := client.Create(ctx, resource, metav1.CreateOptions{FieldManager: fieldManager})
+		createSpan.End()
+		if k8serrors.IsAlreadyExists(err) {
+			return apps.ResourceActionNone, nil
+		} else if err != nil {
+			return apps.ResourceActionCreate, s.createErr(ctx, resource, mapping, opts, err, "create resource")
+		}
+		*resource = *res
+		return apps.ResourceActionCreate, nil
+	}
+
 	// Create the resource if it doesn't exist yet.
-	_, getSpan := trace.StartSpan(ctx, "Get "+resource.GetName())
-	current, err := client.Get(ctx, resource.GetName(), metav1.GetOptions{})
-	getSpan.End()
-	if k8serrors.IsNotFound(err) {
+	current, err := s.getLive(ctx, client, mapping, resource, opts)
+	if err == nil && isTerminatingNamespace(current) {
+		if err := s.waitForNamespaceDeletion(ctx, current.GetName(), opts); err != nil {
+			return apps.ResourceActionNone, err
+		}
+		current, err = client.Get(ctx, resource.GetName(), metav1.GetOptions{})
+	}
+	if k8serrors.IsNotFound(err) && opts.CreateStrategy == CreateStrategyUpdateOnly {
+		return apps.ResourceActionNone, errors.Wrap(err, "resource doesn't exist and CreateStrategy is UpdateOnly")
+	} else if k8serrors.IsNotFound(err) && strategy == PatchStrategyServerSideApply {
+		res, err := serverSideApply(ctx, client, resource)
+		if err != nil {
+			return apps.ResourceActionCreate, s.createErr(ctx, resource, mapping, opts, err, "create resource with server-side apply")
+		}
+		*resource = *res
+		return apps.ResourceActionCreate, nil
+	} else if k8serrors.IsNotFound(err) {
 		_, createSpan := trace.StartSpan(ctx, "Create "+resource.GetName())
-		res, err := client.Create(ctx, resource, metav1.CreateOptions{})
+		res, err := client.Create(ctx, resource, metav1.CreateOptions{FieldManager: fieldManager})
 		createSpan.End()
 		if err != nil {
-			return apps.ResourceActionCreate, errors.Wrap(err, "create resource")
+			return apps.ResourceActionCreate, s.createErr(ctx, resource, mapping, opts, err, "create resource")
 		}
 		*resource = *res
 		return apps.ResourceActionCreate, nil
 	} else if err != nil {
 		return apps.ResourceActionNone, errors.Wrap(err, "get resource")
 	}
+	dangling, err := s.dropDanglingOwnerRefs(ctx, current, set)
+	if err != nil {
+		return apps.ResourceActionNone, errors.Wrap(err, "check owner references")
+	}
 	if err := validateOwnerRefs(current, set); err != nil {
-		return apps.ResourceActionNone, errors.Wrap(err, "owner conflict")
+		err = errors.Wrap(err, "owner conflict")
+		resolution, cerr := opts.onConflict(resource, current, err)
+		switch {
+		case cerr != nil:
+			return apps.ResourceActionNone, cerr
+		case resolution == ConflictSkip:
+			return apps.ResourceActionSkip, nil
+		case resolution == ConflictRetry:
+			return apps.ResourceActionNone, retryConflictErr{err}
+		case resolution == ConflictForce:
+			// Take over the resource from the other ResourceSet.
+		default:
+			return apps.ResourceActionNone, err
+		}
+	}
+
+	if err := checkAdopt(resource, current, set, opts); err != nil {
+		resolution, cerr := opts.onConflict(resource, current, err)
+		switch {
+		case cerr != nil:
+			return apps.ResourceActionNone, cerr
+		case resolution == ConflictSkip:
+			return apps.ResourceActionSkip, nil
+		case resolution == ConflictRetry:
+			return apps.ResourceActionNone, retryConflictErr{err}
+		case resolution == ConflictForce:
+			// Adopt the resource anyway.
+		default:
+			return apps.ResourceActionNone, err
+		}
+	}
+
+	if err := checkTakeover(resource, current, opts); err != nil {
+		resolution, cerr := opts.onConflict(resource, current, err)
+		switch {
+		case cerr != nil:
+			return apps.ResourceActionNone, cerr
+		case resolution == ConflictSkip:
+			return apps.ResourceActionSkip, nil
+		case resolution == ConflictRetry:
+			return apps.ResourceActionNone, retryConflictErr{err}
+		case resolution == ConflictForce:
+			// Take over the fields from the other managers.
+		default:
+			return apps.ResourceActionNone, err
+		}
+	}
+	if dangling {
+		// Patches merge owner references by UID, so the dangling ones are
+		// removed before the set's reference is added by the patch.
+		opts.logf(resource, apps.ResourceActionUpdate, "dropping owner references to deleted ResourceSets")
+		res, err := client.Update(ctx, current, metav1.UpdateOptions{FieldManager: fieldManager})
+		if k8serrors.IsConflict(err) {
+			return apps.ResourceActionNone, retryConflictErr{err}
+		} else if err != nil {
+			return apps.ResourceActionNone, errors.Wrap(err, "drop dangling owner references")
+		}
+		current = res
+	}
+	// Fail before the update, which would be rejected and could lead to
+	// replacing the resource.
+	if err := checkImmutable(resource, current); err != nil {
+		return apps.ResourceActionNone, err
+	}
+	if f := opts.recreateField(current, resource); f != "" {
+		opts.logf(resource, apps.ResourceActionReplace, "recreating since %s changed", f)
+		return s.replaceResource(ctx, client, resource)
 	}
 
 	// Get what is running, what was installed and what we want to run.
@@ -709,7 +2297,34 @@ func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured
 	originalRaw := getAppliedAnnotation(current)
 
 	var patchErr error
-	if len(originalRaw) > 0 {
+	if strategy == PatchStrategyServerSideApply {
+		if opts.UpgradeManagedFields {
+			if err := upgradeManagedFields(ctx, client, current); err != nil {
+				return apps.ResourceActionNone, err
+			}
+		}
+		res, err := serverSideApply(ctx, client, resource)
+		if err == nil {
+			*resource = *res
+			return apps.ResourceActionUpdate, nil
+		}
+		patchErr = err
+	} else if strategy == PatchStrategyMergeOverLive {
+		// Merge what we want to run over what is running to keep all fields
+		// we don't declare, especially defaults.
+		merged := &unstructured.Unstructured{Object: mergeOverLive(current.Object, resource.Object)}
+		merged.SetResourceVersion(current.GetResourceVersion())
+
+		_, updateSpan := trace.StartSpan(ctx, "Update "+resource.GetName())
+		res, err := client.Update(ctx, merged, metav1.UpdateOptions{FieldManager: fieldManager})
+		updateSpan.End()
+		if err == nil {
+			// Successfully updated.
+			*resource = *res
+			return apps.ResourceActionUpdate, nil
+		}
+		patchErr = err
+	} else if len(originalRaw) > 0 {
 		// Try to patch it.
 		var (
 			patchType types.PatchType
@@ -756,7 +2371,7 @@ func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured
 		// Additionally the CL doesn't seem to implement valid behavior as the patch
 		// retries will not update to a new resourceVersion and the failure would persist.
 		_, patchSpan := trace.StartSpan(ctx, "Patch "+resource.GetName())
-		res, err := client.Patch(ctx, resource.GetName(), patchType, patch, metav1.PatchOptions{})
+		res, err := client.Patch(ctx, resource.GetName(), patchType, patch, metav1.PatchOptions{FieldManager: fieldManager})
 		patchSpan.End()
 		if err == nil {
 			// Successfully patched.
@@ -772,7 +2387,7 @@ func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured
 		resource.SetResourceVersion(current.GetResourceVersion())
 
 		_, updateSpan := trace.StartSpan(ctx, "Update "+resource.GetName())
-		res, err := client.Update(ctx, resource, metav1.UpdateOptions{})
+		res, err := client.Update(ctx, resource, metav1.UpdateOptions{FieldManager: fieldManager})
 		updateSpan.End()
 		if err == nil {
 			// Successfully updated.
@@ -782,10 +2397,34 @@ func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured
 		patchErr = err
 	}
 
-	// If patching/updating failed, consider deleting and recreating the resource.
-	if !canReplace(resource, patchErr) {
+	// If patching/updating failed, consider deleting and recreating the
+	// resource, unless the error is transient or due to missing permissions.
+	if opts.noReplace(patchErr) {
+		return apps.ResourceActionUpdate, errors.Wrap(patchErr, "apply patch or update")
+	}
+	var resolution ConflictResolution
+	if isConflict(patchErr) || opts.replaceOnError(resource, patchErr) {
+		var cerr error
+		if resolution, cerr = opts.onConflict(resource, current, patchErr); cerr != nil {
+			return apps.ResourceActionUpdate, cerr
+		}
+	}
+	switch {
+	case resolution == ConflictSkip:
+		return apps.ResourceActionSkip, nil
+	case resolution == ConflictRetry:
+		return apps.ResourceActionUpdate, retryConflictErr{patchErr}
+	case resolution == ConflictForce && isCustomResourceDefinition(resource):
+		return apps.ResourceActionUpdate, errors.Wrap(patchErr, "apply patch or update, CRDs can't be replaced")
+	case resolution == ConflictForce:
+	case resolution == ConflictFail || !opts.replaceOnError(resource, patchErr):
 		return apps.ResourceActionUpdate, errors.Wrap(patchErr, "apply patch or update")
 	}
+	return s.replaceResource(ctx, client, resource)
+}
+
+// replaceResource deletes the resource and creates it again.
+func (s *Synk) replaceResource(ctx context.Context, client dynamic.ResourceInterface, resource *unstructured.Unstructured) (apps.ResourceAction, error) {
 	_, replace_span := trace.StartSpan(ctx, "Replace "+resource.GetName())
 	res, err := replace(ctx, client, resource)
 	replace_span.End()
@@ -796,74 +2435,321 @@ func (s *Synk) applyOne(ctx context.Context, resource *unstructured.Unstructured
 	return apps.ResourceActionReplace, nil
 }
 
+// serverSideApply creates or updates the resource with server-side apply. The
+// owner reference to the ResourceSet is part of the applied configuration, so
+// that it is owned by Synk's field manager like all other fields and doesn't
+// require a separate update.
+func serverSideApply(ctx context.Context, client dynamic.ResourceInterface, resource *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	raw, err := resource.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	force := resource.GetAnnotations()[forceConflictsAnnotation] == "true"
+	_, span := trace.StartSpan(ctx, "Apply "+resource.GetName())
+	defer span.End()
+	return client.Patch(ctx, resource.GetName(), types.ApplyPatchType, raw, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+}
+
+// applyRegulars applies the resources, which must be sorted by kind. Up to
+// opts.Concurrency resources of the same kind are applied in parallel. It
+// returns the number of failures.
+func (s *Synk) applyRegulars(
+	ctx context.Context,
+	rs *apps.ResourceSet,
+	opts *applyOptions,
+	results applyResults,
+	resources []*unstructured.Unstructured,
+) int {
+	var (
+		mu       sync.Mutex
+		failures int
+	)
+	kinds := opts.governanceKinds()
+	apply := func(r *unstructured.Unstructured) {
+		mu.Lock()
+		// The key changes if the apiserver generates the name.
+		key := resourceKey(r)
+		err := governanceErr(r, results, kinds)
+		mu.Unlock()
+		sum := manifestChecksum(r)
+		action := apps.ResourceActionNone
+		if err != nil {
+			opts.errorf(r, action, "skipped, may retry: %s", err)
+		} else {
+			action, err = s.applyRegular(ctx, rs, opts, r)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failures++
+		}
+		delete(results, key)
+		results.set(r, action, err, opts.takeWarnings(r)...)
+		results[resourceKey(r)].checksum = sum
+		opts.status.changed(ctx, results)
+	}
+	if opts.Concurrency <= 1 {
+		for _, r := range resources {
+			apply(r)
+		}
+		return failures
+	}
+	sem := make(chan struct{}, opts.Concurrency)
+	for len(resources) > 0 {
+		// Wait for each kind to complete before applying the next one.
+		n := 1
+		for n < len(resources) && resources[n].GroupVersionKind() == resources[0].GroupVersionKind() {
+			n++
+		}
+		var wg sync.WaitGroup
+		for _, r := range resources[:n] {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(r *unstructured.Unstructured) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				apply(r)
+			}(r)
+		}
+		wg.Wait()
+		resources = resources[n:]
+	}
+	return failures
+}
+
+// applyRegular applies a resource that is not a CRD.
+func (s *Synk) applyRegular(ctx context.Context, rs *apps.ResourceSet, opts *applyOptions, r *unstructured.Unstructured) (apps.ResourceAction, error) {
+	if ok, err := s.hasRequiredGVK(r); err != nil {
+		opts.errorf(r, apps.ResourceActionNone, "failed to check required GVK: %s", err)
+		return apps.ResourceActionNone, err
+	} else if !ok {
+		opts.logf(r, apps.ResourceActionSkip, "skipped since %s is not available", r.GetAnnotations()[requiredGVKAnnotation])
+		return apps.ResourceActionSkip, nil
+	}
+	if ok, err := supportsK8sVersion(r, opts.serverVersion); err != nil {
+		opts.errorf(r, apps.ResourceActionNone, "failed to check Kubernetes version: %s", err)
+		return apps.ResourceActionNone, err
+	} else if !ok {
+		opts.logf(r, apps.ResourceActionSkip, "skipped since the cluster runs Kubernetes %s", opts.serverVersion)
+		return apps.ResourceActionSkip, nil
+	}
+	// Attach the ResourceSet as owner. CRDs are exempt since
+	// the risk of unintended deletion of all its instances is too high.
+	setOwnerRef(r, rs, opts.blockOwnerDeletion())
+	if err := addOwnerRefs(r, opts.AdditionalOwnerRefs); err != nil {
+		opts.errorf(r, apps.ResourceActionNone, "failed to set owner references: %s", err)
+		return apps.ResourceActionNone, err
+	}
+	action, err := s.applyOne(ctx, r, rs, opts)
+	if err != nil {
+		opts.errorf(r, action, "failed to apply, may retry: %s", err)
+	} else {
+		opts.logf(r, action, "applied successfully")
+	}
+	return action, err
+}
+
+// verifyApplied re-reads the resource and records a warning if fields differ
+// from the desired state.
+func (s *Synk) verifyApplied(ctx context.Context, desired *unstructured.Unstructured, opts *applyOptions) {
+	client, err := s.resourceClient(desired)
+	if err != nil {
+		opts.warnf(desired, "verify after apply: %s", err)
+		return
+	}
+	live, err := client.Get(ctx, desired.GetName(), metav1.GetOptions{})
+	if err != nil {
+		opts.warnf(desired, "verify after apply: get resource: %s", err)
+		return
+	}
+	if fields := opts.changedFields(live, desired); len(fields) > 0 {
+		opts.warnf(desired, "verify after apply: fields differ from the applied state: %s", strings.Join(fields, ", "))
+	}
+}
+
 // crdAvailable checks if all versions of the given CRD are present in the
 // server's discovery information. Callers must use s.Discovery.Invalidate()
 // to clear the discovery cache before calling this method to check against the
-// latest server state.
+// latest server state. Use servedResources and crdServed to check several CRDs.
 func (s *Synk) crdAvailable(ucrd *unstructured.Unstructured) (bool, error) {
+	return crdServed(ucrd, s.servedResources())
+}
+
+// servedResources returns the resource names in the server's discovery
+// information by group version. All resources are fetched with a single
+// discovery call, so that any number of CRDs can be checked against them.
+// Like crdAvailable, callers must invalidate the discovery cache first.
+func (s *Synk) servedResources() map[string]map[string]bool {
+	_, lists, err := s.discovery.ServerGroupsAndResources()
+	if err != nil {
+		// If discovery failed for some groups, the lists of the others are
+		// still returned. CRDs in the failed groups are treated as not yet
+		// available.
+		slog.Warn("ServerGroupsAndResources failed", ilog.Err(err))
+	}
+	served := map[string]map[string]bool{}
+	for _, l := range lists {
+		if l == nil {
+			continue
+		}
+		names := served[l.GroupVersion]
+		if names == nil {
+			names = map[string]bool{}
+			served[l.GroupVersion] = names
+		}
+		for _, r := range l.APIResources {
+			names[r.Name] = true
+		}
+	}
+	return served
+}
+
+// crdServed checks if all served versions of the given CRD are in the result
+// of servedResources.
+func crdServed(ucrd *unstructured.Unstructured, served map[string]map[string]bool) (bool, error) {
 	var crd apiextensions.CustomResourceDefinition
 	if err := convert(ucrd, &crd); err != nil {
 		return false, err
 	}
-
-	// Get a list of versions to check for.
-	var versions []string
 	for _, v := range crd.Spec.Versions {
-		if v.Served {
-			versions = append(versions, v.Name)
-		}
-	}
-
-	for _, v := range versions {
-		list, err := s.discovery.ServerResourcesForGroupVersion(crd.Spec.Group + "/" + v)
-		if err != nil {
-			// We'd like to detect "not found" vs network errors here. But unfortunately
-			// there's no canonical error being used.
-			slog.Warn("ServerResourcesForGroupVersion failed",
-				slog.String("Group", crd.Spec.Group),
-				slog.String("Version", v),
-				ilog.Err(err))
-			return false, nil
-		}
-		found := false
-		for _, r := range list.APIResources {
-			if r.Name == crd.Spec.Names.Plural {
-				found = true
-				break
-			}
-		}
-		if !found {
+		if v.Served && !served[crd.Spec.Group+"/"+v.Name][crd.Spec.Names.Plural] {
 			return false, nil
 		}
 	}
 	return true, nil
 }
 
+// resourceSetGVR is the default resource type of ResourceSets.
 var resourceSetGVR = schema.GroupVersionResource{
 	Group:    "apps.cloudrobotics.com",
 	Version:  "v1alpha1",
 	Resource: "resourcesets",
 }
 
+// resourceSetGVR returns the resource type of the Synk's ResourceSets.
+func (s *Synk) resourceSetGVR() schema.GroupVersionResource {
+	if s.resourceSetGV.Empty() {
+		return resourceSetGVR
+	}
+	return s.resourceSetGV.WithResource(resourceSetGVR.Resource)
+}
+
+// resourceSetGVK returns the type of the ResourceSet, which is the default
+// type if the ResourceSet has no type meta, eg in tests.
+func resourceSetGVK(set *apps.ResourceSet) schema.GroupVersionKind {
+	if set == nil || set.Kind == "" {
+		return resourceSetGVR.GroupVersion().WithKind("ResourceSet")
+	}
+	return set.GroupVersionKind()
+}
+
+// isResourceSetRef returns true if the owner reference refers to a
+// ResourceSet of the given group, in any version.
+func isResourceSetRef(or metav1.OwnerReference, group string) bool {
+	gv, err := schema.ParseGroupVersion(or.APIVersion)
+	return err == nil && gv.Group == group && or.Kind == "ResourceSet"
+}
+
+// resourceSets returns the client for ResourceSets, which is scoped to the
+// Synk's namespace if it has one.
+func (s *Synk) resourceSets() dynamic.ResourceInterface {
+	if s.namespace != "" {
+		return s.client.Resource(s.resourceSetGVR()).Namespace(s.namespace)
+	}
+	return s.client.Resource(s.resourceSetGVR())
+}
+
+func (s *Synk) resourceSetScope() apiextensions.ResourceScope {
+	if s.namespace != "" {
+		return apiextensions.NamespaceScoped
+	}
+	return apiextensions.ClusterScoped
+}
+
 func (s *Synk) createResourceSet(ctx context.Context, rs *apps.ResourceSet) error {
 	rs.Kind = "ResourceSet"
-	rs.APIVersion = "apps.cloudrobotics.com/v1alpha1"
+	rs.APIVersion = s.resourceSetGVR().GroupVersion().String()
 
 	var u unstructured.Unstructured
 	if err := convert(rs, &u); err != nil {
 		return err
 	}
-	res, err := s.client.Resource(resourceSetGVR).Create(ctx, &u, metav1.CreateOptions{})
+	res, err := s.resourceSets().Create(ctx, &u, metav1.CreateOptions{})
 	if err != nil {
-		return err
+		return resourceSetErr(err)
+	}
+	// The status subresource ignores the status on creation.
+	if phase, _, _ := unstructured.NestedString(res.Object, "status", "phase"); phase == "" && rs.Status.Phase != "" {
+		return s.patchResourceSetStatus(ctx, rs)
 	}
 	return convert(res, rs)
 }
 
+// ErrUnexpectedCount is returned if the number of resources differs from
+// ApplyOptions.ExpectedCount.
+var ErrUnexpectedCount = errors.New("unexpected resource count")
+
+// ErrResourceSetCRDMissing is returned if the ResourceSet CRD isn't installed
+// in the cluster.
+var ErrResourceSetCRDMissing = errors.New("the ResourceSet CRD resourcesets.apps.cloudrobotics.com is not installed, install it with `synk init` or EnsureResourceSetCRD first")
+
+// resourceSetErr returns ErrResourceSetCRDMissing if the error indicates that
+// the ResourceSet resource doesn't exist. Errors for missing objects, including
+// namespaces, have a name in their details.
+func resourceSetErr(err error) error {
+	if !k8serrors.IsNotFound(err) {
+		return err
+	}
+	if se, ok := errors.Cause(err).(k8serrors.APIStatus); ok && se.Status().Details != nil && se.Status().Details.Name != "" {
+		return err
+	}
+	return ErrResourceSetCRDMissing
+}
+
+// EnsureResourceSetCRD installs the ResourceSet CRD if it's missing.
+func (s *Synk) EnsureResourceSetCRD(ctx context.Context) error {
+	_, err := s.resourceSets().List(ctx, metav1.ListOptions{Limit: 1})
+	if err == nil {
+		return nil
+	}
+	if resourceSetErr(err) != ErrResourceSetCRDMissing {
+		return errors.Wrap(err, "list ResourceSets")
+	}
+	return s.Init()
+}
+
 type applyResult struct {
-	resource *unstructured.Unstructured
-	err      error
-	action   apps.ResourceAction
+	resource     *unstructured.Unstructured
+	err          error
+	action       apps.ResourceAction
+	warnings     []string
+	readyTimeout *metav1.Duration
+	// checksum is the manifestChecksum of the desired resource.
+	checksum string
+}
+
+func (r *applyResult) status() apps.ResourceStatus {
+	st := apps.ResourceStatus{
+		Namespace:  r.resource.GetNamespace(),
+		Name:       r.resource.GetName(),
+		Action:     r.action,
+		UID:        string(r.resource.GetUID()),
+		Generation: r.resource.GetGeneration(),
+		Checksum:   r.checksum,
+	}
+	if r.resource.GetLabels()[generateNameLabel] != "" {
+		st.GenerateName = r.resource.GetGenerateName()
+	}
+	if r.err != nil {
+		st.Error = r.err.Error()
+	}
+	st.Warnings = r.warnings
+	st.ReadyTimeout = r.readyTimeout
+	st.Canary = isCanary(r.resource)
+	return st
 }
 
 func (r *applyResult) String() string {
@@ -872,11 +2758,12 @@ func (r *applyResult) String() string {
 
 type applyResults map[string]*applyResult
 
-func (r applyResults) set(res *unstructured.Unstructured, action apps.ResourceAction, err error) {
+func (r applyResults) set(res *unstructured.Unstructured, action apps.ResourceAction, err error, warnings ...string) {
 	r[resourceKey(res)] = &applyResult{
 		resource: res,
 		action:   action,
 		err:      err,
+		warnings: warnings,
 	}
 }
 
@@ -898,20 +2785,27 @@ func (r applyResults) list() (l []*applyResult) {
 }
 
 func (s *Synk) updateResourceSetStatus(ctx context.Context, rs *apps.ResourceSet, results applyResults) error {
+	setResourceSetStatus(rs, results)
+	return s.patchResourceSetStatus(ctx, rs)
+}
+
+// setResourceSetStatus sets the final status for the results.
+func setResourceSetStatus(rs *apps.ResourceSet, results applyResults) {
+	setStatusGroups(rs, results)
+	rs.Status.FinishedAt = metav1.Now()
+	rs.Status.Phase = resourceSetPhase(&rs.Status)
+	if healthGateFailed(results) {
+		rs.Status.Phase = apps.ResourceSetPhaseFailed
+	}
+}
+
+// setStatusGroups sets the applied and failed resources and the counts.
+func setStatusGroups(rs *apps.ResourceSet, results applyResults) {
 	type group map[schema.GroupVersionKind][]apps.ResourceStatus
 	applied, failed := group{}, group{}
 
 	for _, r := range results.list() {
-		st := apps.ResourceStatus{
-			Namespace:  r.resource.GetNamespace(),
-			Name:       r.resource.GetName(),
-			Action:     r.action,
-			UID:        string(r.resource.GetUID()),
-			Generation: r.resource.GetGeneration(),
-		}
-		if r.err != nil {
-			st.Error = r.err.Error()
-		}
+		st := r.status()
 		gvk := r.resource.GroupVersionKind()
 		if r.err != nil {
 			failed[gvk] = append(failed[gvk], st)
@@ -933,30 +2827,210 @@ func (s *Synk) updateResourceSetStatus(ctx context.Context, rs *apps.ResourceSet
 			return lessResourceSetStatusGroup(&(*list)[i], &(*list)[j])
 		})
 	}
+	// The results cover all resources, including those of a resumed run.
+	rs.Status.Applied, rs.Status.Failed = nil, nil
 	build(applied, &rs.Status.Applied)
 	build(failed, &rs.Status.Failed)
 
-	rs.Status.FinishedAt = metav1.Now()
-	if len(rs.Status.Failed) > 0 {
-		rs.Status.Phase = apps.ResourceSetPhaseFailed
-	} else {
-		rs.Status.Phase = apps.ResourceSetPhaseSettled
+	rs.Status.Counts = resourceCounts(results)
+}
+
+// resourceCounts counts the resources by scope. Namespaces were populated
+// for all namespaced resources before applying.
+func resourceCounts(results applyResults) *apps.ResourceCounts {
+	counts := &apps.ResourceCounts{}
+	for _, r := range results {
+		switch {
+		case isCustomResourceDefinition(r.resource):
+			counts.CRDs++
+		case r.resource.GetNamespace() == "":
+			counts.ClusterScoped++
+		default:
+			counts.Namespaced++
+		}
 	}
+	return counts
+}
 
+// updateResourceSet updates the metadata and spec of the ResourceSet. The
+// status is only updated if the CRD has no status subresource, otherwise it
+// must be written with patchResourceSetStatus.
+func (s *Synk) updateResourceSet(ctx context.Context, rs *apps.ResourceSet) error {
 	var u unstructured.Unstructured
 	if err := convert(rs, &u); err != nil {
 		return err
 	}
-	res, err := s.client.Resource(resourceSetGVR).Update(ctx, &u, metav1.UpdateOptions{})
+	res, err := s.resourceSets().Update(ctx, &u, metav1.UpdateOptions{})
+	if err != nil {
+		return errors.Wrap(err, "update ResourceSet")
+	}
+	return convert(res, rs)
+}
+
+// storeGeneratedNames updates the spec if the apiserver generated names for
+// resources of the set.
+func (s *Synk) storeGeneratedNames(ctx context.Context, rs *apps.ResourceSet, generated bool) error {
+	if !generated {
+		return nil
+	}
+	return s.updateResourceSet(ctx, rs)
+}
+
+// patchResourceSetStatus writes the status with a merge patch of the status
+// subresource. Unlike an update, it doesn't fail or overwrite changes if
+// others modified the ResourceSet concurrently. Synk owns all status fields,
+// so the patch clears those that are empty. ResourceSet CRDs installed by
+// older versions of Init have no status subresource, in which case the
+// status is patched on the ResourceSet itself.
+func (s *Synk) patchResourceSetStatus(ctx context.Context, rs *apps.ResourceSet) error {
+	patch, err := statusPatch(&rs.Status)
+	if err != nil {
+		return err
+	}
+	res, err := s.resourceSets().Patch(ctx, rs.Name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if k8serrors.IsNotFound(err) {
+		res, err = s.resourceSets().Patch(ctx, rs.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
 	if err != nil {
 		return errors.Wrap(err, "update ResourceSet status")
 	}
 	return convert(res, rs)
 }
 
+// statusPatch returns a merge patch that sets all fields of the status,
+// including empty ones.
+func statusPatch(st *apps.ResourceSetStatus) ([]byte, error) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(*st)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if _, ok := fields[name]; !ok {
+			fields[name] = nil
+		}
+	}
+	return json.Marshal(map[string]interface{}{"status": fields})
+}
+
+func resourceSetPhase(st *apps.ResourceSetStatus) apps.ResourceSetPhase {
+	switch {
+	case len(st.Failed) == 0:
+		return apps.ResourceSetPhaseSettled
+	case len(st.Applied) == 0:
+		return apps.ResourceSetPhaseFailed
+	default:
+		return apps.ResourceSetPhaseDegraded
+	}
+}
+
+// setResourceStatus replaces the status of a single resource in the
+// ResourceSet's status and adds it to its spec if necessary. It returns true
+// if the spec changed.
+func setResourceStatus(rs *apps.ResourceSet, r *applyResult) bool {
+	gvk := r.resource.GroupVersionKind()
+	st := r.status()
+
+	ref := apps.ResourceRef{Namespace: st.Namespace, Name: st.Name}
+	found, added := false, false
+	for i := range rs.Spec.Resources {
+		g := &rs.Spec.Resources[i]
+		if g.Group != gvk.Group || g.Version != gvk.Version || g.Kind != gvk.Kind {
+			continue
+		}
+		for _, item := range g.Items {
+			if item == ref {
+				found = true
+			}
+		}
+		if !found {
+			g.Items = append(g.Items, ref)
+			found, added = true, true
+		}
+	}
+	if !found {
+		added = true
+		rs.Spec.Resources = append(rs.Spec.Resources, apps.ResourceSetSpecGroup{
+			Group:   gvk.Group,
+			Version: gvk.Version,
+			Kind:    gvk.Kind,
+			Items:   []apps.ResourceRef{ref},
+		})
+		sort.Slice(rs.Spec.Resources, func(i, j int) bool {
+			return lessResourceSetSpecGroup(&rs.Spec.Resources[i], &rs.Spec.Resources[j])
+		})
+	}
+
+	// Remove previous status entries before adding the new one.
+	remove := func(list []apps.ResourceSetStatusGroup) (res []apps.ResourceSetStatusGroup) {
+		for _, g := range list {
+			if g.Group == gvk.Group && g.Version == gvk.Version && g.Kind == gvk.Kind {
+				items := g.Items[:0:0]
+				for _, item := range g.Items {
+					if item.Namespace != st.Namespace || item.Name != st.Name {
+						items = append(items, item)
+					}
+				}
+				if len(items) == 0 {
+					continue
+				}
+				g.Items = items
+			}
+			res = append(res, g)
+		}
+		return res
+	}
+	rs.Status.Applied = remove(rs.Status.Applied)
+	rs.Status.Failed = remove(rs.Status.Failed)
+
+	list := &rs.Status.Applied
+	if r.err != nil {
+		list = &rs.Status.Failed
+	}
+	found = false
+	for i := range *list {
+		g := &(*list)[i]
+		if g.Group == gvk.Group && g.Version == gvk.Version && g.Kind == gvk.Kind {
+			g.Items = append(g.Items, st)
+			found = true
+		}
+	}
+	if !found {
+		*list = append(*list, apps.ResourceSetStatusGroup{
+			Group:   gvk.Group,
+			Version: gvk.Version,
+			Kind:    gvk.Kind,
+			Items:   []apps.ResourceStatus{st},
+		})
+		sort.Slice(*list, func(i, j int) bool {
+			return lessResourceSetStatusGroup(&(*list)[i], &(*list)[j])
+		})
+	}
+	rs.Status.Phase = resourceSetPhase(&rs.Status)
+	return added
+}
+
+// appliedStatuses returns the statuses of all successfully applied resources
+// by resource key.
+func appliedStatuses(st *apps.ResourceSetStatus) map[string]apps.ResourceStatus {
+	res := map[string]apps.ResourceStatus{}
+	for _, g := range st.Applied {
+		for _, item := range g.Items {
+			key := fmt.Sprintf("%s/%s/%s", gvkKey(g.Group, g.Version, g.Kind), item.Namespace, item.Name)
+			res[key] = item
+		}
+	}
+	return res
+}
+
 // deleteResourceSets deletes all ResourceSets of the given name that have a lower version.
 func (s *Synk) deleteResourceSets(ctx context.Context, name string, version int32) error {
-	c := s.client.Resource(resourceSetGVR)
+	c := s.resourceSets()
 
 	list, err := c.List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -978,23 +3052,55 @@ func (s *Synk) deleteResourceSets(ctx context.Context, name string, version int3
 	return nil
 }
 
-// next returns the next version for the resources name.
-func (s *Synk) next(ctx context.Context, name string) (version int32, err error) {
-	list, err := s.client.Resource(resourceSetGVR).List(ctx, metav1.ListOptions{})
+// NextVersion returns the version of the ResourceSet that the next Apply for
+// the name creates, which is one higher than the latest existing version.
+// Apply doesn't create a new version if it resumes an interrupted apply of the
+// same resources or skips an unchanged or suspended set.
+func (s *Synk) NextVersion(ctx context.Context, name string) (int32, error) {
+	prev, err := s.latest(ctx, name)
 	if err != nil {
-		return 0, errors.Wrap(err, "list existing ResourceSets")
+		return 0, err
 	}
-	var curVersion int32
-	for _, r := range list.Items {
+	return nextVersion(prev), nil
+}
+
+// nextVersion returns the version following prev, which may be nil.
+func nextVersion(prev *apps.ResourceSet) int32 {
+	if prev == nil {
+		return 1
+	}
+	_, v, _ := decodeResourceSetName(prev.Name)
+	return v + 1
+}
+
+// latest returns the ResourceSet with the highest version for the resources
+// name or nil if there is none.
+func (s *Synk) latest(ctx context.Context, name string) (*apps.ResourceSet, error) {
+	list, err := s.resourceSets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(resourceSetErr(err), "list existing ResourceSets")
+	}
+	var (
+		cur        *unstructured.Unstructured
+		curVersion int32
+	)
+	for i, r := range list.Items {
 		n, v, ok := decodeResourceSetName(r.GetName())
 		if !ok || n != name {
 			continue
 		}
 		if v > curVersion {
-			curVersion = v
+			cur, curVersion = &list.Items[i], v
 		}
 	}
-	return curVersion + 1, nil
+	if cur == nil {
+		return nil, nil
+	}
+	var rs apps.ResourceSet
+	if err := convert(cur, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
 }
 
 // Filter for helm-hooks that mark test resources. See
@@ -1052,12 +3158,22 @@ func sortResources(res []*unstructured.Unstructured) {
 	})
 }
 
+// ResourceKey returns the key of a resource for ApplyOptions.OnLiveObject and
+// WarningFunc, which has the form "group/version/kind/namespace/name".
+func ResourceKey(r *unstructured.Unstructured) string {
+	return resourceKey(r)
+}
+
 func resourceKey(r *unstructured.Unstructured) string {
 	gvk := r.GroupVersionKind()
+	name := r.GetName()
+	if name == "" {
+		name = r.GetGenerateName()
+	}
 	return fmt.Sprintf("%s/%s/%s",
 		gvkKey(gvk.Group, gvk.Version, gvk.Kind),
 		r.GetNamespace(),
-		r.GetName())
+		name)
 }
 
 func gvkKey(group, version, kind string) string {
@@ -20,11 +20,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -32,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/scheme"
 	k8stest "k8s.io/client-go/testing"
@@ -159,7 +162,7 @@ func TestSynk_initialize(t *testing.T) {
 	ctx := context.Background()
 	s := newFixture(t).newSynk()
 
-	_, _, err := s.initialize(ctx, &ApplyOptions{name: "test"},
+	_, _, err := s.initialize(ctx, newApplyOptions("test", nil),
 		newUnstructured("v1", "Pod", "ns2", "pod1"),
 		newUnstructured("apps/v1", "Deployment", "ns1", "deploy1"),
 		newUnstructured("v1", "Pod", "ns1", "pod1"),
@@ -210,6 +213,217 @@ status:
 	}
 }
 
+func TestSynk_initializeNamespaced(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+	s.namespace = "ns1"
+
+	rs, resources, err := s.initialize(ctx, newApplyOptions("test", nil),
+		newUnstructured("v1", "Pod", "", "pod1"),
+		newUnstructured("v1", "Pod", "ns1", "pod2"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Namespace != "ns1" {
+		t.Errorf("expected ResourceSet in namespace %q but got %q", "ns1", rs.Namespace)
+	}
+	for _, r := range resources {
+		if r.GetNamespace() != "ns1" {
+			t.Errorf("expected namespace %q on %q but got %q", "ns1", r.GetName(), r.GetNamespace())
+		}
+	}
+	if _, err := s.client.Resource(resourceSetGVR).Namespace("ns1").Get(ctx, "test.v1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected namespaced ResourceSet: %s", err)
+	}
+
+	_, _, err = s.initialize(ctx, newApplyOptions("test", nil),
+		newUnstructured("v1", "Pod", "ns2", "pod1"),
+	)
+	if err == nil {
+		t.Errorf("expected error for resource outside of namespace, got nil")
+	}
+}
+
+func TestSynk_InitNamespaced(t *testing.T) {
+	s := newFixture(t).newSynk()
+	s.namespace = "ns1"
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	s.mapper = mapper
+	s.discovery = &staticDiscovery{}
+	s.AddResources(&metav1.APIResourceList{
+		GroupVersion: resourceSetGVR.GroupVersion().String(),
+		APIResources: []metav1.APIResource{{Name: "resourcesets", Kind: "ResourceSet", Namespaced: true}},
+	})
+
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	crdGVR := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	crd, err := s.client.Resource(crdGVR).Get(context.Background(), "resourcesets.apps.cloudrobotics.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope"); scope != "Namespaced" {
+		t.Errorf("expected ResourceSet CRD scope %q, got %q", "Namespaced", scope)
+	}
+}
+
+func TestSynk_ApplyWithoutResourceSetCRD(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	// The apiserver responds with a generic 404 for unknown resource types.
+	f.fake.PrependReactor("*", "resourcesets", func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewGenericServerResponse(404, action.GetVerb(), resourceSetGVR.GroupResource(), "", "", 0, false)
+	})
+
+	_, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if errors.Cause(err) != ErrResourceSetCRDMissing {
+		t.Errorf("expected ErrResourceSetCRDMissing, got %v", err)
+	}
+	if err := s.Delete(ctx, "test"); err != ErrResourceSetCRDMissing {
+		t.Errorf("expected ErrResourceSetCRDMissing from Delete, got %v", err)
+	}
+	// Missing objects are reported as before.
+	if err := resourceSetErr(k8serrors.NewNotFound(resourceSetGVR.GroupResource(), "test.v1")); err == ErrResourceSetCRDMissing {
+		t.Errorf("unexpected ErrResourceSetCRDMissing for missing object")
+	}
+}
+
+func TestSynk_ApplyExpectedCount(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	resources := func() []*unstructured.Unstructured {
+		// Empty resources, eg from an empty template, aren't counted.
+		return []*unstructured.Unstructured{newUnstructured("v1", "ConfigMap", "ns1", "cm1"), {}}
+	}
+
+	two := 2
+	_, err := s.Apply(ctx, "test", &ApplyOptions{ExpectedCount: &two}, resources()...)
+	if !errors.Is(err, ErrUnexpectedCount) {
+		t.Fatalf("expected ErrUnexpectedCount, got %v", err)
+	}
+	if want := "got 1 resources, expected 2"; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error to contain %q, got %q", want, err)
+	}
+	if writes := filterReadActions(f.fake.Actions()); len(writes) > 0 {
+		t.Errorf("expected no writes, got %v", writes)
+	}
+
+	one := 1
+	if _, err := s.Apply(ctx, "test", &ApplyOptions{ExpectedCount: &one}, resources()...); err != nil {
+		t.Errorf("expected apply with matching count to succeed, got %v", err)
+	}
+}
+
+func TestSynk_ApplySetsResourceSetAnnotations(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	opts := &ApplyOptions{Annotations: map[string]string{TraceIDAnnotation: "trace-1", "example.com/request": "r1"}}
+	cm := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	rs, err := s.Apply(ctx, "test", opts, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.resourceSets().Get(ctx, rs.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stored.GetAnnotations(); !reflect.DeepEqual(got, opts.Annotations) {
+		t.Errorf("expected ResourceSet annotations %v, got %v", opts.Annotations, got)
+	}
+	live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := live.GetAnnotations()[TraceIDAnnotation]; ok {
+		t.Errorf("expected no trace ID on the applied resource")
+	}
+}
+
+func TestSynk_ApplyRecordsSourceRevision(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	opts := &ApplyOptions{SourceRevision: "abc123", Annotations: map[string]string{TraceIDAnnotation: "trace-1"}}
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	sets, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("expected one ResourceSet, got %d", len(sets))
+	}
+	want := map[string]string{SourceRevisionAnnotation: "abc123", TraceIDAnnotation: "trace-1"}
+	if got := sets[0].Annotations; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected annotations %v, got %v", want, got)
+	}
+	if got := NewApplyResult(sets[0]).SourceRevision; got != "abc123" {
+		t.Errorf("expected source revision %q in result, got %q", "abc123", got)
+	}
+	live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := live.GetAnnotations()[SourceRevisionAnnotation]; ok {
+		t.Errorf("expected no source revision on the resource without PropagateSourceRevision")
+	}
+
+	opts = &ApplyOptions{SourceRevision: "def456", PropagateSourceRevision: true, PatchStrategy: PatchStrategyMergeOverLive}
+	if _, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	live, err = s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := live.GetAnnotations()[SourceRevisionAnnotation]; got != "def456" {
+		t.Errorf("expected source revision %q on the resource, got %q", "def456", got)
+	}
+}
+
+func TestSynk_ApplyForbidden(t *testing.T) {
+	ctx := context.Background()
+	forbidden := func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewForbidden(action.GetResource().GroupResource(), "", errors.New("RBAC: access denied"))
+	}
+
+	t.Run("resourcesets", func(t *testing.T) {
+		f := newFixture(t)
+		s := f.newSynk()
+		f.fake.PrependReactor("create", "resourcesets", forbidden)
+
+		_, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+		if !k8serrors.IsForbidden(err) {
+			t.Fatalf("expected forbidden error, got %v", err)
+		}
+		for _, a := range f.fake.Actions() {
+			if a.GetResource().Resource == "configmaps" && a.GetVerb() != "get" {
+				t.Errorf("expected no writes to ConfigMaps, got %v", a)
+			}
+		}
+	})
+	t.Run("resources", func(t *testing.T) {
+		f := newFixture(t)
+		s := f.newSynk()
+		f.fake.PrependReactor("create", "configmaps", forbidden)
+
+		rs, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+		if err == nil {
+			t.Fatal("expected error for forbidden resource")
+		}
+		if len(rs.Status.Failed) != 1 || !strings.Contains(rs.Status.Failed[0].Items[0].Error, "forbidden") {
+			t.Errorf("expected ConfigMap to fail as forbidden, got %v", rs.Status.Failed)
+		}
+	})
+}
+
 func TestSynk_updateResourceSetStatus(t *testing.T) {
 	ctx := context.Background()
 	f := newFixture(t)
@@ -255,7 +469,7 @@ kind: ResourceSet
 metadata:
   name: set1
 status:
-  phase: Failed
+  phase: Degraded
   applied:
   failed:
   - version: v1
@@ -282,6 +496,10 @@ status:
     - namespace: ns1
       name: deploy1
       action: Create
+  counts:
+    crds: 0
+    clusterScoped: 0
+    namespaced: 4
 `)
 	if v, _, _ := unstructured.NestedString(got.Object, "status", "finishedAt"); v == "" {
 		t.Errorf("finishedAt timestamp was not set")
@@ -295,11 +513,63 @@ status:
 	}
 }
 
+func TestResourceCounts(t *testing.T) {
+	results := applyResults{}
+	for _, r := range []*unstructured.Unstructured{
+		newUnstructured("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "robots.registry.cloudrobotics.com"),
+		newUnstructured("v1", "Namespace", "", "ns1"),
+		newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRole", "", "role1"),
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+	} {
+		results.set(r, apps.ResourceActionCreate, nil)
+	}
+	want := &apps.ResourceCounts{CRDs: 1, ClusterScoped: 2, Namespaced: 1}
+	if got := resourceCounts(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("resourceCounts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSynk_updateResourceSetStatusPhase(t *testing.T) {
+	tests := []struct {
+		desc   string
+		errors []error
+		want   apps.ResourceSetPhase
+	}{
+		{"all applied", []error{nil, nil}, apps.ResourceSetPhaseSettled},
+		{"some failed", []error{nil, errors.New("oops")}, apps.ResourceSetPhaseDegraded},
+		{"all failed", []error{errors.New("oops"), errors.New("oops")}, apps.ResourceSetPhaseFailed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFixture(t).newSynk()
+
+			rs := &apps.ResourceSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "set1"},
+			}
+			if err := s.createResourceSet(ctx, rs); err != nil {
+				t.Fatal(err)
+			}
+			results := applyResults{}
+			for i, err := range tc.errors {
+				results.set(newUnstructured("v1", "Pod", "ns1", fmt.Sprintf("pod%d", i)), apps.ResourceActionCreate, err)
+			}
+			if err := s.updateResourceSetStatus(ctx, rs, results); err != nil {
+				t.Fatal(err)
+			}
+			if rs.Status.Phase != tc.want {
+				t.Errorf("expected phase %q but got %q", tc.want, rs.Status.Phase)
+			}
+		})
+	}
+}
+
 // Hardcode some GVR mappings for easy use in tests. The only other way is
 // setting up a full RestMapper.
 var gvrs = map[string]schema.GroupVersionResource{
 	"configmaps":  {Version: "v1", Resource: "configmaps"},
 	"deployments": {Group: "apps", Version: "v1", Resource: "deployments"},
+	"services":    {Version: "v1", Resource: "services"},
 	"approllouts": {Group: "apps.cloudrobotics.com", Version: "v1alpha1", Resource: "approllouts"},
 }
 
@@ -338,7 +608,7 @@ data:
 	// Note: We can't test applying an Unstructured object here, as the
 	// fake client doesn't support strategic merge patches:
 	// https://github.com/kubernetes/client-go/issues/613
-	results, err := f.newSynk().applyAll(context.Background(), set, &ApplyOptions{name: "test"},
+	results, err := f.newSynk().applyAll(context.Background(), set, newApplyOptions("test", nil),
 		cm.DeepCopy(),
 	)
 	if err != nil {
@@ -380,7 +650,7 @@ func TestSynk_applyAllIsCreatingResources(t *testing.T) {
 	set.Name = "test.v1"
 	set.UID = "deadbeef"
 
-	results, err := f.newSynk().applyAll(context.Background(), set, &ApplyOptions{name: "test"},
+	results, err := f.newSynk().applyAll(context.Background(), set, newApplyOptions("test", nil),
 		rollout.DeepCopy(),
 		deploy.DeepCopy(),
 	)
@@ -413,103 +683,695 @@ func TestSynk_applyAllIsCreatingResources(t *testing.T) {
 	f.verifyWriteActions()
 }
 
-func TestSynk_applyAllRetriesResourceExpired(t *testing.T) {
-	// deploy is the input to applyAll(), annotatedDeploy is the expected output.
-	// TODO(rodrigoq): change verifyWriteActions() to avoid this boilerplate
-	deploy := newUnstructured("apps/v1", "Deployment", "foo1", "dp1")
-	annotatedDeploy := deploy.DeepCopy()
+func TestSynk_applyAllSkipsResourcesWithMissingGVK(t *testing.T) {
+	f := newFixture(t)
+
+	monitor := newUnstructured("apps/v1", "Deployment", "foo1", "dp1")
+	monitor.SetAnnotations(map[string]string{requiredGVKAnnotation: "monitoring.coreos.com/v1/ServiceMonitor"})
+	deploy := newUnstructured("apps/v1", "Deployment", "foo1", "dp2")
+	deploy.SetAnnotations(map[string]string{requiredGVKAnnotation: "apps/v1/Deployment"})
+
 	set := &apps.ResourceSet{}
 	set.Name = "test.v1"
 	set.UID = "deadbeef"
-	_true := true
-	ownerRef := metav1.OwnerReference{
-		APIVersion:         "apps.cloudrobotics.com/v1alpha1",
-		Kind:               "ResourceSet",
-		Name:               set.Name,
-		UID:                set.UID,
-		BlockOwnerDeletion: &_true,
+
+	results, err := f.newSynk().applyAll(context.Background(), set, newApplyOptions("test", nil),
+		monitor, deploy,
+	)
+	if err != nil {
+		t.Fatal(err)
 	}
-	annotatedDeploy.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
-	setAppliedAnnotation(annotatedDeploy)
-	emptyPatch := []byte(`{}`)
+	if got := results[resourceKey(monitor)].action; got != apps.ResourceActionSkip {
+		t.Errorf("expected action %q for resource with missing GVK, got %q", apps.ResourceActionSkip, got)
+	}
+	if got := results[resourceKey(deploy)].action; got != apps.ResourceActionCreate {
+		t.Errorf("expected action %q for resource with available GVK, got %q", apps.ResourceActionCreate, got)
+	}
+	if writes := filterReadActions(f.fake.Actions()); len(writes) != 1 {
+		t.Errorf("expected exactly one write, got %d", len(writes))
+	}
+}
+
+func TestSynk_applyAllRespectsBlockOwnerDeletion(t *testing.T) {
+	_false := false
+	tests := []struct {
+		desc string
+		opt  *bool
+		want bool
+	}{
+		{desc: "default", opt: nil, want: true},
+		{desc: "disabled", opt: &_false, want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			set.UID = "deadbeef"
 
+			deploy := newUnstructured("apps/v1", "Deployment", "foo1", "dp1")
+			opts := newApplyOptions("test", &ApplyOptions{BlockOwnerDeletion: tc.opt})
+			if _, err := newFixture(t).newSynk().applyAll(context.Background(), set, opts, deploy); err != nil {
+				t.Fatal(err)
+			}
+			refs := deploy.GetOwnerReferences()
+			if len(refs) != 1 || refs[0].BlockOwnerDeletion == nil {
+				t.Fatalf("expected owner reference with BlockOwnerDeletion, got %v", refs)
+			}
+			if got := *refs[0].BlockOwnerDeletion; got != tc.want {
+				t.Errorf("expected BlockOwnerDeletion %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSynk_applyAllSkipCRDWait(t *testing.T) {
+	var (
+		crdGVK     = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+		rolloutGVK = schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "AppRollout"}
+	)
 	tests := []struct {
 		desc    string
-		verb    string
-		objects []runtime.Object
-		actions []k8stest.Action
-	}{{
-		desc:    "create deployment returns ResourceExpired",
-		verb:    "create",
-		objects: []runtime.Object{},
-		actions: []k8stest.Action{
-			k8stest.NewCreateAction(gvrs["deployments"], "foo1", annotatedDeploy),
-			k8stest.NewCreateAction(gvrs["deployments"], "foo1", annotatedDeploy),
-		},
-	}, {
-		desc:    "patch deployment returns ResourceExpired",
-		verb:    "patch",
-		objects: []runtime.Object{annotatedDeploy},
-		actions: []k8stest.Action{
-			k8stest.NewPatchAction(gvrs["deployments"], "foo1", "dp1", types.StrategicMergePatchType, emptyPatch),
-			k8stest.NewPatchAction(gvrs["deployments"], "foo1", "dp1", types.StrategicMergePatchType, emptyPatch),
-		},
-	}, {
-		desc:    "update deployment returns ResourceExpired",
-		verb:    "update",
-		objects: []runtime.Object{deploy},
-		actions: []k8stest.Action{
-			k8stest.NewUpdateAction(gvrs["deployments"], "foo1", annotatedDeploy),
-			k8stest.NewUpdateAction(gvrs["deployments"], "foo1", annotatedDeploy),
-		},
-	}}
+		policy  MapperRefreshPolicy
+		wantErr bool
+	}{
+		{desc: "refresh once", policy: MapperRefreshOnce, wantErr: true},
+		{desc: "refresh on miss", policy: MapperRefreshOnMiss, wantErr: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			s := newFixture(t).newSynk()
+			// The CRD only becomes served for the second mapper reset, which
+			// mimics it not being established right after creation.
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(crdGVK, meta.RESTScopeRoot)
+			s.mapper = mapper
+			resets := 0
+			s.resetMapper = func() {
+				resets++
+				if resets == 2 {
+					mapper.Add(rolloutGVK, meta.RESTScopeNamespace)
+				}
+			}
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+
+			crd := newUnstructured("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "approllouts.apps.cloudrobotics.com")
+			rollout := newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "foo1", "ar1")
+			opts := newApplyOptions("test", &ApplyOptions{SkipCRDWait: true, MapperRefresh: tc.policy})
+			// The fake discovery client would panic if the CRD wait was attempted.
+			results, err := s.applyAll(context.Background(), set, opts, crd, rollout)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if results.failed(crd) {
+				t.Errorf("expected CRD to be applied, got %v", results[resourceKey(crd)])
+			}
+			if !tc.wantErr {
+				if _, err := s.client.Resource(gvrs["approllouts"]).Namespace("foo1").Get(context.Background(), "ar1", metav1.GetOptions{}); err != nil {
+					t.Errorf("expected AppRollout to be applied: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// servingDiscovery serves the AppRollout CRD right away and the App CRD only
+// once an AppRollout exists, like a controller that is configured by one
+// custom resource and installs the next CRD.
+type servingDiscovery struct {
+	fakeCachedDiscoveryClient
+	client dynamic.Interface
+}
+
+func (d *servingDiscovery) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	list := &metav1.APIResourceList{
+		GroupVersion: "apps.cloudrobotics.com/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "approllouts", Kind: "AppRollout", Namespaced: true}},
+	}
+	if _, err := d.client.Resource(gvrs["approllouts"]).Namespace("foo1").Get(context.Background(), "ar1", metav1.GetOptions{}); err == nil {
+		list.APIResources = append(list.APIResources, metav1.APIResource{Name: "apps", Kind: "App"})
+	}
+	return nil, []*metav1.APIResourceList{list}, nil
+}
+
+func TestSynk_applyAllInterleavesCRDs(t *testing.T) {
+	defer func(d time.Duration) { crdWaitInterval = d }(crdWaitInterval)
+	crdWaitInterval = time.Millisecond
 
+	newCRD := func(plural, kind, scope string) *unstructured.Unstructured {
+		crd := &unstructured.Unstructured{}
+		unmarshalYAML(t, &crd.Object, fmt.Sprintf(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: %[1]s.apps.cloudrobotics.com
+spec:
+  group: apps.cloudrobotics.com
+  names:
+    kind: %[2]s
+    plural: %[1]s
+  scope: %[3]s
+  versions:
+  - name: v1alpha1
+    served: true`, plural, kind, scope))
+		return crd
+	}
+	tests := []struct {
+		desc    string
+		policy  CRDWaitPolicy
+		failCRD bool
+		wantErr bool
+	}{
+		{desc: "per CRD", policy: CRDWaitPerCRD, wantErr: false},
+		{desc: "per CRD retries failed CRD", policy: CRDWaitPerCRD, failCRD: true, wantErr: false},
+		{desc: "all", policy: CRDWaitAll, wantErr: true},
+	}
 	for _, tc := range tests {
 		t.Run(tc.desc, func(t *testing.T) {
 			f := newFixture(t)
-			f.addObjects(tc.objects...)
 			s := f.newSynk()
-			// ResourceExpired should be treated as a transient error.
-			f.fake.PrependReactor(tc.verb, "deployments", func(action k8stest.Action) (bool, runtime.Object, error) {
-				return true, nil, k8serrors.NewResourceExpired("gone")
-			})
+			s.discovery = &servingDiscovery{client: s.client}
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+			mapper.Add(schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "AppRollout"}, meta.RESTScopeNamespace)
+			mapper.Add(schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "App"}, meta.RESTScopeRoot)
+			s.mapper = mapper
+			if tc.failCRD {
+				failed := false
+				f.fake.PrependReactor("create", "customresourcedefinitions", func(action k8stest.Action) (bool, runtime.Object, error) {
+					if failed {
+						return false, nil, nil
+					}
+					failed = true
+					return true, nil, k8serrors.NewInternalError(errors.New("etcd unavailable"))
+				})
+			}
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
 
-			_, err := s.applyAll(context.Background(), set, &ApplyOptions{name: "test"},
-				deploy.DeepCopy(),
+			app := newUnstructured("apps.cloudrobotics.com/v1alpha1", "App", "", "app1")
+			opts := newApplyOptions("test", &ApplyOptions{CRDWait: tc.policy})
+			results, err := s.applyAll(context.Background(), set, opts,
+				newCRD("apps", "App", "Cluster"),
+				newCRD("approllouts", "AppRollout", "Namespaced"),
+				newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "foo1", "ar1"),
+				app,
 			)
-			if err == nil {
-				t.Error("applyAll() succeeded unexpectedly, want ResourceExpired")
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr {
+				if r, ok := results[resourceKey(app)]; !ok || r.err != nil || r.action != apps.ResourceActionCreate {
+					t.Errorf("expected App to be created after its CRD was served, got %v", r)
+				}
 			}
-
-			// applyAll() should retry once before failing.
-			f.expectActions(tc.actions...)
-			f.verifyWriteActions()
 		})
 	}
 }
 
-func TestSynk_skipsTestResources(t *testing.T) {
-	ctx := context.Background()
-	s := newFixture(t).newSynk()
+// countingDiscovery serves the given resources once it was invalidated
+// servedAfter times and counts the discovery calls.
+type countingDiscovery struct {
+	fakeCachedDiscoveryClient
+	resources     []*metav1.APIResourceList
+	servedAfter   int
+	invalidations int
+	calls         int
+}
 
-	testPod := newUnstructured("v1", "Pod", "ns", "pod2")
-	testPod.SetAnnotations(map[string]string{"helm.sh/hook": "test-success"})
+func (d *countingDiscovery) Invalidate() { d.invalidations++ }
 
-	_, _, err := s.initialize(context.Background(), &ApplyOptions{name: "test"},
-		newUnstructured("v1", "Pod", "ns", "pod1"),
-		testPod,
-	)
-	if err != nil {
-		t.Fatal(err)
+func (d *countingDiscovery) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	d.calls++
+	if d.invalidations < d.servedAfter {
+		return nil, nil, nil
 	}
-	got, err := s.client.Resource(resourceSetGVR).Get(ctx, "test.v1", metav1.GetOptions{})
-	if err != nil {
-		t.Fatal(err)
+	return nil, d.resources, nil
+}
+
+func (d *countingDiscovery) ServerResourcesForGroupVersion(gv string) (*metav1.APIResourceList, error) {
+	d.calls++
+	for _, l := range d.resources {
+		if l.GroupVersion == gv && d.invalidations >= d.servedAfter {
+			return l, nil
+		}
 	}
-	var want unstructured.Unstructured
-	unmarshalYAML(t, &want, `
-apiVersion: apps.cloudrobotics.com/v1alpha1
-kind: ResourceSet
+	return nil, k8serrors.NewNotFound(schema.GroupResource{}, gv)
+}
+
+// manyCRDs returns n CRDs and the discovery information that serves them.
+func manyCRDs(t testing.TB, n int) ([]*unstructured.Unstructured, *metav1.APIResourceList) {
+	list := &metav1.APIResourceList{GroupVersion: "example.com/v1"}
+	var crds []*unstructured.Unstructured
+	for i := 0; i < n; i++ {
+		crd := &unstructured.Unstructured{}
+		unmarshalYAML(t, &crd.Object, fmt.Sprintf(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widget%[1]ds.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget%[1]d
+    plural: widget%[1]ds
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true`, i))
+		crds = append(crds, crd)
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name: fmt.Sprintf("widget%ds", i), Kind: fmt.Sprintf("Widget%d", i), Namespaced: true,
+		})
+	}
+	return crds, list
+}
+
+func TestSynk_applyAllChecksCRDsWithOneDiscoveryCallPerPoll(t *testing.T) {
+	defer func(d time.Duration) { crdWaitInterval = d }(crdWaitInterval)
+	crdWaitInterval = time.Millisecond
+
+	for _, policy := range []CRDWaitPolicy{CRDWaitPerCRD, CRDWaitAll} {
+		t.Run(string(policy), func(t *testing.T) {
+			f := newFixture(t)
+			s := f.newSynk()
+			crds, list := manyCRDs(t, 30)
+			d := &countingDiscovery{resources: []*metav1.APIResourceList{list}, servedAfter: 3}
+			s.discovery = d
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+			s.mapper = mapper
+
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			results, err := s.applyAll(context.Background(), set, newApplyOptions("test", &ApplyOptions{CRDWait: policy}), crds...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, crd := range crds {
+				if results.failed(crd) {
+					t.Errorf("expected CRD %s to be applied, got %v", crd.GetName(), results[resourceKey(crd)])
+				}
+			}
+			if d.invalidations != 3 {
+				t.Errorf("expected 3 polls until the CRDs are served, got %d", d.invalidations)
+			}
+			if d.calls != d.invalidations {
+				t.Errorf("expected one discovery call per poll, got %d calls in %d polls", d.calls, d.invalidations)
+			}
+		})
+	}
+}
+
+func TestSynk_applyAllExtendsWaitForProgressingCRDs(t *testing.T) {
+	defer func(d time.Duration) { crdWaitInterval = d }(crdWaitInterval)
+	crdWaitInterval = time.Millisecond
+
+	tests := []struct {
+		desc          string
+		maxTimeout    time.Duration
+		namesAccepted string
+		wantErr       bool
+	}{
+		{"no extension", 0, "True", true},
+		{"progressing", time.Minute, "True", false},
+		{"names not accepted", time.Minute, "False", true},
+	}
+	for _, policy := range []CRDWaitPolicy{CRDWaitPerCRD, CRDWaitAll} {
+		for _, tc := range tests {
+			t.Run(string(policy)+"/"+tc.desc, func(t *testing.T) {
+				f := newFixture(t)
+				s := f.newSynk()
+				crds, list := manyCRDs(t, 1)
+				crds[0].Object["status"] = map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "NamesAccepted", "status": tc.namesAccepted},
+						map[string]interface{}{"type": "Established", "status": "False", "reason": "Installing"},
+					},
+				}
+				// The CRD is established shortly after the regular wait.
+				s.discovery = &countingDiscovery{resources: []*metav1.APIResourceList{list}, servedAfter: crdWaitRetries + 5}
+				mapper := meta.NewDefaultRESTMapper(nil)
+				mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+				s.mapper = mapper
+
+				set := &apps.ResourceSet{}
+				set.Name = "test.v1"
+				opts := newApplyOptions("test", &ApplyOptions{CRDWait: policy, CRDMaxTimeout: tc.maxTimeout})
+				_, err := s.applyAll(context.Background(), set, opts, crds...)
+				var notServed *crdNotServedError
+				if tc.wantErr && !errors.As(err, &notServed) {
+					t.Errorf("expected crdNotServedError, got %v", err)
+				} else if !tc.wantErr && err != nil {
+					t.Errorf("expected CRD to be served, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkSynk_waitForCRDs reports the discovery calls for waiting on a
+// set of CRDs that are served on the third poll.
+func BenchmarkSynk_waitForCRDs(b *testing.B) {
+	defer func(d time.Duration) { crdWaitInterval = d }(crdWaitInterval)
+	crdWaitInterval = time.Millisecond
+
+	crds, list := manyCRDs(b, 30)
+	for i := 0; i < b.N; i++ {
+		f := newFixture(&testing.T{})
+		s := f.newSynk()
+		d := &countingDiscovery{resources: []*metav1.APIResourceList{list}, servedAfter: 3}
+		s.discovery = d
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+		s.mapper = mapper
+
+		set := &apps.ResourceSet{}
+		set.Name = "test.v1"
+		if _, err := s.applyAll(context.Background(), set, newApplyOptions("test", &ApplyOptions{CRDWait: CRDWaitAll}), crds...); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(d.calls), "discovery-calls/op")
+	}
+}
+
+func TestSynk_ApplyMapsCustomResourcesOnFirstPass(t *testing.T) {
+	defer func(d time.Duration) { crdWaitInterval = d }(crdWaitInterval)
+	crdWaitInterval = time.Millisecond
+
+	for _, policy := range []CRDWaitPolicy{CRDWaitPerCRD, CRDWaitAll} {
+		t.Run(string(policy), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			s.discovery = &servingDiscovery{client: s.client}
+			// The mapper only knows the AppRollout once it was reset,
+			// like a DeferredDiscoveryRESTMapper that cached discovery
+			// before the CRD was established.
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+			s.mapper = mapper
+			s.resetMapper = func() {
+				mapper.Add(schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "AppRollout"}, meta.RESTScopeNamespace)
+			}
+
+			crd := &unstructured.Unstructured{}
+			unmarshalYAML(t, &crd.Object, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: approllouts.apps.cloudrobotics.com
+spec:
+  group: apps.cloudrobotics.com
+  names:
+    kind: AppRollout
+    plural: approllouts
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true`)
+			var failures []string
+			opts := &ApplyOptions{
+				CRDWait: policy,
+				Log: func(r *unstructured.Unstructured, _ apps.ResourceAction, status, msg string) {
+					if status == StatusFailure {
+						failures = append(failures, resourceKey(r)+": "+msg)
+					}
+				},
+			}
+			if _, err := s.Apply(ctx, "test", opts, crd, newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "foo1", "ar1")); err != nil {
+				t.Fatal(err)
+			}
+			if len(failures) > 0 {
+				t.Errorf("expected no failed attempts, got %q", failures)
+			}
+			if n := countActions(f, "create", "approllouts"); n != 1 {
+				t.Errorf("expected 1 AppRollout create, got %d", n)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneOnConflict(t *testing.T) {
+	tests := []struct {
+		desc        string
+		resolutions []ConflictResolution
+		wantAction  apps.ResourceAction
+		wantErr     bool
+		wantOwner   string
+	}{
+		{desc: "default", resolutions: nil, wantAction: apps.ResourceActionNone, wantErr: true, wantOwner: "other.v1"},
+		{desc: "fail", resolutions: []ConflictResolution{ConflictFail}, wantAction: apps.ResourceActionNone, wantErr: true, wantOwner: "other.v1"},
+		{desc: "skip", resolutions: []ConflictResolution{ConflictSkip}, wantAction: apps.ResourceActionSkip, wantOwner: "other.v1"},
+		{desc: "force", resolutions: []ConflictResolution{ConflictForce}, wantAction: apps.ResourceActionUpdate, wantOwner: "test.v1"},
+		{desc: "retry then skip", resolutions: []ConflictResolution{ConflictRetry, ConflictSkip}, wantAction: apps.ResourceActionSkip, wantOwner: "other.v1"},
+		{desc: "retry forever", resolutions: []ConflictResolution{ConflictRetry, ConflictRetry, ConflictRetry, ConflictRetry}, wantAction: apps.ResourceActionNone, wantErr: true, wantOwner: "other.v1"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			var live corev1.ConfigMap
+			unmarshalYAML(t, &live, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: foo1
+  name: cm1
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: other.v1
+    uid: other
+data:
+  foo: bar`)
+			// The owner exists, so the reference isn't dropped as dangling.
+			other := &apps.ResourceSet{}
+			other.Name = "other.v1"
+			other.UID = "other"
+			f := newFixture(t)
+			f.addObjects(&live, other)
+			s := f.newSynk()
+
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			set.UID = "deadbeef"
+			cm := newUnstructured("v1", "ConfigMap", "foo1", "cm1")
+			setOwnerRef(cm, set, true)
+
+			calls := 0
+			opts := newApplyOptions("test", nil)
+			if tc.resolutions != nil {
+				opts.OnConflict = func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error) {
+					if live.GetName() != "cm1" || err == nil {
+						t.Errorf("unexpected conflict arguments %v, %v", live, err)
+					}
+					calls++
+					return tc.resolutions[calls-1], nil
+				}
+			}
+			action, err := s.applyOne(context.Background(), cm, set, opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if action != tc.wantAction {
+				t.Errorf("expected action %q, got %q", tc.wantAction, action)
+			}
+			if calls != len(tc.resolutions) {
+				t.Errorf("expected %d OnConflict calls, got %d", len(tc.resolutions), calls)
+			}
+			got, err := s.client.Resource(gvrs["configmaps"]).Namespace("foo1").Get(context.Background(), "cm1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refs := got.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != tc.wantOwner {
+				t.Errorf("expected owner %q, got %v", tc.wantOwner, refs)
+			}
+		})
+	}
+}
+
+func TestSynk_applyAllRetriesResourceExpired(t *testing.T) {
+	// deploy is the input to applyAll(), annotatedDeploy is the expected output.
+	// TODO(rodrigoq): change verifyWriteActions() to avoid this boilerplate
+	deploy := newUnstructured("apps/v1", "Deployment", "foo1", "dp1")
+	annotatedDeploy := deploy.DeepCopy()
+	set := &apps.ResourceSet{}
+	set.Name = "test.v1"
+	set.UID = "deadbeef"
+	_true := true
+	ownerRef := metav1.OwnerReference{
+		APIVersion:         "apps.cloudrobotics.com/v1alpha1",
+		Kind:               "ResourceSet",
+		Name:               set.Name,
+		UID:                set.UID,
+		BlockOwnerDeletion: &_true,
+	}
+	annotatedDeploy.SetOwnerReferences([]metav1.OwnerReference{ownerRef})
+	setAppliedAnnotation(annotatedDeploy)
+	emptyPatch := []byte(`{}`)
+
+	tests := []struct {
+		desc    string
+		verb    string
+		objects []runtime.Object
+		actions []k8stest.Action
+	}{{
+		desc:    "create deployment returns ResourceExpired",
+		verb:    "create",
+		objects: []runtime.Object{},
+		actions: []k8stest.Action{
+			k8stest.NewCreateAction(gvrs["deployments"], "foo1", annotatedDeploy),
+			k8stest.NewCreateAction(gvrs["deployments"], "foo1", annotatedDeploy),
+		},
+	}, {
+		desc:    "patch deployment returns ResourceExpired",
+		verb:    "patch",
+		objects: []runtime.Object{annotatedDeploy},
+		actions: []k8stest.Action{
+			k8stest.NewPatchAction(gvrs["deployments"], "foo1", "dp1", types.StrategicMergePatchType, emptyPatch),
+			k8stest.NewPatchAction(gvrs["deployments"], "foo1", "dp1", types.StrategicMergePatchType, emptyPatch),
+		},
+	}, {
+		desc:    "update deployment returns ResourceExpired",
+		verb:    "update",
+		objects: []runtime.Object{deploy},
+		actions: []k8stest.Action{
+			k8stest.NewUpdateAction(gvrs["deployments"], "foo1", annotatedDeploy),
+			k8stest.NewUpdateAction(gvrs["deployments"], "foo1", annotatedDeploy),
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			f := newFixture(t)
+			f.addObjects(tc.objects...)
+			s := f.newSynk()
+			// ResourceExpired should be treated as a transient error.
+			f.fake.PrependReactor(tc.verb, "deployments", func(action k8stest.Action) (bool, runtime.Object, error) {
+				return true, nil, k8serrors.NewResourceExpired("gone")
+			})
+
+			_, err := s.applyAll(context.Background(), set, newApplyOptions("test", nil),
+				deploy.DeepCopy(),
+			)
+			if err == nil {
+				t.Error("applyAll() succeeded unexpectedly, want ResourceExpired")
+			}
+
+			// applyAll() should retry once before failing.
+			f.expectActions(tc.actions...)
+			f.verifyWriteActions()
+		})
+	}
+}
+
+func TestSynk_initializeNamespaceOverride(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	rs, resources, err := s.initialize(ctx, newApplyOptions("test", &ApplyOptions{Namespace: "ns1", NamespaceOverride: "tenant-1"}),
+		newUnstructured("v1", "Namespace", "", "tenant-1"),
+		newUnstructured("v1", "Pod", "ns2", "pod1"),
+		newUnstructured("v1", "Pod", "", "pod2"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range resources {
+		want := "tenant-1"
+		if r.GetKind() == "Namespace" {
+			want = ""
+		}
+		if r.GetNamespace() != want {
+			t.Errorf("expected namespace %q on %q but got %q", want, r.GetName(), r.GetNamespace())
+		}
+	}
+	for _, g := range rs.Spec.Resources {
+		if g.Kind != "Pod" {
+			continue
+		}
+		for _, ref := range g.Items {
+			if ref.Namespace != "tenant-1" {
+				t.Errorf("expected stored reference to %q in namespace %q but got %q", ref.Name, "tenant-1", ref.Namespace)
+			}
+		}
+	}
+}
+
+func TestSynk_initializeEnforceNamespaceOverride(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	_, resources, err := s.initialize(ctx, newApplyOptions("test", &ApplyOptions{NamespaceOverride: "tenant-1", EnforceNamespace: true}),
+		newUnstructured("v1", "Pod", "ns2", "pod1"),
+		newUnstructured("v1", "Pod", "", "pod2"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range resources {
+		if r.GetNamespace() != "tenant-1" {
+			t.Errorf("expected namespace %q on %q but got %q", "tenant-1", r.GetName(), r.GetNamespace())
+		}
+	}
+}
+
+func TestSynk_initializeSetsNamespaceLabels(t *testing.T) {
+	s := newFixture(t).newSynk()
+
+	ns1 := newUnstructured("v1", "Namespace", "", "ns1")
+	ns1.SetLabels(map[string]string{"pod-security.kubernetes.io/enforce": "privileged"})
+	ns2 := newUnstructured("v1", "Namespace", "", "ns2")
+	pod := newUnstructured("v1", "Pod", "ns1", "pod1")
+
+	_, resources, err := s.initialize(context.Background(), newApplyOptions("test", &ApplyOptions{
+		NamespaceLabels: map[string]string{
+			"pod-security.kubernetes.io/enforce": "restricted",
+			"pod-security.kubernetes.io/warn":    "restricted",
+		},
+	}), ns1, ns2, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"ns1": {
+			"pod-security.kubernetes.io/enforce": "privileged",
+			"pod-security.kubernetes.io/warn":    "restricted",
+		},
+		"ns2": {
+			"pod-security.kubernetes.io/enforce": "restricted",
+			"pod-security.kubernetes.io/warn":    "restricted",
+		},
+		"pod1": nil,
+	}
+	for _, r := range resources {
+		if got := r.GetLabels(); !reflect.DeepEqual(got, want[r.GetName()]) {
+			t.Errorf("expected labels %v on %q but got %v", want[r.GetName()], r.GetName(), got)
+		}
+	}
+}
+
+func TestSynk_skipsTestResources(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	testPod := newUnstructured("v1", "Pod", "ns", "pod2")
+	testPod.SetAnnotations(map[string]string{"helm.sh/hook": "test-success"})
+
+	_, _, err := s.initialize(context.Background(), newApplyOptions("test", nil),
+		newUnstructured("v1", "Pod", "ns", "pod1"),
+		testPod,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.client.Resource(resourceSetGVR).Get(ctx, "test.v1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want unstructured.Unstructured
+	unmarshalYAML(t, &want, `
+apiVersion: apps.cloudrobotics.com/v1alpha1
+kind: ResourceSet
 metadata:
   labels:
     name: test
@@ -520,12 +1382,297 @@ spec:
     kind: Pod
     items:
     - name: pod1
-      namespace: ns
+      namespace: ns
+status:
+  phase: Pending
+`)
+	if !reflect.DeepEqual(want.Object["spec"], got.Object["spec"]) {
+		t.Errorf("expected spec\n%v\nbut got\n%v", want.Object["spec"], got.Object["spec"])
+	}
+}
+
+func TestSynk_ApplyResumesPendingResourceSet(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	newResources := func() []*unstructured.Unstructured {
+		return []*unstructured.Unstructured{
+			newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+			newUnstructured("v1", "ConfigMap", "ns1", "cm2"),
+		}
+	}
+	// Simulate an interrupted apply that only got to apply cm1.
+	rs, _, err := s.initialize(ctx, newApplyOptions("test", nil), newResources()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Status.Applied = []apps.ResourceSetStatusGroup{{
+		Version: "v1",
+		Kind:    "ConfigMap",
+		Items:   []apps.ResourceStatus{{Namespace: "ns1", Name: "cm1", Action: apps.ResourceActionCreate, UID: "uid1"}},
+	}}
+	if err := s.updateResourceSet(ctx, rs); err != nil {
+		t.Fatal(err)
+	}
+	f.fake.ClearActions()
+
+	got, err := s.Apply(ctx, "test", nil, newResources()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "test.v1" {
+		t.Errorf("expected resumed ResourceSet %q, got %q", "test.v1", got.Name)
+	}
+	if _, err := s.client.Resource(resourceSetGVR).Get(ctx, "test.v2", metav1.GetOptions{}); err == nil {
+		t.Errorf("unexpected new ResourceSet version")
+	}
+	if n := countActions(f, "create", "configmaps"); n != 1 {
+		t.Errorf("expected 1 ConfigMap create, got %d", n)
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected cm2 to be applied: %s", err)
+	}
+	if got.Status.Phase != apps.ResourceSetPhaseSettled {
+		t.Errorf("expected phase %q, got %q", apps.ResourceSetPhaseSettled, got.Status.Phase)
+	}
+	if len(got.Status.Applied) != 1 || len(got.Status.Applied[0].Items) != 2 {
+		t.Fatalf("expected both ConfigMaps in applied status, got %v", got.Status.Applied)
+	}
+	if uid := got.Status.Applied[0].Items[0].UID; uid != "uid1" {
+		t.Errorf("expected UID of resumed resource to be kept, got %q", uid)
+	}
+}
+
+func TestSynk_ApplyAfterResumeReusingOptions(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	opts := &ApplyOptions{PatchStrategy: PatchStrategyMergeOverLive}
+
+	// Simulate an interrupted apply that only got to apply cm1.
+	rs, _, err := s.initialize(ctx, newApplyOptions("test", opts), newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Status.Applied = []apps.ResourceSetStatusGroup{{
+		Version: "v1",
+		Kind:    "ConfigMap",
+		Items:   []apps.ResourceStatus{{Namespace: "ns1", Name: "cm1", Action: apps.ResourceActionCreate}},
+	}}
+	if err := s.updateResourceSet(ctx, rs); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	} else if got.Name != "test.v1" {
+		t.Fatalf("expected resumed ResourceSet test.v1, got %s", got.Name)
+	}
+
+	// The next version must apply cm1 although the resumed one didn't.
+	cm1 := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	cm1.SetLabels(map[string]string{"foo": "bar"})
+	got, err := s.Apply(ctx, "test", opts, cm1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "test.v2" {
+		t.Errorf("expected new ResourceSet test.v2, got %s", got.Name)
+	}
+	live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := live.GetLabels()["foo"]; v != "bar" {
+		t.Errorf("expected cm1 to be applied with label foo=bar, got %v", live.GetLabels())
+	}
+}
+
+func TestSynk_ApplyResumeSkipsEstablishedCRDs(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	s.discovery = &servingDiscovery{client: s.client}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "AppRollout"}, meta.RESTScopeNamespace)
+	s.mapper = mapper
+
+	newResources := func() []*unstructured.Unstructured {
+		crd := &unstructured.Unstructured{}
+		unmarshalYAML(t, &crd.Object, `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: approllouts.apps.cloudrobotics.com
+spec:
+  group: apps.cloudrobotics.com
+  names:
+    kind: AppRollout
+    plural: approllouts
+  scope: Namespaced
+  versions:
+  - name: v1alpha1
+    served: true`)
+		return []*unstructured.Unstructured{crd, newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "foo1", "ar1")}
+	}
+	// Simulate an apply that was interrupted while waiting for the CRD.
+	rs, resources, err := s.initialize(ctx, newApplyOptions("test", nil), newResources()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.applyOne(ctx, resources[0], rs, newApplyOptions("test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	f.fake.ClearActions()
+
+	if _, err := s.Apply(ctx, "test", nil, newResources()...); err != nil {
+		t.Fatal(err)
+	}
+	for _, verb := range []string{"create", "update", "patch"} {
+		if n := countActions(f, verb, "customresourcedefinitions"); n != 0 {
+			t.Errorf("expected established CRD not to be applied again, got %d %s actions", n, verb)
+		}
+	}
+	if n := countActions(f, "create", "approllouts"); n != 1 {
+		t.Errorf("expected 1 AppRollout create, got %d", n)
+	}
+}
+
+func TestSynk_ApplySkipsSuspendedResourceSet(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	if err := s.Suspend(ctx, "test"); err == nil {
+		t.Errorf("expected error suspending missing ResourceSet, got nil")
+	}
+	if _, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Suspend(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name != "test.v1" || !rs.Spec.Suspended {
+		t.Errorf("expected suspended ResourceSet test.v1, got %q (suspended=%v)", rs.Name, rs.Spec.Suspended)
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{}); err == nil {
+		t.Errorf("unexpected apply of cm2 while suspended")
+	}
+
+	if err := s.Resume(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	rs, err = s.Apply(ctx, "test", nil, newUnstructured("v1", "ConfigMap", "ns1", "cm2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name != "test.v2" || rs.Spec.Suspended {
+		t.Errorf("expected active ResourceSet test.v2, got %q (suspended=%v)", rs.Name, rs.Spec.Suspended)
+	}
+	if _, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm2", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected cm2 to be applied after resume: %s", err)
+	}
+}
+
+func TestSynk_ApplyOne(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+
+	pod := newUnstructured("v1", "Pod", "ns1", "pod1")
+	opts := newApplyOptions("test", nil)
+	rs, resources, err := s.initialize(ctx, opts, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := s.applyAll(ctx, rs, opts, resources...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.updateResourceSetStatus(ctx, rs, results); err != nil {
+		t.Fatal(err)
+	}
+	// The apiserver ignores the status in updates of the ResourceSet, since
+	// its CRD has the status subresource.
+	tracker := s.client.(*dynamicfake.FakeDynamicClient).Tracker()
+	f.fake.PrependReactor("update", "resourcesets", func(action k8stest.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "" {
+			return false, nil, nil
+		}
+		u := action.(k8stest.UpdateAction).GetObject().(*unstructured.Unstructured)
+		old, err := tracker.Get(resourceSetGVR, u.GetNamespace(), u.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		u.Object["status"] = old.(*unstructured.Unstructured).Object["status"]
+		return false, nil, nil
+	})
+
+	// Re-apply the existing pod and add a new ConfigMap.
+	for _, r := range []*unstructured.Unstructured{
+		pod,
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+	} {
+		if _, err := s.ApplyOne(ctx, "test", r); err != nil {
+			t.Fatalf("ApplyOne(%s): %s", r.GetName(), err)
+		}
+	}
+	if _, err := s.client.Resource(resourceSetGVR).Get(ctx, "test.v2", metav1.GetOptions{}); err == nil {
+		t.Errorf("unexpected new ResourceSet version")
+	}
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != "test.v1" {
+		t.Errorf("expected owner reference to test.v1, got %v", refs)
+	}
+	got, err := s.latest(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want apps.ResourceSet
+	unmarshalYAML(t, &want, `
+spec:
+  resources:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - name: cm1
+      namespace: ns1
+  - version: v1
+    kind: Pod
+    items:
+    - name: pod1
+      namespace: ns1
 status:
-  phase: Pending
+  phase: Settled
+  applied:
+  - version: v1
+    kind: ConfigMap
+    items:
+    - name: cm1
+      namespace: ns1
+      action: Create
+  - version: v1
+    kind: Pod
+    items:
+    - name: pod1
+      namespace: ns1
+      action: Update
 `)
-	if !reflect.DeepEqual(want.Object["spec"], got.Object["spec"]) {
-		t.Errorf("expected spec\n%v\nbut got\n%v", want.Object["spec"], got.Object["spec"])
+	if !reflect.DeepEqual(got.Spec, want.Spec) {
+		t.Errorf("expected spec\n%v\nbut got\n%v", want.Spec, got.Spec)
+	}
+	if !reflect.DeepEqual(got.Status.Applied, want.Status.Applied) {
+		t.Errorf("expected applied status\n%v\nbut got\n%v", want.Status.Applied, got.Status.Applied)
+	}
+	if got.Status.Phase != want.Status.Phase {
+		t.Errorf("expected phase %q but got %q", want.Status.Phase, got.Status.Phase)
 	}
 }
 
@@ -553,6 +1700,27 @@ func TestSynk_deleteResourceSets(t *testing.T) {
 	f.verifyWriteActions()
 }
 
+func TestSynk_NextVersion(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addObjects(
+		newUnstructured("apps.cloudrobotics.com/v1alpha1", "ResourceSet", "", "test.v2"),
+		newUnstructured("apps.cloudrobotics.com/v1alpha1", "ResourceSet", "", "test.v10"),
+		newUnstructured("apps.cloudrobotics.com/v1alpha1", "ResourceSet", "", "other.v12"),
+	)
+	s := f.newSynk()
+
+	for name, want := range map[string]int32{"test": 11, "other": 13, "new": 1} {
+		got, err := s.NextVersion(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("NextVersion(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
 func TestSynk_populateNamespaces(t *testing.T) {
 	f := newFixture(t)
 	s := f.newSynk()
@@ -582,6 +1750,7 @@ spec:
 	if err := s.populateNamespaces(
 		context.Background(),
 		"ns2",
+		false,
 		[]*unstructured.Unstructured{&exampleCRD},
 		ns1, pod1, pod2, cr1,
 	); err != nil {
@@ -632,7 +1801,7 @@ func newUnstructured(apiVersion, kind, namespace, name string) *unstructured.Uns
 	return &u
 }
 
-func unmarshalYAML(t *testing.T, v interface{}, s string) {
+func unmarshalYAML(t testing.TB, v interface{}, s string) {
 	t.Helper()
 	if err := yaml.Unmarshal([]byte(strings.TrimSpace(s)), v); err != nil {
 		t.Fatal(err)
@@ -673,3 +1842,588 @@ func sprintAction(a k8stest.Action) string {
 		return fmt.Sprintf("<UNKNOWN ACTION %T>", a)
 	}
 }
+
+// ssaRecorder records the Force option of server-side apply patches, which
+// the fake client doesn't support. It stores the applied configuration with
+// managed fields for the field manager instead of merging it.
+type ssaRecorder struct {
+	dynamic.Interface
+	forced map[string]bool
+}
+
+func (c *ssaRecorder) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &ssaRecordingResource{c.Interface.Resource(gvr), c.forced}
+}
+
+type ssaRecordingResource struct {
+	dynamic.NamespaceableResourceInterface
+	forced map[string]bool
+}
+
+func (r *ssaRecordingResource) Namespace(ns string) dynamic.ResourceInterface {
+	return &ssaRecordingNamespacedResource{r.NamespaceableResourceInterface.Namespace(ns), r.forced}
+}
+
+type ssaRecordingNamespacedResource struct {
+	dynamic.ResourceInterface
+	forced map[string]bool
+}
+
+func (r *ssaRecordingNamespacedResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if pt != types.ApplyPatchType {
+		return r.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+	}
+	if opts.FieldManager != fieldManager {
+		return nil, errors.Errorf("unexpected field manager %q", opts.FieldManager)
+	}
+	r.forced[name] = opts.Force != nil && *opts.Force
+
+	var obj unstructured.Unstructured
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	obj.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:    opts.FieldManager,
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: obj.GetAPIVersion(),
+	}})
+	live, err := r.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return r.Create(ctx, &obj, metav1.CreateOptions{})
+	} else if err != nil {
+		return nil, err
+	}
+	obj.SetResourceVersion(live.GetResourceVersion())
+	return r.Update(ctx, &obj, metav1.UpdateOptions{})
+}
+
+func TestSynk_applyOneServerSideApplyForceConflicts(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "cm1"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "cm2"}},
+	)
+	s := f.newSynk()
+	forced := map[string]bool{}
+	s.client = &ssaRecorder{Interface: s.client, forced: forced}
+
+	set := &apps.ResourceSet{}
+	set.Name = "test.v1"
+	cm2 := newUnstructured("v1", "ConfigMap", "ns1", "cm2")
+	cm2.SetAnnotations(map[string]string{forceConflictsAnnotation: "true"})
+	opts := &ApplyOptions{PatchStrategy: PatchStrategyServerSideApply}
+	for _, r := range []*unstructured.Unstructured{newUnstructured("v1", "ConfigMap", "ns1", "cm1"), cm2} {
+		if action, err := s.applyOne(ctx, r, set, newApplyOptions("test", opts)); err != nil {
+			t.Fatalf("apply %s: %s", r.GetName(), err)
+		} else if action != apps.ResourceActionUpdate {
+			t.Errorf("apply %s: expected action Update, got %q", r.GetName(), action)
+		}
+	}
+	if want := map[string]bool{"cm1": false, "cm2": true}; !reflect.DeepEqual(forced, want) {
+		t.Errorf("expected forced applies %v, got %v", want, forced)
+	}
+}
+
+func TestSynk_ApplyMixedApplyMethods(t *testing.T) {
+	tests := []struct {
+		desc     string
+		strategy PatchStrategy
+		want     map[string]bool
+	}{
+		{"client-side default", PatchStrategyMergeOverLive, map[string]bool{"server": false}},
+		{"server-side default", PatchStrategyServerSideApply, map[string]bool{"server": false, "default": false}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			for _, name := range []string{"server", "client", "default"} {
+				f.addObjects(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: name}})
+			}
+			s := f.newSynk()
+			// Only server-side applies are recorded.
+			applied := map[string]bool{}
+			s.client = &ssaRecorder{Interface: s.client, forced: applied}
+
+			server := newUnstructured("v1", "ConfigMap", "ns1", "server")
+			server.SetAnnotations(map[string]string{applyMethodAnnotation: "server-side"})
+			client := newUnstructured("v1", "ConfigMap", "ns1", "client")
+			client.SetAnnotations(map[string]string{applyMethodAnnotation: "client-side"})
+			opts := &ApplyOptions{PatchStrategy: tc.strategy}
+			if _, err := s.Apply(ctx, "test", opts, server, client, newUnstructured("v1", "ConfigMap", "ns1", "default")); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(applied, tc.want) {
+				t.Errorf("expected server-side applies of %v, got %v", tc.want, applied)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneInvalidApplyMethod(t *testing.T) {
+	s := newFixture(t).newSynk()
+	r := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	r.SetAnnotations(map[string]string{applyMethodAnnotation: "sideways"})
+	if _, err := s.applyOne(context.Background(), r, nil, nil); err == nil || !strings.Contains(err.Error(), applyMethodAnnotation) {
+		t.Errorf("expected error for invalid apply method, got %v", err)
+	}
+}
+
+func TestSynk_ApplyVerifyAfterApply(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	// Simulate a mutating webhook that drops a field.
+	f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+		u := action.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured)
+		if u.GetName() == "cm2" {
+			unstructured.RemoveNestedField(u.Object, "data", "dropped")
+		}
+		return false, nil, nil
+	})
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		u := newUnstructured("v1", "ConfigMap", "ns1", name)
+		unstructured.SetNestedStringMap(u.Object, map[string]string{"kept": "a", "dropped": "b"}, "data")
+		return u
+	}
+	rs, err := s.Apply(ctx, "test", &ApplyOptions{VerifyAfterApply: true}, newConfigMap("cm1"), newConfigMap("cm2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want apps.ResourceSetStatus
+	unmarshalYAML(t, &want, `
+applied:
+- version: v1
+  kind: ConfigMap
+  items:
+  - namespace: ns1
+    name: cm1
+    action: Create
+    checksum: 7b01fbe4b1bd1bcf
+  - namespace: ns1
+    name: cm2
+    action: Create
+    checksum: 671b1cc65cad8d69
+    warnings:
+    - "verify after apply: fields differ from the applied state: data.dropped"`)
+	if !reflect.DeepEqual(rs.Status.Applied, want.Applied) {
+		t.Errorf("expected applied status\n%v\nbut got\n%v", want.Applied, rs.Status.Applied)
+	}
+}
+
+func TestSynk_applyOneNoReplaceErrors(t *testing.T) {
+	defer func(w func(context.Context, time.Duration) error) { rateLimitWait = w }(rateLimitWait)
+	rateLimitWait = func(context.Context, time.Duration) error { return nil }
+
+	gr := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	immutable := errors.New("spec.selector: field is immutable")
+	tests := []struct {
+		desc        string
+		err         error
+		classes     []func(error) bool
+		wantReplace bool
+		// wantRetried is set for errors that are retried without replacing,
+		// so that the update succeeds.
+		wantRetried bool
+	}{
+		{"invalid", k8serrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "dp1", nil), nil, true, false},
+		{"generic immutable", immutable, nil, true, false},
+		{"forbidden", k8serrors.NewForbidden(gr, "dp1", immutable), nil, false, false},
+		{"unauthorized", k8serrors.NewUnauthorized(immutable.Error()), nil, false, false},
+		{"timeout", k8serrors.NewTimeoutError(immutable.Error(), 1), nil, false, false},
+		{"server timeout", k8serrors.NewServerTimeout(gr, immutable.Error(), 1), nil, false, false},
+		{"too many requests", k8serrors.NewTooManyRequests(immutable.Error(), 1), nil, false, true},
+		{"service unavailable", k8serrors.NewServiceUnavailable(immutable.Error()), nil, false, false},
+		{"forbidden with disabled list", k8serrors.NewForbidden(gr, "dp1", immutable), []func(error) bool{}, true, false},
+		{"custom", immutable, []func(error) bool{func(error) bool { return true }}, false, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			live := newUnstructured("apps/v1", "Deployment", "foo1", "dp1")
+			f := newFixture(t)
+			f.addObjects(live)
+			s := f.newSynk()
+			failed := false
+			f.fake.PrependReactor("update", "deployments", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if failed {
+					return false, nil, nil
+				}
+				failed = true
+				return true, nil, tc.err
+			})
+
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			set.UID = "deadbeef"
+			dp := newUnstructured("apps/v1", "Deployment", "foo1", "dp1")
+			setOwnerRef(dp, set, true)
+			opts := newApplyOptions("test", &ApplyOptions{
+				NoReplaceErrors: tc.classes,
+				OnConflict: func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error) {
+					return ConflictForce, nil
+				},
+			})
+			action, err := s.applyOne(context.Background(), dp, set, opts)
+			deleted := false
+			for _, a := range f.fake.Actions() {
+				if a.GetVerb() == "delete" {
+					deleted = true
+				}
+			}
+			if deleted != tc.wantReplace {
+				t.Errorf("expected replace %v, got action %q, error %v", tc.wantReplace, action, err)
+			}
+			if tc.wantRetried && (err != nil || action != apps.ResourceActionUpdate) {
+				t.Errorf("expected retried update, got action %q, error %v", action, err)
+			}
+			if !tc.wantReplace && !tc.wantRetried && (err == nil || action != apps.ResourceActionUpdate) {
+				t.Errorf("expected failed update, got action %q, error %v", action, err)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneCreateStrategy(t *testing.T) {
+	tests := []struct {
+		strategy   CreateStrategy
+		exists     bool
+		wantAction apps.ResourceAction
+		wantErr    bool
+		wantData   string
+	}{
+		{"", false, apps.ResourceActionCreate, false, "new"},
+		{"", true, apps.ResourceActionUpdate, false, "new"},
+		{CreateStrategyCreateOrUpdate, true, apps.ResourceActionUpdate, false, "new"},
+		{CreateStrategyCreateOnly, false, apps.ResourceActionCreate, false, "new"},
+		{CreateStrategyCreateOnly, true, apps.ResourceActionNone, false, "old"},
+		{CreateStrategyUpdateOnly, false, apps.ResourceActionNone, true, ""},
+		{CreateStrategyUpdateOnly, true, apps.ResourceActionUpdate, false, "new"},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s/exists=%v", tc.strategy, tc.exists), func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			if tc.exists {
+				f.addObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "cm1"},
+					Data:       map[string]string{"key": "old"},
+				})
+			}
+			s := f.newSynk()
+			cm := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+			unstructured.SetNestedStringMap(cm.Object, map[string]string{"key": "new"}, "data")
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			opts := &ApplyOptions{CreateStrategy: tc.strategy, PatchStrategy: PatchStrategyMergeOverLive}
+
+			action, err := s.applyOne(ctx, cm, set, newApplyOptions("test", opts))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("applyOne() error = %v, want error: %v", err, tc.wantErr)
+			}
+			if action != tc.wantAction {
+				t.Errorf("expected action %q, got %q", tc.wantAction, action)
+			}
+			live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+			if tc.wantData == "" {
+				if !k8serrors.IsNotFound(err) {
+					t.Errorf("expected ConfigMap not to exist, got %v", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, _ := unstructured.NestedString(live.Object, "data", "key"); got != tc.wantData {
+				t.Errorf("expected data %q, got %q", tc.wantData, got)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneScopeOverrides(t *testing.T) {
+	rolloutGK := schema.GroupKind{Group: "apps.cloudrobotics.com", Kind: "AppRollout"}
+	tests := []struct {
+		desc      string
+		overrides map[schema.GroupKind]meta.RESTScopeName
+		wantErr   bool
+	}{
+		{"mapper scope", nil, true},
+		{"override", map[schema.GroupKind]meta.RESTScopeName{rolloutGK: meta.RESTScopeNameNamespace}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			// Discovery misreports the namespaced AppRollout as cluster-scoped.
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(rolloutGK.WithVersion("v1alpha1"), meta.RESTScopeRoot)
+			s.mapper = mapper
+			f.fake.PrependReactor("create", "approllouts", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if action.GetNamespace() == "" {
+					return true, nil, k8serrors.NewNotFound(schema.GroupResource{Group: rolloutGK.Group, Resource: "approllouts"}, "")
+				}
+				return false, nil, nil
+			})
+			ar := newUnstructured("apps.cloudrobotics.com/v1alpha1", "AppRollout", "ns1", "ar1")
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			// The apiserver responds to the wrong path as if the type wasn't served.
+			opts := &ApplyOptions{ScopeOverrides: tc.overrides, NotServedRetries: -1}
+
+			_, err := s.applyOne(ctx, ar, set, newApplyOptions("test", opts))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("applyOne() error = %v, want error: %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			gvr := schema.GroupVersionResource{Group: rolloutGK.Group, Version: "v1alpha1", Resource: "approllouts"}
+			if _, err := s.client.Resource(gvr).Namespace("ns1").Get(ctx, "ar1", metav1.GetOptions{}); err != nil {
+				t.Errorf("expected AppRollout in namespace ns1: %v", err)
+			}
+			// PlanApply finds the AppRollout in its namespace as well.
+			plan, err := s.PlanApply(ctx, "test", opts, ar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := plan.Changes[0]; c.Err != nil || c.Ownership == OwnershipNew {
+				t.Errorf("expected PlanApply to find the AppRollout, got ownership %q, error %v", c.Ownership, c.Err)
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyRejectsInvalidScopeOverride(t *testing.T) {
+	s := newFixture(t).newSynk()
+	opts := &ApplyOptions{ScopeOverrides: map[schema.GroupKind]meta.RESTScopeName{{Kind: "ConfigMap"}: "cluster"}}
+	_, err := s.Apply(context.Background(), "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+	if err == nil || !strings.Contains(err.Error(), "invalid scope override") {
+		t.Errorf("expected invalid scope override error, got %v", err)
+	}
+}
+
+func TestSynk_ApplyOnLiveObject(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.addObjects(newUnstructured("apps/v1", "Deployment", "ns1", "dp1"))
+	s := f.newSynk()
+	f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+		obj := action.(k8stest.CreateAction).GetObject().(*unstructured.Unstructured).DeepCopy()
+		obj.SetUID("uid1")
+		return true, obj, nil
+	})
+	f.fake.PrependReactor("update", "deployments", func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("spec.selector: field is immutable")
+	})
+	cm := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	dp := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	live := map[string]*unstructured.Unstructured{}
+	opts := &ApplyOptions{
+		PatchStrategy: PatchStrategyMergeOverLive,
+		OnLiveObject: func(key string, obj *unstructured.Unstructured) {
+			live[key] = obj
+		},
+	}
+
+	rs, err := s.Apply(ctx, "test", opts, cm, dp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rs.Status.Applied[1].Items[0].Action; got != apps.ResourceActionReplace {
+		t.Errorf("expected Deployment to be replaced, got %q", got)
+	}
+	if len(live) != 2 {
+		t.Fatalf("expected 2 live objects, got %v", live)
+	}
+	if got := live[ResourceKey(cm)]; got == nil || got.GetUID() != "uid1" {
+		t.Errorf("expected created ConfigMap with UID, got %v", got)
+	}
+	if got := live[ResourceKey(dp)]; got == nil || len(got.GetOwnerReferences()) != 1 {
+		t.Errorf("expected replaced Deployment with owner reference, got %v", got)
+	}
+}
+
+func TestSynk_ApplyConcurrency(t *testing.T) {
+	ctx := context.Background()
+	s := newFixture(t).newSynk()
+
+	resources := []*unstructured.Unstructured{newUnstructured("v1", "Namespace", "", "ns1")}
+	for i := 0; i < 20; i++ {
+		resources = append(resources,
+			newUnstructured("v1", "ConfigMap", "ns1", fmt.Sprintf("cm%02d", i)),
+			newUnstructured("v1", "Secret", "ns1", fmt.Sprintf("secret%02d", i)),
+		)
+	}
+	opts := &ApplyOptions{Concurrency: 4, PrefetchLive: true}
+	rs, err := s.Apply(ctx, "test", opts, resources...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Status.Failed) != 0 {
+		t.Errorf("expected no failures, got %v", rs.Status.Failed)
+	}
+	applied := 0
+	for _, g := range rs.Status.Applied {
+		for _, item := range g.Items {
+			if item.Action != apps.ResourceActionCreate {
+				t.Errorf("expected %s %s to be created, got %q", g.Kind, item.Name, item.Action)
+			}
+			applied++
+		}
+	}
+	if applied != len(resources) {
+		t.Errorf("expected %d applied resources, got %d", len(resources), applied)
+	}
+}
+
+// BenchmarkSynk_ApplyLargeSet reports the requests per apply of a large set.
+// The fake client serializes requests, so the time per apply doesn't reflect
+// the benefit of concurrency against a real apiserver.
+func BenchmarkSynk_ApplyLargeSet(b *testing.B) {
+	const n = 1000
+	benchmarks := []struct {
+		desc        string
+		prefetch    bool
+		concurrency int
+	}{
+		{"sequential", false, 0},
+		{"prefetch", true, 0},
+		{"prefetch-concurrent", true, 16},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.desc, func(b *testing.B) {
+			ctx := context.Background()
+			f := newFixture(&testing.T{})
+			s := f.newSynk()
+			resources := make([]*unstructured.Unstructured, n)
+			for i := range resources {
+				resources[i] = newUnstructured("v1", "ConfigMap", "ns1", fmt.Sprintf("cm%04d", i))
+			}
+			// Create the resources so that the benchmark measures updates.
+			if _, err := s.Apply(ctx, "test", nil, resources...); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f.fake.ClearActions()
+				opts := &ApplyOptions{
+					PrefetchLive:  bm.prefetch,
+					Concurrency:   bm.concurrency,
+					PatchStrategy: PatchStrategyMergeOverLive,
+				}
+				if _, err := s.Apply(ctx, "test", opts, resources...); err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(float64(len(f.fake.Actions())), "requests/op")
+			}
+		})
+	}
+}
+
+func TestSynk_ApplyServerSideApplySetsOwnerReference(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	s := f.newSynk()
+	s.client = &ssaRecorder{Interface: s.client, forced: map[string]bool{}}
+
+	opts := &ApplyOptions{PatchStrategy: PatchStrategyServerSideApply}
+	for _, want := range []apps.ResourceAction{apps.ResourceActionCreate, apps.ResourceActionUpdate} {
+		rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rs.Status.Applied[0].Items[0].Action; got != want {
+			t.Errorf("expected action %q, got %q", want, got)
+		}
+	}
+	// Owner reference and fields must be applied in a single patch. The
+	// updates are made by the ssaRecorder, which stores the patches.
+	if n := countActions(f, "patch", "configmaps"); n != 0 {
+		t.Errorf("expected no other patches, got %d", n)
+	}
+	if n := countActions(f, "create", "configmaps") + countActions(f, "update", "configmaps"); n != 2 {
+		t.Errorf("expected 2 server-side applies, got %d writes", n)
+	}
+
+	cm, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := cm.GetOwnerReferences(); len(refs) != 1 || refs[0].Kind != "ResourceSet" || refs[0].Name != "test.v2" {
+		t.Errorf("expected owner reference to test.v2, got %v", refs)
+	}
+	if mf := cm.GetManagedFields(); len(mf) != 1 || mf[0].Manager != fieldManager || mf[0].Operation != metav1.ManagedFieldsOperationApply {
+		t.Errorf("expected fields to be managed by %q, got %v", fieldManager, mf)
+	}
+}
+
+// recreatingResource simulates a controller that recreates an object right
+// after it was deleted, or a deletion that is blocked by a finalizer.
+type recreatingResource struct {
+	dynamic.ResourceInterface
+	terminating bool
+}
+
+func (r *recreatingResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	live, err := r.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if r.terminating {
+		now := metav1.Now()
+		live.SetDeletionTimestamp(&now)
+		_, err := r.Update(ctx, live, metav1.UpdateOptions{})
+		return err
+	}
+	if err := r.ResourceInterface.Delete(ctx, name, opts, subresources...); err != nil {
+		return err
+	}
+	recreated := newUnstructured("v1", "ConfigMap", live.GetNamespace(), name)
+	recreated.SetLabels(map[string]string{"recreated-by": "controller"})
+	_, err = r.Create(ctx, recreated, metav1.CreateOptions{})
+	return err
+}
+
+func TestReplace_concurrentRecreation(t *testing.T) {
+	tests := []struct {
+		desc          string
+		terminating   bool
+		wantTransient bool
+	}{
+		{"recreated by controller", false, false},
+		{"deletion pending", true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			f.addObjects(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "cm1", ResourceVersion: "1"},
+				Data:       map[string]string{"key": "old"},
+			})
+			s := f.newSynk()
+			client := &recreatingResource{
+				ResourceInterface: s.client.Resource(gvrs["configmaps"]).Namespace("ns1"),
+				terminating:       tc.terminating,
+			}
+			desired := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+			desired.SetResourceVersion("1")
+			unstructured.SetNestedStringMap(desired.Object, map[string]string{"key": "new"}, "data")
+
+			res, err := replace(ctx, client, desired)
+			if tc.wantTransient {
+				if !IsTransientErr(err) {
+					t.Fatalf("expected transient error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, _ := unstructured.NestedString(res.Object, "data", "key"); got != "new" {
+				t.Errorf("expected recreated object to be updated to the desired state, got data %q", got)
+			}
+		})
+	}
+}
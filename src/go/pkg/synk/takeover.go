@@ -0,0 +1,105 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxTakeoverFields bounds the number of fields listed in takeover warnings.
+const maxTakeoverFields = 5
+
+// checkTakeover warns if applying desired changes more than
+// TakeoverWarningThreshold fields of the live object that are managed by
+// other field managers. If BlockTakeover is set, it returns an error instead.
+func checkTakeover(desired, live *unstructured.Unstructured, opts *applyOptions) error {
+	if strategy, _ := opts.patchStrategy(desired); opts.TakeoverWarningThreshold <= 0 || strategy == PatchStrategyServerSideApply {
+		return nil
+	}
+	fields, managers := takeoverFields(live, desired, opts)
+	if len(fields) <= opts.TakeoverWarningThreshold {
+		return nil
+	}
+	listed := fields
+	if len(listed) > maxTakeoverFields {
+		listed = append(listed[:maxTakeoverFields:maxTakeoverFields], "...")
+	}
+	msg := errors.Errorf("taking over %d fields managed by %s: %s",
+		len(fields), strings.Join(managers, ", "), strings.Join(listed, ", "))
+	if opts.BlockTakeover {
+		return errors.Wrap(msg, "field takeover")
+	}
+	opts.warnf(desired, "%s", msg)
+	return nil
+}
+
+// takeoverFields returns the fields that applying desired would change and
+// that are managed by field managers other than Synk, and those managers.
+func takeoverFields(live, desired *unstructured.Unstructured, opts *applyOptions) (fields, managers []string) {
+	owners := map[string][]string{}
+	for _, mf := range live.GetManagedFields() {
+		if mf.Manager == fieldManager || mf.Subresource != "" || mf.FieldsV1 == nil {
+			continue
+		}
+		var set map[string]interface{}
+		if err := json.Unmarshal(mf.FieldsV1.Raw, &set); err != nil {
+			continue
+		}
+		for _, p := range managedPaths(set, "") {
+			owners[p] = append(owners[p], mf.Manager)
+		}
+	}
+	seen := map[string]bool{}
+	for _, f := range opts.changedFields(live, desired) {
+		ms, ok := owners[f]
+		if !ok {
+			continue
+		}
+		fields = append(fields, f)
+		for _, m := range ms {
+			if !seen[m] {
+				seen[m] = true
+				managers = append(managers, m)
+			}
+		}
+	}
+	sort.Strings(managers)
+	return fields, managers
+}
+
+// managedPaths returns the paths of the fields in a FieldsV1 set in the
+// format of changedFields. Like there, list items aren't descended into.
+func managedPaths(set map[string]interface{}, prefix string) []string {
+	var paths []string
+	for k, v := range set {
+		if !strings.HasPrefix(k, "f:") {
+			continue
+		}
+		p := strings.TrimPrefix(k, "f:")
+		if prefix != "" {
+			p = prefix + "." + p
+		}
+		paths = append(paths, p)
+		if sub, ok := v.(map[string]interface{}); ok {
+			paths = append(paths, managedPaths(sub, p)...)
+		}
+	}
+	return paths
+}
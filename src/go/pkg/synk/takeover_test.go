@@ -0,0 +1,133 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newManagedConfigMap(t *testing.T) *corev1.ConfigMap {
+	var cm corev1.ConfigMap
+	unmarshalYAML(t, &cm, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: ns1
+  managedFields:
+  - manager: kubectl-edit
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:data:
+        f:a: {}
+        f:b: {}
+  - manager: synk
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:data:
+        f:c: {}
+data:
+  a: "1"
+  b: "2"
+  c: "3"
+`)
+	return &cm
+}
+
+func TestTakeoverFields(t *testing.T) {
+	u := toUnstructured(t, newManagedConfigMap(t))
+	desired := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	desired.Object["data"] = map[string]interface{}{"a": "1", "b": "x", "c": "x", "d": "x"}
+
+	fields, managers := takeoverFields(u, desired, newApplyOptions("test", nil))
+	if want := []string{"data.b"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected fields %v, got %v", want, fields)
+	}
+	if want := []string{"kubectl-edit"}; !reflect.DeepEqual(managers, want) {
+		t.Errorf("expected managers %v, got %v", want, managers)
+	}
+}
+
+func TestSynk_applyOneTakeoverThreshold(t *testing.T) {
+	tests := []struct {
+		desc         string
+		threshold    int
+		block        bool
+		onConflict   func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error)
+		wantErr      bool
+		wantWarnings int
+		wantData     string
+	}{
+		{desc: "disabled", wantData: "x"},
+		{desc: "below threshold", threshold: 2, wantData: "x"},
+		{desc: "warn", threshold: 1, wantWarnings: 1, wantData: "x"},
+		{desc: "block", threshold: 1, block: true, wantErr: true, wantData: "1"},
+		{
+			desc:      "block forced by OnConflict",
+			threshold: 1,
+			block:     true,
+			onConflict: func(desired, live *unstructured.Unstructured, err error) (ConflictResolution, error) {
+				return ConflictForce, nil
+			},
+			wantData: "x",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			f.addObjects(newManagedConfigMap(t))
+			s := f.newSynk()
+
+			desired := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+			desired.Object["data"] = map[string]interface{}{"a": "x", "b": "x", "c": "3"}
+			opts := newApplyOptions("test", &ApplyOptions{
+				PatchStrategy:            PatchStrategyMergeOverLive,
+				TakeoverWarningThreshold: tc.threshold,
+				BlockTakeover:            tc.block,
+				OnConflict:               tc.onConflict,
+			})
+			set := &apps.ResourceSet{}
+			set.Name = "test.v1"
+			_, err := s.applyOne(ctx, desired, set, opts)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "taking over 2 fields managed by kubectl-edit") {
+				t.Errorf("unexpected error %q", err)
+			}
+			if got := opts.takeWarnings(desired); len(got) != tc.wantWarnings {
+				t.Errorf("expected %d warnings, got %q", tc.wantWarnings, got)
+			}
+			live, err := s.client.Resource(gvrs["configmaps"]).Namespace("ns1").Get(ctx, "cm1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, _ := unstructured.NestedString(live.Object, "data", "a"); got != tc.wantData {
+				t.Errorf("expected data.a %q, got %q", tc.wantData, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// unauthorizedRetryDelay gives the client time to refresh its credentials
+// with ApplyOptions.RetryUnauthorized, eg by running an exec plugin.
+const unauthorizedRetryDelay = 2 * time.Second
+
+// UnauthorizedError is returned if the apiserver rejected the credentials of
+// the client with 401 Unauthorized. Short-lived credentials, eg from exec or
+// OIDC plugins, may have expired during the apply.
+type UnauthorizedError struct {
+	Err error
+}
+
+func (e *UnauthorizedError) Error() string {
+	return fmt.Sprintf("unauthorized, the client credentials may have expired: %s", e.Err)
+}
+
+func (e *UnauthorizedError) Unwrap() error {
+	return e.Err
+}
+
+// isUnauthorized returns true for 401 Unauthorized responses and
+// UnauthorizedErrors.
+func isUnauthorized(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ue *UnauthorizedError
+	return errors.As(err, &ue) || k8serrors.IsUnauthorized(errors.Cause(err))
+}
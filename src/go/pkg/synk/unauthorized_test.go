@@ -0,0 +1,124 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stest "k8s.io/client-go/testing"
+)
+
+func TestSynk_ApplyUnauthorized(t *testing.T) {
+	defer func(w func(context.Context, time.Duration) error) { rateLimitWait = w }(rateLimitWait)
+
+	tests := []struct {
+		desc  string
+		retry bool
+		// rejections is the number of requests rejected before the
+		// client's credentials are refreshed.
+		rejections int
+		wantErr    bool
+	}{
+		{"fails without retry", false, 100, true},
+		{"succeeds after retry", true, 1, false},
+		{"fails after retry", true, 100, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			var waits []time.Duration
+			rateLimitWait = func(_ context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+			ctx := context.Background()
+			f := newFixture(t)
+			s := f.newSynk()
+			// The token expired before the first request.
+			rejected := 0
+			f.fake.PrependReactor("create", "configmaps", func(action k8stest.Action) (bool, runtime.Object, error) {
+				if rejected == tc.rejections {
+					return false, nil, nil
+				}
+				rejected++
+				return true, nil, k8serrors.NewUnauthorized("token expired")
+			})
+
+			opts := &ApplyOptions{RetryUnauthorized: tc.retry}
+			rs, err := s.Apply(ctx, "test", opts, newUnstructured("v1", "ConfigMap", "ns1", "cm1"))
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := rs.Status.Applied[0].Items[0].Action; got != apps.ResourceActionCreate {
+					t.Errorf("expected action Create, got %q", got)
+				}
+				if len(waits) != 1 || waits[0] != unauthorizedRetryDelay {
+					t.Errorf("expected one wait of %s, got %v", unauthorizedRetryDelay, waits)
+				}
+				return
+			}
+			var ue *UnauthorizedError
+			if !errors.As(err, &ue) {
+				t.Fatalf("expected UnauthorizedError, got %v", err)
+			}
+			if IsTransientErr(err) {
+				t.Errorf("expected unauthorized error not to be transient, got %v", err)
+			}
+			if !tc.retry && len(waits) != 0 {
+				t.Errorf("expected no retry, got waits %v", waits)
+			}
+			if failed := rs.Status.Failed[0].Items[0].Error; !strings.Contains(failed, "credentials may have expired") {
+				t.Errorf("expected the resource's error to mention expired credentials, got %q", failed)
+			}
+		})
+	}
+}
+
+func TestSynk_applyOneUnauthorizedDoesNotReplace(t *testing.T) {
+	defer func(w func(context.Context, time.Duration) error) { rateLimitWait = w }(rateLimitWait)
+	rateLimitWait = func(context.Context, time.Duration) error { return nil }
+
+	ctx := context.Background()
+	f := newFixture(t)
+	deploy := newUnstructured("apps/v1", "Deployment", "ns1", "dp1")
+	f.addObjects(deploy.DeepCopy())
+	s := f.newSynk()
+	// Some apiservers describe the rejected request, which must not be taken
+	// for an immutable field.
+	f.fake.PrependReactor("patch", "deployments", func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewUnauthorized("field is immutable")
+	})
+	f.fake.PrependReactor("update", "deployments", func(action k8stest.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewUnauthorized("field is immutable")
+	})
+
+	set := &apps.ResourceSet{}
+	set.Name = "test.v1"
+	// An empty list of NoReplaceErrors doesn't allow replacing either.
+	opts := &ApplyOptions{NoReplaceErrors: []func(error) bool{}, RetryUnauthorized: true}
+	if _, err := s.applyOne(ctx, deploy, set, newApplyOptions("test", opts)); !isUnauthorized(err) {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+	if n := countActions(f, "delete", "deployments"); n != 0 {
+		t.Errorf("expected no replacement, got %d deletes", n)
+	}
+}
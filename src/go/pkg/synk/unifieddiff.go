@@ -0,0 +1,265 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each change.
+	diffContext = 3
+	// redactedValue replaces the values of Secrets in diffs.
+	redactedValue = "<redacted>"
+)
+
+// UnifiedDiff renders the created, updated and pruned resources of the plan
+// as unified diffs in the format of git, one file per resource, eg to post
+// the plan as a comment on a pull request. Resources are ordered like
+// Changes. Updates and replacements only show the fields that are part of
+// the manifest, since the others are left to the apiserver. The values of Secrets are replaced
+// by "<redacted>", so changes to them only show up as added or removed keys.
+func (p *Plan) UnifiedDiff() string {
+	var b strings.Builder
+	for i := range p.Changes {
+		c := &p.Changes[i]
+		var from, to *unstructured.Unstructured
+		switch c.Action {
+		case apps.ResourceActionCreate:
+			to = diffObject(c.desired)
+		case apps.ResourceActionUpdate, apps.ResourceActionReplace:
+			from, to = diffObject(projectFields(c.live, c.desired)), diffObject(c.desired)
+		case apps.ResourceActionDelete:
+			from = diffObject(c.live)
+		default:
+			continue
+		}
+		writeFileDiff(&b, diffPath(c), yamlLines(from), yamlLines(to), from == nil, to == nil)
+	}
+	return b.String()
+}
+
+// diffPath returns the path of the resource in a diff, eg
+// "apps/v1/Deployment/default/app.yaml".
+func diffPath(c *PlannedChange) string {
+	name := c.Name
+	if name == "" && c.desired != nil {
+		name = c.desired.GetGenerateName()
+	}
+	return path.Join(c.Group, c.Version, c.Kind, c.Namespace, name+".yaml")
+}
+
+// diffObject returns a copy of the resource without the fields that Synk
+// manages or ignores and with redacted Secret values.
+func diffObject(r *unstructured.Unstructured) *unstructured.Unstructured {
+	if r == nil {
+		return nil
+	}
+	u := r.DeepCopy()
+	// The sanitizers only fail on malformed objects, which are then shown
+	// as they are.
+	_ = sanitize([]*unstructured.Unstructured{u}, exportSanitizers)
+	if u.GroupVersionKind().Group == "" && u.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			values, ok := u.Object[field].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for k := range values {
+				values[k] = redactedValue
+			}
+		}
+	}
+	return u
+}
+
+// projectFields returns a copy of live with only the fields that are set in
+// desired. Lists are kept as a whole, like changedFields compares them.
+func projectFields(live, desired *unstructured.Unstructured) *unstructured.Unstructured {
+	if live == nil || desired == nil {
+		return live
+	}
+	var project func(l, d map[string]interface{}) map[string]interface{}
+	project = func(l, d map[string]interface{}) map[string]interface{} {
+		res := map[string]interface{}{}
+		for k, dv := range d {
+			lv, ok := l[k]
+			if !ok {
+				continue
+			}
+			lm, lok := lv.(map[string]interface{})
+			dm, dok := dv.(map[string]interface{})
+			if lok && dok {
+				res[k] = project(lm, dm)
+			} else {
+				res[k] = lv
+			}
+		}
+		return res
+	}
+	return &unstructured.Unstructured{Object: project(live.Object, desired.Object)}
+}
+
+// yamlLines returns the lines of the resource as YAML, which has sorted keys.
+func yamlLines(r *unstructured.Unstructured) []string {
+	if r == nil {
+		return nil
+	}
+	data, err := yaml.Marshal(r.Object)
+	if err != nil {
+		return []string{fmt.Sprintf("# failed to encode: %s", err)}
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// writeFileDiff writes the git diff header and the hunks for a single file.
+func writeFileDiff(b *strings.Builder, name string, a, z []string, created, deleted bool) {
+	fmt.Fprintf(b, "diff --git a/%s b/%s\n", name, name)
+	switch {
+	case created:
+		fmt.Fprintf(b, "new file mode 100644\n--- /dev/null\n+++ b/%s\n", name)
+	case deleted:
+		fmt.Fprintf(b, "deleted file mode 100644\n--- a/%s\n+++ /dev/null\n", name)
+	default:
+		fmt.Fprintf(b, "--- a/%s\n+++ b/%s\n", name, name)
+	}
+	b.WriteString(unifiedHunks(a, z, diffContext))
+}
+
+// diffOp is a line of an edit script: ' ' for unchanged lines, '-' for lines
+// only in the old and '+' for lines only in the new version.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// lineDiff returns a minimal edit script from a to z, based on their longest
+// common subsequence.
+func lineDiff(a, z []string) []diffOp {
+	// Common prefixes and suffixes are frequent and keep the table small.
+	pre := 0
+	for pre < len(a) && pre < len(z) && a[pre] == z[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(z)-pre && a[len(a)-1-suf] == z[len(z)-1-suf] {
+		suf++
+	}
+	ma, mz := a[pre:len(a)-suf], z[pre:len(z)-suf]
+	// lcs[i][j] is the length of the common subsequence of ma[i:] and mz[j:].
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mz)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mz) - 1; j >= 0; j-- {
+			if ma[i] == mz[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := make([]diffOp, 0, len(a)+len(z))
+	for _, l := range a[:pre] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mz) {
+		switch {
+		case i < len(ma) && j < len(mz) && ma[i] == mz[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case j == len(mz) || i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mz[j]})
+			j++
+		}
+	}
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// unifiedHunks returns the hunks of the unified diff from a to z with n lines
+// of context. It's empty if they are equal.
+func unifiedHunks(a, z []string, n int) string {
+	ops := lineDiff(a, z)
+	// Line numbers in a and z before each op.
+	ai, zi := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for k, op := range ops {
+		ai[k+1], zi[k+1] = ai[k], zi[k]
+		if op.kind != '+' {
+			ai[k+1]++
+		}
+		if op.kind != '-' {
+			zi[k+1]++
+		}
+	}
+	var b strings.Builder
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// Extend the hunk while the next change is within its context.
+		start, end := max(k-n, 0), k
+		for end < len(ops) {
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*n {
+				break
+			}
+			end = next + 1
+		}
+		end = min(end+n, len(ops))
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(ai[start], ai[end]-ai[start]), hunkRange(zi[start], zi[end]-zi[start]))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+		}
+		k = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the range of a hunk that starts after the given number
+// of lines, like diff -u.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
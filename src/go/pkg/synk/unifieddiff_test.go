@@ -0,0 +1,162 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestUnifiedHunks(t *testing.T) {
+	lines := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.SplitAfter(strings.ReplaceAll(s, " ", "\n")+"\n", "\n")[:strings.Count(s, " ")+1]
+	}
+	tests := []struct {
+		desc string
+		a, z string
+		want string
+	}{
+		{"equal", "a b c", "a b c", ""},
+		{"created", "", "a b", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"deleted", "a", "", "@@ -1 +0,0 @@\n-a\n"},
+		{"changed line", "1 2 3 4 5 6 7 8 9", "1 2 3 4 x 6 7 8 9",
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n"},
+		{"merged hunks", "1 2 3 4 5 6 7 8", "x 2 3 4 5 6 7 y",
+			"@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n"},
+		{"separate hunks", "1 2 3 4 5 6 7 8 9 10", "x 2 3 4 5 6 7 8 9 y",
+			"@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n"},
+		{"inserted", "a c", "a b c", "@@ -1,2 +1,3 @@\n a\n+b\n c\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := unifiedHunks(lines(tc.a), lines(tc.z), 3); got != tc.want {
+				t.Errorf("expected\n%s\nbut got\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSynk_PlanUnifiedDiff(t *testing.T) {
+	var secret, removed corev1.Secret
+	unmarshalYAML(t, &secret, `
+apiVersion: v1
+kind: Secret
+metadata:
+  namespace: ns1
+  name: creds
+  resourceVersion: "3"
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: test.v1
+    uid: test
+type: Opaque
+data:
+  password: b2xk`)
+	unmarshalYAML(t, &removed, `
+apiVersion: v1
+kind: Secret
+metadata:
+  namespace: ns1
+  name: removed
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: ResourceSet
+    name: test.v1
+    uid: test
+data:
+  token: c2VjcmV0`)
+	var prev apps.ResourceSet
+	unmarshalYAML(t, &prev, `
+apiVersion: apps.cloudrobotics.com/v1alpha1
+kind: ResourceSet
+metadata:
+  name: test.v1
+spec:
+  resources:
+  - version: v1
+    kind: Secret
+    items:
+    - namespace: ns1
+      name: creds
+    - namespace: ns1
+      name: removed`)
+	f := newFixture(t)
+	f.addObjects(&secret, &removed, &prev)
+	s := f.newSynk()
+
+	desired := newUnstructured("v1", "Secret", "ns1", "creds")
+	unstructured.SetNestedField(desired.Object, "Opaque", "type")
+	unstructured.SetNestedStringMap(desired.Object, map[string]string{"password": "bmV3", "user": "YWRtaW4="}, "data")
+	cm := newUnstructured("v1", "ConfigMap", "ns1", "cm1")
+	unstructured.SetNestedStringMap(cm.Object, map[string]string{"foo": "bar"}, "data")
+	plan, err := s.PlanApply(context.Background(), "test", nil, desired, cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `diff --git a/v1/Secret/ns1/creds.yaml b/v1/Secret/ns1/creds.yaml
+--- a/v1/Secret/ns1/creds.yaml
++++ b/v1/Secret/ns1/creds.yaml
+@@ -1,6 +1,7 @@
+ apiVersion: v1
+ data:
+   password: <redacted>
++  user: <redacted>
+ kind: Secret
+ metadata:
+   name: creds
+diff --git a/v1/ConfigMap/ns1/cm1.yaml b/v1/ConfigMap/ns1/cm1.yaml
+new file mode 100644
+--- /dev/null
++++ b/v1/ConfigMap/ns1/cm1.yaml
+@@ -0,0 +1,7 @@
++apiVersion: v1
++data:
++  foo: bar
++kind: ConfigMap
++metadata:
++  name: cm1
++  namespace: ns1
+diff --git a/v1/Secret/ns1/removed.yaml b/v1/Secret/ns1/removed.yaml
+deleted file mode 100644
+--- a/v1/Secret/ns1/removed.yaml
++++ /dev/null
+@@ -1,7 +0,0 @@
+-apiVersion: v1
+-data:
+-  token: <redacted>
+-kind: Secret
+-metadata:
+-  name: removed
+-  namespace: ns1
+`
+	got := plan.UnifiedDiff()
+	if got != want {
+		t.Errorf("expected diff\n%s\nbut got\n%s", want, got)
+	}
+	for _, leaked := range []string{"b2xk", "bmV3", "YWRtaW4=", "c2VjcmV0"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("diff contains Secret value %q", leaked)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ValidateSet checks the resources for structural problems that keep them
+// from being applied as one set, such as resources without a kind or name and
+// multiple resources for the same object. Versions of the same kind are
+// considered the same object. Resources with generateName must have unique
+// generateNames per kind and namespace.
+func ValidateSet(resources ...*unstructured.Unstructured) []error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, r := range resources {
+		gvk := r.GroupVersionKind()
+		if gvk.Kind == "" || gvk.Version == "" {
+			errs = append(errs, errors.Errorf("%s: apiVersion and kind must be set", describe(r)))
+			continue
+		}
+		name := r.GetName()
+		if name == "" {
+			name = r.GetGenerateName()
+		}
+		if name == "" {
+			errs = append(errs, errors.Errorf("%s: name or generateName must be set", describe(r)))
+			continue
+		}
+		key := fmt.Sprintf("%s/%s/%s", gvk.GroupKind(), r.GetNamespace(), name)
+		if seen[key] {
+			errs = append(errs, errors.Errorf("%s: duplicate resource", describe(r)))
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
+// ValidateReferences checks that the ConfigMaps, Secrets and ServiceAccounts
+// that the pod specs of workloads reference are part of
+// the set. Optional references and the default ServiceAccount are ignored.
+// Since objects that are created by the cluster or by other means are
+// reported as well, the check is separate from ValidateSet.
+func ValidateReferences(resources ...*unstructured.Unstructured) []error {
+	present := map[string]bool{}
+	for _, r := range resources {
+		present[fmt.Sprintf("%s/%s/%s", r.GroupVersionKind().GroupKind(), r.GetNamespace(), r.GetName())] = true
+	}
+	var errs []error
+	for _, r := range resources {
+		spec, err := podSpec(r)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s: decode pod spec", describe(r)))
+			continue
+		} else if spec == nil {
+			continue
+		}
+		for _, ref := range podReferences(spec) {
+			if !present[fmt.Sprintf("%s/%s/%s", ref.GroupKind, r.GetNamespace(), ref.name)] {
+				errs = append(errs, errors.Errorf("%s: references %s %q, which is not part of the set", describe(r), ref.Kind, ref.name))
+			}
+		}
+	}
+	return errs
+}
+
+// podSpec returns the pod spec of the resource or nil if it has none.
+func podSpec(r *unstructured.Unstructured) (*corev1.PodSpec, error) {
+	path, ok := podSpecPaths[r.GetKind()]
+	if !ok {
+		return nil, nil
+	}
+	m, ok, err := unstructured.NestedMap(r.Object, path...)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var spec corev1.PodSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+type podReference struct {
+	schema.GroupKind
+	name string
+}
+
+// podReferences returns the required references of the pod spec.
+func podReferences(spec *corev1.PodSpec) []podReference {
+	var refs []podReference
+	add := func(kind, name string, optional *bool) {
+		if name != "" && (optional == nil || !*optional) {
+			refs = append(refs, podReference{schema.GroupKind{Kind: kind}, name})
+		}
+	}
+	if sa := spec.ServiceAccountName; sa != "default" {
+		add("ServiceAccount", sa, nil)
+	}
+	for _, s := range spec.ImagePullSecrets {
+		add("Secret", s.Name, nil)
+	}
+	for _, v := range spec.Volumes {
+		if cm := v.ConfigMap; cm != nil {
+			add("ConfigMap", cm.Name, cm.Optional)
+		}
+		if s := v.Secret; s != nil {
+			add("Secret", s.SecretName, s.Optional)
+		}
+		if p := v.Projected; p != nil {
+			for _, src := range p.Sources {
+				if cm := src.ConfigMap; cm != nil {
+					add("ConfigMap", cm.Name, cm.Optional)
+				}
+				if s := src.Secret; s != nil {
+					add("Secret", s.Name, s.Optional)
+				}
+			}
+		}
+	}
+	containers := append(append([]corev1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if cm := e.ConfigMapRef; cm != nil {
+				add("ConfigMap", cm.Name, cm.Optional)
+			}
+			if s := e.SecretRef; s != nil {
+				add("Secret", s.Name, s.Optional)
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if cm := e.ValueFrom.ConfigMapKeyRef; cm != nil {
+				add("ConfigMap", cm.Name, cm.Optional)
+			}
+			if s := e.ValueFrom.SecretKeyRef; s != nil {
+				add("Secret", s.Name, s.Optional)
+			}
+		}
+	}
+	return refs
+}
+
+func describe(r *unstructured.Unstructured) string {
+	if ns := r.GetNamespace(); ns != "" {
+		return fmt.Sprintf("%s %s/%s", r.GetKind(), ns, r.GetName())
+	}
+	return fmt.Sprintf("%s %s", r.GetKind(), r.GetName())
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func errorStrings(errs []error) (s []string) {
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return s
+}
+
+func TestValidateSet(t *testing.T) {
+	errs := ValidateSet(
+		newUnstructured("v1", "ConfigMap", "ns1", "cm1"),
+		newUnstructured("v1", "ConfigMap", "ns2", "cm1"),
+		newUnstructured("apps/v1", "Deployment", "ns1", "dp1"),
+		newUnstructured("apps/v1beta2", "Deployment", "ns1", "dp1"),
+		newUnstructured("v1", "ConfigMap", "ns1", ""),
+		&unstructured.Unstructured{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "x"}}},
+	)
+	want := []string{
+		"Deployment ns1/dp1: duplicate resource",
+		"ConfigMap ns1/: name or generateName must be set",
+		" x: apiVersion and kind must be set",
+	}
+	if got := errorStrings(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateSet() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateReferences(t *testing.T) {
+	var deploy unstructured.Unstructured
+	unmarshalYAML(t, &deploy.Object, `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: dp1, namespace: ns1}
+spec:
+  template:
+    spec:
+      serviceAccountName: robot
+      volumes:
+      - name: config
+        configMap: {name: config}
+      - name: optional
+        secret: {secretName: optional, optional: true}
+      containers:
+      - name: c1
+        envFrom:
+        - secretRef: {name: credentials}
+        env:
+        - name: KEY
+          valueFrom:
+            configMapKeyRef: {name: other, key: key}
+`)
+	errs := ValidateReferences(
+		&deploy,
+		newUnstructured("v1", "ConfigMap", "ns1", "config"),
+		newUnstructured("v1", "ConfigMap", "ns2", "other"),
+		newUnstructured("v1", "ServiceAccount", "ns1", "robot"),
+	)
+	want := []string{
+		`Deployment ns1/dp1: references Secret "credentials", which is not part of the set`,
+		`Deployment ns1/dp1: references ConfigMap "other", which is not part of the set`,
+	}
+	if got := errorStrings(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateReferences() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var varPat = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// substituteVars replaces ${VAR} placeholders in the namespaces and names of
+// the resources with the values from vars. It fails without modifying any
+// resource if a placeholder can't be resolved.
+func substituteVars(resources []*unstructured.Unstructured, vars map[string]string) error {
+	unresolved := map[string]bool{}
+	expand := func(s string) string {
+		return varPat.ReplaceAllStringFunc(s, func(m string) string {
+			k := varPat.FindStringSubmatch(m)[1]
+			v, ok := vars[k]
+			if !ok {
+				unresolved[k] = true
+			}
+			return v
+		})
+	}
+	namespaces := make([]string, len(resources))
+	names := make([]string, len(resources))
+	for i, r := range resources {
+		namespaces[i] = expand(r.GetNamespace())
+		names[i] = expand(r.GetName())
+	}
+	if len(unresolved) > 0 {
+		var l []string
+		for k := range unresolved {
+			l = append(l, k)
+		}
+		sort.Strings(l)
+		return errors.Errorf("unresolved variables in resource names or namespaces: %s", strings.Join(l, ", "))
+	}
+	for i, r := range resources {
+		if r.GetNamespace() != namespaces[i] {
+			r.SetNamespace(namespaces[i])
+		}
+		if r.GetName() != names[i] {
+			r.SetName(names[i])
+		}
+	}
+	return nil
+}
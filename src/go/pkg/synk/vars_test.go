@@ -0,0 +1,56 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSubstituteVars(t *testing.T) {
+	resources := []*unstructured.Unstructured{
+		newUnstructured("v1", "Namespace", "", "tenant-${TENANT}"),
+		newUnstructured("v1", "ConfigMap", "tenant-${TENANT}", "${APP}-config"),
+		newUnstructured("v1", "ConfigMap", "default", "plain"),
+	}
+	vars := map[string]string{"TENANT": "acme", "APP": "web"}
+	if err := substituteVars(resources, vars); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/tenant-acme", "tenant-acme/web-config", "default/plain"}
+	for i, r := range resources {
+		if got := r.GetNamespace() + "/" + r.GetName(); got != want[i] {
+			t.Errorf("resource %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+}
+
+func TestSubstituteVars_unresolved(t *testing.T) {
+	resources := []*unstructured.Unstructured{
+		newUnstructured("v1", "ConfigMap", "${NS}", "${B}-${A}"),
+		newUnstructured("v1", "ConfigMap", "default", "${A}"),
+	}
+	err := substituteVars(resources, map[string]string{"NS": "ns1"})
+	if err == nil {
+		t.Fatal("expected error for unresolved variables")
+	}
+	if want := "unresolved variables in resource names or namespaces: A, B"; err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err)
+	}
+	if ns := resources[0].GetNamespace(); ns != "${NS}" {
+		t.Errorf("expected resources to be unchanged on error, got namespace %q", ns)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+)
+
+// warningFuncKey is the context key of the function that receives the
+// apiserver warnings for the requests made with the context.
+type warningFuncKey struct{}
+
+// ForwardWarnings wraps the transport of the config, so that the warnings
+// that the apiserver returns while applying a resource are passed to
+// ApplyOptions.WarningFunc. NewForConfig does so already. Callers that pass
+// their own dynamic client to New must create it from a config that they
+// called ForwardWarnings on. The warnings are still handled by the config's
+// WarningHandler as well.
+func ForwardWarnings(cfg *rest.Config) {
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &warningTransport{rt: rt}
+	})
+}
+
+// warningContext returns a context that forwards the apiserver warnings for
+// the resource to WarningFunc.
+func (o *ApplyOptions) warningContext(ctx context.Context, r *unstructured.Unstructured) context.Context {
+	if o.WarningFunc == nil {
+		return ctx
+	}
+	key := resourceKey(r)
+	return context.WithValue(ctx, warningFuncKey{}, func(warning string) {
+		o.WarningFunc(key, warning)
+	})
+}
+
+// warningTransport passes the warning headers of responses to the function
+// in the request's context.
+type warningTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *warningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if resp == nil {
+		return resp, err
+	}
+	f, ok := req.Context().Value(warningFuncKey{}).(func(string))
+	if !ok {
+		return resp, err
+	}
+	// Malformed headers are reported by the WarningHandler.
+	warnings, _ := utilnet.ParseWarningHeaders(resp.Header["Warning"])
+	for _, w := range warnings {
+		f(w.Text)
+	}
+	return resp, err
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestForwardWarnings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Warning", `299 - "extensions/v1beta1 Ingress is deprecated"`)
+		w.Header().Add("Warning", `299 - "unknown field \"spec.foo\""`)
+	}))
+	defer srv.Close()
+	cfg := &rest.Config{Host: srv.URL}
+	ForwardWarnings(cfg)
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	opts := &ApplyOptions{WarningFunc: func(key, warning string) {
+		got = append(got, key+": "+warning)
+	}}
+	for _, ctx := range []context.Context{
+		opts.warningContext(context.Background(), newUnstructured("v1", "ConfigMap", "ns1", "cm1")),
+		// Requests without a resource, eg for the ResourceSet, aren't forwarded.
+		context.Background(),
+	} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	want := []string{
+		`/v1/ConfigMap/ns1/cm1: extensions/v1beta1 Ingress is deprecated`,
+		`/v1/ConfigMap/ns1/cm1: unknown field "spec.foo"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected warnings\ngot:  %q\nwant: %q", got, want)
+	}
+}